@@ -0,0 +1,105 @@
+// Package achievements awards badges for rules defined in the
+// achievement_rules table. Badges are never taken back: a badge stays
+// awarded when the workout that earned it is later edited or deleted.
+package achievements
+
+import (
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// Result is where a user stands on a rule: the current value of its
+// metric and, once the threshold was reached, the award for it.
+type Result struct {
+	Rule  *store.AchievementRule
+	Value float64
+	Award *store.Award
+}
+
+// metrics accumulates the values rules are measured on as workouts are
+// added in the order they were performed.
+type metrics struct {
+	workoutCount  float64
+	longestStreak float64
+	sessionVolume float64
+	totalVolume   float64
+
+	streak   int
+	lastWeek time.Time
+}
+
+// weekStart returns the start of the Monday-based week t falls in, in loc.
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+}
+
+func (m *metrics) add(workout *store.Workout, bodyWeights *store.BodyWeightLog, loc *time.Location) {
+	m.workoutCount++
+
+	volume := stats.WorkoutTotals(workout, bodyWeights).Volume
+	m.sessionVolume = max(m.sessionVolume, volume)
+	m.totalVolume += volume
+
+	week := weekStart(workout.PerformedAt, loc)
+	switch {
+	case m.streak > 0 && week.Equal(m.lastWeek):
+		return
+	case m.streak > 0 && week.Equal(m.lastWeek.AddDate(0, 0, 7)):
+		m.streak++
+	default:
+		m.streak = 1
+	}
+	m.lastWeek = week
+	m.longestStreak = max(m.longestStreak, float64(m.streak))
+}
+
+func (m *metrics) value(metric string) float64 {
+	switch metric {
+	case store.AchievementMetricWorkoutCount:
+		return m.workoutCount
+	case store.AchievementMetricWeeklyStreak:
+		return m.longestStreak
+	case store.AchievementMetricSessionVolume:
+		return m.sessionVolume
+	case store.AchievementMetricTotalVolume:
+		return m.totalVolume
+	}
+	return 0
+}
+
+// Evaluate replays the user's workouts, sorted by the time they were
+// performed, and returns a result for every rule. A rule's award is for the
+// first workout with which its threshold was reached. Weeks are counted in
+// loc.
+func Evaluate(userID int, rules []*store.AchievementRule, workouts []*store.Workout, bodyWeights *store.BodyWeightLog, loc *time.Location) []Result {
+	results := make([]Result, len(rules))
+	for i, rule := range rules {
+		results[i].Rule = rule
+	}
+
+	var m metrics
+	for _, workout := range workouts {
+		m.add(workout, bodyWeights, loc)
+		for i := range results {
+			if results[i].Award != nil || m.value(results[i].Rule.Metric) < results[i].Rule.Threshold {
+				continue
+			}
+			workoutID := workout.ID
+			results[i].Award = &store.Award{
+				UserID:     userID,
+				RuleID:     results[i].Rule.ID,
+				WorkoutID:  &workoutID,
+				AchievedAt: workout.PerformedAt,
+			}
+		}
+	}
+
+	for i := range results {
+		results[i].Value = m.value(results[i].Rule.Metric)
+	}
+	return results
+}
@@ -0,0 +1,75 @@
+package achievements
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func liftingWorkout(id int, at time.Time, weight float64) *store.Workout {
+	reps := 10
+	return &store.Workout{
+		ID:          id,
+		PerformedAt: at,
+		Entries: []store.WorkoutEntry{
+			{Kind: store.EntryKindReps, ExerciseName: "Squat", Sets: 5, Reps: &reps, Weight: &weight},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	rules := []*store.AchievementRule{
+		{ID: 1, Metric: store.AchievementMetricWorkoutCount, Threshold: 1},
+		{ID: 2, Metric: store.AchievementMetricWeeklyStreak, Threshold: 3},
+		{ID: 3, Metric: store.AchievementMetricSessionVolume, Threshold: 1000},
+		{ID: 4, Metric: store.AchievementMetricWorkoutCount, Threshold: 10},
+	}
+
+	workouts := []*store.Workout{
+		liftingWorkout(1, time.Date(2024, 1, 1, 18, 0, 0, 0, loc), 10),
+		liftingWorkout(2, time.Date(2024, 1, 3, 18, 0, 0, 0, loc), 10),
+		// Sunday evening is still the first week in the user's time zone.
+		liftingWorkout(3, time.Date(2024, 1, 7, 23, 0, 0, 0, loc), 20),
+		liftingWorkout(4, time.Date(2024, 1, 8, 18, 0, 0, 0, loc), 20),
+		liftingWorkout(5, time.Date(2024, 1, 15, 18, 0, 0, 0, loc), 10),
+	}
+
+	results := Evaluate(7, rules, workouts, nil, loc)
+	require.Len(t, results, 4)
+
+	require.NotNil(t, results[0].Award)
+	assert.Equal(t, 7, results[0].Award.UserID)
+	assert.Equal(t, 1, *results[0].Award.WorkoutID)
+	assert.Equal(t, 5.0, results[0].Value)
+
+	require.NotNil(t, results[1].Award)
+	assert.Equal(t, 5, *results[1].Award.WorkoutID)
+	assert.Equal(t, 3.0, results[1].Value)
+
+	require.NotNil(t, results[2].Award)
+	assert.Equal(t, 3, *results[2].Award.WorkoutID)
+	assert.Equal(t, workouts[2].PerformedAt, results[2].Award.AchievedAt)
+
+	assert.Nil(t, results[3].Award)
+	assert.Equal(t, 5.0, results[3].Value)
+}
+
+func TestWeeklyStreakResets(t *testing.T) {
+	rules := []*store.AchievementRule{{ID: 1, Metric: store.AchievementMetricWeeklyStreak, Threshold: 3}}
+
+	var workouts []*store.Workout
+	// Two weeks, a week off, then two more weeks.
+	for i, day := range []int{1, 8, 22, 29} {
+		workouts = append(workouts, liftingWorkout(i+1, time.Date(2024, 1, day, 9, 0, 0, 0, time.UTC), 10))
+	}
+
+	results := Evaluate(1, rules, workouts, nil, time.UTC)
+	assert.Nil(t, results[0].Award)
+	assert.Equal(t, 2.0, results[0].Value)
+}
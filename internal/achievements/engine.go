@@ -0,0 +1,131 @@
+package achievements
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/notifications"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// BackfillJob runs Backfill in the background.
+var BackfillJob = jobs.NewKind[struct{}]("achievements.backfill")
+
+// Engine awards badges as workouts are saved, and to existing history when
+// rules are added.
+type Engine struct {
+	achievementStore store.AchievementStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	userStore        store.UserStore
+	center           *notifications.Center
+	logger           *log.Logger
+}
+
+func NewEngine(achievementStore store.AchievementStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, userStore store.UserStore, center *notifications.Center, logger *log.Logger) *Engine {
+	return &Engine{achievementStore: achievementStore, workoutStore: workoutStore, measurementStore: measurementStore, userStore: userStore, center: center, logger: logger}
+}
+
+func (e *Engine) WorkoutSaved(workout *store.Workout) error {
+	rules, err := e.achievementStore.ListRules()
+	if err != nil {
+		return err
+	}
+	return e.award(workout.UserID, rules, true)
+}
+
+// Backfill evaluates the rules that were added since it last ran against
+// the history of every user with workouts.
+func (e *Engine) Backfill() error {
+	rules, err := e.achievementStore.ListRulesToBackfill()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	userIDs, err := e.achievementStore.ListUsersWithWorkouts()
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		err = e.award(userID, rules, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range rules {
+		err = e.achievementStore.MarkRuleBackfilled(rule.ID)
+		if err != nil {
+			return err
+		}
+		e.logger.Printf("INFO: achievementRuleBackfilled: %s for %d users", rule.Code, len(userIDs))
+	}
+	return nil
+}
+
+// RunBackfill handles BackfillJob.
+func (e *Engine) RunBackfill(ctx context.Context, _ struct{}) error {
+	return e.Backfill()
+}
+
+// award evaluates rules against the user's whole history and stores the
+// awards they do not hold yet, notifying the user of them when notify is set.
+func (e *Engine) award(userID int, rules []*store.AchievementRule, notify bool) error {
+	user, err := e.userStore.GetUserByID(userID)
+	if err != nil || user == nil {
+		return err
+	}
+
+	workouts, err := e.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: userID})
+	if err != nil {
+		return err
+	}
+	bodyWeights, err := e.measurementStore.GetBodyWeightLog(userID)
+	if err != nil {
+		return err
+	}
+
+	var awards []*store.Award
+	for _, result := range Evaluate(userID, rules, workouts, bodyWeights, user.Location()) {
+		if result.Award != nil {
+			awards = append(awards, result.Award)
+		}
+	}
+	if len(awards) == 0 {
+		return nil
+	}
+
+	created, err := e.achievementStore.CreateAwards(awards)
+	if err != nil {
+		return err
+	}
+	byID := map[int]*store.AchievementRule{}
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+	for _, award := range created {
+		e.logger.Printf("INFO: achievementAwarded: rule %d for user %d", award.RuleID, userID)
+		if !notify {
+			continue
+		}
+		rule := byID[award.RuleID]
+		_, err = e.center.Publish(notifications.Event{
+			UserID: userID,
+			Type:   notifications.TypeAchievement,
+			Title:  "Badge earned: " + rule.Name,
+			Body:   rule.Description,
+			Data: map[string]interface{}{
+				"rule_id":    rule.ID,
+				"code":       rule.Code,
+				"workout_id": award.WorkoutID,
+			},
+			Key: fmt.Sprintf("%s:%d", notifications.TypeAchievement, rule.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
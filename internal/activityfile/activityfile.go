@@ -0,0 +1,197 @@
+// Package activityfile reads cardio activities recorded by watches and bike
+// computers from FIT, GPX and TCX files.
+package activityfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	FormatFIT = "fit"
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+)
+
+var ErrNoActivity = errors.New("file contains no activity data")
+
+// Activity is a parsed activity. Totals reported by the device take
+// precedence; missing ones are derived from the samples.
+type Activity struct {
+	Format              string
+	Sport               string
+	StartTime           time.Time
+	Duration            time.Duration
+	DistanceMeters      float64
+	ElevationGainMeters float64
+	AvgHeartRate        *int
+	MaxHeartRate        *int
+	Calories            *int
+	Samples             []store.ActivitySample
+}
+
+// FormatFromFilename guesses the format from the file extension.
+func FormatFromFilename(name string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+}
+
+func Parse(format string, r io.Reader) (*Activity, error) {
+	var activity *Activity
+	var err error
+
+	switch format {
+	case FormatFIT:
+		activity, err = parseFIT(r)
+	case FormatGPX:
+		activity, err = parseGPX(r)
+	case FormatTCX:
+		activity, err = parseTCX(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	activity.Format = format
+	activity.summarize()
+	if activity.StartTime.IsZero() {
+		return nil, ErrNoActivity
+	}
+
+	return activity, nil
+}
+
+// minElevationStep filters GPS altitude noise out of the elevation gain.
+const minElevationStep = 1.0
+
+func (a *Activity) summarize() {
+	sort.SliceStable(a.Samples, func(i, j int) bool {
+		return a.Samples[i].RecordedAt.Before(a.Samples[j].RecordedAt)
+	})
+
+	if len(a.Samples) == 0 {
+		return
+	}
+	first, last := a.Samples[0], a.Samples[len(a.Samples)-1]
+
+	if a.StartTime.IsZero() {
+		a.StartTime = first.RecordedAt
+	}
+	if a.Duration == 0 {
+		a.Duration = last.RecordedAt.Sub(first.RecordedAt)
+	}
+
+	var distance, gain, hrSum float64
+	var hrCount, hrMax int
+	var prevPoint *store.ActivitySample
+	var baseAltitude *float64
+
+	for i := range a.Samples {
+		sample := &a.Samples[i]
+
+		if sample.Latitude != nil && sample.Longitude != nil {
+			if prevPoint != nil {
+				distance += haversineMeters(*prevPoint.Latitude, *prevPoint.Longitude, *sample.Latitude, *sample.Longitude)
+			}
+			prevPoint = sample
+		}
+
+		if sample.AltitudeMeters != nil {
+			if baseAltitude == nil {
+				baseAltitude = sample.AltitudeMeters
+			} else if delta := *sample.AltitudeMeters - *baseAltitude; math.Abs(delta) >= minElevationStep {
+				if delta > 0 {
+					gain += delta
+				}
+				baseAltitude = sample.AltitudeMeters
+			}
+		}
+
+		if sample.HeartRate != nil {
+			hrSum += float64(*sample.HeartRate)
+			hrCount++
+			hrMax = max(hrMax, *sample.HeartRate)
+		}
+	}
+
+	if a.DistanceMeters == 0 {
+		a.DistanceMeters = distance
+	}
+	if a.ElevationGainMeters == 0 {
+		a.ElevationGainMeters = gain
+	}
+	if a.AvgHeartRate == nil && hrCount > 0 {
+		avg := int(math.Round(hrSum / float64(hrCount)))
+		a.AvgHeartRate = &avg
+	}
+	if a.MaxHeartRate == nil && hrCount > 0 {
+		a.MaxHeartRate = &hrMax
+	}
+}
+
+const earthRadiusMeters = 6371000
+
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// Workout builds the workout that represents the activity for userID.
+func (a *Activity) Workout(userID int) *store.Workout {
+	workout := &store.Workout{
+		UserID:          userID,
+		Title:           sportTitle(a.Sport),
+		DurationMinutes: int(math.Round(a.Duration.Minutes())),
+		PerformedAt:     a.StartTime,
+		Entries:         []store.WorkoutEntry{},
+		Activity: &store.WorkoutActivity{
+			SourceFormat:        a.Format,
+			Sport:               a.Sport,
+			StartedAt:           a.StartTime,
+			DistanceMeters:      math.Round(a.DistanceMeters*10) / 10,
+			ElevationGainMeters: math.Round(a.ElevationGainMeters*10) / 10,
+			AvgHeartRate:        a.AvgHeartRate,
+			MaxHeartRate:        a.MaxHeartRate,
+		},
+	}
+	if a.Calories != nil {
+		workout.CaloriesBurned = *a.Calories
+	}
+	return workout
+}
+
+func sportTitle(sport string) string {
+	if sport == "" || sport == "generic" || sport == "other" {
+		return "Activity"
+	}
+	words := strings.Fields(strings.ReplaceAll(sport, "_", " "))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func normalizeSport(sport string) string {
+	sport = strings.ToLower(strings.TrimSpace(sport))
+	switch sport {
+	case "biking", "bike", "ride":
+		return "cycling"
+	case "run":
+		return "running"
+	case "":
+		return "generic"
+	}
+	return strings.ReplaceAll(sport, " ", "_")
+}
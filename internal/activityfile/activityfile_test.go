@@ -0,0 +1,107 @@
+package activityfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGPX(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="47.4979" lon="19.0402"><ele>100</ele><time>2024-04-01T06:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr><gpxtpx:cad>80</gpxtpx:cad></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="47.4989" lon="19.0402"><ele>105</ele><time>2024-04-01T06:00:30Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>140</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="47.4999" lon="19.0402"><ele>103</ele><time>2024-04-01T06:01:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	activity, err := Parse(FormatGPX, strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, "running", activity.Sport)
+	assert.Equal(t, time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC), activity.StartTime)
+	assert.Equal(t, time.Minute, activity.Duration)
+	assert.InDelta(t, 222, activity.DistanceMeters, 1)
+	assert.Equal(t, 5.0, activity.ElevationGainMeters)
+	assert.Equal(t, 130, *activity.AvgHeartRate)
+	assert.Equal(t, 140, *activity.MaxHeartRate)
+	require.Len(t, activity.Samples, 3)
+	assert.Equal(t, 80, *activity.Samples[0].Cadence)
+}
+
+// fitBuilder writes a minimal little-endian FIT file.
+type fitBuilder struct {
+	records bytes.Buffer
+}
+
+func (b *fitBuilder) define(local byte, global uint16, fields [][3]byte) {
+	b.records.WriteByte(0x40 | local)
+	b.records.Write([]byte{0, 0})
+	binary.Write(&b.records, binary.LittleEndian, global)
+	b.records.WriteByte(byte(len(fields)))
+	for _, field := range fields {
+		b.records.Write(field[:])
+	}
+}
+
+func (b *fitBuilder) data(local byte, values ...interface{}) {
+	b.records.WriteByte(local)
+	for _, v := range values {
+		binary.Write(&b.records, binary.LittleEndian, v)
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	header := []byte{12, 0x10, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T'}
+	binary.LittleEndian.PutUint32(header[4:8], uint32(b.records.Len()))
+	file := append(header, b.records.Bytes()...)
+	return binary.LittleEndian.AppendUint16(file, fitCRC(file))
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2024, 4, 2, 17, 0, 0, 0, time.UTC)
+	ts := uint32(start.Sub(fitEpoch).Seconds())
+
+	var b fitBuilder
+	// record: timestamp, position_lat, position_long, heart_rate, power
+	b.define(0, fitMesgRecord, [][3]byte{{253, 4, 0x86}, {0, 4, 0x85}, {1, 4, 0x85}, {3, 1, 0x02}, {7, 2, 0x84}})
+	b.data(0, ts, int32(566672019), int32(227144000), uint8(130), uint16(210))
+	b.data(0, ts+60, int32(566684000), int32(227144000), uint8(150), uint16(0xFFFF))
+	// session: start_time, sport, total_timer_time, total_distance, total_calories, max_heart_rate
+	b.define(1, fitMesgSession, [][3]byte{{2, 4, 0x86}, {5, 1, 0x00}, {8, 4, 0x86}, {9, 4, 0x86}, {11, 2, 0x84}, {17, 1, 0x02}})
+	b.data(1, ts, uint8(2), uint32(60000), uint32(50000), uint16(15), uint8(152))
+
+	activity, err := Parse(FormatFIT, bytes.NewReader(b.bytes()))
+	require.NoError(t, err)
+
+	assert.Equal(t, "cycling", activity.Sport)
+	assert.Equal(t, start, activity.StartTime)
+	assert.Equal(t, time.Minute, activity.Duration)
+	assert.Equal(t, 500.0, activity.DistanceMeters)
+	assert.Equal(t, 15, *activity.Calories)
+	assert.Equal(t, 140, *activity.AvgHeartRate)
+	assert.Equal(t, 152, *activity.MaxHeartRate)
+
+	require.Len(t, activity.Samples, 2)
+	assert.InDelta(t, 47.4979, *activity.Samples[0].Latitude, 0.0001)
+	assert.Equal(t, 210, *activity.Samples[0].Power)
+	assert.Nil(t, activity.Samples[1].Power)
+
+	corrupted := b.bytes()
+	corrupted[20] ^= 0xFF
+	_, err = Parse(FormatFIT, bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, errInvalidFIT)
+}
@@ -0,0 +1,321 @@
+package activityfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// FIT is Garmin's binary activity format. Only the record (samples) and
+// session (totals) messages are decoded; everything else is skipped.
+
+const (
+	fitMesgSession = 18
+	fitMesgRecord  = 20
+
+	fitFieldTimestamp = 253
+
+	maxFITFileBytes = 64 << 20
+)
+
+// fitEpoch is the FIT reference time, 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var fitSports = map[uint64]string{
+	0: "generic", 1: "running", 2: "cycling", 4: "fitness_equipment", 5: "swimming",
+	10: "training", 11: "walking", 12: "cross_country_skiing", 13: "alpine_skiing",
+	15: "rowing", 16: "mountaineering", 17: "hiking",
+}
+
+var errInvalidFIT = errors.New("invalid FIT file")
+
+type fitFieldDef struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	byteOrder binary.ByteOrder
+	fields    []fitFieldDef
+	devBytes  int
+}
+
+// fitValue is a decoded numeric field; ok is false for the base type's
+// "invalid" marker.
+type fitValue struct {
+	u  uint64
+	i  int64
+	ok bool
+}
+
+func parseFIT(r io.Reader) (*Activity, error) {
+	data, err := io.ReadAll(io.LimitReader(bufio.NewReader(r), maxFITFileBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 {
+		return nil, errInvalidFIT
+	}
+
+	headerSize := int(data[0])
+	if (headerSize != 12 && headerSize != 14) || string(data[8:12]) != ".FIT" {
+		return nil, errInvalidFIT
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < headerSize+dataSize+2 {
+		return nil, fmt.Errorf("%w: truncated", errInvalidFIT)
+	}
+
+	end := headerSize + dataSize
+	if stored := binary.LittleEndian.Uint16(data[end : end+2]); stored != 0 && stored != fitCRC(data[:end]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errInvalidFIT)
+	}
+
+	activity := &Activity{}
+	definitions := map[byte]*fitDefinition{}
+	var lastTimestamp uint32
+
+	for pos := headerSize; pos < end; {
+		header := data[pos]
+		pos++
+
+		var local byte
+		var compressedTime *uint32
+
+		if header&0x80 != 0 {
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			ts := (lastTimestamp &^ 0x1F) + offset
+			if offset < lastTimestamp&0x1F {
+				ts += 0x20
+			}
+			compressedTime = &ts
+		} else {
+			local = header & 0x0F
+
+			if header&0x40 != 0 {
+				def, n, err := parseFITDefinition(data[pos:end], header&0x20 != 0)
+				if err != nil {
+					return nil, err
+				}
+				definitions[local] = def
+				pos += n
+				continue
+			}
+		}
+
+		def, ok := definitions[local]
+		if !ok {
+			return nil, fmt.Errorf("%w: data message without definition", errInvalidFIT)
+		}
+
+		values := map[byte]fitValue{}
+		for _, field := range def.fields {
+			if pos+field.size > end {
+				return nil, fmt.Errorf("%w: truncated message", errInvalidFIT)
+			}
+			values[field.num] = decodeFITValue(data[pos:pos+field.size], field.baseType, def.byteOrder)
+			pos += field.size
+		}
+		pos += def.devBytes
+		if pos > end {
+			return nil, fmt.Errorf("%w: truncated message", errInvalidFIT)
+		}
+
+		if ts, ok := values[fitFieldTimestamp]; ok && ts.ok {
+			lastTimestamp = uint32(ts.u)
+		} else if compressedTime != nil {
+			lastTimestamp = *compressedTime
+			values[fitFieldTimestamp] = fitValue{u: uint64(*compressedTime), ok: true}
+		}
+
+		switch def.global {
+		case fitMesgRecord:
+			if sample, ok := fitRecordSample(values); ok {
+				activity.Samples = append(activity.Samples, sample)
+			}
+		case fitMesgSession:
+			applyFITSession(activity, values)
+		}
+	}
+
+	return activity, nil
+}
+
+func parseFITDefinition(data []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, fmt.Errorf("%w: truncated definition", errInvalidFIT)
+	}
+
+	def := &fitDefinition{byteOrder: binary.LittleEndian}
+	if data[1] == 1 {
+		def.byteOrder = binary.BigEndian
+	}
+	def.global = def.byteOrder.Uint16(data[2:4])
+
+	count := int(data[4])
+	pos := 5
+	if len(data) < pos+count*3 {
+		return nil, 0, fmt.Errorf("%w: truncated definition", errInvalidFIT)
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitFieldDef{num: data[pos], size: int(data[pos+1]), baseType: data[pos+2] & 0x1F})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(data) < pos+1 {
+			return nil, 0, fmt.Errorf("%w: truncated definition", errInvalidFIT)
+		}
+		devCount := int(data[pos])
+		pos++
+		if len(data) < pos+devCount*3 {
+			return nil, 0, fmt.Errorf("%w: truncated definition", errInvalidFIT)
+		}
+		for i := 0; i < devCount; i++ {
+			def.devBytes += int(data[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+func decodeFITValue(b []byte, baseType byte, order binary.ByteOrder) fitValue {
+	switch {
+	case len(b) == 1 && (baseType == 0 || baseType == 2 || baseType == 10 || baseType == 13):
+		return fitValue{u: uint64(b[0]), ok: b[0] != 0xFF && !(baseType == 10 && b[0] == 0)}
+	case len(b) == 1 && baseType == 1:
+		return fitValue{i: int64(int8(b[0])), ok: b[0] != 0x7F}
+	case len(b) == 2 && (baseType == 4 || baseType == 11):
+		v := order.Uint16(b)
+		return fitValue{u: uint64(v), ok: v != 0xFFFF && !(baseType == 11 && v == 0)}
+	case len(b) == 2 && baseType == 3:
+		v := int16(order.Uint16(b))
+		return fitValue{i: int64(v), ok: v != 0x7FFF}
+	case len(b) == 4 && (baseType == 6 || baseType == 12):
+		v := order.Uint32(b)
+		return fitValue{u: uint64(v), ok: v != 0xFFFFFFFF && !(baseType == 12 && v == 0)}
+	case len(b) == 4 && baseType == 5:
+		v := int32(order.Uint32(b))
+		return fitValue{i: int64(v), ok: v != 0x7FFFFFFF}
+	}
+	return fitValue{}
+}
+
+func fitTime(v fitValue) time.Time {
+	return fitEpoch.Add(time.Duration(v.u) * time.Second)
+}
+
+func fitSemicircles(v fitValue) *float64 {
+	degrees := float64(v.i) * (180 / math.Pow(2, 31))
+	return &degrees
+}
+
+func fitInt(v fitValue) *int {
+	n := int(v.u)
+	return &n
+}
+
+func fitRecordSample(values map[byte]fitValue) (store.ActivitySample, bool) {
+	ts, ok := values[fitFieldTimestamp]
+	if !ok || !ts.ok {
+		return store.ActivitySample{}, false
+	}
+
+	sample := store.ActivitySample{RecordedAt: fitTime(ts)}
+
+	lat, latOK := values[0]
+	lon, lonOK := values[1]
+	if latOK && lonOK && lat.ok && lon.ok {
+		sample.Latitude = fitSemicircles(lat)
+		sample.Longitude = fitSemicircles(lon)
+	}
+
+	// enhanced_altitude (78) supersedes altitude (2); both are (m + 500) * 5.
+	for _, num := range []byte{78, 2} {
+		if v, ok := values[num]; ok && v.ok {
+			altitude := float64(v.u)/5 - 500
+			sample.AltitudeMeters = &altitude
+			break
+		}
+	}
+
+	if v, ok := values[3]; ok && v.ok {
+		sample.HeartRate = fitInt(v)
+	}
+	if v, ok := values[4]; ok && v.ok {
+		sample.Cadence = fitInt(v)
+	}
+	if v, ok := values[7]; ok && v.ok {
+		sample.Power = fitInt(v)
+	}
+
+	return sample, true
+}
+
+func applyFITSession(activity *Activity, values map[byte]fitValue) {
+	if v, ok := values[2]; ok && v.ok && activity.StartTime.IsZero() {
+		activity.StartTime = fitTime(v)
+	}
+	if v, ok := values[5]; ok && v.ok {
+		activity.Sport = fitSports[v.u]
+	}
+	if activity.Sport == "" {
+		activity.Sport = "generic"
+	}
+
+	// Timer time excludes pauses; fall back to elapsed time.
+	for _, num := range []byte{8, 7} {
+		if v, ok := values[num]; ok && v.ok {
+			activity.Duration += time.Duration(v.u) * time.Millisecond
+			break
+		}
+	}
+	if v, ok := values[9]; ok && v.ok {
+		activity.DistanceMeters += float64(v.u) / 100
+	}
+	if v, ok := values[11]; ok && v.ok {
+		calories := int(v.u)
+		if activity.Calories != nil {
+			calories += *activity.Calories
+		}
+		activity.Calories = &calories
+	}
+	if v, ok := values[22]; ok && v.ok {
+		activity.ElevationGainMeters += float64(v.u)
+	}
+	if v, ok := values[16]; ok && v.ok && activity.AvgHeartRate == nil {
+		activity.AvgHeartRate = fitInt(v)
+	}
+	if v, ok := values[17]; ok && v.ok && (activity.MaxHeartRate == nil || int(v.u) > *activity.MaxHeartRate) {
+		activity.MaxHeartRate = fitInt(v)
+	}
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
@@ -0,0 +1,69 @@
+package activityfile
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// gpxPoint reads heart rate and cadence from the Garmin TrackPointExtension,
+// which is what most devices and apps write, and power from the bare
+// <power> extension used by Strava and others.
+type gpxPoint struct {
+	Lat       *float64 `xml:"lat,attr"`
+	Lon       *float64 `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+	Time      string   `xml:"time"`
+	HeartRate *int     `xml:"extensions>TrackPointExtension>hr"`
+	Cadence   *int     `xml:"extensions>TrackPointExtension>cad"`
+	Power     *int     `xml:"extensions>power"`
+}
+
+func parseGPX(r io.Reader) (*Activity, error) {
+	var file gpxFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &Activity{Sport: "generic"}
+	for _, track := range file.Tracks {
+		if track.Type != "" {
+			activity.Sport = normalizeSport(track.Type)
+		}
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				recordedAt, err := time.Parse(time.RFC3339, strings.TrimSpace(point.Time))
+				if err != nil {
+					continue
+				}
+				activity.Samples = append(activity.Samples, store.ActivitySample{
+					RecordedAt:     recordedAt,
+					Latitude:       point.Lat,
+					Longitude:      point.Lon,
+					AltitudeMeters: point.Elevation,
+					HeartRate:      point.HeartRate,
+					Cadence:        point.Cadence,
+					Power:          point.Power,
+				})
+			}
+		}
+	}
+
+	return activity, nil
+}
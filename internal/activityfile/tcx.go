@@ -0,0 +1,116 @@
+package activityfile
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+type tcxFile struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	ID    string   `xml:"Id"`
+	Laps  []tcxLap `xml:"Lap"`
+}
+
+type tcxLap struct {
+	StartTime        string        `xml:"StartTime,attr"`
+	TotalTimeSeconds float64       `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64       `xml:"DistanceMeters"`
+	Calories         *int          `xml:"Calories"`
+	AvgHeartRate     *int          `xml:"AverageHeartRateBpm>Value"`
+	MaxHeartRate     *int          `xml:"MaximumHeartRateBpm>Value"`
+	Trackpoints      []tcxTrackpnt `xml:"Track>Trackpoint"`
+}
+
+type tcxTrackpnt struct {
+	Time       string   `xml:"Time"`
+	Latitude   *float64 `xml:"Position>LatitudeDegrees"`
+	Longitude  *float64 `xml:"Position>LongitudeDegrees"`
+	Altitude   *float64 `xml:"AltitudeMeters"`
+	HeartRate  *int     `xml:"HeartRateBpm>Value"`
+	Cadence    *int     `xml:"Cadence"`
+	RunCadence *int     `xml:"Extensions>TPX>RunCadence"`
+	Watts      *int     `xml:"Extensions>TPX>Watts"`
+}
+
+// parseTCX reads the first activity in a Garmin Training Center file. Lap
+// totals are summed; the heart rate average is weighted by lap duration.
+func parseTCX(r io.Reader) (*Activity, error) {
+	var file tcxFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Activities) == 0 {
+		return nil, ErrNoActivity
+	}
+
+	source := file.Activities[0]
+	activity := &Activity{Sport: normalizeSport(source.Sport)}
+
+	if started, err := time.Parse(time.RFC3339, strings.TrimSpace(source.ID)); err == nil {
+		activity.StartTime = started
+	}
+
+	var seconds, weightedHR, hrSeconds float64
+	for _, lap := range source.Laps {
+		if activity.StartTime.IsZero() {
+			if started, err := time.Parse(time.RFC3339, lap.StartTime); err == nil {
+				activity.StartTime = started
+			}
+		}
+
+		seconds += lap.TotalTimeSeconds
+		activity.DistanceMeters += lap.DistanceMeters
+		if lap.Calories != nil {
+			calories := *lap.Calories
+			if activity.Calories != nil {
+				calories += *activity.Calories
+			}
+			activity.Calories = &calories
+		}
+		if lap.AvgHeartRate != nil {
+			weightedHR += float64(*lap.AvgHeartRate) * lap.TotalTimeSeconds
+			hrSeconds += lap.TotalTimeSeconds
+		}
+		if lap.MaxHeartRate != nil && (activity.MaxHeartRate == nil || *lap.MaxHeartRate > *activity.MaxHeartRate) {
+			activity.MaxHeartRate = lap.MaxHeartRate
+		}
+
+		for _, point := range lap.Trackpoints {
+			recordedAt, err := time.Parse(time.RFC3339, strings.TrimSpace(point.Time))
+			if err != nil {
+				continue
+			}
+			cadence := point.Cadence
+			if cadence == nil {
+				cadence = point.RunCadence
+			}
+			activity.Samples = append(activity.Samples, store.ActivitySample{
+				RecordedAt:     recordedAt,
+				Latitude:       point.Latitude,
+				Longitude:      point.Longitude,
+				AltitudeMeters: point.Altitude,
+				HeartRate:      point.HeartRate,
+				Cadence:        cadence,
+				Power:          point.Watts,
+			})
+		}
+	}
+
+	activity.Duration = time.Duration(seconds * float64(time.Second))
+	if hrSeconds > 0 {
+		avg := int(math.Round(weightedHR / hrSeconds))
+		activity.AvgHeartRate = &avg
+	}
+
+	return activity, nil
+}
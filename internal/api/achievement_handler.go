@@ -0,0 +1,102 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/achievements"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+type AchievementHandler struct {
+	achievementStore store.AchievementStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewAchievementHandler(achievementStore store.AchievementStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *AchievementHandler {
+	return &AchievementHandler{achievementStore: achievementStore, workoutStore: workoutStore, measurementStore: measurementStore, logger: logger}
+}
+
+// achievementResponse is a rule with the user's progress towards it and,
+// once earned, their award.
+type achievementResponse struct {
+	*store.AchievementRule
+	Unit       *string    `json:"unit"`
+	Progress   float64    `json:"progress"`
+	Earned     bool       `json:"earned"`
+	WorkoutID  *int       `json:"workout_id"`
+	AchievedAt *time.Time `json:"achieved_at"`
+	AwardedAt  *time.Time `json:"awarded_at"`
+}
+
+// HandleListAchievements returns every badge, earned ones first, with the
+// user's progress towards those still locked.
+func (ah *AchievementHandler) HandleListAchievements(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	rules, err := ah.achievementStore.ListRules()
+	if err != nil {
+		ah.logger.Printf("ERROR: listAchievementRules: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list achievements"})
+		return
+	}
+	awards, err := ah.achievementStore.ListAwards(currentUser.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: listAwards: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list achievements"})
+		return
+	}
+	workouts, err := ah.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID})
+	if err != nil {
+		ah.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list achievements"})
+		return
+	}
+	bodyWeights, err := ah.measurementStore.GetBodyWeightLog(currentUser.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: getBodyWeightLog: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list achievements"})
+		return
+	}
+
+	awardsByRule := map[int]*store.Award{}
+	for _, award := range awards {
+		awardsByRule[award.RuleID] = award
+	}
+
+	earned := []achievementResponse{}
+	locked := []achievementResponse{}
+	for _, result := range achievements.Evaluate(currentUser.ID, rules, workouts, bodyWeights, currentUser.Location()) {
+		response := achievementResponse{AchievementRule: result.Rule, Progress: result.Value}
+		if result.Rule.MeasuresWeight() {
+			unit := units.WeightUnit(system)
+			response.Unit = &unit
+			response.Threshold = units.Round(units.FromKilograms(response.Threshold, unit), units.WeightPlaces)
+			response.Progress = units.Round(units.FromKilograms(response.Progress, unit), units.WeightPlaces)
+		}
+
+		award, ok := awardsByRule[result.Rule.ID]
+		if !ok {
+			locked = append(locked, response)
+			continue
+		}
+		response.Earned = true
+		response.Progress = max(response.Progress, response.Threshold)
+		response.WorkoutID, response.AchievedAt, response.AwardedAt = award.WorkoutID, &award.AchievedAt, &award.AwardedAt
+		earned = append(earned, response)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": append(earned, locked...)})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/activityfile"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const maxActivityUploadBytes = 64 << 20
+
+type ActivityHandler struct {
+	activityStore store.ActivityStore
+	workoutStore  store.WorkoutStore
+	logger        *log.Logger
+}
+
+func NewActivityHandler(activityStore store.ActivityStore, workoutStore store.WorkoutStore, logger *log.Logger) *ActivityHandler {
+	return &ActivityHandler{activityStore: activityStore, workoutStore: workoutStore, logger: logger}
+}
+
+// HandleImportActivity creates a workout from a FIT, GPX or TCX file sent as
+// the multipart field "file". The format is taken from the optional "format"
+// field or else the file extension.
+func (ah *ActivityHandler) HandleImportActivity(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxActivityUploadBytes)
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		ah.logger.Printf("ERROR: parseMultipartForm: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid upload"})
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = activityfile.FormatFromFilename(fileHeader.Filename)
+	}
+
+	activity, err := activityfile.Parse(format, file)
+	if err != nil {
+		ah.logger.Printf("ERROR: parseActivity: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Could not read activity file: " + err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	workout := activity.Workout(currentUser.ID)
+
+	createdWorkout, err := ah.activityStore.CreateActivityWorkout(workout, activity.Samples)
+	if errors.Is(err, store.ErrDuplicateActivity) {
+		existingID, err := ah.activityStore.GetWorkoutIDByActivityStart(currentUser.ID, activity.StartTime)
+		if err != nil {
+			ah.logger.Printf("ERROR: getWorkoutIDByActivityStart: %s", err)
+		}
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "This activity has already been imported", "workout_id": existingID})
+		return
+	}
+	if err != nil {
+		ah.logger.Printf("ERROR: createActivityWorkout: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to import activity"})
+		return
+	}
+
+	ah.logger.Printf("INFO: importActivity: %d (%s, %d samples)", createdWorkout.ID, format, len(activity.Samples))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdWorkout})
+}
+
+func (ah *ActivityHandler) HandleGetActivitySamples(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.logger.Printf("ERROR: readIDParam: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	ownerID, err := ah.workoutStore.GetWorkoutOwner(workoutID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+			return
+		}
+		ah.logger.Printf("ERROR: getWorkoutOwner: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout owner"})
+		return
+	}
+	// Only the owner sees samples, so other users, who may not know of the
+	// workout, are told it does not exist.
+	if ownerID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	samples, err := ah.activityStore.GetActivitySamples(workoutID)
+	if err != nil {
+		ah.logger.Printf("ERROR: getActivitySamples: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get samples"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": samples})
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/calendar"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/tokens"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	monthLayout = "2006-01"
+
+	// calendarFeedTTL is how long a feed URL works unless it is revoked or
+	// replaced first; calendar apps keep polling a leaked URL until then.
+	calendarFeedTTL = 90 * 24 * time.Hour
+	// calendarFeedHistory is how far back the feed lists workouts.
+	calendarFeedHistory = 365 * 24 * time.Hour
+)
+
+type CalendarHandler struct {
+	workoutStore  store.WorkoutStore
+	scheduleStore store.ScheduleStore
+	tokenStore    store.TokenStore
+	userStore     store.UserStore
+	publicURL     *url.URL
+	logger        *log.Logger
+}
+
+func NewCalendarHandler(workoutStore store.WorkoutStore, scheduleStore store.ScheduleStore, tokenStore store.TokenStore, userStore store.UserStore, publicURL *url.URL, logger *log.Logger) *CalendarHandler {
+	return &CalendarHandler{workoutStore: workoutStore, scheduleStore: scheduleStore, tokenStore: tokenStore, userStore: userStore, publicURL: publicURL, logger: logger}
+}
+
+// HandleGetCalendar returns every day of the month given as YYYY-MM, the
+// current one by default, with the workouts performed and the sessions
+// planned on it in the user's time zone.
+func (ch *CalendarHandler) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+
+	first := calendar.MonthStart(time.Now(), loc)
+	if v := r.URL.Query().Get("month"); v != "" {
+		month, err := time.ParseInLocation(monthLayout, v, loc)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "month must be in YYYY-MM format"})
+			return
+		}
+		first = month
+	}
+	next := first.AddDate(0, 1, 0)
+
+	workouts, err := ch.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID, From: &first, To: &next})
+	if err != nil {
+		ch.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get calendar"})
+		return
+	}
+	schedules, err := ch.scheduleStore.ListSchedules(currentUser.ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: listSchedules: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get calendar"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"month":    first.Format(monthLayout),
+		"timezone": loc.String(),
+		"days":     calendar.Month(first, workouts, schedules, loc),
+	}})
+}
+
+// HandleCreateFeed returns a new webcal URL of the user's calendar feed and
+// when it expires. The URL carries its own token, so creating one revokes
+// the previous URL. It is built from the configured public URL, never from
+// the request, so a forged Host header cannot send the token elsewhere.
+func (ch *CalendarHandler) HandleCreateFeed(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := ch.tokenStore.DeleteToken(currentUser.ID, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteToken: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create calendar feed"})
+		return
+	}
+	token, err := ch.tokenStore.CreateToken(currentUser.ID, calendarFeedTTL, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: createToken: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	feedURL := *ch.publicURL
+	feedURL.Scheme = "webcal"
+	feedURL.Path = strings.TrimSuffix(feedURL.Path, "/") + "/api/v1/calendar/feed/" + token.Plaintext + ".ics"
+
+	ch.logger.Printf("INFO: createCalendarFeed: user %d", currentUser.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": utils.Envelope{
+		"url":        feedURL.String(),
+		"expires_at": token.Expiry,
+	}})
+}
+
+// HandleRevokeFeed stops the user's calendar feed URL from working.
+func (ch *CalendarHandler) HandleRevokeFeed(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := ch.tokenStore.DeleteToken(currentUser.ID, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteToken: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke calendar feed"})
+		return
+	}
+
+	ch.logger.Printf("INFO: revokeCalendarFeed: user %d", currentUser.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleGetFeed serves the read-only ICS feed named by the token in the
+// URL, with the workouts of the last year and every schedule.
+func (ch *CalendarHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(chi.URLParam(r, "file"), ".ics")
+
+	user, err := ch.userStore.GetUserToken(tokens.ScopeCalendarFeed, token)
+	if err != nil {
+		ch.logger.Printf("ERROR: getUserToken: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get calendar feed"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Calendar feed not found"})
+		return
+	}
+
+	from := time.Now().Add(-calendarFeedHistory)
+	workouts, err := ch.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: user.ID, From: &from})
+	if err != nil {
+		ch.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get calendar feed"})
+		return
+	}
+	schedules, err := ch.scheduleStore.ListSchedules(user.ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: listSchedules: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get calendar feed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="workouts.ics"`)
+
+	err = calendar.WriteICS(w, calendar.Feed{
+		Name:      user.Username + "'s workouts",
+		Location:  user.Location(),
+		Workouts:  workouts,
+		Schedules: schedules,
+	})
+	if err != nil {
+		ch.logger.Printf("ERROR: writeICS: %s", err)
+	}
+}
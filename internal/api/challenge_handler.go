@@ -0,0 +1,365 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/challenges"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	defaultLeaderboardPageSize = 20
+	maxLeaderboardPageSize     = 100
+	leaderboardCursorPrefix    = "v1:"
+)
+
+type ChallengeHandler struct {
+	challengeStore   store.ChallengeStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewChallengeHandler(challengeStore store.ChallengeStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *ChallengeHandler {
+	return &ChallengeHandler{challengeStore: challengeStore, workoutStore: workoutStore, measurementStore: measurementStore, logger: logger}
+}
+
+func encodeLeaderboardCursor(cursor store.LeaderboardCursor) string {
+	raw := leaderboardCursorPrefix + cursor.Score + ":" + strconv.Itoa(cursor.UserID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeLeaderboardCursor(cursor string) (*store.LeaderboardCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), leaderboardCursorPrefix) {
+		return nil, errors.New("invalid leaderboard cursor")
+	}
+
+	score, userID, ok := strings.Cut(strings.TrimPrefix(string(raw), leaderboardCursorPrefix), ":")
+	if !ok {
+		return nil, errors.New("invalid leaderboard cursor")
+	}
+	if _, err = strconv.ParseFloat(score, 64); err != nil {
+		return nil, errors.New("invalid leaderboard cursor")
+	}
+	id, err := strconv.Atoi(userID)
+	if err != nil || id < 0 {
+		return nil, errors.New("invalid leaderboard cursor")
+	}
+
+	return &store.LeaderboardCursor{Score: score, UserID: id}, nil
+}
+
+// readPageSize parses the optional limit query parameter.
+func readPageSize(r *http.Request) (int, error) {
+	limit := defaultLeaderboardPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLeaderboardPageSize {
+			return 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = n
+	}
+	return limit, nil
+}
+
+// loadChallenge reads the challenge in the URL as seen by the current user,
+// writing the error response if it does not exist.
+func (ch *ChallengeHandler) loadChallenge(w http.ResponseWriter, r *http.Request) (*store.Challenge, bool) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	challenge, err := ch.challengeStore.GetChallenge(challengeID, middleware.GetUser(r).ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get challenge"})
+		return nil, false
+	}
+	if challenge == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Challenge not found"})
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// join scores the user's workouts performed in the challenge's window so
+// far and adds them to it.
+func (ch *ChallengeHandler) join(challenge *store.Challenge, userID int) (bool, error) {
+	workouts, err := ch.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: userID, From: &challenge.StartsAt, To: &challenge.EndsAt})
+	if err != nil {
+		return false, err
+	}
+	bodyWeights, err := ch.measurementStore.GetBodyWeightLog(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return ch.challengeStore.JoinChallenge(challenge.ID, userID, challenges.Contributions(challenge, workouts, bodyWeights))
+}
+
+// HandleCreateChallenge creates a challenge that its creator joins right
+// away.
+func (ch *ChallengeHandler) HandleCreateChallenge(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var challenge store.Challenge
+	err = json.NewDecoder(r.Body).Decode(&challenge)
+	if err != nil {
+		ch.logger.Printf("ERROR: decodeCreateChallengeBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	err = challenge.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if !challenge.EndsAt.After(time.Now()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "ends_at must be in the future"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	challenge.CreatorID = currentUser.ID
+
+	err = ch.challengeStore.CreateChallenge(&challenge)
+	if err != nil {
+		ch.logger.Printf("ERROR: createChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create challenge"})
+		return
+	}
+
+	_, err = ch.join(&challenge, currentUser.ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: joinChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to join challenge"})
+		return
+	}
+	challenge.Joined, challenge.ParticipantCount = true, 1
+	challenge.SetUnit(system)
+
+	ch.logger.Printf("INFO: createChallenge: %d", challenge.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": challenge})
+}
+
+// HandleListChallenges returns every challenge, optionally only those with
+// the given status or that the user joined.
+func (ch *ChallengeHandler) HandleListChallenges(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter := store.ChallengeFilter{UserID: middleware.GetUser(r).ID, Status: r.URL.Query().Get("status")}
+	switch filter.Status {
+	case "", store.ChallengeStatusUpcoming, store.ChallengeStatusActive, store.ChallengeStatusFinished:
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be upcoming, active or finished"})
+		return
+	}
+	if v := r.URL.Query().Get("joined"); v != "" {
+		filter.JoinedOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "joined must be true or false"})
+			return
+		}
+	}
+
+	challengeList, err := ch.challengeStore.ListChallenges(filter)
+	if err != nil {
+		ch.logger.Printf("ERROR: listChallenges: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list challenges"})
+		return
+	}
+
+	for _, challenge := range challengeList {
+		challenge.SetUnit(system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": challengeList})
+}
+
+func (ch *ChallengeHandler) HandleGetChallenge(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	challenge, ok := ch.loadChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	challenge.SetUnit(system)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": challenge})
+}
+
+func (ch *ChallengeHandler) HandleDeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.loadChallenge(w, r)
+	if !ok {
+		return
+	}
+	if challenge.CreatorID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the creator of this challenge"})
+		return
+	}
+
+	err := ch.challengeStore.DeleteChallenge(challenge.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Challenge not found"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete challenge"})
+		return
+	}
+
+	ch.logger.Printf("INFO: deleteChallenge: %d", challenge.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleJoinChallenge adds the current user to a challenge that has not
+// finished, counting the workouts they already performed in its window.
+func (ch *ChallengeHandler) HandleJoinChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.loadChallenge(w, r)
+	if !ok {
+		return
+	}
+	if challenge.Status == store.ChallengeStatusFinished {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "This challenge has finished"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	joined, err := ch.join(challenge, currentUser.ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: joinChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to join challenge"})
+		return
+	}
+	if !joined {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You have already joined this challenge"})
+		return
+	}
+
+	ch.logger.Printf("INFO: joinChallenge: %d by user %d", challenge.ID, currentUser.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleLeaveChallenge removes the current user and their score from a
+// challenge that has not finished.
+func (ch *ChallengeHandler) HandleLeaveChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.loadChallenge(w, r)
+	if !ok {
+		return
+	}
+	if challenge.Status == store.ChallengeStatusFinished {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "This challenge has finished"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	err := ch.challengeStore.LeaveChallenge(challenge.ID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You have not joined this challenge"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: leaveChallenge: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to leave challenge"})
+		return
+	}
+
+	ch.logger.Printf("INFO: leaveChallenge: %d by user %d", challenge.ID, currentUser.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleGetLeaderboard returns a page of the challenge's participants,
+// highest score first, and the current user's own standing. Pass
+// next_cursor back as cursor for the following page.
+func (ch *ChallengeHandler) HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	cursor, err := decodeLeaderboardCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := readPageSize(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	challenge, ok := ch.loadChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	// One extra entry tells whether there is a next page.
+	entries, err := ch.challengeStore.GetLeaderboard(challenge.ID, cursor, limit+1)
+	if err != nil {
+		ch.logger.Printf("ERROR: getLeaderboard: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get leaderboard"})
+		return
+	}
+	var nextCursor *string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next := encodeLeaderboardCursor(entries[limit-1].Cursor())
+		nextCursor = &next
+	}
+
+	me, err := ch.challengeStore.GetStanding(challenge.ID, middleware.GetUser(r).ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getStanding: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get leaderboard"})
+		return
+	}
+
+	for _, entry := range entries {
+		entry.Score = challenge.DisplayScore(entry.Score, system)
+	}
+	if me != nil {
+		me.Score = challenge.DisplayScore(me.Score, system)
+	}
+	challenge.SetUnit(system)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"challenge":   challenge,
+		"entries":     entries,
+		"me":          me,
+		"next_cursor": nextCursor,
+	}})
+}
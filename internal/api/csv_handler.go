@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+	"github.com/andras-szesztai/fem_fitness_project/internal/workoutcsv"
+)
+
+const (
+	maxCSVUploadBytes   = 20 << 20
+	maxCSVImportWorkout = maxBatchOperations
+	defaultCSVPreset    = "native"
+)
+
+type CSVHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+func NewCSVHandler(workoutStore store.WorkoutStore, logger *log.Logger) *CSVHandler {
+	return &CSVHandler{workoutStore: workoutStore, logger: logger}
+}
+
+// HandleExportWorkouts writes every workout of the user with weights and
+// distances in the units they were entered in, so the file imports back
+// without conversion. The "units" query parameter converts them instead.
+func (ch *CSVHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	system, err := units.ParseSystem(r.URL.Query().Get("units"), "")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	workouts, err := ch.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID})
+	if err != nil {
+		ch.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to export workouts"})
+		return
+	}
+
+	if system != "" {
+		for _, workout := range workouts {
+			workout.ConvertUnits(system)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="workouts.csv"`)
+
+	err = workoutcsv.Export(w, workouts)
+	if err != nil {
+		ch.logger.Printf("ERROR: exportWorkouts: %s", err)
+		return
+	}
+
+	ch.logger.Printf("INFO: exportWorkouts: %d workouts for user %d", len(workouts), currentUser.ID)
+}
+
+// HandleImportWorkouts reads a multipart upload with the CSV in "file", an
+// optional mapping preset in "preset", an optional JSON "mapping" that
+// overrides single columns of the preset, and "dry_run" to only validate.
+// Values without a unit column are read in the user's units. Nothing is
+// imported unless every row is valid.
+func (ch *CSVHandler) HandleImportWorkouts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVUploadBytes)
+	err := r.ParseMultipartForm(maxCSVUploadBytes)
+	if err != nil {
+		ch.logger.Printf("ERROR: parseMultipartForm: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid upload"})
+		return
+	}
+
+	presetName := r.FormValue("preset")
+	if presetName == "" {
+		presetName = defaultCSVPreset
+	}
+	preset, ok := workoutcsv.Presets[presetName]
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("unknown preset %q", presetName)})
+		return
+	}
+
+	mapping := workoutcsv.Mapping{}
+	for field, column := range preset {
+		mapping[field] = column
+	}
+	if raw := r.FormValue("mapping"); raw != "" {
+		var overrides workoutcsv.Mapping
+		err = json.Unmarshal([]byte(raw), &overrides)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mapping must be a JSON object of field to column name"})
+			return
+		}
+		for field, column := range overrides {
+			mapping[field] = column
+		}
+	}
+
+	dryRun := r.FormValue("dry_run") == "true"
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	currentUser := middleware.GetUser(r)
+
+	system, ok := workoutcsv.PresetUnits[presetName]
+	if !ok {
+		system = currentUser.Units
+	}
+
+	workouts, report, err := workoutcsv.Parse(file, mapping, workoutcsv.Options{Location: currentUser.Location(), Units: system})
+	if err != nil {
+		ch.logger.Printf("ERROR: parseCSV: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if len(workouts) > maxCSVImportWorkout {
+		report.Errors = append(report.Errors, workoutcsv.RowError{Error: fmt.Sprintf("at most %d workouts can be imported at once", maxCSVImportWorkout)})
+	}
+
+	if dryRun {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"dry_run": true, "report": report}})
+		return
+	}
+	if !report.Valid() || len(workouts) == 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "Nothing was imported", "report": report})
+		return
+	}
+
+	ops := make([]store.WorkoutBatchOp, len(workouts))
+	for i, workout := range workouts {
+		ops[i] = store.WorkoutBatchOp{Op: store.BatchOpCreate, Workout: workout}
+	}
+
+	results, err := ch.workoutStore.ApplyWorkoutBatch(currentUser.ID, ops, true)
+	if err != nil {
+		ch.logger.Printf("ERROR: applyWorkoutBatch: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to import workouts"})
+		return
+	}
+
+	ids := make([]int, len(results))
+	for i, result := range results {
+		if result.Err != nil && !errors.Is(result.Err, store.ErrBatchAborted) {
+			ch.logger.Printf("ERROR: importWorkout: %s", result.Err)
+			report.Errors = append(report.Errors, workoutcsv.RowError{Error: fmt.Sprintf("workout %q on %s was rejected", workouts[i].Title, workouts[i].PerformedAt.Format(time.RFC3339))})
+			utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "Nothing was imported", "report": report})
+			return
+		}
+		ids[i] = result.ID
+	}
+
+	ch.logger.Printf("INFO: importWorkouts: %d workouts for user %d", len(ids), currentUser.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": utils.Envelope{"dry_run": false, "report": report, "workout_ids": ids}})
+}
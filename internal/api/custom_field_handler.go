@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+type CustomFieldHandler struct {
+	customFieldStore store.CustomFieldStore
+	logger           *log.Logger
+}
+
+func NewCustomFieldHandler(customFieldStore store.CustomFieldStore, logger *log.Logger) *CustomFieldHandler {
+	return &CustomFieldHandler{customFieldStore: customFieldStore, logger: logger}
+}
+
+func (ch *CustomFieldHandler) loadCustomField(w http.ResponseWriter, r *http.Request) (*store.CustomField, bool) {
+	fieldID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	field, err := ch.customFieldStore.GetCustomField(fieldID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getCustomField: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get custom field"})
+		return nil, false
+	}
+	if field == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Custom field not found"})
+		return nil, false
+	}
+	if field.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this custom field"})
+		return nil, false
+	}
+
+	return field, true
+}
+
+func (ch *CustomFieldHandler) HandleListCustomFields(w http.ResponseWriter, r *http.Request) {
+	fields, err := ch.customFieldStore.ListCustomFields(middleware.GetUser(r).ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: listCustomFields: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list custom fields"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": fields})
+}
+
+func (ch *CustomFieldHandler) HandleCreateCustomField(w http.ResponseWriter, r *http.Request) {
+	var field store.CustomField
+	err := json.NewDecoder(r.Body).Decode(&field)
+	if err != nil {
+		ch.logger.Printf("ERROR: decodeCreateCustomFieldBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	err = field.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	field.UserID = middleware.GetUser(r).ID
+	err = ch.customFieldStore.CreateCustomField(&field)
+	if errors.Is(err, store.ErrDuplicateCustomField) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You already have a custom field with this name"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: createCustomField: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create custom field"})
+		return
+	}
+
+	ch.logger.Printf("INFO: createCustomField: %d", field.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": field})
+}
+
+// HandleUpdateCustomField renames a field or changes the options of an enum
+// field. The type of a field cannot change.
+func (ch *CustomFieldHandler) HandleUpdateCustomField(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    *string  `json:"name"`
+		Type    *string  `json:"type"`
+		Options []string `json:"options"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("ERROR: decodeUpdateCustomFieldBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	field, ok := ch.loadCustomField(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Type != nil && *req.Type != field.Type {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "type cannot be changed"})
+		return
+	}
+	if req.Name != nil {
+		field.Name = *req.Name
+	}
+	if req.Options != nil {
+		field.Options = req.Options
+	}
+
+	err = field.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ch.customFieldStore.UpdateCustomField(field)
+	if errors.Is(err, store.ErrDuplicateCustomField) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You already have a custom field with this name"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: updateCustomField: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update custom field"})
+		return
+	}
+
+	ch.logger.Printf("INFO: updateCustomField: %d", field.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": field})
+}
+
+// HandleDeleteCustomField deletes a field together with its values.
+func (ch *CustomFieldHandler) HandleDeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	field, ok := ch.loadCustomField(w, r)
+	if !ok {
+		return
+	}
+
+	err := ch.customFieldStore.DeleteCustomField(field.ID)
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteCustomField: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete custom field"})
+		return
+	}
+
+	ch.logger.Printf("INFO: deleteCustomField: %d", field.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
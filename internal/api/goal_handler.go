@@ -0,0 +1,323 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/goals"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+type GoalHandler struct {
+	goalStore        store.GoalStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewGoalHandler(goalStore store.GoalStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *GoalHandler {
+	return &GoalHandler{goalStore: goalStore, workoutStore: workoutStore, measurementStore: measurementStore, logger: logger}
+}
+
+type goalResponse struct {
+	*store.Goal
+	Progress goals.Progress `json:"progress"`
+}
+
+// evaluateGoals measures the progress of goalList and expresses everything
+// in the units of system.
+func (gh *GoalHandler) evaluateGoals(currentUser *store.User, goalList []*store.Goal, system string) ([]goalResponse, error) {
+	loc := currentUser.Location()
+
+	history, err := goals.LoadHistory(gh.workoutStore, gh.measurementStore, currentUser.ID, goalList, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	responses := make([]goalResponse, 0, len(goalList))
+	for _, goal := range goalList {
+		progress := goals.Evaluate(goal, history, now, loc)
+		progress.ConvertUnits(goal, system)
+		goal.ConvertUnits(system)
+		responses = append(responses, goalResponse{Goal: goal, Progress: progress})
+	}
+	return responses, nil
+}
+
+// defaultGoalUnit is the unit a target without one is in: the user's
+// preferred unit for goals measured in weight or distance.
+func defaultGoalUnit(goalType string, system string) *string {
+	var unit string
+	switch goalType {
+	case store.GoalTypeOneRepMax, store.GoalTypeWeeklyVolume, store.GoalTypeBodyWeight:
+		unit = units.WeightUnit(system)
+	case store.GoalTypeDistancePerMonth:
+		unit = units.DistanceUnit(system)
+	default:
+		return nil
+	}
+	return &unit
+}
+
+// loadGoal reads the goal in the URL and checks that it belongs to the
+// current user, writing the error response if it does not.
+func (gh *GoalHandler) loadGoal(w http.ResponseWriter, r *http.Request) (*store.Goal, bool) {
+	goalID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	goal, err := gh.goalStore.GetGoal(goalID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoal: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get goal"})
+		return nil, false
+	}
+	if goal == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Goal not found"})
+		return nil, false
+	}
+	if goal.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this goal"})
+		return nil, false
+	}
+
+	return goal, true
+}
+
+// validateDeadline checks that the goal's deadline has not passed in the
+// user's time zone.
+func validateDeadline(goal *store.Goal, loc *time.Location) bool {
+	return time.Now().Before(goals.DeadlineEnd(goal, loc))
+}
+
+func (gh *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var goal store.Goal
+	err = json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodeCreateGoalBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if goal.Unit == nil {
+		goal.Unit = defaultGoalUnit(goal.Type, currentUser.Units)
+	}
+	err = goal.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if !validateDeadline(&goal, currentUser.Location()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "deadline must not be in the past"})
+		return
+	}
+
+	// Goals that are not recurring measure progress from where the user
+	// stands today.
+	goal.StartValue = nil
+	switch goal.Type {
+	case store.GoalTypeOneRepMax:
+		workouts, err := gh.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID})
+		if err != nil {
+			gh.logger.Printf("ERROR: listWorkouts: %s", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create goal"})
+			return
+		}
+		best := stats.BestOneRepMax(workouts, *goal.ExerciseName)
+		goal.StartValue = &best
+	case store.GoalTypeBodyWeight:
+		bodyWeights, err := gh.measurementStore.GetBodyWeightLog(currentUser.ID)
+		if err != nil {
+			gh.logger.Printf("ERROR: getBodyWeightLog: %s", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create goal"})
+			return
+		}
+		bodyWeight := bodyWeights.At(time.Now())
+		if bodyWeight == 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Log your body weight before setting a body weight goal"})
+			return
+		}
+		goal.StartValue = &bodyWeight
+	}
+
+	goal.UserID = currentUser.ID
+	goal.CompletedAt = nil
+
+	err = gh.goalStore.CreateGoal(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: createGoal: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create goal"})
+		return
+	}
+
+	responses, err := gh.evaluateGoals(currentUser, []*store.Goal{&goal}, system)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get goal progress"})
+		return
+	}
+
+	gh.logger.Printf("INFO: createGoal: %d", goal.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": responses[0]})
+}
+
+// HandleListGoals returns the user's goals with their live progress,
+// optionally only those with the given status.
+func (gh *GoalHandler) HandleListGoals(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", goals.StatusActive, goals.StatusCompleted, goals.StatusExpired, goals.StatusEnded:
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be active, completed, expired or ended"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	goalList, err := gh.goalStore.ListGoals(currentUser.ID)
+	if err != nil {
+		gh.logger.Printf("ERROR: listGoals: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list goals"})
+		return
+	}
+
+	responses, err := gh.evaluateGoals(currentUser, goalList, system)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get goal progress"})
+		return
+	}
+
+	if status != "" {
+		filtered := []goalResponse{}
+		for _, response := range responses {
+			if response.Progress.Status == status {
+				filtered = append(filtered, response)
+			}
+		}
+		responses = filtered
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": responses})
+}
+
+func (gh *GoalHandler) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	goal, ok := gh.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	responses, err := gh.evaluateGoals(middleware.GetUser(r), []*store.Goal{goal}, system)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get goal progress"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": responses[0]})
+}
+
+// HandleUpdateGoal changes the target or deadline of a goal. The type and
+// exercise of a goal are fixed.
+func (gh *GoalHandler) HandleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target   *float64 `json:"target"`
+		Unit     *string  `json:"unit"`
+		Deadline *string  `json:"deadline"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodeUpdateGoalBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	goal, ok := gh.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if req.Target != nil {
+		goal.Target = *req.Target
+		goal.Unit = defaultGoalUnit(goal.Type, currentUser.Units)
+		if req.Unit != nil {
+			goal.Unit = req.Unit
+		}
+	}
+	if req.Deadline != nil {
+		goal.Deadline = *req.Deadline
+	}
+
+	err = goal.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if req.Deadline != nil && !validateDeadline(goal, currentUser.Location()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "deadline must not be in the past"})
+		return
+	}
+
+	err = gh.goalStore.UpdateGoal(goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: updateGoal: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update goal"})
+		return
+	}
+
+	gh.logger.Printf("INFO: updateGoal: %d", goal.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+func (gh *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.loadGoal(w, r)
+	if !ok {
+		return
+	}
+
+	err := gh.goalStore.DeleteGoal(goal.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Goal not found"})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: deleteGoal: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete goal"})
+		return
+	}
+
+	gh.logger.Printf("INFO: deleteGoal: %d", goal.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+// JobHandler lets admins inspect the background job queue, retry dead or
+// cancelled jobs and cancel queued ones.
+type JobHandler struct {
+	jobStore store.JobStore
+	logger   *log.Logger
+}
+
+func NewJobHandler(jobStore store.JobStore, logger *log.Logger) *JobHandler {
+	return &JobHandler{jobStore: jobStore, logger: logger}
+}
+
+func (jh *JobHandler) loadJob(w http.ResponseWriter, r *http.Request) (*store.Job, bool) {
+	jobID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	job, err := jh.jobStore.GetJob(jobID)
+	if err != nil {
+		jh.logger.Printf("ERROR: getJob: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get job"})
+		return nil, false
+	}
+	if job == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Job not found"})
+		return nil, false
+	}
+
+	return job, true
+}
+
+// HandleListJobs returns jobs newest first, optionally only those with the
+// given status and kind.
+func (jh *JobHandler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !store.ValidJobStatus(status) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be queued, running, succeeded, dead or cancelled"})
+		return
+	}
+	limit, err := readPageSize(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	offset, err := readOffset(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	jobs, err := jh.jobStore.ListJobs(store.JobFilter{
+		Status: status,
+		Kind:   r.URL.Query().Get("kind"),
+		Limit:  limit + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		jh.logger.Printf("ERROR: listJobs: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list jobs"})
+		return
+	}
+
+	var nextOffset *int
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"jobs":        jobs,
+		"next_offset": nextOffset,
+	}})
+}
+
+// HandleGetJobStats returns how many jobs of each kind have each status.
+func (jh *JobHandler) HandleGetJobStats(w http.ResponseWriter, r *http.Request) {
+	counts, err := jh.jobStore.CountJobs()
+	if err != nil {
+		jh.logger.Printf("ERROR: countJobs: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get job stats"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": counts})
+}
+
+func (jh *JobHandler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": job})
+}
+
+// HandleRetryJob queues a dead or cancelled job to run now with a fresh
+// set of attempts.
+func (jh *JobHandler) HandleRetryJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	retried, err := jh.jobStore.RetryJob(job.ID)
+	if errors.Is(err, store.ErrDuplicateJob) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Another job with the same unique key is queued or running"})
+		return
+	}
+	if err != nil {
+		jh.logger.Printf("ERROR: retryJob: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retry job"})
+		return
+	}
+	if retried == nil {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Only dead or cancelled jobs can be retried"})
+		return
+	}
+
+	jh.logger.Printf("INFO: retryJob: %d (%s)", retried.ID, retried.Kind)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": retried})
+}
+
+// HandleCancelJob keeps a queued job from running.
+func (jh *JobHandler) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	cancelled, err := jh.jobStore.CancelJob(job.ID)
+	if err != nil {
+		jh.logger.Printf("ERROR: cancelJob: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to cancel job"})
+		return
+	}
+	if cancelled == nil {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Only queued jobs can be cancelled"})
+		return
+	}
+
+	jh.logger.Printf("INFO: cancelJob: %d (%s)", cancelled.ID, cancelled.Kind)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": cancelled})
+}
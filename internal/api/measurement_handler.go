@@ -0,0 +1,299 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	defaultTrendWindowDays = 7
+	maxTrendWindowDays     = 90
+	bodyFatPlaces          = 2
+)
+
+type MeasurementHandler struct {
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewMeasurementHandler(measurementStore store.MeasurementStore, logger *log.Logger) *MeasurementHandler {
+	return &MeasurementHandler{measurementStore: measurementStore, logger: logger}
+}
+
+// measurementTrends holds a series for every value measured in a range.
+type measurementTrends struct {
+	BodyWeight     *stats.Series           `json:"body_weight"`
+	BodyFatPercent *stats.Series           `json:"body_fat_percent"`
+	Circumferences map[string]stats.Series `json:"circumferences"`
+}
+
+func newMeasurementTrends(measurements []*store.Measurement, window time.Duration) measurementTrends {
+	var bodyWeights, bodyFats []stats.Point
+	circumferences := map[string][]stats.Point{}
+	for _, measurement := range measurements {
+		if measurement.BodyWeight != nil {
+			bodyWeights = append(bodyWeights, stats.Point{At: measurement.MeasuredAt, Value: *measurement.BodyWeight})
+		}
+		if measurement.BodyFatPercent != nil {
+			bodyFats = append(bodyFats, stats.Point{At: measurement.MeasuredAt, Value: *measurement.BodyFatPercent})
+		}
+		for site, length := range measurement.Circumferences {
+			circumferences[site] = append(circumferences[site], stats.Point{At: measurement.MeasuredAt, Value: length})
+		}
+	}
+
+	trends := measurementTrends{Circumferences: map[string]stats.Series{}}
+	if len(bodyWeights) > 0 {
+		series := stats.NewSeries(bodyWeights, window, units.WeightPlaces)
+		trends.BodyWeight = &series
+	}
+	if len(bodyFats) > 0 {
+		series := stats.NewSeries(bodyFats, window, bodyFatPlaces)
+		trends.BodyFatPercent = &series
+	}
+	for site, points := range circumferences {
+		trends.Circumferences[site] = stats.NewSeries(points, window, units.LengthPlaces)
+	}
+	return trends
+}
+
+// readTrendWindow parses the optional window_days query parameter, the
+// number of days moving averages are taken over.
+func readTrendWindow(r *http.Request) (time.Duration, error) {
+	days := defaultTrendWindowDays
+	if v := r.URL.Query().Get("window_days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendWindowDays {
+			return 0, errors.New("window_days must be between 1 and 90")
+		}
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// loadMeasurement reads the measurement in the URL and checks that it
+// belongs to the current user, writing the error response if it does not.
+func (mh *MeasurementHandler) loadMeasurement(w http.ResponseWriter, r *http.Request) (*store.Measurement, bool) {
+	measurementID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	measurement, err := mh.measurementStore.GetMeasurement(measurementID)
+	if err != nil {
+		mh.logger.Printf("ERROR: getMeasurement: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get measurement"})
+		return nil, false
+	}
+	if measurement == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Measurement not found"})
+		return nil, false
+	}
+	if measurement.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this measurement"})
+		return nil, false
+	}
+
+	return measurement, true
+}
+
+func (mh *MeasurementHandler) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var measurement store.Measurement
+	err = json.NewDecoder(r.Body).Decode(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: decodeCreateMeasurementBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	// Values without a unit are in the units the user prefers.
+	if measurement.WeightUnit == "" {
+		measurement.WeightUnit = units.WeightUnit(currentUser.Units)
+	}
+	if measurement.LengthUnit == "" {
+		measurement.LengthUnit = units.LengthUnit(currentUser.Units)
+	}
+
+	err = measurement.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurement.UserID = currentUser.ID
+
+	err = mh.measurementStore.CreateMeasurement(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: createMeasurement: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create measurement"})
+		return
+	}
+
+	measurement.ConvertUnits(system)
+
+	mh.logger.Printf("INFO: createMeasurement: %d", measurement.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": measurement})
+}
+
+func (mh *MeasurementHandler) HandleGetMeasurement(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurement, ok := mh.loadMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	measurement.ConvertUnits(system)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": measurement})
+}
+
+// HandleListMeasurements returns the measurements taken between the optional
+// from and to dates, with moving averages over window_days and trend lines.
+func (mh *MeasurementHandler) HandleListMeasurements(w http.ResponseWriter, r *http.Request) {
+	from, to, err := readDateRange(r, middleware.GetUser(r).Location())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	window, err := readTrendWindow(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurements, err := mh.measurementStore.ListMeasurements(store.MeasurementFilter{UserID: middleware.GetUser(r).ID, From: from, To: to})
+	if err != nil {
+		mh.logger.Printf("ERROR: listMeasurements: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list measurements"})
+		return
+	}
+
+	for _, measurement := range measurements {
+		measurement.ConvertUnits(system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"weight_unit":  units.WeightUnit(system),
+		"length_unit":  units.LengthUnit(system),
+		"measurements": measurements,
+		"trends":       newMeasurementTrends(measurements, window),
+	}})
+}
+
+func (mh *MeasurementHandler) HandleUpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MeasuredAt     *time.Time         `json:"measured_at"`
+		BodyWeight     *float64           `json:"body_weight"`
+		WeightUnit     *string            `json:"weight_unit"`
+		BodyFatPercent *float64           `json:"body_fat_percent"`
+		Circumferences map[string]float64 `json:"circumferences"`
+		LengthUnit     *string            `json:"length_unit"`
+		Notes          *string            `json:"notes"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		mh.logger.Printf("ERROR: decodeUpdateMeasurementBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	measurement, ok := mh.loadMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if req.MeasuredAt != nil {
+		measurement.MeasuredAt = *req.MeasuredAt
+	}
+	if req.BodyWeight != nil {
+		measurement.BodyWeight = req.BodyWeight
+		measurement.WeightUnit = units.WeightUnit(currentUser.Units)
+		if req.WeightUnit != nil {
+			measurement.WeightUnit = *req.WeightUnit
+		}
+	}
+	if req.BodyFatPercent != nil {
+		measurement.BodyFatPercent = req.BodyFatPercent
+	}
+	// Circumferences are replaced as a whole.
+	if req.Circumferences != nil {
+		measurement.Circumferences = req.Circumferences
+		measurement.LengthUnit = units.LengthUnit(currentUser.Units)
+		if req.LengthUnit != nil {
+			measurement.LengthUnit = *req.LengthUnit
+		}
+	}
+	if req.Notes != nil {
+		measurement.Notes = *req.Notes
+	}
+
+	err = measurement.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = mh.measurementStore.UpdateMeasurement(measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: updateMeasurement: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update measurement"})
+		return
+	}
+
+	mh.logger.Printf("INFO: updateMeasurement: %d", measurement.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+func (mh *MeasurementHandler) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement, ok := mh.loadMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	err := mh.measurementStore.DeleteMeasurement(measurement.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Measurement not found"})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: deleteMeasurement: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete measurement"})
+		return
+	}
+
+	mh.logger.Printf("INFO: deleteMeasurement: %d", measurement.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
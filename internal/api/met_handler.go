@@ -0,0 +1,111 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/calories"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const maxMET = 30
+
+// METHandler manages the MET values calories are estimated with. Users start
+// from calories.DefaultMETs and can add or override values per exercise;
+// changes apply to workouts saved afterwards.
+type METHandler struct {
+	metStore store.METStore
+	logger   *log.Logger
+}
+
+func NewMETHandler(metStore store.METStore, logger *log.Logger) *METHandler {
+	return &METHandler{metStore: metStore, logger: logger}
+}
+
+type metValue struct {
+	ExerciseName string  `json:"exercise_name"`
+	MET          float64 `json:"met"`
+	Custom       bool    `json:"custom"`
+}
+
+func (mh *METHandler) HandleListMETValues(w http.ResponseWriter, r *http.Request) {
+	overrides, err := mh.metStore.ListMETValues(middleware.GetUser(r).ID)
+	if err != nil {
+		mh.logger.Printf("ERROR: listMETValues: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list MET values"})
+		return
+	}
+
+	values := []metValue{}
+	for name, met := range calories.DefaultMETs.With(overrides) {
+		_, custom := overrides[name]
+		values = append(values, metValue{ExerciseName: name, MET: met, Custom: custom})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].ExerciseName < values[j].ExerciseName
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": values})
+}
+
+func (mh *METHandler) HandleSetMETValue(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ExerciseName string  `json:"exercise_name"`
+		MET          float64 `json:"met"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		mh.logger.Printf("ERROR: decodeSetMETValueBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+	if strings.TrimSpace(req.ExerciseName) == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "exercise_name is required"})
+		return
+	}
+	if req.MET <= 0 || req.MET > maxMET {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "met must be greater than 0 and at most 30"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	err = mh.metStore.UpsertMETValue(currentUser.ID, req.ExerciseName, req.MET)
+	if err != nil {
+		mh.logger.Printf("ERROR: upsertMETValue: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to set MET value"})
+		return
+	}
+
+	mh.logger.Printf("INFO: setMETValue: %q for user %d", calories.Key(req.ExerciseName), currentUser.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": metValue{ExerciseName: calories.Key(req.ExerciseName), MET: req.MET, Custom: true}})
+}
+
+// HandleDeleteMETValue removes the user's value for the exercise named by the
+// exercise_name query parameter, bringing back the default if there is one.
+func (mh *METHandler) HandleDeleteMETValue(w http.ResponseWriter, r *http.Request) {
+	exerciseName := r.URL.Query().Get("exercise_name")
+	if strings.TrimSpace(exerciseName) == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "exercise_name is required"})
+		return
+	}
+
+	err := mh.metStore.DeleteMETValue(middleware.GetUser(r).ID, exerciseName)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "No MET value set for this exercise"})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: deleteMETValue: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete MET value"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/live"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/notifications"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	notificationEventUnread       = "unread"
+	notificationKeepAliveInterval = 15 * time.Second
+)
+
+type NotificationHandler struct {
+	notificationStore store.NotificationStore
+	center            *notifications.Center
+	logger            *log.Logger
+}
+
+func NewNotificationHandler(notificationStore store.NotificationStore, center *notifications.Center, logger *log.Logger) *NotificationHandler {
+	return &NotificationHandler{notificationStore: notificationStore, center: center, logger: logger}
+}
+
+func (nh *NotificationHandler) loadNotification(w http.ResponseWriter, r *http.Request) (*store.Notification, bool) {
+	notificationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	notification, err := nh.notificationStore.GetNotification(notificationID)
+	if err != nil {
+		nh.logger.Printf("ERROR: getNotification: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get notification"})
+		return nil, false
+	}
+	if notification == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Notification not found"})
+		return nil, false
+	}
+	if notification.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this notification"})
+		return nil, false
+	}
+
+	return notification, true
+}
+
+// HandleListNotifications returns the user's notifications, newest first,
+// with the unread counts. unread=true leaves out those already read.
+func (nh *NotificationHandler) HandleListNotifications(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unreadOnly := false
+	if v := r.URL.Query().Get("unread"); v != "" {
+		var err error
+		unreadOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unread must be true or false"})
+			return
+		}
+	}
+	limit, err := readPageSize(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	offset, err := readOffset(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	list, err := nh.notificationStore.ListNotifications(store.NotificationFilter{
+		UserID:     currentUser.ID,
+		UnreadOnly: unreadOnly,
+		Limit:      limit + 1,
+		Offset:     offset,
+	})
+	if err != nil {
+		nh.logger.Printf("ERROR: listNotifications: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list notifications"})
+		return
+	}
+	unread, err := nh.notificationStore.CountUnread(currentUser.ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: countUnread: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list notifications"})
+		return
+	}
+
+	var nextOffset *int
+	if len(list) > limit {
+		list = list[:limit]
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"notifications": list,
+		"unread":        unread,
+		"next_offset":   nextOffset,
+	}})
+}
+
+func (nh *NotificationHandler) HandleGetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	unread, err := nh.notificationStore.CountUnread(middleware.GetUser(r).ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: countUnread: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count notifications"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": unread})
+}
+
+func (nh *NotificationHandler) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	notification, ok := nh.loadNotification(w, r)
+	if !ok {
+		return
+	}
+
+	err := nh.notificationStore.MarkNotificationRead(notification)
+	if err != nil {
+		nh.logger.Printf("ERROR: markNotificationRead: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to mark notification read"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": notification})
+}
+
+func (nh *NotificationHandler) HandleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	marked, err := nh.notificationStore.MarkAllNotificationsRead(middleware.GetUser(r).ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: markAllNotificationsRead: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"marked": marked}})
+}
+
+// HandleGetPreferences returns whether each notification type is on.
+func (nh *NotificationHandler) HandleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	saved, err := nh.notificationStore.GetNotificationPreferences(middleware.GetUser(r).ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: getNotificationPreferences: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get notification preferences"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": notifications.Preferences(saved)})
+}
+
+// HandleUpdatePreferences turns the notification types in the body, an
+// object of type to boolean, on or off; other types are left as they are.
+func (nh *NotificationHandler) HandleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req map[string]bool
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		nh.logger.Printf("ERROR: decodeUpdateNotificationPreferencesBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+	for notificationType := range req {
+		if !notifications.ValidType(notificationType) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("unknown notification type %q", notificationType)})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = nh.notificationStore.SaveNotificationPreferences(currentUser.ID, req)
+	if err != nil {
+		nh.logger.Printf("ERROR: saveNotificationPreferences: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update notification preferences"})
+		return
+	}
+	saved, err := nh.notificationStore.GetNotificationPreferences(currentUser.ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: getNotificationPreferences: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update notification preferences"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": notifications.Preferences(saved)})
+}
+
+// HandleStream streams the user's new notifications as server-sent events
+// until the client goes away, starting with the unread counts.
+func (nh *NotificationHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	events, unsubscribe := nh.center.Subscribe(currentUser.ID)
+	defer unsubscribe()
+
+	unread, err := nh.notificationStore.CountUnread(currentUser.ID)
+	if err != nil {
+		nh.logger.Printf("ERROR: countUnread: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to stream notifications"})
+		return
+	}
+
+	// Streams outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		nh.logger.Printf("ERROR: setWriteDeadline: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	err = writeStreamEvent(w, rc, live.Event{Type: notificationEventUnread, Data: unread, At: time.Now().UTC()})
+	if err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(notificationKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			if err == nil {
+				err = rc.Flush()
+			}
+		case event := <-events:
+			err = writeStreamEvent(w, rc, event)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/progression"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// recentSessionCount is how many past sessions suggestions look at.
+const recentSessionCount = 10
+
+type ProgressionHandler struct {
+	progressionStore store.ProgressionStore
+	logger           *log.Logger
+}
+
+func NewProgressionHandler(progressionStore store.ProgressionStore, logger *log.Logger) *ProgressionHandler {
+	return &ProgressionHandler{progressionStore: progressionStore, logger: logger}
+}
+
+// progressionSettingsResponse shows settings with their increment in the
+// units of a unit system. Custom tells saved settings from defaults.
+type progressionSettingsResponse struct {
+	store.ProgressionSettings
+	IncrementUnit string `json:"increment_unit"`
+	Custom        bool   `json:"custom"`
+}
+
+func newProgressionSettingsResponse(settings store.ProgressionSettings, custom bool, system string) progressionSettingsResponse {
+	unit := units.WeightUnit(system)
+	settings.Increment = units.Round(units.FromKilograms(settings.Increment, unit), units.WeightPlaces)
+	return progressionSettingsResponse{ProgressionSettings: settings, IncrementUnit: unit, Custom: custom}
+}
+
+// readExerciseName reads the exercise in the URL. Exercises are known by
+// name, so clients escape it as a path segment.
+func readExerciseName(r *http.Request) (string, error) {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil || strings.TrimSpace(name) == "" {
+		return "", errors.New("invalid exercise name")
+	}
+	return name, nil
+}
+
+// loadSettings returns the user's settings for the exercise, or the
+// defaults of their model. A model other than the saved one starts from
+// that model's defaults.
+func (ph *ProgressionHandler) loadSettings(currentUser *store.User, exerciseName string, model string) (store.ProgressionSettings, bool, error) {
+	saved, err := ph.progressionStore.GetProgressionSettings(currentUser.ID, exerciseName)
+	if err != nil {
+		return store.ProgressionSettings{}, false, err
+	}
+	if saved != nil && (model == "" || model == saved.Model) {
+		return *saved, true, nil
+	}
+	if model == "" {
+		model = store.ProgressionModelLinear
+	}
+	return progression.Default(exerciseName, model, currentUser.Units), false, nil
+}
+
+// HandleGetSuggestion proposes the sets, reps and weight of the next
+// session of an exercise from the recent ones. The optional model query
+// parameter tries a different progression model than the saved one.
+func (ph *ProgressionHandler) HandleGetSuggestion(w http.ResponseWriter, r *http.Request) {
+	exerciseName, err := readExerciseName(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	model := r.URL.Query().Get("model")
+	if model != "" && !store.ValidProgressionModel(model) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "model must be linear, double_progression or rpe"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	settings, custom, err := ph.loadSettings(currentUser, exerciseName, model)
+	if err != nil {
+		ph.logger.Printf("ERROR: getProgressionSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get suggestion"})
+		return
+	}
+
+	sessions, err := ph.progressionStore.ListExerciseSessions(currentUser.ID, exerciseName, recentSessionCount)
+	if err != nil {
+		ph.logger.Printf("ERROR: listExerciseSessions: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get suggestion"})
+		return
+	}
+
+	suggestion := progression.Suggest(settings, sessions)
+
+	weightUnit := units.WeightUnit(system)
+	if suggestion.Weight != nil {
+		weight := units.Round(units.FromKilograms(*suggestion.Weight, weightUnit), units.WeightPlaces)
+		suggestion.Weight = &weight
+	}
+	for i := range sessions {
+		sessions[i].Weight = units.Round(units.FromKilograms(sessions[i].Weight, weightUnit), units.WeightPlaces)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"exercise_name":   exerciseName,
+		"weight_unit":     weightUnit,
+		"settings":        newProgressionSettingsResponse(settings, custom, system),
+		"suggestion":      suggestion,
+		"recent_sessions": sessions,
+	}})
+}
+
+func (ph *ProgressionHandler) HandleGetProgressionSettings(w http.ResponseWriter, r *http.Request) {
+	exerciseName, err := readExerciseName(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	settings, custom, err := ph.loadSettings(middleware.GetUser(r), exerciseName, "")
+	if err != nil {
+		ph.logger.Printf("ERROR: getProgressionSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get progression settings"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": newProgressionSettingsResponse(settings, custom, system)})
+}
+
+// HandleSetProgressionSettings saves how the user progresses on an
+// exercise. Fields left out take the defaults of the model; the increment
+// is in increment_unit, or the unit the user prefers.
+func (ph *ProgressionHandler) HandleSetProgressionSettings(w http.ResponseWriter, r *http.Request) {
+	exerciseName, err := readExerciseName(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		Model         string   `json:"model"`
+		Sets          *int     `json:"sets"`
+		MinReps       *int     `json:"min_reps"`
+		MaxReps       *int     `json:"max_reps"`
+		TargetRPE     *float64 `json:"target_rpe"`
+		Increment     *float64 `json:"increment"`
+		IncrementUnit *string  `json:"increment_unit"`
+		DeloadPercent *float64 `json:"deload_percent"`
+		StallSessions *int     `json:"stall_sessions"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: decodeProgressionSettingsBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+	if !store.ValidProgressionModel(req.Model) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "model must be linear, double_progression or rpe"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	settings := progression.Default(exerciseName, req.Model, currentUser.Units)
+
+	if req.Sets != nil {
+		settings.Sets = *req.Sets
+	}
+	if req.MinReps != nil {
+		settings.MinReps = *req.MinReps
+		// Linear and RPE progression aim for a single rep count.
+		if req.MaxReps == nil && req.Model != store.ProgressionModelDoubleProgression {
+			settings.MaxReps = *req.MinReps
+		}
+	}
+	if req.MaxReps != nil {
+		settings.MaxReps = *req.MaxReps
+	}
+	if req.TargetRPE != nil {
+		settings.TargetRPE = req.TargetRPE
+	}
+	if req.Increment != nil {
+		unit := units.WeightUnit(currentUser.Units)
+		if req.IncrementUnit != nil {
+			unit = *req.IncrementUnit
+		}
+		if !units.ValidWeightUnit(unit) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "increment_unit must be kg or lb"})
+			return
+		}
+		settings.Increment = units.Round(units.ToKilograms(*req.Increment, unit), units.CanonicalWeightPlaces)
+	}
+	if req.DeloadPercent != nil {
+		settings.DeloadPercent = *req.DeloadPercent
+	}
+	if req.StallSessions != nil {
+		settings.StallSessions = *req.StallSessions
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ph.progressionStore.UpsertProgressionSettings(currentUser.ID, &settings)
+	if err != nil {
+		ph.logger.Printf("ERROR: upsertProgressionSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to save progression settings"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": newProgressionSettingsResponse(settings, true, currentUser.Units)})
+}
+
+// HandleDeleteProgressionSettings goes back to the default settings for an
+// exercise.
+func (ph *ProgressionHandler) HandleDeleteProgressionSettings(w http.ResponseWriter, r *http.Request) {
+	exerciseName, err := readExerciseName(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ph.progressionStore.DeleteProgressionSettings(middleware.GetUser(r).ID, exerciseName)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "No progression settings for this exercise"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: deleteProgressionSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete progression settings"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/reminders"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+	"github.com/andras-szesztai/fem_fitness_project/internal/webhooks"
+)
+
+// defaultMissedDays is how many finished days the missed sessions report
+// covers when no range is given.
+const defaultMissedDays = 30
+
+type ReminderHandler struct {
+	reminderStore store.ReminderStore
+	scheduleStore store.ScheduleStore
+	logger        *log.Logger
+}
+
+func NewReminderHandler(reminderStore store.ReminderStore, scheduleStore store.ScheduleStore, logger *log.Logger) *ReminderHandler {
+	return &ReminderHandler{reminderStore: reminderStore, scheduleStore: scheduleStore, logger: logger}
+}
+
+func (rh *ReminderHandler) HandleGetReminderSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := rh.reminderStore.GetReminderSettings(middleware.GetUser(r).ID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getReminderSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get reminder settings"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": settings})
+}
+
+// reminderSettingsWithSecret shows the webhook signing secret, which is
+// only returned when it is created.
+type reminderSettingsWithSecret struct {
+	*store.ReminderSettings
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// HandleUpdateReminderSettings changes the given settings; an empty
+// webhook_url stops webhook delivery. Saving a webhook_url creates a new
+// signing secret, which the response shows once.
+func (rh *ReminderHandler) HandleUpdateReminderSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email        *bool   `json:"email"`
+		InApp        *bool   `json:"in_app"`
+		WebhookURL   *string `json:"webhook_url"`
+		NotifyMissed *bool   `json:"notify_missed"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		rh.logger.Printf("ERROR: decodeUpdateReminderSettingsBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	settings, err := rh.reminderStore.GetReminderSettings(middleware.GetUser(r).ID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getReminderSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update reminder settings"})
+		return
+	}
+
+	if req.Email != nil {
+		settings.Email = *req.Email
+	}
+	if req.InApp != nil {
+		settings.InApp = *req.InApp
+	}
+	if req.WebhookURL != nil {
+		settings.WebhookURL = req.WebhookURL
+		settings.WebhookSecret = nil
+		if strings.TrimSpace(*req.WebhookURL) == "" {
+			settings.WebhookURL = nil
+		}
+	}
+	if req.NotifyMissed != nil {
+		settings.NotifyMissed = *req.NotifyMissed
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if req.WebhookURL != nil && settings.WebhookURL != nil {
+		err = webhooks.ValidateURL(r.Context(), *settings.WebhookURL)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "webhook_" + err.Error()})
+			return
+		}
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			rh.logger.Printf("ERROR: newWebhookSecret: %s", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update reminder settings"})
+			return
+		}
+		settings.WebhookSecret = &secret
+	}
+
+	err = rh.reminderStore.SaveReminderSettings(settings)
+	if err != nil {
+		rh.logger.Printf("ERROR: saveReminderSettings: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update reminder settings"})
+		return
+	}
+
+	if req.WebhookURL != nil && settings.WebhookSecret != nil {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": reminderSettingsWithSecret{settings, *settings.WebhookSecret}})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": settings})
+}
+
+// HandleListMissed returns the planned sessions within the from and to
+// dates, the last 30 days by default, on whose day no workout was logged.
+// Today is never included, as a session may still be logged.
+func (rh *ReminderHandler) HandleListMissed(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+
+	from, to, err := readDateRange(r, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	today := reminders.DayStart(time.Now(), loc)
+	if to == nil || to.After(today) {
+		to = &today
+	}
+	if from == nil {
+		start := to.AddDate(0, 0, -defaultMissedDays)
+		from = &start
+	}
+
+	missed := []reminders.Notice{}
+	if !from.Before(*to) {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": missed})
+		return
+	}
+
+	schedules, err := rh.scheduleStore.ListSchedules(currentUser.ID)
+	if err != nil {
+		rh.logger.Printf("ERROR: listSchedules: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list missed sessions"})
+		return
+	}
+	performed, err := rh.reminderStore.ListWorkoutTimes(currentUser.ID, *from, *to)
+	if err != nil {
+		rh.logger.Printf("ERROR: listWorkoutTimes: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list missed sessions"})
+		return
+	}
+
+	for _, schedule := range schedules {
+		missed = append(missed, reminders.Missed(schedule, performed, *from, *to, loc)...)
+	}
+	sort.SliceStable(missed, func(i, j int) bool { return missed[i].StartsAt.Before(missed[j].StartsAt) })
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": missed})
+}
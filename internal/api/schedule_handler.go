@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+type ScheduleHandler struct {
+	scheduleStore store.ScheduleStore
+	logger        *log.Logger
+}
+
+func NewScheduleHandler(scheduleStore store.ScheduleStore, logger *log.Logger) *ScheduleHandler {
+	return &ScheduleHandler{scheduleStore: scheduleStore, logger: logger}
+}
+
+func (sh *ScheduleHandler) loadSchedule(w http.ResponseWriter, r *http.Request) (*store.Schedule, bool) {
+	scheduleID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	schedule, err := sh.scheduleStore.GetSchedule(scheduleID)
+	if err != nil {
+		sh.logger.Printf("ERROR: getSchedule: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get schedule"})
+		return nil, false
+	}
+	if schedule == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Schedule not found"})
+		return nil, false
+	}
+	if schedule.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this schedule"})
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+func (sh *ScheduleHandler) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := sh.scheduleStore.ListSchedules(middleware.GetUser(r).ID)
+	if err != nil {
+		sh.logger.Printf("ERROR: listSchedules: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list schedules"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": schedules})
+}
+
+// HandleCreateSchedule plans a workout at starts_at, a local time in the
+// user's time zone, repeated by the optional rrule.
+func (sh *ScheduleHandler) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule store.Schedule
+	err := json.NewDecoder(r.Body).Decode(&schedule)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeCreateScheduleBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	err = schedule.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	schedule.UserID = middleware.GetUser(r).ID
+	err = sh.scheduleStore.CreateSchedule(&schedule)
+	if err != nil {
+		sh.logger.Printf("ERROR: createSchedule: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create schedule"})
+		return
+	}
+
+	sh.logger.Printf("INFO: createSchedule: %d", schedule.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": schedule})
+}
+
+func (sh *ScheduleHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := sh.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": schedule})
+}
+
+// HandleUpdateSchedule changes the given fields; an empty rrule makes the
+// schedule happen once and no_reminder turns its reminder off.
+func (sh *ScheduleHandler) HandleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title           *string `json:"title"`
+		Notes           *string `json:"notes"`
+		StartsAt        *string `json:"starts_at"`
+		DurationMinutes *int    `json:"duration_minutes"`
+		RRule           *string `json:"rrule"`
+		ReminderMinutes *int    `json:"reminder_minutes"`
+		NoReminder      bool    `json:"no_reminder"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeUpdateScheduleBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, ok := sh.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		schedule.Title = *req.Title
+	}
+	if req.Notes != nil {
+		schedule.Notes = *req.Notes
+	}
+	if req.StartsAt != nil {
+		schedule.StartsAt = *req.StartsAt
+	}
+	if req.DurationMinutes != nil {
+		schedule.DurationMinutes = *req.DurationMinutes
+	}
+	if req.RRule != nil {
+		schedule.RRule = req.RRule
+	}
+	if req.ReminderMinutes != nil {
+		schedule.ReminderMinutes = req.ReminderMinutes
+	}
+	if req.NoReminder {
+		schedule.ReminderMinutes = nil
+	}
+
+	err = schedule.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = sh.scheduleStore.UpdateSchedule(schedule)
+	if err != nil {
+		sh.logger.Printf("ERROR: updateSchedule: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update schedule"})
+		return
+	}
+
+	sh.logger.Printf("INFO: updateSchedule: %d", schedule.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": schedule})
+}
+
+func (sh *ScheduleHandler) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := sh.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	err := sh.scheduleStore.DeleteSchedule(schedule.ID)
+	if err != nil {
+		sh.logger.Printf("ERROR: deleteSchedule: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete schedule"})
+		return
+	}
+
+	sh.logger.Printf("INFO: deleteSchedule: %d", schedule.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
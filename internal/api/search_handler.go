@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const maxSearchQueryLength = 200
+
+type SearchHandler struct {
+	searchStore store.SearchStore
+	logger      *log.Logger
+}
+
+func NewSearchHandler(searchStore store.SearchStore, logger *log.Logger) *SearchHandler {
+	return &SearchHandler{searchStore: searchStore, logger: logger}
+}
+
+// readOffset parses the optional offset query parameter.
+func readOffset(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("offset")
+	if v == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(v)
+	if err != nil || offset < 0 {
+		return 0, errors.New("offset must be a non-negative integer")
+	}
+	return offset, nil
+}
+
+// HandleSearch searches the title, description, exercise names and notes
+// of workouts for the words in q, matching each as a prefix so it can back
+// typeahead. Only the user's own workouts are searched unless scope is
+// all, which adds other users' public workouts; tags limits the search to
+// workouts carrying every one of them.
+func (sh *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQueryLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "q is required and must be at most 200 characters"})
+		return
+	}
+	if store.PrefixQuery(q) == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "q must contain at least one word"})
+		return
+	}
+
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = store.SearchScopeMine
+	}
+	if scope != store.SearchScopeMine && scope != store.SearchScopeAll {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "scope must be mine or all"})
+		return
+	}
+
+	tags, err := readTags(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	limit, err := readPageSize(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	offset, err := readOffset(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// One extra result tells whether another page follows.
+	results, err := sh.searchStore.SearchWorkouts(store.SearchFilter{
+		UserID: middleware.GetUser(r).ID,
+		Query:  q,
+		Scope:  scope,
+		Tags:   tags,
+		Limit:  limit + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		sh.logger.Printf("ERROR: searchWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to search"})
+		return
+	}
+
+	var nextOffset *int
+	if len(results) > limit {
+		results = results[:limit]
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"results":     results,
+		"next_offset": nextOffset,
+	}})
+}
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/live"
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	sessionEventState        = "state"
+	sessionEventStarted      = "session_started"
+	sessionEventSetCompleted = "set_completed"
+	sessionEventEntryChanged = "current_entry_changed"
+	sessionEventRestStarted  = "rest_started"
+	sessionEventRestStopped  = "rest_stopped"
+	sessionEventRestFinished = "rest_finished"
+	sessionEventFinished     = "session_finished"
+	sessionKeepAliveInterval = 15 * time.Second
+	maxSessionRestSeconds    = 60 * 60
+)
+
+// SessionHandler runs live workout sessions. Every change is stored and then
+// published to the devices following the session through
+// GET /workouts/{id}/session/events, a Server-Sent Events stream that starts
+// with the current state. Rest timers run on the server, which publishes
+// rest_finished when one runs out.
+type SessionHandler struct {
+	sessionStore store.SessionStore
+	workoutStore store.WorkoutStore
+	hub          *live.Hub
+	logger       *log.Logger
+}
+
+func NewSessionHandler(sessionStore store.SessionStore, workoutStore store.WorkoutStore, hub *live.Hub, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{sessionStore: sessionStore, workoutStore: workoutStore, hub: hub, logger: logger}
+}
+
+type sessionState struct {
+	*store.WorkoutSession
+	RestEndsAt *time.Time `json:"rest_ends_at"`
+}
+
+// newSessionState returns the session with its weights in the units of
+// system, leaving session as it is.
+func newSessionState(session *store.WorkoutSession, system string) sessionState {
+	converted := *session
+	converted.CompletedSets = append([]store.CompletedSet{}, session.CompletedSets...)
+	converted.ConvertUnits(system)
+	return sessionState{WorkoutSession: &converted, RestEndsAt: converted.RestEndsAt()}
+}
+
+// localizeEvent expresses the weights in event in the units of system.
+// Sessions and sets are published as stored, in the units their weights
+// were entered in, so every stream can convert them to its own units.
+func localizeEvent(event live.Event, system string) live.Event {
+	switch data := event.Data.(type) {
+	case *store.WorkoutSession:
+		event.Data = newSessionState(data, system)
+	case store.CompletedSet:
+		data.ConvertUnits(system)
+		event.Data = data
+	}
+	return event
+}
+
+// authorizeWorkout checks that the workout in the URL belongs to the current
+// user and writes the error response if it does not.
+func (sh *SessionHandler) authorizeWorkout(w http.ResponseWriter, r *http.Request) (int, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return 0, false
+	}
+
+	ownerID, err := sh.workoutStore.GetWorkoutOwner(workoutID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+			return 0, false
+		}
+		sh.logger.Printf("ERROR: getWorkoutOwner: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout owner"})
+		return 0, false
+	}
+	// Only the owner follows a session, so other users, who may not know
+	// of the workout, are told it does not exist.
+	if ownerID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return 0, false
+	}
+
+	return workoutID, true
+}
+
+// loadSession authorizes the request and returns the workout's session,
+// writing the error response if there is none.
+func (sh *SessionHandler) loadSession(w http.ResponseWriter, r *http.Request) (*store.WorkoutSession, bool) {
+	workoutID, ok := sh.authorizeWorkout(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	session, err := sh.sessionStore.GetSession(workoutID)
+	if err != nil {
+		sh.logger.Printf("ERROR: getSession: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get session"})
+		return nil, false
+	}
+	if session == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout has no session"})
+		return nil, false
+	}
+
+	return session, true
+}
+
+func (sh *SessionHandler) writeSessionError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, store.ErrSessionFinished):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Session is already finished"})
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Entry is not part of this workout"})
+	default:
+		sh.logger.Printf("ERROR: %s: %s", op, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update session"})
+	}
+}
+
+func (sh *SessionHandler) HandleStartSession(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := sh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	session, err := sh.sessionStore.StartSession(workoutID, currentUser.ID)
+	if errors.Is(err, store.ErrSessionExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "This workout already has a session"})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: startSession: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to start session"})
+		return
+	}
+
+	sh.hub.Publish(session.ID, sessionEventStarted, session)
+
+	sh.logger.Printf("INFO: startSession: %d for workout %d", session.ID, workoutID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": newSessionState(session, system)})
+}
+
+func (sh *SessionHandler) HandleGetSession(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": newSessionState(session, system)})
+}
+
+func (sh *SessionHandler) HandleCompleteSet(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var set store.CompletedSet
+	err = json.NewDecoder(r.Body).Decode(&set)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeCompleteSetBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+	err = set.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	err = sh.sessionStore.CompleteSet(session, &set)
+	if err != nil {
+		sh.writeSessionError(w, "completeSet", err)
+		return
+	}
+
+	sh.hub.Publish(session.ID, sessionEventSetCompleted, set)
+	set.ConvertUnits(system)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": set})
+}
+
+func (sh *SessionHandler) HandleSetCurrentEntry(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EntryID *int `json:"entry_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeSetCurrentEntryBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	err = sh.sessionStore.SetCurrentEntry(session, req.EntryID)
+	if err != nil {
+		sh.writeSessionError(w, "setCurrentEntry", err)
+		return
+	}
+
+	data := utils.Envelope{"current_entry_id": session.CurrentEntryID}
+	sh.hub.Publish(session.ID, sessionEventEntryChanged, data)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": data})
+}
+
+func (sh *SessionHandler) HandleStartRest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Seconds int `json:"seconds"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeStartRestBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+	if req.Seconds < 1 || req.Seconds > maxSessionRestSeconds {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("seconds must be between 1 and %d", maxSessionRestSeconds)})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	err = sh.sessionStore.StartRest(session, req.Seconds)
+	if err != nil {
+		sh.writeSessionError(w, "startRest", err)
+		return
+	}
+
+	data := utils.Envelope{"rest_started_at": session.RestStartedAt, "rest_seconds": session.RestSeconds, "rest_ends_at": session.RestEndsAt()}
+	sh.hub.Publish(session.ID, sessionEventRestStarted, data)
+
+	expired := *session
+	sh.hub.StartTimer(session.ID, time.Until(*session.RestEndsAt()), func() {
+		err := sh.sessionStore.StopRest(&expired)
+		if err != nil {
+			sh.logger.Printf("ERROR: stopRest: %s", err)
+		}
+		sh.hub.Publish(expired.ID, sessionEventRestFinished, utils.Envelope{"rest_seconds": req.Seconds})
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": data})
+}
+
+func (sh *SessionHandler) HandleStopRest(w http.ResponseWriter, r *http.Request) {
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	sh.hub.StopTimer(session.ID)
+
+	err := sh.sessionStore.StopRest(session)
+	if err != nil {
+		sh.writeSessionError(w, "stopRest", err)
+		return
+	}
+
+	sh.hub.Publish(session.ID, sessionEventRestStopped, nil)
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleFinishSession ends the session, sets the workout's duration to the
+// length of the session and estimates its calories again.
+func (sh *SessionHandler) HandleFinishSession(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	sh.hub.StopTimer(session.ID)
+
+	workout, err := sh.sessionStore.FinishSession(session)
+	if err != nil {
+		sh.writeSessionError(w, "finishSession", err)
+		return
+	}
+
+	sh.hub.Publish(session.ID, sessionEventFinished, session)
+	state := newSessionState(session, system)
+
+	workout.ConvertUnits(system)
+
+	sh.logger.Printf("INFO: finishSession: %d for workout %d", session.ID, workout.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"session": state, "workout": workout}})
+}
+
+// HandleSessionEvents streams the session's events until the client goes
+// away or the session finishes.
+func (sh *SessionHandler) HandleSessionEvents(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	session, ok := sh.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	events, unsubscribe := sh.hub.Subscribe(session.ID)
+	defer unsubscribe()
+
+	// Read the state again now that nothing published can be missed.
+	session, err = sh.sessionStore.GetSession(session.WorkoutID)
+	if err != nil || session == nil {
+		sh.logger.Printf("ERROR: getSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get session"})
+		return
+	}
+
+	// Streams outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		sh.logger.Printf("ERROR: setWriteDeadline: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	err = writeStreamEvent(w, rc, live.Event{Type: sessionEventState, Data: newSessionState(session, system), At: time.Now().UTC()})
+	if err != nil || session.Status != store.SessionStatusActive {
+		return
+	}
+
+	keepAlive := time.NewTicker(sessionKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			if err == nil {
+				err = rc.Flush()
+			}
+		case event := <-events:
+			err = writeStreamEvent(w, rc, localizeEvent(event, system))
+			if event.Type == sessionEventFinished {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, rc *http.ResponseController, event live.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	if err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const dateLayout = "2006-01-02"
+
+type StatsHandler struct {
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewStatsHandler(workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *StatsHandler {
+	return &StatsHandler{workoutStore: workoutStore, measurementStore: measurementStore, logger: logger}
+}
+
+// readDateRange parses the optional from and to query parameters as dates.
+// The range includes both days.
+func readDateRange(r *http.Request, loc *time.Location) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation(dateLayout, v, loc)
+		if err != nil {
+			return nil, nil, errors.New("from must be a date in YYYY-MM-DD format")
+		}
+		from = &t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation(dateLayout, v, loc)
+		if err != nil {
+			return nil, nil, errors.New("to must be a date in YYYY-MM-DD format")
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, errors.New("from must not be after to")
+	}
+
+	return from, to, nil
+}
+
+func (sh *StatsHandler) HandleGetSummary(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	from, to, err := readDateRange(r, currentUser.Location())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	tags, err := readTags(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workouts, err := sh.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID, From: from, To: to, Tags: tags})
+	if err != nil {
+		sh.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get stats"})
+		return
+	}
+
+	bodyWeights, err := sh.measurementStore.GetBodyWeightLog(currentUser.ID)
+	if err != nil {
+		sh.logger.Printf("ERROR: getBodyWeightLog: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get stats"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": stats.Summarize(workouts, system, bodyWeights)})
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	syncPageSize     = 500
+	maxSyncPushBatch = 500
+	syncCursorPrefix = "v1:"
+
+	syncOpUpsert = "upsert"
+	syncOpDelete = "delete"
+
+	syncStatusApplied  = "applied"
+	syncStatusConflict = "conflict"
+	syncStatusRejected = "rejected"
+)
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// SyncHandler implements delta sync for offline clients.
+//
+// Pull: GET /sync?since=<cursor> returns every workout created or updated and
+// every deletion (tombstone) after the cursor, oldest first, along with the
+// cursor to send next time. Workouts always carry their full entries and
+// groups, so a changed workout replaces the client's copy wholesale.
+//
+// Push: POST /sync applies a batch of changes keyed by client-generated UUIDs.
+// Conflicts are resolved with "server wins" optimistic concurrency:
+//   - an upsert for an unknown client_id creates the workout;
+//   - an upsert or delete for a known client_id is only applied when its
+//     base_version equals the server's current version, otherwise the change
+//     is reported as a conflict together with the server copy so the client
+//     can rebase its edit and push again;
+//   - an upsert with a base_version for a client_id that has since been
+//     deleted is a conflict reported with its tombstone, so an offline edit
+//     does not bring back a workout another device deleted;
+//   - a delete for an unknown client_id is treated as already applied.
+//
+// Each change is applied in its own transaction and gets its own result.
+type SyncHandler struct {
+	store  store.SyncStore
+	logger *log.Logger
+}
+
+func NewSyncHandler(store store.SyncStore, logger *log.Logger) *SyncHandler {
+	return &SyncHandler{store: store, logger: logger}
+}
+
+type syncChange struct {
+	Op          string         `json:"op"`
+	ClientID    string         `json:"client_id"`
+	BaseVersion int64          `json:"base_version"`
+	Workout     *store.Workout `json:"workout"`
+}
+
+type syncPushRequest struct {
+	Changes []syncChange `json:"changes"`
+}
+
+type syncChangeResult struct {
+	ClientID  string           `json:"client_id"`
+	Status    string           `json:"status"`
+	Workout   *store.Workout   `json:"workout,omitempty"`
+	Tombstone *store.Tombstone `json:"tombstone,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+func encodeSyncCursor(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncCursorPrefix + strconv.FormatInt(version, 10)))
+}
+
+func decodeSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), syncCursorPrefix) {
+		return 0, errors.New("invalid sync cursor")
+	}
+
+	version, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncCursorPrefix), 10, 64)
+	if err != nil || version < 0 {
+		return 0, errors.New("invalid sync cursor")
+	}
+
+	return version, nil
+}
+
+func (sh *SyncHandler) HandleGetChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := decodeSyncCursor(r.URL.Query().Get("since"))
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeSyncCursor: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	changes, err := sh.store.GetChangesSince(currentUser.ID, since, syncPageSize)
+	if err != nil {
+		sh.logger.Printf("ERROR: getChangesSince: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get changes"})
+		return
+	}
+
+	for _, workout := range changes.Workouts {
+		workout.ConvertUnits(system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"data": utils.Envelope{
+			"workouts":   changes.Workouts,
+			"tombstones": changes.Tombstones,
+			"has_more":   changes.HasMore,
+			"cursor":     encodeSyncCursor(changes.Version),
+		},
+	})
+}
+
+func (sh *SyncHandler) HandlePushChanges(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var req syncPushRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeSyncPushRequest: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.Changes) > maxSyncPushBatch {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("at most %d changes can be pushed at once", maxSyncPushBatch)})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	results := make([]syncChangeResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		result := sh.applyChange(currentUser.ID, change)
+		if result.Workout != nil {
+			result.Workout.ConvertUnits(system)
+		}
+		results = append(results, result)
+	}
+
+	sh.logger.Printf("INFO: pushChanges: %d changes for user %d", len(results), currentUser.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": results})
+}
+
+func (sh *SyncHandler) applyChange(userID int, change syncChange) syncChangeResult {
+	result := syncChangeResult{ClientID: change.ClientID}
+
+	if !uuidRegex.MatchString(change.ClientID) {
+		result.Status = syncStatusRejected
+		result.Error = "client_id must be a UUID"
+		return result
+	}
+
+	var err error
+	switch change.Op {
+	case syncOpUpsert:
+		if change.Workout == nil || change.Workout.Title == "" {
+			result.Status = syncStatusRejected
+			result.Error = "workout with a title is required"
+			return result
+		}
+		err = validateWorkout(change.Workout)
+		if err != nil {
+			result.Status = syncStatusRejected
+			result.Error = err.Error()
+			return result
+		}
+		change.Workout.UserID = userID
+		change.Workout.ClientID = &change.ClientID
+		result.Workout, _, err = sh.store.UpsertWorkoutByClientID(change.Workout, change.BaseVersion)
+	case syncOpDelete:
+		_, err = sh.store.DeleteWorkoutByClientID(userID, change.ClientID, change.BaseVersion)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+	default:
+		result.Status = syncStatusRejected
+		result.Error = "op must be upsert or delete"
+		return result
+	}
+
+	var deleted *store.DeletedConflictError
+	if errors.As(err, &deleted) {
+		result.Status = syncStatusConflict
+		result.Tombstone = &deleted.Tombstone
+		return result
+	}
+	if errors.Is(err, store.ErrVersionConflict) {
+		result.Status = syncStatusConflict
+		result.Workout, err = sh.store.GetWorkoutByClientID(userID, change.ClientID)
+		if err != nil {
+			sh.logger.Printf("ERROR: getWorkoutByClientID: %s", err)
+		}
+		return result
+	}
+	if errors.Is(err, store.ErrInvalidCustomField) {
+		result.Status = syncStatusRejected
+		result.Error = err.Error()
+		return result
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: applySyncChange: %s", err)
+		result.Status = syncStatusRejected
+		result.Error = "Failed to apply change"
+		return result
+	}
+
+	result.Status = syncStatusApplied
+	return result
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+type TagHandler struct {
+	tagStore store.TagStore
+	logger   *log.Logger
+}
+
+func NewTagHandler(tagStore store.TagStore, logger *log.Logger) *TagHandler {
+	return &TagHandler{tagStore: tagStore, logger: logger}
+}
+
+// readTags parses the optional comma-separated tags query parameter.
+func readTags(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("tags")
+	if v == "" {
+		return nil, nil
+	}
+	return store.NormalizeTags(strings.Split(v, ","))
+}
+
+func (th *TagHandler) loadTag(w http.ResponseWriter, r *http.Request) (*store.Tag, bool) {
+	tagID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	tag, err := th.tagStore.GetTag(tagID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTag: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get tag"})
+		return nil, false
+	}
+	if tag == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Tag not found"})
+		return nil, false
+	}
+	if tag.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this tag"})
+		return nil, false
+	}
+
+	return tag, true
+}
+
+// HandleListTags returns the user's tags by name with the number of
+// workouts carrying each. Tags are created by adding them to a workout.
+func (th *TagHandler) HandleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.tagStore.ListTags(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Printf("ERROR: listTags: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list tags"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": tags})
+}
+
+func (th *TagHandler) HandleRenameTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("ERROR: decodeRenameTagBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	name, err := store.NormalizeTagName(req.Name)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	tag, ok := th.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	tag.Name = name
+	err = th.tagStore.RenameTag(tag)
+	if errors.Is(err, store.ErrDuplicateTag) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You already have a tag with this name"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: renameTag: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to rename tag"})
+		return
+	}
+
+	th.logger.Printf("INFO: renameTag: %d", tag.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": tag})
+}
+
+func (th *TagHandler) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := th.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := th.tagStore.DeleteTag(tag.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: deleteTag: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete tag"})
+		return
+	}
+
+	th.logger.Printf("INFO: deleteTag: %d", tag.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
@@ -14,7 +14,10 @@ import (
 type TokenHandler struct {
 	store     store.TokenStore
 	userStore store.UserStore
-	logger    *log.Logger
+	// maxSessions caps the authentication tokens a user holds at once;
+	// zero leaves them uncapped.
+	maxSessions int
+	logger      *log.Logger
 }
 
 type createTokenRequest struct {
@@ -22,8 +25,8 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(store store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
-	return &TokenHandler{store: store, userStore: userStore, logger: logger}
+func NewTokenHandler(store store.TokenStore, userStore store.UserStore, maxSessions int, logger *log.Logger) *TokenHandler {
+	return &TokenHandler{store: store, userStore: userStore, maxSessions: maxSessions, logger: logger}
 }
 
 func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
@@ -54,13 +57,35 @@ func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	token, err := th.store.CreateToken(user.ID, 24*time.Hour, tokens.ScopeAuthentication)
+	var token *tokens.Token
+	var evicted int64
+	if th.maxSessions > 0 {
+		token, evicted, err = th.store.CreateCappedToken(user.ID, 24*time.Hour, tokens.ScopeAuthentication, th.maxSessions)
+	} else {
+		token, err = th.store.CreateToken(user.ID, 24*time.Hour, tokens.ScopeAuthentication)
+	}
 	if err != nil {
 		th.logger.Printf("ERROR: createToken: %s", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create token"})
 		return
 	}
+	if evicted > 0 {
+		th.logger.Printf("INFO: evictSessions: %d for user %d", evicted, user.ID)
+	}
 
 	th.logger.Printf("INFO: createToken: %s", token.Plaintext)
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"token": token})
 }
+
+// HandleGetTokenStats returns how many tokens of each scope are active and
+// how many expired ones wait for cleanup.
+func (th *TokenHandler) HandleGetTokenStats(w http.ResponseWriter, r *http.Request) {
+	counts, err := th.store.CountTokens()
+	if err != nil {
+		th.logger.Printf("ERROR: countTokens: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get token stats"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": counts})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/trainingload"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+// maxTrainingLoadDays caps the days a single request computes.
+const maxTrainingLoadDays = 366
+
+type TrainingLoadHandler struct {
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewTrainingLoadHandler(workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *TrainingLoadHandler {
+	return &TrainingLoadHandler{workoutStore: workoutStore, measurementStore: measurementStore, logger: logger}
+}
+
+// readBand parses the optional acwr_low and acwr_high query parameters.
+func readBand(r *http.Request) (trainingload.Band, error) {
+	band := trainingload.Band{Low: trainingload.DefaultBandLow, High: trainingload.DefaultBandHigh}
+	if v := r.URL.Query().Get("acwr_low"); v != "" {
+		low, err := strconv.ParseFloat(v, 64)
+		if err != nil || low < 0 {
+			return band, errors.New("acwr_low must be a non-negative number")
+		}
+		band.Low = low
+	}
+	if v := r.URL.Query().Get("acwr_high"); v != "" {
+		high, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return band, errors.New("acwr_high must be a number")
+		}
+		band.High = high
+	}
+	if band.High <= band.Low {
+		return band, errors.New("acwr_high must be above acwr_low")
+	}
+	return band, nil
+}
+
+// HandleGetTrainingLoad returns the load of every workout and the daily
+// acute and chronic load, ACWR, monotony and strain between the optional
+// from and to dates, the last 28 days by default. Days with an ACWR
+// outside the acwr_low to acwr_high band are flagged.
+func (th *TrainingLoadHandler) HandleGetTrainingLoad(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+
+	from, to, err := readDateRange(r, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	band, err := readBand(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// to is exclusive; the series runs up to and including the day before.
+	lastDay := time.Now().In(loc)
+	if to != nil {
+		lastDay = to.AddDate(0, 0, -1)
+	}
+	firstDay := lastDay.AddDate(0, 0, -(trainingload.ChronicDays - 1))
+	if from != nil {
+		firstDay = *from
+	}
+	if !firstDay.Before(lastDay.AddDate(0, 0, 1)) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must not be after to"})
+		return
+	}
+	if lastDay.Sub(firstDay) > maxTrainingLoadDays*24*time.Hour {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "the range can span at most 366 days"})
+		return
+	}
+
+	historyStart := trainingload.HistoryStart(firstDay, loc)
+	rangeStart := time.Date(firstDay.Year(), firstDay.Month(), firstDay.Day(), 0, 0, 0, 0, loc)
+	historyEnd := time.Date(lastDay.Year(), lastDay.Month(), lastDay.Day()+1, 0, 0, 0, 0, loc)
+	workouts, err := th.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID, From: &historyStart, To: &historyEnd})
+	if err != nil {
+		th.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get training load"})
+		return
+	}
+	bodyWeights, err := th.measurementStore.GetBodyWeightLog(currentUser.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: getBodyWeightLog: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get training load"})
+		return
+	}
+
+	// Workouts before the range only feed the rolling metrics.
+	sessions := make([]trainingload.SessionLoad, 0, len(workouts))
+	inRange := []trainingload.SessionLoad{}
+	for _, workout := range workouts {
+		session := trainingload.Session(workout, bodyWeights)
+		sessions = append(sessions, session)
+		if !workout.PerformedAt.Before(rangeStart) {
+			inRange = append(inRange, session)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"band":     band,
+		"days":     trainingload.Series(sessions, firstDay, lastDay, band, loc),
+		"sessions": inRange,
+	}})
+}
@@ -6,8 +6,11 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
 	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
 	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
 )
 
@@ -16,6 +19,16 @@ type registerRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Bio      string `json:"bio"`
+	Units    string `json:"units"`
+	Timezone string `json:"timezone"`
+}
+
+// updatePreferencesRequest takes body_weight in the units being set, or the
+// current ones when units is not sent.
+type updatePreferencesRequest struct {
+	Units      *string  `json:"units"`
+	BodyWeight *float64 `json:"body_weight"`
+	Timezone   *string  `json:"timezone"`
 }
 
 type UserHandler struct {
@@ -41,9 +54,27 @@ func (uh *UserHandler) validateRegisterRequest(req *registerRequest) error {
 		return errors.New("invalid email address")
 	}
 
+	if req.Units != "" && !units.ValidSystem(req.Units) {
+		return errors.New("units must be metric or imperial")
+	}
+
+	if req.Timezone != "" && !validTimezone(req.Timezone) {
+		return errors.New("timezone must be an IANA time zone such as Europe/Budapest")
+	}
+
 	return nil
 }
 
+// validTimezone reports whether name is a loadable IANA time zone. The
+// server's own "Local" zone is not one a user can choose.
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
 func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req registerRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -63,6 +94,8 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 	user := &store.User{
 		Username: req.Username,
 		Email:    req.Email,
+		Units:    req.Units,
+		Timezone: req.Timezone,
 	}
 
 	if req.Bio != "" {
@@ -86,3 +119,66 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 	uh.logger.Printf("INFO: user created: %s", user.Username)
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "User created successfully"})
 }
+
+// readUnits returns the unit system responses are shown in: the "units"
+// query parameter when given, else the user's preference.
+func readUnits(r *http.Request) (string, error) {
+	fallback := middleware.GetUser(r).Units
+	if !units.ValidSystem(fallback) {
+		fallback = units.SystemMetric
+	}
+	return units.ParseSystem(r.URL.Query().Get("units"), fallback)
+}
+
+func (uh *UserHandler) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": middleware.GetUser(r)})
+}
+
+func (uh *UserHandler) HandleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req updatePreferencesRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.logger.Printf("ERROR: decodeUpdatePreferencesRequest: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if req.Units != nil {
+		if !units.ValidSystem(*req.Units) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "units must be metric or imperial"})
+			return
+		}
+		currentUser.Units = *req.Units
+	}
+
+	if req.Timezone != nil {
+		if !validTimezone(*req.Timezone) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "timezone must be an IANA time zone such as Europe/Budapest"})
+			return
+		}
+		currentUser.Timezone = *req.Timezone
+	}
+
+	bodyWeight := currentUser.BodyWeightKilograms()
+	if req.BodyWeight != nil {
+		if *req.BodyWeight <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body_weight must be positive"})
+			return
+		}
+		kilograms := units.Round(units.ToKilograms(*req.BodyWeight, units.WeightUnit(currentUser.Units)), units.CanonicalWeightPlaces)
+		bodyWeight = &kilograms
+	}
+	currentUser.SetBodyWeight(bodyWeight)
+
+	err = uh.userStore.UpdateUserPreferences(currentUser)
+	if err != nil {
+		uh.logger.Printf("ERROR: updateUserPreferences: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update preferences"})
+		return
+	}
+
+	uh.logger.Printf("INFO: updatePreferences: %d", currentUser.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": currentUser})
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+	"github.com/andras-szesztai/fem_fitness_project/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxWebhookDescriptionLength = 255
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	logger       *log.Logger
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{webhookStore: webhookStore, logger: logger}
+}
+
+// webhookWithSecret shows the signing secret, which is only returned when
+// it is created.
+type webhookWithSecret struct {
+	*store.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+func validateWebhook(ctx context.Context, subscription *store.WebhookSubscription) error {
+	err := webhooks.ValidateURL(ctx, subscription.URL)
+	if err != nil {
+		return err
+	}
+	if len(subscription.Events) == 0 {
+		return errors.New("events must name at least one event")
+	}
+	seen := map[string]bool{}
+	events := make([]string, 0, len(subscription.Events))
+	for _, event := range subscription.Events {
+		if !webhooks.ValidEvent(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	subscription.Events = events
+	if len(subscription.Description) > maxWebhookDescriptionLength {
+		return errors.New("description must be at most 255 characters")
+	}
+	return nil
+}
+
+func (wh *WebhookHandler) loadWebhook(w http.ResponseWriter, r *http.Request) (*store.WebhookSubscription, bool) {
+	subscriptionID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	subscription, err := wh.webhookStore.GetSubscription(subscriptionID)
+	if err != nil {
+		wh.logger.Printf("ERROR: getWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get webhook"})
+		return nil, false
+	}
+	if subscription == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Webhook not found"})
+		return nil, false
+	}
+	if subscription.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this webhook"})
+		return nil, false
+	}
+
+	return subscription, true
+}
+
+func (wh *WebhookHandler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := wh.webhookStore.ListSubscriptions(middleware.GetUser(r).ID)
+	if err != nil {
+		wh.logger.Printf("ERROR: listWebhooks: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list webhooks"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": subscriptions})
+}
+
+// HandleCreateWebhook subscribes url to events. The response carries the
+// secret deliveries are signed with; it is not shown again.
+func (wh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodeCreateWebhookBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	subscription := &store.WebhookSubscription{
+		UserID:      middleware.GetUser(r).ID,
+		URL:         req.URL,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      true,
+	}
+	err = validateWebhook(r.Context(), subscription)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	subscription.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		wh.logger.Printf("ERROR: newWebhookSecret: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create webhook"})
+		return
+	}
+	err = wh.webhookStore.CreateSubscription(subscription)
+	if err != nil {
+		wh.logger.Printf("ERROR: createWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create webhook"})
+		return
+	}
+
+	wh.logger.Printf("INFO: createWebhook: %d", subscription.ID)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": webhookWithSecret{subscription, subscription.Secret}})
+}
+
+func (wh *WebhookHandler) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": subscription})
+}
+
+func (wh *WebhookHandler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL         *string  `json:"url"`
+		Events      []string `json:"events"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodeUpdateWebhookBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.Events != nil {
+		subscription.Events = req.Events
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	err = validateWebhook(r.Context(), subscription)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = wh.webhookStore.UpdateSubscription(subscription)
+	if err != nil {
+		wh.logger.Printf("ERROR: updateWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update webhook"})
+		return
+	}
+
+	wh.logger.Printf("INFO: updateWebhook: %d", subscription.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": subscription})
+}
+
+// HandleRotateWebhookSecret replaces the signing secret and returns the new
+// one. Deliveries sent from now on are signed with it.
+func (wh *WebhookHandler) HandleRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		wh.logger.Printf("ERROR: newWebhookSecret: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to rotate webhook secret"})
+		return
+	}
+	subscription.Secret = secret
+	err = wh.webhookStore.UpdateSubscription(subscription)
+	if err != nil {
+		wh.logger.Printf("ERROR: updateWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	wh.logger.Printf("INFO: rotateWebhookSecret: %d", subscription.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": webhookWithSecret{subscription, secret}})
+}
+
+func (wh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := wh.webhookStore.DeleteSubscription(subscription.ID)
+	if err != nil {
+		wh.logger.Printf("ERROR: deleteWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete webhook"})
+		return
+	}
+
+	wh.logger.Printf("INFO: deleteWebhook: %d", subscription.ID)
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
+}
+
+// HandleListDeliveries returns the webhook's delivery log, newest first.
+func (wh *WebhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := readPageSize(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	offset, err := readOffset(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := wh.webhookStore.ListDeliveries(subscription.ID, limit+1, offset)
+	if err != nil {
+		wh.logger.Printf("ERROR: listWebhookDeliveries: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list deliveries"})
+		return
+	}
+
+	var nextOffset *int
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{
+		"deliveries":  deliveries,
+		"next_offset": nextOffset,
+	}})
+}
+
+// HandleRedeliver queues a logged delivery to be sent again.
+func (wh *WebhookHandler) HandleRedeliver(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryID"))
+	if err != nil || deliveryID < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid delivery id"})
+		return
+	}
+
+	subscription, ok := wh.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := wh.webhookStore.GetDelivery(deliveryID)
+	if err != nil {
+		wh.logger.Printf("ERROR: getWebhookDelivery: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to redeliver"})
+		return
+	}
+	if delivery == nil || delivery.SubscriptionID != subscription.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Delivery not found"})
+		return
+	}
+
+	redelivery, err := wh.webhookStore.Redeliver(delivery)
+	if err != nil {
+		wh.logger.Printf("ERROR: redeliverWebhook: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to redeliver"})
+		return
+	}
+
+	wh.logger.Printf("INFO: redeliverWebhook: %d as %d", delivery.ID, redelivery.ID)
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": redelivery})
+}
@@ -3,14 +3,24 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
 	"github.com/andras-szesztai/fem_fitness_project/internal/store"
 	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
 )
 
+const maxBatchOperations = 1000
+
+const (
+	batchModeAtomic  = "atomic"
+	batchModePartial = "partial"
+)
+
 type WorkoutHandler struct {
 	store  store.WorkoutStore
 	logger *log.Logger
@@ -28,6 +38,12 @@ func (wh *WorkoutHandler) HandleGetWorkout(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	workout, err := wh.store.GetWorkout(workoutID)
 	if err != nil {
 		wh.logger.Printf("ERROR: getWorkout: %s", err)
@@ -35,20 +51,63 @@ func (wh *WorkoutHandler) HandleGetWorkout(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if workout == nil {
+	if workout == nil || !visibleTo(workout, middleware.GetUser(r)) {
 		wh.logger.Printf("ERROR: getWorkout: %s", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
 		return
 	}
 
+	workout.ConvertUnits(system)
+
 	wh.logger.Printf("INFO: getWorkout: %d", workoutID)
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workout})
 
 }
 
+// HandleListWorkouts returns the user's workouts, oldest first, optionally
+// limited to the from and to dates and to those carrying every tag in tags.
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	from, to, err := readDateRange(r, currentUser.Location())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	tags, err := readTags(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workouts, err := wh.store.ListWorkouts(store.WorkoutFilter{UserID: currentUser.ID, From: from, To: to, Tags: tags})
+	if err != nil {
+		wh.logger.Printf("ERROR: listWorkouts: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list workouts"})
+		return
+	}
+
+	for _, workout := range workouts {
+		workout.ConvertUnits(system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workouts})
+}
+
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
+	system, err := readUnits(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	var workout store.Workout
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	err = json.NewDecoder(r.Body).Decode(&workout)
 	if err != nil {
 		wh.logger.Printf("ERROR: decodeCreateWorkoutBody: %s", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
@@ -62,19 +121,44 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if workout.ClientID != nil && !uuidRegex.MatchString(*workout.ClientID) {
+		wh.logger.Printf("ERROR: validateClientID: %s", *workout.ClientID)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "client_id must be a UUID"})
+		return
+	}
+
+	err = validateWorkout(&workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: validateWorkout: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	workout.UserID = currentUser.ID
 
 	createdWorkout, err := wh.store.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrInvalidCustomField) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("ERROR: createWorkout: %s", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create workout"})
 		return
 	}
 
+	createdWorkout.ConvertUnits(system)
+
 	wh.logger.Printf("INFO: createWorkout: %d", createdWorkout.ID)
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdWorkout})
 }
 
+// visibleTo reports whether user may see workout. Private workouts are
+// hidden from everyone but their owner, so to others they are not found.
+func visibleTo(workout *store.Workout, user *store.User) bool {
+	return workout.Visibility != store.VisibilityPrivate || workout.UserID == user.ID
+}
+
 func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -83,24 +167,39 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	currentUser := middleware.GetUser(r)
+	if currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "You must be logged in to update a workout"})
+		return
+	}
+
 	existingWorkout, err := wh.store.GetWorkout(workoutID)
 	if err != nil {
 		wh.logger.Printf("ERROR: getWorkout: %s", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout"})
 		return
 	}
-	if existingWorkout == nil {
-		wh.logger.Printf("ERROR: getWorkout: %s", err)
+	if existingWorkout == nil || !visibleTo(existingWorkout, currentUser) {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
 		return
 	}
+	if existingWorkout.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this workout"})
+		return
+	}
 
 	var updatedWorkoutRequest struct {
-		Title           *string              `json:"title"`
-		Description     *string              `json:"description"`
-		DurationMinutes *int                 `json:"duration_minutes"`
-		CaloriesBurned  *int                 `json:"calories_burned"`
-		Entries         []store.WorkoutEntry `json:"entries"`
+		Title           *string                   `json:"title"`
+		Description     *string                   `json:"description"`
+		DurationMinutes *int                      `json:"duration_minutes"`
+		CaloriesBurned  *int                      `json:"calories_burned"`
+		PerformedAt     *time.Time                `json:"performed_at"`
+		RPE             *float64                  `json:"rpe"`
+		Visibility      *string                   `json:"visibility"`
+		Tags            []string                  `json:"tags"`
+		CustomFields    []store.WorkoutFieldValue `json:"custom_fields"`
+		Entries         []store.WorkoutEntry      `json:"entries"`
+		Groups          []store.WorkoutEntryGroup `json:"groups"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updatedWorkoutRequest)
@@ -120,32 +219,59 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		existingWorkout.DurationMinutes = *updatedWorkoutRequest.DurationMinutes
 	}
 	if updatedWorkoutRequest.CaloriesBurned != nil {
-		existingWorkout.CaloriesBurned = *updatedWorkoutRequest.CaloriesBurned
+		// Sending back the estimate unchanged keeps it an estimate; any
+		// other value is the user's own, and 0 asks for a new estimate.
+		calories := *updatedWorkoutRequest.CaloriesBurned
+		existingWorkout.CaloriesEstimated = existingWorkout.CaloriesEstimated && calories == existingWorkout.CaloriesBurned
+		existingWorkout.CaloriesBurned = calories
 	}
-	if updatedWorkoutRequest.Entries != nil {
-		existingWorkout.Entries = updatedWorkoutRequest.Entries
+	if updatedWorkoutRequest.PerformedAt != nil {
+		existingWorkout.PerformedAt = *updatedWorkoutRequest.PerformedAt
 	}
-
-	currentUser := middleware.GetUser(r)
-	if currentUser.IsAnonymous() {
-		wh.logger.Printf("ERROR: getUser: %s", err)
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "You must be logged in to update a workout"})
-		return
+	if updatedWorkoutRequest.RPE != nil {
+		if !validRPE(*updatedWorkoutRequest.RPE) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "rpe must be between 1 and 10"})
+			return
+		}
+		existingWorkout.RPE = updatedWorkoutRequest.RPE
 	}
-
-	ownerID, err := wh.store.GetWorkoutOwner(workoutID)
+	if updatedWorkoutRequest.Visibility != nil {
+		if !store.ValidVisibility(*updatedWorkoutRequest.Visibility) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be public or private"})
+			return
+		}
+		existingWorkout.Visibility = *updatedWorkoutRequest.Visibility
+	}
+	// Tags and custom fields are each replaced as a whole.
+	if updatedWorkoutRequest.Tags != nil {
+		existingWorkout.Tags = updatedWorkoutRequest.Tags
+	}
+	if updatedWorkoutRequest.CustomFields != nil {
+		existingWorkout.CustomFields = updatedWorkoutRequest.CustomFields
+	}
+	err = validateWorkoutLabels(existingWorkout)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %s", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout owner"})
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
-	if ownerID != currentUser.ID {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %s", err)
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this workout"})
-		return
+	// Entries and groups together make up the workout's content; sending
+	// either replaces both.
+	if updatedWorkoutRequest.Entries != nil || updatedWorkoutRequest.Groups != nil {
+		err = validateWorkoutContent(updatedWorkoutRequest.Entries, updatedWorkoutRequest.Groups)
+		if err != nil {
+			wh.logger.Printf("ERROR: validateWorkoutContent: %s", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		existingWorkout.Entries = updatedWorkoutRequest.Entries
+		existingWorkout.Groups = updatedWorkoutRequest.Groups
 	}
 
 	err = wh.store.UpdateWorkout(existingWorkout)
+	if errors.Is(err, store.ErrInvalidCustomField) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("ERROR: updateWorkout: %s", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update workout"})
@@ -171,14 +297,17 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	ownerID, err := wh.store.GetWorkoutOwner(workoutID)
+	workout, err := wh.store.GetWorkout(workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %s", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout owner"})
+		wh.logger.Printf("ERROR: getWorkout: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to get workout"})
 		return
 	}
-	if ownerID != currentUser.ID {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %s", err)
+	if workout == nil || !visibleTo(workout, currentUser) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+	if workout.UserID != currentUser.ID {
 		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this workout"})
 		return
 	}
@@ -198,3 +327,178 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 	wh.logger.Printf("INFO: deleteWorkout: %d", workoutID)
 	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{})
 }
+
+type workoutBatchRequest struct {
+	Mode       string                 `json:"mode"`
+	Operations []store.WorkoutBatchOp `json:"operations"`
+}
+
+type workoutBatchItemResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// validateWorkout checks a workout sent for creation or as a whole
+// replacement; an empty visibility leaves it as it is.
+func validateWorkout(workout *store.Workout) error {
+	if workout.Visibility != "" && !store.ValidVisibility(workout.Visibility) {
+		return errors.New("visibility must be public or private")
+	}
+	if workout.RPE != nil && !validRPE(*workout.RPE) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+	err := validateWorkoutLabels(workout)
+	if err != nil {
+		return err
+	}
+	return validateWorkoutContent(workout.Entries, workout.Groups)
+}
+
+// validateWorkoutLabels normalizes the workout's tags and checks that each
+// custom field is given once. Values are checked against their field when
+// the workout is saved.
+func validateWorkoutLabels(workout *store.Workout) error {
+	if workout.Tags != nil {
+		tags, err := store.NormalizeTags(workout.Tags)
+		if err != nil {
+			return err
+		}
+		workout.Tags = tags
+	}
+
+	seen := map[int]bool{}
+	for i, value := range workout.CustomFields {
+		if value.FieldID <= 0 {
+			return fmt.Errorf("custom_fields[%d]: field_id is required", i)
+		}
+		if seen[value.FieldID] {
+			return fmt.Errorf("custom_fields[%d]: field %d is given twice", i, value.FieldID)
+		}
+		seen[value.FieldID] = true
+	}
+	return nil
+}
+
+func validRPE(rpe float64) bool {
+	return rpe >= 1 && rpe <= 10
+}
+
+func validateWorkoutContent(entries []store.WorkoutEntry, groups []store.WorkoutEntryGroup) error {
+	for i := range entries {
+		entries[i].Normalize()
+		err := entries[i].Validate()
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+	for i := range groups {
+		groups[i].Normalize()
+		err := groups[i].Validate()
+		if err != nil {
+			return fmt.Errorf("groups[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateWorkoutBatchOp(op store.WorkoutBatchOp) error {
+	switch op.Op {
+	case store.BatchOpCreate:
+		if op.Workout == nil {
+			return errors.New("workout is required for create")
+		}
+		return validateWorkout(op.Workout)
+	case store.BatchOpUpdate:
+		if op.ID <= 0 || op.Workout == nil {
+			return errors.New("id and workout are required for update")
+		}
+		return validateWorkout(op.Workout)
+	case store.BatchOpDelete:
+		if op.ID <= 0 {
+			return errors.New("id is required for delete")
+		}
+	default:
+		return errors.New("op must be create, update or delete")
+	}
+	return nil
+}
+
+func batchItemResult(index int, op store.WorkoutBatchOp, result store.WorkoutBatchResult) workoutBatchItemResult {
+	item := workoutBatchItemResult{Index: index, Op: op.Op, ID: result.ID}
+
+	switch {
+	case result.Err == nil && op.Op == store.BatchOpCreate:
+		item.Status = http.StatusCreated
+	case result.Err == nil && op.Op == store.BatchOpDelete:
+		item.Status = http.StatusNoContent
+	case result.Err == nil:
+		item.Status = http.StatusOK
+	case errors.Is(result.Err, sql.ErrNoRows):
+		item.Status, item.Error = http.StatusNotFound, "Workout not found"
+	case errors.Is(result.Err, store.ErrNotOwner):
+		item.Status, item.Error = http.StatusForbidden, "You are not the owner of this workout"
+	case errors.Is(result.Err, store.ErrInvalidCustomField):
+		item.Status, item.Error = http.StatusUnprocessableEntity, result.Err.Error()
+	case errors.Is(result.Err, store.ErrBatchAborted):
+		item.Status, item.Error = http.StatusFailedDependency, "Not applied because another operation failed"
+	case store.IsConstraintViolation(result.Err):
+		item.Status, item.Error = http.StatusUnprocessableEntity, "Invalid workout"
+	default:
+		item.Status, item.Error = http.StatusInternalServerError, "Failed to apply operation"
+	}
+
+	return item
+}
+
+// HandleWorkoutBatch applies up to maxBatchOperations creates, full-replacement
+// updates and deletes. Mode "atomic" (the default) applies all or nothing;
+// mode "partial" applies every operation that succeeds on its own.
+func (wh *WorkoutHandler) HandleWorkoutBatch(w http.ResponseWriter, r *http.Request) {
+	var req workoutBatchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodeWorkoutBatchBody: %s", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = batchModeAtomic
+	}
+	if req.Mode != batchModeAtomic && req.Mode != batchModePartial {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mode must be atomic or partial"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("operations must contain between 1 and %d items", maxBatchOperations)})
+		return
+	}
+
+	for i, op := range req.Operations {
+		err = validateWorkoutBatchOp(op)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("operations[%d]: %s", i, err)})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	results, err := wh.store.ApplyWorkoutBatch(currentUser.ID, req.Operations, req.Mode == batchModeAtomic)
+	if err != nil {
+		wh.logger.Printf("ERROR: applyWorkoutBatch: %s", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to apply batch"})
+		return
+	}
+
+	items := make([]workoutBatchItemResult, len(results))
+	for i, result := range results {
+		items[i] = batchItemResult(i, req.Operations[i], result)
+	}
+
+	wh.logger.Printf("INFO: workoutBatch: %d operations for user %d", len(items), currentUser.ID)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": items})
+}
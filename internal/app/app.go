@@ -5,24 +5,98 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
+	"github.com/andras-szesztai/fem_fitness_project/internal/achievements"
 	"github.com/andras-szesztai/fem_fitness_project/internal/api"
+	"github.com/andras-szesztai/fem_fitness_project/internal/challenges"
+	"github.com/andras-szesztai/fem_fitness_project/internal/goals"
+	"github.com/andras-szesztai/fem_fitness_project/internal/hooks"
+	"github.com/andras-szesztai/fem_fitness_project/internal/housekeeping"
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/live"
 	"github.com/andras-szesztai/fem_fitness_project/internal/middleware"
+	"github.com/andras-szesztai/fem_fitness_project/internal/notifications"
+	"github.com/andras-szesztai/fem_fitness_project/internal/outbox"
+	"github.com/andras-szesztai/fem_fitness_project/internal/records"
+	"github.com/andras-szesztai/fem_fitness_project/internal/reminders"
 	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/webhooks"
 	"github.com/andras-szesztai/fem_fitness_project/migrations"
 )
 
+type Config struct {
+	// PublicURL is the address clients reach the API at, such as
+	// https://fitness.example.com. Links handed out to clients are built
+	// from it rather than from request headers.
+	PublicURL      string
+	IdempotencyTTL time.Duration
+	// ReminderInterval is how often schedules are checked for reminders.
+	ReminderInterval time.Duration
+	// SMTPAddr is the host:port of the relay reminder email goes through;
+	// without one, email is written to the log.
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	// WebhookInterval is how often the webhook queue is checked for due
+	// deliveries.
+	WebhookInterval time.Duration
+	// OutboxInterval is how often pending domain events are dispatched to
+	// their subscribers.
+	OutboxInterval time.Duration
+	// JobWorkers is how many background jobs run at once; without any,
+	// jobs wait for another process to run them.
+	JobWorkers int
+	// JobPollInterval is how long an idle worker waits before looking for
+	// due jobs again.
+	JobPollInterval time.Duration
+	// TokenCleanupInterval is how often expired tokens are deleted.
+	TokenCleanupInterval time.Duration
+	// MaxSessions caps how many sessions a user has at once; logging in
+	// again ends the oldest. Zero leaves sessions uncapped.
+	MaxSessions int
+}
+
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	Middleware     *middleware.UserMiddleware
-	TokenHandler   *api.TokenHandler
-	DB             *sql.DB
+	Logger                *log.Logger
+	WorkoutHandler        *api.WorkoutHandler
+	UserHandler           *api.UserHandler
+	Middleware            *middleware.UserMiddleware
+	IdempotencyMiddleware *middleware.IdempotencyMiddleware
+	TokenHandler          *api.TokenHandler
+	SyncHandler           *api.SyncHandler
+	CSVHandler            *api.CSVHandler
+	ActivityHandler       *api.ActivityHandler
+	StatsHandler          *api.StatsHandler
+	SessionHandler        *api.SessionHandler
+	METHandler            *api.METHandler
+	MeasurementHandler    *api.MeasurementHandler
+	GoalHandler           *api.GoalHandler
+	AchievementHandler    *api.AchievementHandler
+	ChallengeHandler      *api.ChallengeHandler
+	ProgressionHandler    *api.ProgressionHandler
+	TrainingLoadHandler   *api.TrainingLoadHandler
+	SearchHandler         *api.SearchHandler
+	TagHandler            *api.TagHandler
+	CustomFieldHandler    *api.CustomFieldHandler
+	ScheduleHandler       *api.ScheduleHandler
+	CalendarHandler       *api.CalendarHandler
+	ReminderHandler       *api.ReminderHandler
+	NotificationHandler   *api.NotificationHandler
+	WebhookHandler        *api.WebhookHandler
+	JobHandler            *api.JobHandler
+	DB                    *sql.DB
 }
 
-func NewApplication() (*Application, error) {
+func NewApplication(cfg Config) (*Application, error) {
+	publicURL, err := url.Parse(cfg.PublicURL)
+	if err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+		return nil, fmt.Errorf("app: public URL %q must be an absolute http or https URL", cfg.PublicURL)
+	}
+
 	pgDB, err := store.Open()
 	if err != nil {
 		return nil, fmt.Errorf("app: new %w", err)
@@ -35,24 +109,161 @@ func NewApplication() (*Application, error) {
 
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
+	outboxStore := store.NewPostgresOutboxStore(pgDB)
+	eventDispatcher := outbox.NewDispatcher(outboxStore, logger)
+	workoutHooks := hooks.NewRegistry(eventDispatcher)
+
+	jobStore := store.NewPostgresJobStore(pgDB)
+	jobQueue := jobs.NewQueue(jobStore, logger)
+	jobHandler := api.NewJobHandler(jobStore, logger)
+
+	notificationStore := store.NewPostgresNotificationStore(pgDB)
+	notificationCenter := notifications.NewCenter(notificationStore, logger)
+	notificationHandler := api.NewNotificationHandler(notificationStore, notificationCenter, logger)
+
+	measurementStore := store.NewPostgresMeasurementStore(pgDB)
+	measurementHandler := api.NewMeasurementHandler(measurementStore, logger)
+
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	csvHandler := api.NewCSVHandler(workoutStore, logger)
+	statsHandler := api.NewStatsHandler(workoutStore, measurementStore, logger)
+	trainingLoadHandler := api.NewTrainingLoadHandler(workoutStore, measurementStore, logger)
+
+	activityStore := store.NewPostgresActivityStore(pgDB)
+	activityHandler := api.NewActivityHandler(activityStore, workoutStore, logger)
+
+	sessionStore := store.NewPostgresSessionStore(pgDB)
+	sessionHandler := api.NewSessionHandler(sessionStore, workoutStore, live.NewHub(), logger)
+
+	metStore := store.NewPostgresMETStore(pgDB)
+	metHandler := api.NewMETHandler(metStore, logger)
 
 	userStore := store.NewPostgresUserStore(pgDB)
 	userHandler := api.NewUserHandler(userStore, logger)
 
+	recordWatcher := records.NewWatcher(workoutStore, outboxStore)
+	workoutHooks.OnWorkoutSaved("records", recordWatcher.WorkoutSaved)
+	recordNotifier := notifications.NewRecordNotifier(notificationCenter, userStore)
+	workoutHooks.OnRecordAchieved("notifications", recordNotifier.RecordAchieved)
+
+	webhookStore := store.NewPostgresWebhookStore(pgDB)
+	webhookHandler := api.NewWebhookHandler(webhookStore, logger)
+	webhookDispatcher := webhooks.NewDispatcher(webhookStore, webhooks.NewClient(10*time.Second), logger)
+	eventDispatcher.Subscribe("webhooks", webhookDispatcher.EventOccurred, webhooks.SourceEvents()...)
+	if cfg.WebhookInterval > 0 {
+		go webhookDispatcher.Run(cfg.WebhookInterval)
+	}
+
 	tokenStore := store.NewPostgresTokenStore(pgDB)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, cfg.MaxSessions, logger)
+	tokenCleaner := housekeeping.NewTokenCleaner(tokenStore, logger)
+	jobs.Handle(jobQueue, housekeeping.CleanupTokensJob, tokenCleaner.CleanupTokens)
+	if cfg.TokenCleanupInterval > 0 {
+		jobs.Every(jobQueue, housekeeping.CleanupTokensJob, struct{}{}, cfg.TokenCleanupInterval)
+	}
+
+	idempotencyStore := store.NewPostgresIdempotencyStore(pgDB)
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(idempotencyStore, cfg.IdempotencyTTL, logger)
+	idempotencyCleaner := housekeeping.NewIdempotencyCleaner(idempotencyStore, logger)
+	jobs.Handle(jobQueue, housekeeping.CleanupIdempotencyKeysJob, idempotencyCleaner.CleanupIdempotencyKeys)
+	if cfg.IdempotencyTTL > 0 {
+		jobs.Every(jobQueue, housekeeping.CleanupIdempotencyKeysJob, struct{}{}, housekeeping.IdempotencyCleanupInterval(cfg.IdempotencyTTL))
+	}
+
+	syncStore := store.NewPostgresSyncStore(pgDB)
+	syncHandler := api.NewSyncHandler(syncStore, logger)
+
+	goalStore := store.NewPostgresGoalStore(pgDB)
+	goalHandler := api.NewGoalHandler(goalStore, workoutStore, measurementStore, logger)
+	goalTracker := goals.NewTracker(goalStore, workoutStore, measurementStore, userStore, notificationCenter, logger)
+	workoutHooks.OnWorkoutSaved("goals", goalTracker.WorkoutSaved)
+	workoutHooks.OnMeasurementSaved("goals", goalTracker.MeasurementSaved)
+
+	achievementStore := store.NewPostgresAchievementStore(pgDB)
+	achievementHandler := api.NewAchievementHandler(achievementStore, workoutStore, measurementStore, logger)
+	achievementEngine := achievements.NewEngine(achievementStore, workoutStore, measurementStore, userStore, notificationCenter, logger)
+	workoutHooks.OnWorkoutSaved("achievements", achievementEngine.WorkoutSaved)
+	jobs.Handle(jobQueue, achievements.BackfillJob, achievementEngine.RunBackfill)
+	_, err = jobs.Enqueue(jobQueue, achievements.BackfillJob, struct{}{}, jobs.Options{UniqueKey: "backfill"})
+	if err != nil {
+		logger.Printf("ERROR: enqueueAchievementBackfill: %s", err)
+	}
+
+	challengeStore := store.NewPostgresChallengeStore(pgDB)
+	challengeHandler := api.NewChallengeHandler(challengeStore, workoutStore, measurementStore, logger)
+	challengeScorer := challenges.NewScorer(challengeStore, measurementStore)
+	workoutHooks.OnWorkoutSaved("challenges", challengeScorer.WorkoutSaved)
+	workoutHooks.OnWorkoutDeleted("challenges", challengeScorer.WorkoutDeleted)
+
+	progressionStore := store.NewPostgresProgressionStore(pgDB)
+	progressionHandler := api.NewProgressionHandler(progressionStore, logger)
+
+	searchStore := store.NewPostgresSearchStore(pgDB)
+	searchHandler := api.NewSearchHandler(searchStore, logger)
+
+	tagStore := store.NewPostgresTagStore(pgDB)
+	tagHandler := api.NewTagHandler(tagStore, logger)
+
+	customFieldStore := store.NewPostgresCustomFieldStore(pgDB)
+	customFieldHandler := api.NewCustomFieldHandler(customFieldStore, logger)
+
+	scheduleStore := store.NewPostgresScheduleStore(pgDB)
+	scheduleHandler := api.NewScheduleHandler(scheduleStore, logger)
+	calendarHandler := api.NewCalendarHandler(workoutStore, scheduleStore, tokenStore, userStore, publicURL, logger)
+
+	reminderStore := store.NewPostgresReminderStore(pgDB)
+	reminderHandler := api.NewReminderHandler(reminderStore, scheduleStore, logger)
+	var mailer reminders.Mailer = reminders.NewLogMailer(logger)
+	if cfg.SMTPAddr != "" {
+		mailer = reminders.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword)
+	}
+	reminderScheduler := reminders.NewScheduler(reminderStore, userStore, jobQueue, []reminders.Notifier{
+		reminders.NewInAppNotifier(notificationCenter),
+		reminders.NewEmailNotifier(mailer),
+		reminders.NewWebhookNotifier(webhooks.NewClient(10 * time.Second)),
+	}, logger)
+	jobs.Handle(jobQueue, reminders.NotifyJob, reminderScheduler.Notify)
+	if cfg.ReminderInterval > 0 {
+		go reminderScheduler.Run(cfg.ReminderInterval)
+	}
+
+	if cfg.OutboxInterval > 0 {
+		go eventDispatcher.Run(cfg.OutboxInterval)
+	}
+	jobQueue.Start(cfg.JobWorkers, cfg.JobPollInterval)
 
 	userMiddleware := middleware.NewUserMiddleware(userStore)
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     userMiddleware,
-		DB:             pgDB,
+		Logger:                logger,
+		WorkoutHandler:        workoutHandler,
+		UserHandler:           userHandler,
+		TokenHandler:          tokenHandler,
+		SyncHandler:           syncHandler,
+		CSVHandler:            csvHandler,
+		ActivityHandler:       activityHandler,
+		StatsHandler:          statsHandler,
+		SessionHandler:        sessionHandler,
+		METHandler:            metHandler,
+		MeasurementHandler:    measurementHandler,
+		GoalHandler:           goalHandler,
+		AchievementHandler:    achievementHandler,
+		ChallengeHandler:      challengeHandler,
+		ProgressionHandler:    progressionHandler,
+		TrainingLoadHandler:   trainingLoadHandler,
+		SearchHandler:         searchHandler,
+		TagHandler:            tagHandler,
+		CustomFieldHandler:    customFieldHandler,
+		ScheduleHandler:       scheduleHandler,
+		CalendarHandler:       calendarHandler,
+		ReminderHandler:       reminderHandler,
+		NotificationHandler:   notificationHandler,
+		WebhookHandler:        webhookHandler,
+		JobHandler:            jobHandler,
+		Middleware:            userMiddleware,
+		IdempotencyMiddleware: idempotencyMiddleware,
+		DB:                    pgDB,
 	}
 
 	return app, nil
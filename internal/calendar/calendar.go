@@ -0,0 +1,98 @@
+// Package calendar lays out workouts and planned sessions by day and writes
+// them as an iCalendar feed.
+package calendar
+
+import (
+	"sort"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const DateLayout = "2006-01-02"
+
+type WorkoutItem struct {
+	ID              int       `json:"id"`
+	Title           string    `json:"title"`
+	PerformedAt     time.Time `json:"performed_at"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Tags            []string  `json:"tags"`
+}
+
+// PlannedItem is one occurrence of a schedule.
+type PlannedItem struct {
+	ScheduleID int       `json:"schedule_id"`
+	Title      string    `json:"title"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+}
+
+type Day struct {
+	Date     string        `json:"date"`
+	Workouts []WorkoutItem `json:"workouts"`
+	Planned  []PlannedItem `json:"planned"`
+}
+
+// MonthStart returns midnight of the first day of t's month in loc.
+func MonthStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// Planned returns the occurrences of schedules starting within [from, to),
+// in loc, earliest first.
+func Planned(schedules []*store.Schedule, from, to time.Time, loc *time.Location) []PlannedItem {
+	items := []PlannedItem{}
+	for _, schedule := range schedules {
+		for _, start := range schedule.Occurrences(from, to, loc) {
+			items = append(items, PlannedItem{
+				ScheduleID: schedule.ID,
+				Title:      schedule.Title,
+				StartsAt:   start,
+				EndsAt:     start.Add(time.Duration(schedule.DurationMinutes) * time.Minute),
+			})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].StartsAt.Before(items[j].StartsAt) })
+	return items
+}
+
+// Month returns every day of the month starting at first, a midnight in
+// loc, with the workouts performed and the sessions planned on it.
+func Month(first time.Time, workouts []*store.Workout, schedules []*store.Schedule, loc *time.Location) []Day {
+	next := first.AddDate(0, 1, 0)
+
+	days := []Day{}
+	index := map[string]int{}
+	for day := first; day.Before(next); day = day.AddDate(0, 0, 1) {
+		date := day.Format(DateLayout)
+		index[date] = len(days)
+		days = append(days, Day{Date: date, Workouts: []WorkoutItem{}, Planned: []PlannedItem{}})
+	}
+
+	for _, workout := range workouts {
+		performedAt := workout.PerformedAt.In(loc)
+		i, ok := index[performedAt.Format(DateLayout)]
+		if !ok {
+			continue
+		}
+		tags := workout.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		days[i].Workouts = append(days[i].Workouts, WorkoutItem{
+			ID:              workout.ID,
+			Title:           workout.Title,
+			PerformedAt:     performedAt,
+			DurationMinutes: workout.DurationMinutes,
+			Tags:            tags,
+		})
+	}
+
+	for _, item := range Planned(schedules, first, next, loc) {
+		i := index[item.StartsAt.Format(DateLayout)]
+		days[i].Planned = append(days[i].Planned, item)
+	}
+
+	return days
+}
@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestMonthGroupsByLocalDay(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	first := time.Date(2026, 2, 1, 0, 0, 0, 0, tokyo)
+	workouts := []*store.Workout{
+		// 2026-02-01 08:30 in Tokyo, still January in UTC.
+		{ID: 1, Title: "Morning run", PerformedAt: time.Date(2026, 1, 31, 23, 30, 0, 0, time.UTC), DurationMinutes: 30},
+		{ID: 2, Title: "Lifting", PerformedAt: time.Date(2026, 2, 10, 10, 0, 0, 0, time.UTC), Tags: []string{"deload"}},
+	}
+	schedules := []*store.Schedule{
+		{ID: 7, Title: "Push day", StartsAt: "2026-01-05T18:00", DurationMinutes: 60, RRule: strPtr("FREQ=WEEKLY;BYDAY=MO")},
+	}
+
+	days := Month(first, workouts, schedules, tokyo)
+
+	require.Len(t, days, 28)
+	assert.Equal(t, "2026-02-01", days[0].Date)
+	require.Len(t, days[0].Workouts, 1)
+	assert.Equal(t, 1, days[0].Workouts[0].ID)
+	assert.Equal(t, []string{}, days[0].Workouts[0].Tags)
+	assert.Equal(t, []string{"deload"}, days[9].Workouts[0].Tags)
+
+	mondays := 0
+	for _, day := range days {
+		for _, planned := range day.Planned {
+			mondays++
+			assert.Equal(t, time.Monday, planned.StartsAt.Weekday())
+			assert.Equal(t, 18, planned.StartsAt.Hour())
+			assert.Equal(t, time.Hour, planned.EndsAt.Sub(planned.StartsAt))
+		}
+	}
+	assert.Equal(t, 4, mondays)
+}
+
+func TestPlannedIncludesOneOffSchedules(t *testing.T) {
+	schedules := []*store.Schedule{
+		{ID: 1, Title: "Race", StartsAt: "2026-03-15T09:00", DurationMinutes: 120},
+		{ID: 2, Title: "Later", StartsAt: "2026-04-15T09:00", DurationMinutes: 60},
+	}
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	items := Planned(schedules, from, from.AddDate(0, 1, 0), time.UTC)
+	require.Len(t, items, 1)
+	assert.Equal(t, 1, items[0].ScheduleID)
+}
+
+func TestWriteICS(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = WriteICS(&buf, Feed{
+		Name:     "ana's workouts",
+		Location: ny,
+		Workouts: []*store.Workout{{
+			ID:              3,
+			Title:           "Legs; heavy, really",
+			Description:     strings.Repeat("squats ", 20),
+			PerformedAt:     time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC),
+			DurationMinutes: 45,
+			Tags:            []string{"deload"},
+		}},
+		Schedules: []*store.Schedule{
+			{ID: 9, Title: "Push day", StartsAt: "2026-10-19T18:00", DurationMinutes: 60, RRule: strPtr("FREQ=WEEKLY;BYDAY=MO,TH")},
+		},
+	})
+	require.NoError(t, err)
+	ics := buf.String()
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "UID:workout-3@fem-fitness-project\r\n")
+	assert.Contains(t, ics, "DTSTART:20261019T220000Z\r\nDTEND:20261019T224500Z\r\n")
+	assert.Contains(t, ics, `SUMMARY:Legs\; heavy\, really`)
+	assert.Contains(t, ics, "CATEGORIES:deload\r\n")
+	assert.Contains(t, ics, "DTSTART;TZID=America/New_York:20261019T180000\r\n")
+	assert.Contains(t, ics, "RRULE:FREQ=WEEKLY;BYDAY=MO,TH\r\n")
+
+	for _, line := range strings.Split(ics, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	assert.Contains(t, ics, "\r\n squats")
+}
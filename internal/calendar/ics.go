@@ -0,0 +1,135 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	icsUTCLayout   = "20060102T150405Z"
+	icsLocalLayout = "20060102T150405"
+	icsUIDDomain   = "fem-fitness-project"
+	icsLineOctets  = 75
+)
+
+// Feed is the content of a user's calendar feed. Workouts appear as
+// confirmed events, schedules as tentative ones that repeat by their RRule.
+type Feed struct {
+	Name      string
+	Location  *time.Location
+	Workouts  []*store.Workout
+	Schedules []*store.Schedule
+}
+
+// WriteICS writes the feed as an RFC 5545 calendar.
+func WriteICS(w io.Writer, feed Feed) error {
+	out := &icsWriter{w: bufio.NewWriter(w)}
+
+	out.line("BEGIN:VCALENDAR")
+	out.line("VERSION:2.0")
+	out.line("PRODID:-//fem_fitness_project//Workouts//EN")
+	out.line("CALSCALE:GREGORIAN")
+	out.line("METHOD:PUBLISH")
+	out.line("X-WR-CALNAME:" + escapeText(feed.Name))
+	out.line("X-WR-TIMEZONE:" + feed.Location.String())
+
+	for _, workout := range feed.Workouts {
+		start := workout.PerformedAt.UTC()
+		end := start.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+
+		out.line("BEGIN:VEVENT")
+		out.line(fmt.Sprintf("UID:workout-%d@%s", workout.ID, icsUIDDomain))
+		out.line("DTSTAMP:" + workout.UpdatedAt.UTC().Format(icsUTCLayout))
+		out.line("DTSTART:" + start.Format(icsUTCLayout))
+		out.line("DTEND:" + end.Format(icsUTCLayout))
+		out.line("SUMMARY:" + escapeText(workout.Title))
+		if workout.Description != "" {
+			out.line("DESCRIPTION:" + escapeText(workout.Description))
+		}
+		if len(workout.Tags) > 0 {
+			tags := make([]string, len(workout.Tags))
+			for i, tag := range workout.Tags {
+				tags[i] = escapeText(tag)
+			}
+			out.line("CATEGORIES:" + strings.Join(tags, ","))
+		}
+		out.line("STATUS:CONFIRMED")
+		out.line("END:VEVENT")
+	}
+
+	for _, schedule := range feed.Schedules {
+		start := schedule.Start(feed.Location)
+		end := start.Add(time.Duration(schedule.DurationMinutes) * time.Minute)
+
+		out.line("BEGIN:VEVENT")
+		out.line(fmt.Sprintf("UID:schedule-%d@%s", schedule.ID, icsUIDDomain))
+		out.line("DTSTAMP:" + schedule.UpdatedAt.UTC().Format(icsUTCLayout))
+		out.line("DTSTART" + localTime(start))
+		out.line("DTEND" + localTime(end))
+		if schedule.RRule != nil {
+			out.line("RRULE:" + *schedule.RRule)
+		}
+		out.line("SUMMARY:" + escapeText(schedule.Title))
+		if schedule.Notes != "" {
+			out.line("DESCRIPTION:" + escapeText(schedule.Notes))
+		}
+		out.line("STATUS:TENTATIVE")
+		out.line("END:VEVENT")
+	}
+
+	out.line("END:VCALENDAR")
+
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// localTime formats t as a property value with its time zone, so calendar
+// apps keep repeating events at the same wall-clock time across DST.
+func localTime(t time.Time) string {
+	if t.Location() == time.UTC {
+		return ":" + t.Format(icsUTCLayout)
+	}
+	return ";TZID=" + t.Location().String() + ":" + t.Format(icsLocalLayout)
+}
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes a content line, folded after 75 octets without splitting a
+// UTF-8 sequence.
+func (iw *icsWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	limit := icsLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, iw.err = iw.w.WriteString(s[:cut] + "\r\n ")
+		if iw.err != nil {
+			return
+		}
+		s = s[cut:]
+		// Continuation lines start with the folding space.
+		limit = icsLineOctets - 1
+	}
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
@@ -0,0 +1,138 @@
+// Package calories estimates the energy spent in a workout from the MET
+// (metabolic equivalent of task) value of each exercise and the body weight
+// of the athlete: kcal = MET × kg × hours.
+package calories
+
+import (
+	"math"
+	"strings"
+)
+
+// Seconds assumed for work that records no duration.
+const (
+	SecondsPerRep = 3
+	SecondsPerSet = 40
+)
+
+// DefaultMET is used for exercises and entry kinds the table does not know.
+const DefaultMET = 5.0
+
+// Table maps exercise and sport names, as returned by Key, to MET values.
+type Table map[string]float64
+
+// DefaultMETs are taken from the Compendium of Physical Activities. Users can
+// add to and override them per exercise.
+var DefaultMETs = Table{
+	"back squat":       5.0,
+	"barbell row":      5.0,
+	"bench press":      5.0,
+	"box jump":         8.0,
+	"burpee":           8.0,
+	"crunch":           3.8,
+	"cycling":          7.5,
+	"deadlift":         6.0,
+	"elliptical":       5.0,
+	"front squat":      5.0,
+	"hiking":           6.0,
+	"jump rope":        11.8,
+	"kettlebell":       9.8,
+	"kettlebell swing": 9.8,
+	"lunge":            5.0,
+	"overhead press":   5.0,
+	"plank":            3.8,
+	"pull up":          8.0,
+	"push up":          8.0,
+	"rowing":           7.0,
+	"running":          9.8,
+	"sit up":           3.8,
+	"squat":            5.0,
+	"stair climber":    9.0,
+	"stretching":       2.3,
+	"swimming":         6.0,
+	"walking":          3.5,
+	"yoga":             2.5,
+}
+
+// KindMETs are the fallbacks for entries whose exercise is not in the table.
+var KindMETs = map[string]float64{
+	"reps":     5.0,
+	"time":     4.0,
+	"distance": 7.0,
+	"cardio":   7.0,
+}
+
+// Key normalizes an exercise or sport name for lookups, so "Pull-Up" and
+// "pull_up" find the same value.
+func Key(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// With returns a copy of t with overrides applied on top.
+func (t Table) With(overrides Table) Table {
+	merged := make(Table, len(t)+len(overrides))
+	for name, met := range t {
+		merged[name] = met
+	}
+	for name, met := range overrides {
+		merged[Key(name)] = met
+	}
+	return merged
+}
+
+// Lookup returns the MET value of the named exercise, falling back to its
+// kind and then to DefaultMET.
+func (t Table) Lookup(name string, kind string) float64 {
+	if met, ok := t[Key(name)]; ok {
+		return met
+	}
+	if met, ok := KindMETs[kind]; ok {
+		return met
+	}
+	return DefaultMET
+}
+
+// Effort is time spent on one exercise.
+type Effort struct {
+	Name    string
+	Kind    string
+	Seconds float64
+}
+
+// EffortSeconds returns the time spent on sets of an exercise: the recorded
+// duration when there is one, else an allowance per rep or per set.
+func EffortSeconds(sets int, reps *int, durationSeconds *int) float64 {
+	sets = max(sets, 1)
+	switch {
+	case durationSeconds != nil:
+		return float64(sets * *durationSeconds)
+	case reps != nil:
+		return float64(sets * *reps * SecondsPerRep)
+	default:
+		return float64(sets * SecondsPerSet)
+	}
+}
+
+// Estimate returns the kilocalories burned by a body of bodyWeightKg doing
+// efforts. The MET values of the efforts are averaged by their time; when
+// totalSeconds is positive it is used as the length of the whole workout,
+// rests included, otherwise only the efforts count.
+func (t Table) Estimate(bodyWeightKg float64, totalSeconds float64, efforts []Effort) int {
+	var seconds, metSeconds float64
+	for _, effort := range efforts {
+		if effort.Seconds <= 0 {
+			continue
+		}
+		seconds += effort.Seconds
+		metSeconds += t.Lookup(effort.Name, effort.Kind) * effort.Seconds
+	}
+	if seconds == 0 || bodyWeightKg <= 0 {
+		return 0
+	}
+
+	if totalSeconds <= 0 {
+		totalSeconds = seconds
+	}
+	return int(math.Round(metSeconds / seconds * bodyWeightKg * totalSeconds / 3600))
+}
@@ -0,0 +1,45 @@
+package calories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestLookup(t *testing.T) {
+	table := DefaultMETs.With(Table{"Pull-Up": 9.5, "Sled Push": 8.0})
+
+	assert.Equal(t, 9.5, table.Lookup("pull_up", "reps"))
+	assert.Equal(t, 8.0, table.Lookup("sled  push", "time"))
+	assert.Equal(t, 9.8, table.Lookup("Running", "cardio"))
+	assert.Equal(t, KindMETs["distance"], table.Lookup("farmer carry", "distance"))
+	assert.Equal(t, DefaultMET, table.Lookup("farmer carry", ""))
+	assert.Equal(t, 8.0, DefaultMETs["pull up"], "overrides must not change the defaults")
+}
+
+func TestEffortSeconds(t *testing.T) {
+	assert.Equal(t, 180.0, EffortSeconds(3, intPtr(10), intPtr(60)))
+	assert.Equal(t, 90.0, EffortSeconds(3, intPtr(10), nil))
+	assert.Equal(t, 120.0, EffortSeconds(3, nil, nil))
+	assert.Equal(t, 40.0, EffortSeconds(0, nil, nil))
+}
+
+func TestEstimate(t *testing.T) {
+	// 30 minutes of running at 9.8 MET for 70 kg.
+	running := []Effort{{Name: "running", Kind: "cardio", Seconds: 1800}}
+	assert.Equal(t, 343, DefaultMETs.Estimate(70, 0, running))
+
+	// The MET values are averaged by time and applied to the whole workout.
+	mixed := []Effort{
+		{Name: "bench press", Kind: "reps", Seconds: 300},
+		{Name: "burpee", Kind: "reps", Seconds: 100},
+	}
+	assert.Equal(t, 383, DefaultMETs.Estimate(80, 3000, mixed))
+
+	assert.Equal(t, 0, DefaultMETs.Estimate(0, 1800, running))
+	assert.Equal(t, 0, DefaultMETs.Estimate(70, 1800, nil))
+}
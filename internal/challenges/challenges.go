@@ -0,0 +1,101 @@
+// Package challenges keeps the scores of challenge participants up to date
+// as their workouts are saved and deleted. Every workout's contribution is
+// stored, so a save only moves a score by the difference it makes.
+package challenges
+
+import (
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// Score is what the workout adds to its user's score in the challenge, in
+// kilograms, meters or as a count. Private workouts and workouts performed
+// outside the challenge's window add nothing.
+func Score(challenge *store.Challenge, workout *store.Workout, bodyWeights *store.BodyWeightLog) float64 {
+	if workout.Visibility == store.VisibilityPrivate || !challenge.Covers(workout.PerformedAt) {
+		return 0
+	}
+
+	var totals stats.Totals
+	matched := false
+	bodyWeight := bodyWeights.At(workout.PerformedAt)
+	workout.EachEntry(func(group *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+		if challenge.ExerciseName != nil && !stats.SameExercise(entry.ExerciseName, *challenge.ExerciseName) {
+			return
+		}
+		matched = true
+		entryTotals := stats.EntryTotals(*entry, bodyWeight)
+		if group != nil {
+			entryTotals.Volume *= float64(group.Rounds)
+			entryTotals.Distance *= float64(group.Rounds)
+		}
+		totals.Volume += entryTotals.Volume
+		totals.Distance += entryTotals.Distance
+	})
+
+	if activity := workout.Activity; activity != nil {
+		if challenge.ExerciseName == nil || stats.SameExercise(activity.Sport, *challenge.ExerciseName) {
+			matched = true
+			totals.Distance += activity.DistanceMeters
+		}
+	}
+
+	switch challenge.Metric {
+	case store.ChallengeMetricVolume:
+		return totals.Volume
+	case store.ChallengeMetricDistance:
+		return totals.Distance
+	case store.ChallengeMetricWorkoutCount:
+		if matched {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Contributions scores each of workouts in the challenge, keyed by workout
+// id, leaving out those that add nothing.
+func Contributions(challenge *store.Challenge, workouts []*store.Workout, bodyWeights *store.BodyWeightLog) map[int]float64 {
+	contributions := map[int]float64{}
+	for _, workout := range workouts {
+		if value := Score(challenge, workout, bodyWeights); value != 0 {
+			contributions[workout.ID] = value
+		}
+	}
+	return contributions
+}
+
+// Scorer updates challenge scores from the workout hooks.
+type Scorer struct {
+	challengeStore   store.ChallengeStore
+	measurementStore store.MeasurementStore
+}
+
+func NewScorer(challengeStore store.ChallengeStore, measurementStore store.MeasurementStore) *Scorer {
+	return &Scorer{challengeStore: challengeStore, measurementStore: measurementStore}
+}
+
+// WorkoutSaved rescores the workout in every unfinished challenge its user
+// joined. A workout moved out of a challenge's window or made private is
+// scored 0, which takes it out again.
+func (s *Scorer) WorkoutSaved(workout *store.Workout) error {
+	challenges, err := s.challengeStore.ListOpenChallenges(workout.UserID)
+	if err != nil || len(challenges) == 0 {
+		return err
+	}
+
+	bodyWeights, err := s.measurementStore.GetBodyWeightLog(workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	values := map[int]float64{}
+	for _, challenge := range challenges {
+		values[challenge.ID] = Score(challenge, workout, bodyWeights)
+	}
+	return s.challengeStore.SetContributions(workout.UserID, workout.ID, values)
+}
+
+func (s *Scorer) WorkoutDeleted(userID int, workoutID int) error {
+	return s.challengeStore.RemoveWorkoutContributions(workoutID)
+}
@@ -0,0 +1,67 @@
+package challenges
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func march() *store.Challenge {
+	return &store.Challenge{
+		StartsAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:   time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestScoreVolume(t *testing.T) {
+	challenge := march()
+	challenge.Metric = store.ChallengeMetricVolume
+
+	reps, weight, kettlebell := 5, 100.0, 20.0
+	workout := &store.Workout{
+		PerformedAt: time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		Entries: []store.WorkoutEntry{
+			{Kind: store.EntryKindReps, ExerciseName: "Deadlift", Sets: 3, Reps: &reps, Weight: &weight},
+		},
+		Groups: []store.WorkoutEntryGroup{
+			{Rounds: 2, Entries: []store.WorkoutEntry{
+				{Kind: store.EntryKindReps, ExerciseName: "Kettlebell swing", Sets: 2, Reps: &reps, Weight: &kettlebell},
+			}},
+		},
+	}
+	assert.Equal(t, 1500.0+400.0, Score(challenge, workout, nil))
+
+	workout.Visibility = store.VisibilityPrivate
+	assert.Equal(t, 0.0, Score(challenge, workout, nil))
+
+	workout.Visibility = store.VisibilityPublic
+	workout.PerformedAt = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0.0, Score(challenge, workout, nil))
+}
+
+func TestScoreRunningDistance(t *testing.T) {
+	challenge := march()
+	challenge.Metric = store.ChallengeMetricDistance
+	challenge.ExerciseName = ptr("running")
+
+	distance, unit := 5.0, "km"
+	at := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	run := &store.Workout{ID: 1, PerformedAt: at, Entries: []store.WorkoutEntry{
+		{Kind: store.EntryKindDistance, ExerciseName: "Running", Sets: 1, Distance: &distance, DistanceUnit: &unit},
+		{Kind: store.EntryKindDistance, ExerciseName: "Rowing", Sets: 1, Distance: &distance, DistanceUnit: &unit},
+	}}
+	imported := &store.Workout{ID: 2, PerformedAt: at, Activity: &store.WorkoutActivity{Sport: "Running", DistanceMeters: 10000}}
+	ride := &store.Workout{ID: 3, PerformedAt: at, Activity: &store.WorkoutActivity{Sport: "Cycling", DistanceMeters: 30000}}
+
+	contributions := Contributions(challenge, []*store.Workout{run, imported, ride}, nil)
+	assert.Equal(t, map[int]float64{1: 5000, 2: 10000}, contributions)
+
+	challenge.Metric = store.ChallengeMetricWorkoutCount
+	assert.Equal(t, map[int]float64{1: 1, 2: 1}, Contributions(challenge, []*store.Workout{run, imported, ride}, nil))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,245 @@
+// Package goals measures progress towards goals from the workouts and body
+// weights of their user. Weeks start on Monday and, like months and
+// deadlines, are counted in the user's time zone.
+package goals
+
+import (
+	"math"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusExpired   = "expired"
+	// StatusEnded is reached by recurring goals once their deadline passes.
+	StatusEnded = "ended"
+)
+
+// History is what progress is measured from: workouts sorted by the time
+// they were performed, and the user's body weights.
+type History struct {
+	Workouts    []*store.Workout
+	BodyWeights *store.BodyWeightLog
+}
+
+// Streak counts consecutive weeks or months in which a recurring goal was
+// met. The current period only counts once it is met.
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// Progress is how far a goal has come. Values are in the goal's stored
+// unit. Recurring goals report on the current period, or the last one
+// before the deadline once it has passed.
+type Progress struct {
+	Status      string     `json:"status"`
+	Current     float64    `json:"current"`
+	Target      float64    `json:"target"`
+	Percent     float64    `json:"percent"`
+	Achieved    bool       `json:"achieved"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end"`
+	Streak      *Streak    `json:"streak"`
+}
+
+// ConvertUnits expresses the progress of goal in the units of system.
+func (p *Progress) ConvertUnits(goal *store.Goal, system string) {
+	p.Current = goal.DisplayValue(p.Current, system)
+	p.Target = goal.DisplayValue(p.Target, system)
+}
+
+// DeadlineEnd is the moment the goal's deadline day ends in loc.
+func DeadlineEnd(goal *store.Goal, loc *time.Location) time.Time {
+	deadline, err := time.ParseInLocation("2006-01-02", goal.Deadline, loc)
+	if err != nil {
+		return goal.CreatedAt
+	}
+	return deadline.AddDate(0, 0, 1)
+}
+
+// PeriodStart returns the start of the week or month, by the goal's type,
+// that t falls in.
+func PeriodStart(goal *store.Goal, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if goal.Type == store.GoalTypeDistancePerMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+}
+
+// nextPeriod returns the start of the period after the one starting at
+// start. Adding calendar days rather than hours keeps periods aligned to
+// midnight across daylight saving changes.
+func nextPeriod(goal *store.Goal, start time.Time) time.Time {
+	if goal.Type == store.GoalTypeDistancePerMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// workoutValue is what a workout adds to a period of a recurring goal.
+func workoutValue(goal *store.Goal, workout *store.Workout, bodyWeights *store.BodyWeightLog) float64 {
+	switch goal.Type {
+	case store.GoalTypeWorkoutsPerWeek:
+		return 1
+	case store.GoalTypeWeeklyVolume:
+		return stats.WorkoutTotals(workout, bodyWeights).Volume
+	case store.GoalTypeDistancePerMonth:
+		return stats.WorkoutTotals(workout, bodyWeights).Distance
+	}
+	return 0
+}
+
+// PeriodValue sums what the workouts performed in [start, end) add to a
+// recurring goal.
+func PeriodValue(goal *store.Goal, history History, start, end time.Time) float64 {
+	value := 0.0
+	for _, workout := range history.Workouts {
+		if !workout.PerformedAt.Before(start) && workout.PerformedAt.Before(end) {
+			value += workoutValue(goal, workout, history.BodyWeights)
+		}
+	}
+	return value
+}
+
+// currentValue is where a goal that is not recurring stands at now.
+func currentValue(goal *store.Goal, history History, now time.Time) float64 {
+	switch goal.Type {
+	case store.GoalTypeOneRepMax:
+		best := stats.BestOneRepMax(history.Workouts, *goal.ExerciseName)
+		if goal.StartValue != nil {
+			best = max(best, *goal.StartValue)
+		}
+		return best
+	case store.GoalTypeBodyWeight:
+		return history.BodyWeights.At(now)
+	}
+	return 0
+}
+
+// achieved reports whether value meets the goal. Body weight goals are met
+// from either side, depending on where the user started.
+func achieved(goal *store.Goal, value float64) bool {
+	if goal.Type == store.GoalTypeBodyWeight && goal.StartValue != nil && goal.Target < *goal.StartValue {
+		return value > 0 && value <= goal.Target
+	}
+	return value >= goal.Target
+}
+
+func percent(goal *store.Goal, value float64) float64 {
+	start := 0.0
+	if goal.StartValue != nil && !goal.Recurring() {
+		start = *goal.StartValue
+	}
+	if achieved(goal, value) {
+		return 100
+	}
+	if goal.Target == start || value == 0 {
+		return 0
+	}
+	p := (value - start) / (goal.Target - start) * 100
+	return math.Round(math.Min(math.Max(p, 0), 100)*10) / 10
+}
+
+// lastPeriodStart is the start of the period progress is reported on at
+// now: the current one, or the last one before the deadline.
+func lastPeriodStart(goal *store.Goal, now time.Time, loc *time.Location) time.Time {
+	deadlineEnd := DeadlineEnd(goal, loc)
+	if !now.Before(deadlineEnd) {
+		now = deadlineEnd.Add(-time.Nanosecond)
+	}
+	return PeriodStart(goal, now, loc)
+}
+
+// Evaluate measures the goal's progress at now.
+func Evaluate(goal *store.Goal, history History, now time.Time, loc *time.Location) Progress {
+	progress := Progress{Status: StatusActive, Target: goal.Target}
+	deadlinePassed := !now.Before(DeadlineEnd(goal, loc))
+
+	if goal.Recurring() {
+		start := lastPeriodStart(goal, now, loc)
+		end := nextPeriod(goal, start)
+		progress.PeriodStart, progress.PeriodEnd = &start, &end
+		progress.Current = PeriodValue(goal, history, start, end)
+		streak := computeStreak(goal, history, now, loc)
+		progress.Streak = &streak
+		if deadlinePassed {
+			progress.Status = StatusEnded
+		}
+	} else {
+		progress.Current = currentValue(goal, history, now)
+		switch {
+		case goal.CompletedAt != nil:
+			progress.Status = StatusCompleted
+		case deadlinePassed:
+			progress.Status = StatusExpired
+		}
+	}
+
+	progress.Achieved = achieved(goal, progress.Current)
+	progress.Percent = percent(goal, progress.Current)
+	return progress
+}
+
+// computeStreak walks the periods from the one the goal was created in up
+// to the one reported on at now.
+func computeStreak(goal *store.Goal, history History, now time.Time, loc *time.Location) Streak {
+	first := PeriodStart(goal, goal.CreatedAt, loc)
+	last := lastPeriodStart(goal, now, loc)
+
+	values := map[int64]float64{}
+	for _, workout := range history.Workouts {
+		start := PeriodStart(goal, workout.PerformedAt, loc)
+		values[start.Unix()] += workoutValue(goal, workout, history.BodyWeights)
+	}
+
+	var streak Streak
+	run := 0
+	for start := first; !start.After(last); start = nextPeriod(goal, start) {
+		if values[start.Unix()] >= goal.Target {
+			run++
+			streak.Longest = max(streak.Longest, run)
+			continue
+		}
+		// The current period may still be met.
+		if start.Equal(last) {
+			break
+		}
+		run = 0
+	}
+	streak.Current = run
+	return streak
+}
+
+// Completion returns the period a completion of the goal should be recorded
+// for after a workout performed at performedAt was saved, and the value
+// reached. It reports false when the goal is not met. Recurring goals are
+// checked in the period of the workout, other goals at now; performedAt is
+// nil when a body weight was saved.
+func Completion(goal *store.Goal, history History, performedAt *time.Time, now time.Time, loc *time.Location) (time.Time, float64, bool) {
+	deadlineEnd := DeadlineEnd(goal, loc)
+
+	if goal.Recurring() {
+		if performedAt == nil || !performedAt.Before(deadlineEnd) {
+			return time.Time{}, 0, false
+		}
+		start := PeriodStart(goal, *performedAt, loc)
+		if start.Before(PeriodStart(goal, goal.CreatedAt, loc)) {
+			return time.Time{}, 0, false
+		}
+		value := PeriodValue(goal, history, start, nextPeriod(goal, start))
+		return start, value, value >= goal.Target
+	}
+
+	if goal.CompletedAt != nil || !now.Before(deadlineEnd) {
+		return time.Time{}, 0, false
+	}
+	value := currentValue(goal, history, now)
+	return goal.CreatedAt, value, achieved(goal, value)
+}
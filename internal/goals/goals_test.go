@@ -0,0 +1,113 @@
+package goals
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func workoutAt(at time.Time) *store.Workout {
+	return &store.Workout{PerformedAt: at}
+}
+
+func TestPeriodStartUsesUserTimezone(t *testing.T) {
+	loc := mustLoad(t, "America/New_York")
+	goal := &store.Goal{Type: store.GoalTypeWorkoutsPerWeek}
+
+	// Monday 02:00 UTC is still Sunday evening in New York.
+	mondayUTC := time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC)
+	start := PeriodStart(goal, mondayUTC, loc)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, loc), start)
+
+	// The week holding the switch to daylight saving time still ends at
+	// midnight.
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, loc), nextPeriod(goal, start))
+}
+
+func TestWorkoutsPerWeekStreak(t *testing.T) {
+	loc := mustLoad(t, "Europe/Budapest")
+	goal := &store.Goal{
+		Type:      store.GoalTypeWorkoutsPerWeek,
+		Target:    2,
+		Deadline:  "2024-12-31",
+		CreatedAt: time.Date(2024, 1, 1, 9, 0, 0, 0, loc),
+	}
+
+	var workouts []*store.Workout
+	// Weeks of Jan 1 and Jan 8 are met, Jan 15 is not, Jan 22 and 29 are.
+	for _, day := range []int{1, 3, 8, 10, 15, 22, 24, 29, 31} {
+		workouts = append(workouts, workoutAt(time.Date(2024, 1, day, 18, 0, 0, 0, loc)))
+	}
+	history := History{Workouts: workouts}
+
+	// Mid-week of Feb 5 with one workout so far: the streak stands at two.
+	workouts = append(workouts, workoutAt(time.Date(2024, 2, 5, 7, 0, 0, 0, loc)))
+	history.Workouts = workouts
+	now := time.Date(2024, 2, 6, 12, 0, 0, 0, loc)
+
+	progress := Evaluate(goal, history, now, loc)
+
+	assert.Equal(t, StatusActive, progress.Status)
+	assert.Equal(t, 1.0, progress.Current)
+	assert.Equal(t, 50.0, progress.Percent)
+	assert.False(t, progress.Achieved)
+	require.NotNil(t, progress.Streak)
+	assert.Equal(t, 2, progress.Streak.Current)
+	assert.Equal(t, 2, progress.Streak.Longest)
+
+	// Meeting the current week extends the streak.
+	history.Workouts = append(workouts, workoutAt(time.Date(2024, 2, 7, 7, 0, 0, 0, loc)))
+	progress = Evaluate(goal, history, now, loc)
+	assert.True(t, progress.Achieved)
+	assert.Equal(t, 3, progress.Streak.Current)
+	assert.Equal(t, 3, progress.Streak.Longest)
+}
+
+func TestBodyWeightGoalDirection(t *testing.T) {
+	start := 90.0
+	goal := &store.Goal{Type: store.GoalTypeBodyWeight, Target: 85, StartValue: &start}
+
+	assert.False(t, achieved(goal, 88))
+	assert.Equal(t, 40.0, percent(goal, 88))
+	assert.True(t, achieved(goal, 84.5))
+
+	start = 70
+	goal.Target = 75
+	assert.False(t, achieved(goal, 74))
+	assert.True(t, achieved(goal, 75))
+}
+
+func TestCompletion(t *testing.T) {
+	loc := time.UTC
+	goal := &store.Goal{
+		Type:      store.GoalTypeWorkoutsPerWeek,
+		Target:    1,
+		Deadline:  "2024-01-31",
+		CreatedAt: time.Date(2024, 1, 10, 0, 0, 0, 0, loc),
+	}
+	performedAt := time.Date(2024, 1, 11, 8, 0, 0, 0, loc)
+	history := History{Workouts: []*store.Workout{workoutAt(performedAt)}}
+
+	periodStart, value, ok := Completion(goal, history, &performedAt, performedAt, loc)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, loc), periodStart)
+	assert.Equal(t, 1.0, value)
+
+	// Workouts before the goal's first week or after its deadline do not
+	// complete it.
+	before := time.Date(2024, 1, 3, 8, 0, 0, 0, loc)
+	_, _, ok = Completion(goal, History{Workouts: []*store.Workout{workoutAt(before)}}, &before, performedAt, loc)
+	assert.False(t, ok)
+	after := time.Date(2024, 2, 1, 8, 0, 0, 0, loc)
+	_, _, ok = Completion(goal, History{Workouts: []*store.Workout{workoutAt(after)}}, &after, after, loc)
+	assert.False(t, ok)
+}
@@ -0,0 +1,122 @@
+package goals
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/notifications"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// Tracker records goal completions as workouts and body weights are saved.
+type Tracker struct {
+	goalStore        store.GoalStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	userStore        store.UserStore
+	center           *notifications.Center
+	logger           *log.Logger
+}
+
+func NewTracker(goalStore store.GoalStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, userStore store.UserStore, center *notifications.Center, logger *log.Logger) *Tracker {
+	return &Tracker{goalStore: goalStore, workoutStore: workoutStore, measurementStore: measurementStore, userStore: userStore, center: center, logger: logger}
+}
+
+// LoadHistory loads the user's workouts performed since the earliest period
+// of goals, and their body weights.
+func LoadHistory(workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, userID int, goals []*store.Goal, loc *time.Location) (History, error) {
+	history := History{Workouts: []*store.Workout{}}
+	if len(goals) == 0 {
+		return history, nil
+	}
+
+	from := PeriodStart(goals[0], goals[0].CreatedAt, loc)
+	for _, goal := range goals[1:] {
+		start := PeriodStart(goal, goal.CreatedAt, loc)
+		if start.Before(from) {
+			from = start
+		}
+	}
+
+	var err error
+	history.Workouts, err = workoutStore.ListWorkouts(store.WorkoutFilter{UserID: userID, From: &from})
+	if err != nil {
+		return history, err
+	}
+
+	history.BodyWeights, err = measurementStore.GetBodyWeightLog(userID)
+	return history, err
+}
+
+func (t *Tracker) WorkoutSaved(workout *store.Workout) error {
+	return t.check(workout.UserID, &workout.PerformedAt)
+}
+
+func (t *Tracker) MeasurementSaved(measurement *store.Measurement) error {
+	return t.check(measurement.UserID, nil)
+}
+
+func (t *Tracker) check(userID int, performedAt *time.Time) error {
+	goals, err := t.goalStore.ListGoals(userID)
+	if err != nil {
+		return err
+	}
+	if len(goals) == 0 {
+		return nil
+	}
+
+	user, err := t.userStore.GetUserByID(userID)
+	if err != nil || user == nil {
+		return err
+	}
+	loc := user.Location()
+
+	history, err := LoadHistory(t.workoutStore, t.measurementStore, userID, goals, loc)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, goal := range goals {
+		periodStart, value, ok := Completion(goal, history, performedAt, now, loc)
+		if !ok {
+			continue
+		}
+		recorded, err := t.goalStore.RecordGoalCompletion(goal, periodStart, value)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			continue
+		}
+		t.logger.Printf("INFO: goalCompleted: %d for user %d", goal.ID, userID)
+		_, err = t.center.Publish(completedEvent(goal, periodStart, value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func completedEvent(goal *store.Goal, periodStart time.Time, value float64) notifications.Event {
+	body := "Your " + strings.ReplaceAll(goal.Type, "_", " ") + " goal"
+	if goal.ExerciseName != nil {
+		body += " for " + *goal.ExerciseName
+	}
+
+	return notifications.Event{
+		UserID: goal.UserID,
+		Type:   notifications.TypeGoalCompleted,
+		Title:  "Goal reached",
+		Body:   body + " was met.",
+		Data: map[string]interface{}{
+			"goal_id":      goal.ID,
+			"period_start": periodStart,
+			"value":        value,
+		},
+		Key: fmt.Sprintf("%s:%d:%d", notifications.TypeGoalCompleted, goal.ID, periodStart.Unix()),
+	}
+}
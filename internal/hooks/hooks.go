@@ -0,0 +1,103 @@
+// Package hooks runs follow-up work after users, workouts and body
+// measurements change, such as recomputing derived data. Hooks subscribe to
+// the domain events of the outbox, so they run after the change has been
+// committed, at least once and in order for each workout or measurement; a
+// failing hook is retried and never undoes the change.
+package hooks
+
+import (
+	"encoding/json"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/outbox"
+	"github.com/andras-szesztai/fem_fitness_project/internal/records"
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// UserRegisteredFunc is called with a user after they signed up.
+type UserRegisteredFunc func(user *store.User) error
+
+// WorkoutSavedFunc is called with a workout after it was created, updated or
+// finished in a live session.
+type WorkoutSavedFunc func(workout *store.Workout) error
+
+// RecordAchievedFunc is called with the owner and id of a saved workout and
+// a personal record set in it.
+type RecordAchievedFunc func(userID int, workoutID int, record stats.Record) error
+
+// WorkoutDeletedFunc is called with the owner and id of a deleted workout.
+type WorkoutDeletedFunc func(userID int, workoutID int) error
+
+// MeasurementSavedFunc is called with a body measurement after it was
+// created or updated.
+type MeasurementSavedFunc func(measurement *store.Measurement) error
+
+type Registry struct {
+	dispatcher *outbox.Dispatcher
+}
+
+func NewRegistry(dispatcher *outbox.Dispatcher) *Registry {
+	return &Registry{dispatcher: dispatcher}
+}
+
+func (r *Registry) OnUserRegistered(name string, fn UserRegisteredFunc) {
+	r.dispatcher.Subscribe(name, func(event *store.OutboxEvent) error {
+		var user store.User
+		err := json.Unmarshal(event.Payload, &user)
+		if err != nil {
+			return err
+		}
+		return fn(&user)
+	}, store.EventUserRegistered)
+}
+
+func (r *Registry) OnWorkoutCreated(name string, fn WorkoutSavedFunc) {
+	r.dispatcher.Subscribe(name, workoutHandler(fn), store.EventWorkoutCreated)
+}
+
+func (r *Registry) OnWorkoutUpdated(name string, fn WorkoutSavedFunc) {
+	r.dispatcher.Subscribe(name, workoutHandler(fn), store.EventWorkoutUpdated)
+}
+
+func (r *Registry) OnWorkoutSaved(name string, fn WorkoutSavedFunc) {
+	r.dispatcher.Subscribe(name, workoutHandler(fn), store.EventWorkoutCreated, store.EventWorkoutUpdated)
+}
+
+func workoutHandler(fn WorkoutSavedFunc) outbox.Handler {
+	return func(event *store.OutboxEvent) error {
+		var workout store.Workout
+		err := json.Unmarshal(event.Payload, &workout)
+		if err != nil {
+			return err
+		}
+		return fn(&workout)
+	}
+}
+
+func (r *Registry) OnRecordAchieved(name string, fn RecordAchievedFunc) {
+	r.dispatcher.Subscribe(name, func(event *store.OutboxEvent) error {
+		var achieved records.Achieved
+		err := json.Unmarshal(event.Payload, &achieved)
+		if err != nil {
+			return err
+		}
+		return fn(event.UserID, achieved.WorkoutID, achieved.Record)
+	}, store.EventRecordAchieved)
+}
+
+func (r *Registry) OnWorkoutDeleted(name string, fn WorkoutDeletedFunc) {
+	r.dispatcher.Subscribe(name, func(event *store.OutboxEvent) error {
+		return fn(event.UserID, event.AggregateID)
+	}, store.EventWorkoutDeleted)
+}
+
+func (r *Registry) OnMeasurementSaved(name string, fn MeasurementSavedFunc) {
+	r.dispatcher.Subscribe(name, func(event *store.OutboxEvent) error {
+		var measurement store.Measurement
+		err := json.Unmarshal(event.Payload, &measurement)
+		if err != nil {
+			return err
+		}
+		return fn(&measurement)
+	}, store.EventMeasurementCreated, store.EventMeasurementUpdated)
+}
@@ -0,0 +1,41 @@
+package housekeeping
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// CleanupIdempotencyKeysJob deletes expired idempotency keys along with the
+// responses stored for them.
+var CleanupIdempotencyKeysJob = jobs.NewKind[struct{}]("idempotency.cleanup")
+
+type IdempotencyCleaner struct {
+	idempotencyStore store.IdempotencyStore
+	logger           *log.Logger
+}
+
+func NewIdempotencyCleaner(idempotencyStore store.IdempotencyStore, logger *log.Logger) *IdempotencyCleaner {
+	return &IdempotencyCleaner{idempotencyStore: idempotencyStore, logger: logger}
+}
+
+// IdempotencyCleanupInterval returns how often expired keys are deleted for
+// keys kept for ttl: every ttl, but at least hourly, so an expired key and
+// its response outlive ttl by at most an hour.
+func IdempotencyCleanupInterval(ttl time.Duration) time.Duration {
+	return min(ttl, time.Hour)
+}
+
+// CleanupIdempotencyKeys handles CleanupIdempotencyKeysJob.
+func (ic *IdempotencyCleaner) CleanupIdempotencyKeys(ctx context.Context, _ struct{}) error {
+	deleted, err := ic.idempotencyStore.DeleteExpiredKeys()
+	if err != nil {
+		return err
+	}
+
+	ic.logger.Printf("INFO: cleanupIdempotencyKeys: deleted %d expired", deleted)
+	return nil
+}
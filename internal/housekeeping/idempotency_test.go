@@ -0,0 +1,13 @@
+package housekeeping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyCleanupInterval(t *testing.T) {
+	assert.Equal(t, 30*time.Minute, IdempotencyCleanupInterval(30*time.Minute))
+	assert.Equal(t, time.Hour, IdempotencyCleanupInterval(24*time.Hour))
+}
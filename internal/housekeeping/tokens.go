@@ -0,0 +1,75 @@
+// Package housekeeping holds the background jobs that keep tables from
+// growing without bound.
+package housekeeping
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// tokenBatchSize is how many expired tokens one statement deletes, which
+// keeps each delete short.
+const tokenBatchSize = 1000
+
+// CleanupTokensJob deletes expired tokens.
+var CleanupTokensJob = jobs.NewKind[struct{}]("tokens.cleanup")
+
+type TokenCleaner struct {
+	tokenStore store.TokenStore
+	logger     *log.Logger
+}
+
+func NewTokenCleaner(tokenStore store.TokenStore, logger *log.Logger) *TokenCleaner {
+	return &TokenCleaner{tokenStore: tokenStore, logger: logger}
+}
+
+// CleanupTokens handles CleanupTokensJob. It deletes expired tokens in
+// batches until none are left, then logs how many tokens are active.
+func (tc *TokenCleaner) CleanupTokens(ctx context.Context, _ struct{}) error {
+	var deleted int64
+	for {
+		n, err := tc.tokenStore.DeleteExpiredTokens(tokenBatchSize)
+		if err != nil {
+			return err
+		}
+		deleted += n
+		if n < tokenBatchSize {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	counts, err := tc.tokenStore.CountTokens()
+	if err != nil {
+		return err
+	}
+
+	tc.logger.Printf("INFO: cleanupTokens: deleted %d expired; active %s", deleted, formatCounts(counts.Active))
+	return nil
+}
+
+// formatCounts lists counts as scope=count pairs in scope order.
+func formatCounts(counts map[string]int) string {
+	scopes := make([]string, 0, len(counts))
+	for scope := range counts {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	pairs := make([]string, len(scopes))
+	for i, scope := range scopes {
+		pairs[i] = fmt.Sprintf("%s=%d", scope, counts[scope])
+	}
+	if len(pairs) == 0 {
+		return "none"
+	}
+	return strings.Join(pairs, " ")
+}
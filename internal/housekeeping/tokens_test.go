@@ -0,0 +1,56 @@
+package housekeeping
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTokenStore struct {
+	store.TokenStore
+	expired int64
+	limits  []int
+}
+
+func (f *fakeTokenStore) DeleteExpiredTokens(limit int) (int64, error) {
+	f.limits = append(f.limits, limit)
+	n := min(f.expired, int64(limit))
+	f.expired -= n
+	return n, nil
+}
+
+func (f *fakeTokenStore) CountTokens() (*store.TokenCounts, error) {
+	return &store.TokenCounts{Active: map[string]int{"authentication": 2}}, nil
+}
+
+func TestCleanupTokensDeletesInBatches(t *testing.T) {
+	fake := &fakeTokenStore{expired: 2*tokenBatchSize + 5}
+	cleaner := NewTokenCleaner(fake, log.New(io.Discard, "", 0))
+
+	err := cleaner.CleanupTokens(context.Background(), struct{}{})
+	require.NoError(t, err)
+
+	assert.Len(t, fake.limits, 3)
+	assert.Zero(t, fake.expired)
+}
+
+func TestCleanupTokensStopsWhenCancelled(t *testing.T) {
+	fake := &fakeTokenStore{expired: 3 * tokenBatchSize}
+	cleaner := NewTokenCleaner(fake, log.New(io.Discard, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := cleaner.CleanupTokens(ctx, struct{}{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, fake.limits, 1)
+}
+
+func TestFormatCounts(t *testing.T) {
+	assert.Equal(t, "none", formatCounts(nil))
+	assert.Equal(t, "authentication=3 refresh=1", formatCounts(map[string]int{"refresh": 1, "authentication": 3}))
+}
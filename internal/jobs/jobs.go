@@ -0,0 +1,247 @@
+// Package jobs runs asynchronous work, such as email, imports and
+// recomputations, from a queue of jobs stored in Postgres.
+//
+// Every kind of job has a payload type and a handler registered with
+// Handle. A pool of workers claims due jobs with FOR UPDATE SKIP LOCKED,
+// so any number of processes can share the queue. A failed job is retried
+// with exponential backoff until it runs out of attempts or fails with a
+// Permanent error, then it is dead and waits for an admin to retry it.
+// Delivery is at least once: a job whose worker died is run again once its
+// lease runs out, so handlers must be safe to repeat.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	// DefaultMaxAttempts is how often a job is tried unless it says
+	// otherwise.
+	DefaultMaxAttempts = 5
+
+	// lease is how long a worker holds a job; a handler that runs longer
+	// has its context cancelled.
+	lease = 10 * time.Minute
+
+	firstRetryDelay = 10 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+)
+
+// Kind names a kind of job whose payload is a P.
+type Kind[P any] struct {
+	name string
+}
+
+func NewKind[P any](name string) Kind[P] {
+	return Kind[P]{name: name}
+}
+
+func (k Kind[P]) Name() string {
+	return k.name
+}
+
+// Options adjust a job when it is enqueued.
+type Options struct {
+	// RunAt delays the job until then; the zero value runs it now.
+	RunAt time.Time
+	// UniqueKey, when set, keeps a second job of the kind with the same key
+	// from being queued while the first is queued or running.
+	UniqueKey string
+	// MaxAttempts defaults to DefaultMaxAttempts.
+	MaxAttempts int
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as a failure retrying cannot fix, which makes the
+// job dead at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type handler func(ctx context.Context, payload json.RawMessage) error
+
+type Queue struct {
+	jobStore store.JobStore
+	mu       sync.RWMutex
+	handlers map[string]handler
+	logger   *log.Logger
+}
+
+func NewQueue(jobStore store.JobStore, logger *log.Logger) *Queue {
+	return &Queue{jobStore: jobStore, handlers: map[string]handler{}, logger: logger}
+}
+
+// Handle runs fn for every job of the kind. Workers only claim jobs of the
+// kinds that have a handler.
+func Handle[P any](q *Queue, kind Kind[P], fn func(ctx context.Context, payload P) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.handlers[kind.name]; ok {
+		panic(fmt.Sprintf("jobs: kind %q handled twice", kind.name))
+	}
+	q.handlers[kind.name] = func(ctx context.Context, raw json.RawMessage) error {
+		var payload P
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return Permanent(fmt.Errorf("decode payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// Enqueue queues a job of the kind. When opts name a unique key that a
+// queued or running job of the kind already has, that job is returned
+// instead of a new one.
+func Enqueue[P any](q *Queue, kind Kind[P], payload P, opts Options) (*store.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &store.Job{
+		Kind:        kind.name,
+		Payload:     raw,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+
+	_, err = q.jobStore.EnqueueJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Every enqueues a job of the kind every interval, starting now, until the
+// process exits. The kind's name is the job's unique key, so processes
+// sharing the queue do not pile up runs of it.
+func Every[P any](q *Queue, kind Kind[P], payload P, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for ; ; <-ticker.C {
+			_, err := Enqueue(q, kind, payload, Options{UniqueKey: kind.name})
+			if err != nil {
+				q.logger.Printf("ERROR: enqueueJob %s: %s", kind.name, err)
+			}
+		}
+	}()
+}
+
+// Backoff returns how long to wait before the attempt after the given
+// number of failed ones: 10 seconds after the first, doubling up to six
+// hours.
+func Backoff(failures int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (q *Queue) kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Start runs the given number of workers until the process exits. A worker
+// that finds no due job waits pollInterval before looking again.
+func (q *Queue) Start(workers int, pollInterval time.Duration) {
+	for i := 0; i < workers; i++ {
+		go q.work(pollInterval)
+	}
+}
+
+func (q *Queue) work(pollInterval time.Duration) {
+	for {
+		ran, err := q.RunNext()
+		if err != nil {
+			q.logger.Printf("ERROR: runJob: %s", err)
+		}
+		if !ran || err != nil {
+			time.Sleep(pollInterval)
+		}
+	}
+}
+
+// RunNext claims a due job, runs it and records the outcome. It reports
+// whether there was a job to run.
+func (q *Queue) RunNext() (bool, error) {
+	job, err := q.jobStore.ClaimJob(q.kinds(), lease)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	err = q.run(job)
+	if err == nil {
+		return true, q.jobStore.CompleteJob(job)
+	}
+
+	q.logger.Printf("ERROR: job %d (%s): attempt %d: %s", job.ID, job.Kind, job.Attempts, err)
+	var retryAt *time.Time
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanentError{}) {
+		t := time.Now().Add(Backoff(job.Attempts))
+		retryAt = &t
+	} else {
+		q.logger.Printf("ERROR: job %d (%s): dead after %d attempts", job.ID, job.Kind, job.Attempts)
+	}
+	return true, q.jobStore.FailJob(job, err.Error(), retryAt)
+}
+
+// run calls the job's handler within its lease, turning a panic into an
+// error. A job claimed again after its worker died may be past its last
+// attempt already.
+func (q *Queue) run(job *store.Job) (err error) {
+	if job.Attempts > job.MaxAttempts {
+		return Permanent(errors.New("lease ran out on the last attempt"))
+	}
+
+	q.mu.RLock()
+	handle := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lease)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handle(ctx, job.Payload)
+}
@@ -0,0 +1,189 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJobStore struct {
+	store.JobStore
+	enqueued  []*store.Job
+	claimable *store.Job
+	kinds     []string
+	completed []int
+	failed    []string
+	retryAt   []*time.Time
+}
+
+func (f *fakeJobStore) EnqueueJob(job *store.Job) (bool, error) {
+	job.ID = len(f.enqueued) + 1
+	f.enqueued = append(f.enqueued, job)
+	return true, nil
+}
+
+func (f *fakeJobStore) ClaimJob(kinds []string, lease time.Duration) (*store.Job, error) {
+	f.kinds = kinds
+	job := f.claimable
+	f.claimable = nil
+	if job != nil {
+		job.Attempts++
+	}
+	return job, nil
+}
+
+func (f *fakeJobStore) CompleteJob(job *store.Job) error {
+	f.completed = append(f.completed, job.ID)
+	return nil
+}
+
+func (f *fakeJobStore) FailJob(job *store.Job, message string, retryAt *time.Time) error {
+	f.failed = append(f.failed, message)
+	f.retryAt = append(f.retryAt, retryAt)
+	return nil
+}
+
+type emailPayload struct {
+	UserID int `json:"user_id"`
+}
+
+var sendEmail = NewKind[emailPayload]("email.send")
+
+func newTestQueue() (*Queue, *fakeJobStore) {
+	fake := &fakeJobStore{}
+	return NewQueue(fake, log.New(io.Discard, "", 0)), fake
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Backoff(1))
+	assert.Equal(t, 40*time.Second, Backoff(3))
+	assert.Equal(t, 6*time.Hour, Backoff(20))
+}
+
+func TestEnqueueAppliesOptions(t *testing.T) {
+	q, fake := newTestQueue()
+	runAt := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	job, err := Enqueue(q, sendEmail, emailPayload{UserID: 3}, Options{RunAt: runAt, UniqueKey: "welcome:3"})
+	require.NoError(t, err)
+
+	require.Len(t, fake.enqueued, 1)
+	assert.Equal(t, "email.send", job.Kind)
+	assert.JSONEq(t, `{"user_id": 3}`, string(job.Payload))
+	assert.Equal(t, runAt, job.RunAt)
+	assert.Equal(t, DefaultMaxAttempts, job.MaxAttempts)
+	require.NotNil(t, job.UniqueKey)
+	assert.Equal(t, "welcome:3", *job.UniqueKey)
+}
+
+func TestRunNextDecodesPayload(t *testing.T) {
+	q, fake := newTestQueue()
+	var got emailPayload
+	Handle(q, sendEmail, func(ctx context.Context, payload emailPayload) error {
+		got = payload
+		return nil
+	})
+	fake.claimable = &store.Job{ID: 7, Kind: sendEmail.Name(), Payload: json.RawMessage(`{"user_id": 3}`), MaxAttempts: 5}
+
+	ran, err := q.RunNext()
+	require.NoError(t, err)
+
+	assert.True(t, ran)
+	assert.Equal(t, []string{"email.send"}, fake.kinds)
+	assert.Equal(t, 3, got.UserID)
+	assert.Equal(t, []int{7}, fake.completed)
+}
+
+func TestRunNextRetriesFailures(t *testing.T) {
+	q, fake := newTestQueue()
+	Handle(q, sendEmail, func(ctx context.Context, payload emailPayload) error {
+		return errors.New("relay unavailable")
+	})
+	fake.claimable = &store.Job{ID: 7, Kind: sendEmail.Name(), Payload: json.RawMessage(`{}`), Attempts: 1, MaxAttempts: 5}
+
+	_, err := q.RunNext()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"relay unavailable"}, fake.failed)
+	require.NotNil(t, fake.retryAt[0])
+	assert.WithinDuration(t, time.Now().Add(Backoff(2)), *fake.retryAt[0], time.Second)
+}
+
+func TestRunNextDeadLetters(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(ctx context.Context, payload emailPayload) error
+		job     store.Job
+		message string
+	}{
+		{
+			name:    "out of attempts",
+			handler: func(ctx context.Context, payload emailPayload) error { return errors.New("relay unavailable") },
+			job:     store.Job{Payload: json.RawMessage(`{}`), Attempts: 4, MaxAttempts: 5},
+			message: "relay unavailable",
+		},
+		{
+			name:    "permanent error",
+			handler: func(ctx context.Context, payload emailPayload) error { return Permanent(errors.New("no such user")) },
+			job:     store.Job{Payload: json.RawMessage(`{}`), MaxAttempts: 5},
+			message: "no such user",
+		},
+		{
+			name:    "invalid payload",
+			handler: func(ctx context.Context, payload emailPayload) error { return nil },
+			job:     store.Job{Payload: json.RawMessage(`[]`), MaxAttempts: 5},
+			message: "decode payload: json: cannot unmarshal array into Go value of type jobs.emailPayload",
+		},
+		{
+			name:    "lease ran out on the last attempt",
+			handler: func(ctx context.Context, payload emailPayload) error { return nil },
+			job:     store.Job{Payload: json.RawMessage(`{}`), Attempts: 5, MaxAttempts: 5},
+			message: "lease ran out on the last attempt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fake := newTestQueue()
+			Handle(q, sendEmail, tt.handler)
+			job := tt.job
+			job.Kind = sendEmail.Name()
+			fake.claimable = &job
+
+			_, err := q.RunNext()
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{tt.message}, fake.failed)
+			assert.Nil(t, fake.retryAt[0])
+		})
+	}
+}
+
+func TestRunNextRecoversPanics(t *testing.T) {
+	q, fake := newTestQueue()
+	Handle(q, sendEmail, func(ctx context.Context, payload emailPayload) error {
+		panic("boom")
+	})
+	fake.claimable = &store.Job{ID: 7, Kind: sendEmail.Name(), Payload: json.RawMessage(`{}`), MaxAttempts: 5}
+
+	_, err := q.RunNext()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"panic: boom"}, fake.failed)
+}
+
+func TestRunNextWithoutDueJobs(t *testing.T) {
+	q, _ := newTestQueue()
+
+	ran, err := q.RunNext()
+	require.NoError(t, err)
+	assert.False(t, ran)
+}
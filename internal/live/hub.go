@@ -0,0 +1,114 @@
+// Package live fans out events to every device following a topic. A topic
+// is an ID whose meaning belongs to the hub's owner: a workout session for
+// session streams, a user for notification streams. Subscriptions are held
+// in memory, so all devices following a topic must be connected to the
+// same server instance.
+package live
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 32
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	At   time.Time   `json:"at"`
+}
+
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{}
+	timers      map[int]*time.Timer
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: map[int]map[chan Event]struct{}{},
+		timers:      map[int]*time.Timer{},
+	}
+}
+
+// Subscribe returns the events published to the topic and a function that
+// ends the subscription.
+func (h *Hub) Subscribe(topic int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = map[chan Event]struct{}{}
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[topic], ch)
+			if len(h.subscribers[topic]) == 0 {
+				delete(h.subscribers, topic)
+			}
+		})
+	}
+}
+
+// Publish sends the event to every subscriber of the topic, skipping those
+// that have fallen subscriberBuffer events behind.
+func (h *Hub) Publish(topic int, eventType string, data interface{}) {
+	event := Event{Type: eventType, Data: data, At: time.Now().UTC()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[topic] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// StartTimer calls fn after d unless the topic's timer is restarted or
+// stopped first. A topic has at most one timer.
+func (h *Hub) StartTimer(topic int, d time.Duration, fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if timer, ok := h.timers[topic]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		h.mu.Lock()
+		current := h.timers[topic] == timer
+		if current {
+			delete(h.timers, topic)
+		}
+		h.mu.Unlock()
+
+		if current {
+			fn()
+		}
+	})
+	h.timers[topic] = timer
+}
+
+// StopTimer cancels the topic's timer and reports whether one was running.
+func (h *Hub) StopTimer(topic int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	timer, ok := h.timers[topic]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(h.timers, topic)
+	return true
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/utils"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// maxIdempotentRequestBytes is the largest upload any route accepts, the
+	// activity import; routes with smaller limits still enforce their own.
+	maxIdempotentRequestBytes = 64 << 20
+	// Bodies larger than maxIdempotentMemoryBytes are spooled to a
+	// temporary file instead of memory.
+	maxIdempotentMemoryBytes = 1 << 20
+	// idempotencyLease is how long a request holds its key before a retry
+	// may take it over. It outlasts the server's write timeout, so a request
+	// still being served keeps its key.
+	idempotencyLease = time.Minute
+)
+
+type IdempotencyMiddleware struct {
+	store  store.IdempotencyStore
+	ttl    time.Duration
+	logger *log.Logger
+}
+
+func NewIdempotencyMiddleware(store store.IdempotencyStore, ttl time.Duration, logger *log.Logger) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{store: store, ttl: ttl, logger: logger}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// spooledBody is a request body read ahead of the handler, held in memory
+// when small and in a temporary file otherwise.
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+func (b *spooledBody) Close() error {
+	return nil
+}
+
+func (b *spooledBody) remove() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+}
+
+// spoolBody reads body to the end, writing it to hash as it goes, so the
+// request can be fingerprinted before the handler reads it.
+func spoolBody(body io.Reader, hash io.Writer) (*spooledBody, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(io.MultiWriter(&buf, hash), body, maxIdempotentMemoryBytes+1)
+	if err == io.EOF {
+		return &spooledBody{Reader: &buf}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "idempotent-body-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledBody{Reader: file, file: file}
+
+	_, err = buf.WriteTo(file)
+	if err == nil {
+		_, err = io.Copy(io.MultiWriter(file, hash), body)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spooled.remove()
+		return nil, err
+	}
+
+	return spooled, nil
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// Idempotent makes mutating requests carrying an Idempotency-Key header safe
+// to retry. It must run after Authenticate since keys are scoped per user.
+func (im *IdempotencyMiddleware) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		user := GetUser(r)
+		if key == "" || !isMutatingMethod(r.Method) || user.IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Idempotency key is too long"})
+			return
+		}
+
+		fingerprint := sha256.New()
+		fingerprint.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		body, err := spoolBody(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes), fingerprint)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "Request body is too large"})
+			return
+		}
+		if err != nil {
+			im.logger.Printf("ERROR: readIdempotentBody: %s", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+			return
+		}
+		defer body.remove()
+		r.Body = body
+		requestHash := fingerprint.Sum(nil)
+
+		record, reserved, err := im.store.ReserveKey(user.ID, key, requestHash, im.ttl, idempotencyLease)
+		if err != nil {
+			im.logger.Printf("ERROR: reserveIdempotencyKey: %s", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+			return
+		}
+
+		if !reserved {
+			if !bytes.Equal(record.RequestHash, requestHash) {
+				utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "Idempotency key was already used with a different request"})
+				return
+			}
+			if !record.IsCompleted() {
+				utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "A request with this idempotency key is already in progress"})
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(*record.StatusCode)
+			w.Write(record.ResponseBody)
+			return
+		}
+
+		// A panicking handler stored nothing, so the key is freed for a retry
+		// before the panic carries on up to the server.
+		defer func() {
+			if p := recover(); p != nil {
+				err := im.store.ReleaseKey(user.ID, key)
+				if err != nil {
+					im.logger.Printf("ERROR: releaseIdempotencyKey: %s", err)
+				}
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors are not stored so the client can retry with the same key.
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			err = im.store.ReleaseKey(user.ID, key)
+			if err != nil {
+				im.logger.Printf("ERROR: releaseIdempotencyKey: %s", err)
+			}
+			return
+		}
+
+		err = im.store.CompleteKey(user.ID, key, recorder.status, recorder.body.Bytes())
+		if err != nil {
+			im.logger.Printf("ERROR: completeIdempotencyKey: %s", err)
+		}
+	})
+}
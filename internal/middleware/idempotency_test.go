@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryIdempotencyStore struct {
+	records map[string]*store.IdempotencyRecord
+}
+
+func (m *memoryIdempotencyStore) ReserveKey(userID int, key string, requestHash []byte, ttl time.Duration, lease time.Duration) (*store.IdempotencyRecord, bool, error) {
+	existing, ok := m.records[key]
+	if ok && (existing.IsCompleted() || existing.LockedUntil.After(time.Now()) || !bytes.Equal(existing.RequestHash, requestHash)) {
+		return existing, false, nil
+	}
+	record := &store.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash, ExpiresAt: time.Now().Add(ttl), LockedUntil: time.Now().Add(lease)}
+	m.records[key] = record
+	return record, true, nil
+}
+
+func (m *memoryIdempotencyStore) CompleteKey(userID int, key string, statusCode int, responseBody []byte) error {
+	m.records[key].StatusCode = &statusCode
+	m.records[key].ResponseBody = responseBody
+	return nil
+}
+
+func (m *memoryIdempotencyStore) ReleaseKey(userID int, key string) error {
+	delete(m.records, key)
+	return nil
+}
+
+func (m *memoryIdempotencyStore) DeleteExpiredKeys() (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotent(t *testing.T) {
+	idempotencyStore := &memoryIdempotencyStore{records: map[string]*store.IdempotencyRecord{}}
+	im := NewIdempotencyMiddleware(idempotencyStore, time.Hour, log.New(io.Discard, "", 0))
+
+	calls := 0
+	handler := im.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 1}`))
+	}))
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/workouts", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "abc")
+		req = SetUser(req, &store.User{ID: 1})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send(`{"title": "Legs"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	replay := send(`{"title": "Legs"}`)
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, `{"id": 1}`, replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	mismatch := send(`{"title": "Arms"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	idempotencyStore.records["abc"].StatusCode = nil
+	inProgress := send(`{"title": "Legs"}`)
+	assert.Equal(t, http.StatusConflict, inProgress.Code)
+	assert.Equal(t, 1, calls)
+
+	idempotencyStore.records["abc"].LockedUntil = time.Now().Add(-time.Second)
+	takenOver := send(`{"title": "Legs"}`)
+	assert.Equal(t, http.StatusCreated, takenOver.Code)
+	assert.Empty(t, takenOver.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	idempotencyStore := &memoryIdempotencyStore{records: map[string]*store.IdempotencyRecord{}}
+	im := NewIdempotencyMiddleware(idempotencyStore, time.Hour, log.New(io.Discard, "", 0))
+
+	handler := im.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/workouts", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "abc")
+	req = SetUser(req, &store.User{ID: 1})
+
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+	assert.NotContains(t, idempotencyStore.records, "abc")
+}
+
+func TestIdempotentLargeBodies(t *testing.T) {
+	idempotencyStore := &memoryIdempotencyStore{records: map[string]*store.IdempotencyRecord{}}
+	im := NewIdempotencyMiddleware(idempotencyStore, time.Hour, log.New(io.Discard, "", 0))
+
+	var received int
+	handler := im.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		received = len(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func(key string, size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/import/activity", bytes.NewReader(make([]byte, size)))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		req = SetUser(req, &store.User{ID: 1})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	spooled := send("spooled", 3*maxIdempotentMemoryBytes)
+	assert.Equal(t, http.StatusCreated, spooled.Code)
+	assert.Equal(t, 3*maxIdempotentMemoryBytes, received)
+
+	tooLarge := send("too-large", maxIdempotentRequestBytes+1)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, tooLarge.Code)
+	assert.NotContains(t, idempotencyStore.records, "too-large")
+}
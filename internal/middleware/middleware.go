@@ -80,3 +80,15 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireAdmin lets only users flagged as admins through.
+func (um *UserMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !GetUser(r).IsAdmin {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "Admin access required"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
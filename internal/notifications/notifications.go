@@ -0,0 +1,125 @@
+// Package notifications is the one way events reach a user's notification
+// center. Publishing an event applies the user's preferences, stores the
+// notification and pushes it to the user's open streams.
+package notifications
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/live"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	TypePersonalRecord   = "personal_record"
+	TypeComment          = "comment"
+	TypeLike             = "like"
+	TypeCoachAssigned    = "coach_assigned"
+	TypeGoalCompleted    = "goal_completed"
+	TypeAchievement      = "achievement_awarded"
+	TypeScheduleReminder = "schedule_reminder"
+	TypeScheduleMissed   = "schedule_missed"
+)
+
+// Types lists every notification type a user can turn off.
+var Types = []string{
+	TypePersonalRecord,
+	TypeComment,
+	TypeLike,
+	TypeCoachAssigned,
+	TypeGoalCompleted,
+	TypeAchievement,
+	TypeScheduleReminder,
+	TypeScheduleMissed,
+}
+
+// StreamEventNotification is the type of stream events carrying a new
+// notification.
+const StreamEventNotification = "notification"
+
+func ValidType(notificationType string) bool {
+	for _, t := range Types {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// Preferences returns whether each type is on, given the choices a user
+// saved.
+func Preferences(saved map[string]bool) map[string]bool {
+	preferences := make(map[string]bool, len(Types))
+	for _, t := range Types {
+		enabled, ok := saved[t]
+		preferences[t] = !ok || enabled
+	}
+	return preferences
+}
+
+// Event is something a user should hear about. Key, when not empty,
+// identifies the event so it notifies once however often it is published.
+type Event struct {
+	UserID int
+	Type   string
+	Title  string
+	Body   string
+	Data   interface{}
+	Key    string
+}
+
+type Center struct {
+	notificationStore store.NotificationStore
+	hub               *live.Hub
+	logger            *log.Logger
+}
+
+func NewCenter(notificationStore store.NotificationStore, logger *log.Logger) *Center {
+	return &Center{notificationStore: notificationStore, hub: live.NewHub(), logger: logger}
+}
+
+// Publish notifies the user of event. It returns nil without an error when
+// the user turned the type off or the event was already published.
+func (c *Center) Publish(event Event) (*store.Notification, error) {
+	saved, err := c.notificationStore.GetNotificationPreferences(event.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled, ok := saved[event.Type]; ok && !enabled {
+		return nil, nil
+	}
+
+	notification := &store.Notification{
+		UserID: event.UserID,
+		Type:   event.Type,
+		Title:  event.Title,
+		Body:   event.Body,
+	}
+	if event.Data != nil {
+		notification.Data, err = json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if key := strings.TrimSpace(event.Key); key != "" {
+		notification.DedupeKey = &key
+	}
+
+	created, err := c.notificationStore.CreateNotification(notification)
+	if err != nil || !created {
+		return nil, err
+	}
+
+	c.logger.Printf("INFO: notify: %s %d for user %d", notification.Type, notification.ID, notification.UserID)
+	c.hub.Publish(event.UserID, StreamEventNotification, notification)
+	return notification, nil
+}
+
+// Subscribe returns the notifications published for the user from now on
+// and a function that ends the subscription. Subscriptions are held in
+// memory, so only notifications published by this server instance arrive.
+func (c *Center) Subscribe(userID int) (<-chan live.Event, func()) {
+	return c.hub.Subscribe(userID)
+}
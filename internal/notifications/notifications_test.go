@@ -0,0 +1,36 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferencesDefaultToOn(t *testing.T) {
+	preferences := Preferences(map[string]bool{TypeLike: false, TypeComment: true, "unknown": false})
+
+	assert.Len(t, preferences, len(Types))
+	assert.False(t, preferences[TypeLike])
+	assert.True(t, preferences[TypeComment])
+	assert.True(t, preferences[TypeGoalCompleted])
+	assert.NotContains(t, preferences, "unknown")
+}
+
+func TestValidType(t *testing.T) {
+	assert.True(t, ValidType(TypeScheduleReminder))
+	assert.False(t, ValidType("newsletter"))
+}
+
+func TestRecordEventUsesPreferredUnits(t *testing.T) {
+	user := &store.User{ID: 4, Units: "imperial"}
+
+	event := RecordEvent(user, 12, stats.Record{ExerciseName: "Bench Press", OneRepMax: 100, Previous: 90})
+
+	assert.Equal(t, 4, event.UserID)
+	assert.Equal(t, TypePersonalRecord, event.Type)
+	assert.Equal(t, "New personal record: Bench Press", event.Title)
+	assert.Equal(t, "Estimated one-rep max of 220.46 lb, up from 198.42 lb.", event.Body)
+	assert.Equal(t, "personal_record:12:bench press", event.Key)
+}
@@ -0,0 +1,53 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+// RecordNotifier notifies users of the personal records they set.
+type RecordNotifier struct {
+	center    *Center
+	userStore store.UserStore
+}
+
+func NewRecordNotifier(center *Center, userStore store.UserStore) *RecordNotifier {
+	return &RecordNotifier{center: center, userStore: userStore}
+}
+
+func (rn *RecordNotifier) RecordAchieved(userID int, workoutID int, record stats.Record) error {
+	user, err := rn.userStore.GetUserByID(userID)
+	if err != nil || user == nil {
+		return err
+	}
+
+	_, err = rn.center.Publish(RecordEvent(user, workoutID, record))
+	return err
+}
+
+// RecordEvent is the event of user setting record in a workout, with
+// weights shown in the units the user prefers.
+func RecordEvent(user *store.User, workoutID int, record stats.Record) Event {
+	unit := units.WeightUnit(user.Units)
+	oneRepMax := units.Round(units.FromKilograms(record.OneRepMax, unit), units.WeightPlaces)
+	previous := units.Round(units.FromKilograms(record.Previous, unit), units.WeightPlaces)
+
+	return Event{
+		UserID: user.ID,
+		Type:   TypePersonalRecord,
+		Title:  "New personal record: " + record.ExerciseName,
+		Body:   fmt.Sprintf("Estimated one-rep max of %g %s, up from %g %s.", oneRepMax, unit, previous, unit),
+		Data: map[string]interface{}{
+			"workout_id":    workoutID,
+			"exercise_name": record.ExerciseName,
+			"one_rep_max":   oneRepMax,
+			"previous":      previous,
+			"unit":          unit,
+		},
+		Key: fmt.Sprintf("%s:%d:%s", TypePersonalRecord, workoutID, strings.ToLower(record.ExerciseName)),
+	}
+}
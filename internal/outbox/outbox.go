@@ -0,0 +1,201 @@
+// Package outbox delivers the domain events that stores write to the outbox
+// table, in the transaction of the change they describe, to in-process
+// subscribers.
+//
+// Delivery is at least once: an event is retried with backoff until every
+// subscriber handled it, skipping those that already did, so subscribers
+// must tolerate seeing an event again. Events of one aggregate are
+// dispatched in the order they were written, and an event waiting for a
+// retry holds back the later events of its aggregate.
+package outbox
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	// MaxAttempts is how often an event is dispatched before the
+	// subscribers that keep failing are given up on.
+	MaxAttempts = 10
+
+	// batchSize is how many events one query takes.
+	batchSize = 100
+	// retention is how long dispatched events are kept.
+	retention = 7 * 24 * time.Hour
+	// purgeInterval is how often dispatched events past retention are
+	// deleted.
+	purgeInterval = time.Hour
+
+	firstRetryDelay = 5 * time.Second
+	maxRetryDelay   = time.Hour
+)
+
+// Handler handles one event.
+type Handler func(event *store.OutboxEvent) error
+
+type subscription struct {
+	name   string
+	types  map[string]bool
+	handle Handler
+}
+
+type Dispatcher struct {
+	outboxStore   store.OutboxStore
+	mu            sync.RWMutex
+	subscriptions []subscription
+	logger        *log.Logger
+}
+
+func NewDispatcher(outboxStore store.OutboxStore, logger *log.Logger) *Dispatcher {
+	return &Dispatcher{outboxStore: outboxStore, logger: logger}
+}
+
+// Subscribe calls handle with every event of the given types. The name
+// records which events the subscriber handled, so it must stay the same
+// across releases and may be used only once per event type.
+func (d *Dispatcher) Subscribe(name string, handle Handler, eventTypes ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	types := map[string]bool{}
+	for _, eventType := range eventTypes {
+		for _, sub := range d.subscriptions {
+			if sub.name == name && sub.types[eventType] {
+				panic(fmt.Sprintf("outbox: subscriber %q subscribed to %s twice", name, eventType))
+			}
+		}
+		types[eventType] = true
+	}
+	d.subscriptions = append(d.subscriptions, subscription{name: name, types: types, handle: handle})
+}
+
+func (d *Dispatcher) subscribers(eventType string) []subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	subs := []subscription{}
+	for _, sub := range d.subscriptions {
+		if sub.types[eventType] {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Backoff returns how long to wait before dispatching an event again after
+// the given number of failed attempts: 5 seconds after the first, doubling
+// up to an hour.
+func Backoff(failures int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// Run dispatches pending events every interval until the process exits.
+func (d *Dispatcher) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var purged time.Time
+	for range ticker.C {
+		err := d.DispatchPending()
+		if err != nil {
+			d.logger.Printf("ERROR: dispatchOutbox: %s", err)
+		}
+
+		if time.Since(purged) >= purgeInterval {
+			purged = time.Now()
+			_, err = d.outboxStore.DeleteDispatchedEvents(purged.Add(-retention))
+			if err != nil {
+				d.logger.Printf("ERROR: deleteDispatchedEvents: %s", err)
+			}
+		}
+	}
+}
+
+// DispatchPending dispatches due events until none are left. It returns
+// at once when another process is dispatching.
+func (d *Dispatcher) DispatchPending() error {
+	unlock, ok, err := d.outboxStore.LockDispatcher()
+	if err != nil || !ok {
+		return err
+	}
+	defer func() {
+		err := unlock()
+		if err != nil {
+			d.logger.Printf("ERROR: unlockOutbox: %s", err)
+		}
+	}()
+
+	for {
+		events, err := d.outboxStore.ListPendingEvents(batchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		for _, event := range events {
+			err = d.dispatch(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dispatch hands the event to the subscribers that have not handled it
+// yet. The returned error is reserved for failures to record the outcome.
+func (d *Dispatcher) dispatch(event *store.OutboxEvent) error {
+	failures := []string{}
+	for _, sub := range d.subscribers(event.Type) {
+		if event.Delivered[sub.name] {
+			continue
+		}
+
+		err := call(sub.handle, event)
+		if err != nil {
+			d.logger.Printf("ERROR: outboxSubscriber %s: event %d (%s): %s", sub.name, event.ID, event.Type, err)
+			failures = append(failures, sub.name+": "+err.Error())
+			continue
+		}
+
+		err = d.outboxStore.MarkEventDelivered(event.ID, sub.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(failures) == 0 {
+		return d.outboxStore.MarkEventDispatched(event.ID)
+	}
+
+	var retryAt *time.Time
+	if attempts := event.Attempts + 1; attempts < MaxAttempts {
+		t := time.Now().Add(Backoff(attempts))
+		retryAt = &t
+	} else {
+		d.logger.Printf("ERROR: outboxEvent %d (%s): giving up after %d attempts", event.ID, event.Type, attempts)
+	}
+	return d.outboxStore.RecordEventFailure(event.ID, strings.Join(failures, "; "), retryAt)
+}
+
+// call runs handle, turning a panic into an error so one subscriber cannot
+// stop the others.
+func call(handle Handler, event *store.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handle(event)
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOutboxStore struct {
+	store.OutboxStore
+	delivered  []string
+	dispatched []int64
+	failures   []string
+	retryAt    []*time.Time
+}
+
+func (f *fakeOutboxStore) MarkEventDelivered(eventID int64, subscriber string) error {
+	f.delivered = append(f.delivered, subscriber)
+	return nil
+}
+
+func (f *fakeOutboxStore) MarkEventDispatched(eventID int64) error {
+	f.dispatched = append(f.dispatched, eventID)
+	return nil
+}
+
+func (f *fakeOutboxStore) RecordEventFailure(eventID int64, message string, retryAt *time.Time) error {
+	f.failures = append(f.failures, message)
+	f.retryAt = append(f.retryAt, retryAt)
+	return nil
+}
+
+func newTestDispatcher() (*Dispatcher, *fakeOutboxStore) {
+	fake := &fakeOutboxStore{}
+	return NewDispatcher(fake, log.New(io.Discard, "", 0)), fake
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, Backoff(1))
+	assert.Equal(t, 20*time.Second, Backoff(3))
+	assert.Equal(t, 2560*time.Second, Backoff(MaxAttempts))
+	assert.Equal(t, time.Hour, Backoff(20))
+}
+
+func TestDispatchSkipsDeliveredSubscribers(t *testing.T) {
+	d, fake := newTestDispatcher()
+	calls := []string{}
+	for _, name := range []string{"goals", "records", "webhooks"} {
+		d.Subscribe(name, func(event *store.OutboxEvent) error {
+			calls = append(calls, name)
+			return nil
+		}, store.EventWorkoutCreated)
+	}
+	d.Subscribe("challenges", func(event *store.OutboxEvent) error {
+		calls = append(calls, "challenges")
+		return nil
+	}, store.EventWorkoutDeleted)
+
+	err := d.dispatch(&store.OutboxEvent{ID: 7, Type: store.EventWorkoutCreated, Delivered: map[string]bool{"records": true}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"goals", "webhooks"}, calls)
+	assert.Equal(t, []string{"goals", "webhooks"}, fake.delivered)
+	assert.Equal(t, []int64{7}, fake.dispatched)
+}
+
+func TestDispatchRetriesFailedSubscribers(t *testing.T) {
+	d, fake := newTestDispatcher()
+	d.Subscribe("goals", func(event *store.OutboxEvent) error {
+		return errors.New("database is down")
+	}, store.EventWorkoutUpdated)
+	d.Subscribe("records", func(event *store.OutboxEvent) error {
+		panic("boom")
+	}, store.EventWorkoutUpdated)
+	d.Subscribe("webhooks", func(event *store.OutboxEvent) error {
+		return nil
+	}, store.EventWorkoutUpdated)
+
+	err := d.dispatch(&store.OutboxEvent{ID: 8, Type: store.EventWorkoutUpdated, Attempts: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"webhooks"}, fake.delivered)
+	assert.Empty(t, fake.dispatched)
+	require.Len(t, fake.failures, 1)
+	assert.Equal(t, "goals: database is down; records: panic: boom", fake.failures[0])
+	require.NotNil(t, fake.retryAt[0])
+	assert.WithinDuration(t, time.Now().Add(Backoff(3)), *fake.retryAt[0], time.Second)
+}
+
+func TestDispatchGivesUpAfterMaxAttempts(t *testing.T) {
+	d, fake := newTestDispatcher()
+	d.Subscribe("goals", func(event *store.OutboxEvent) error {
+		return errors.New("invalid payload")
+	}, store.EventMeasurementCreated)
+
+	err := d.dispatch(&store.OutboxEvent{ID: 9, Type: store.EventMeasurementCreated, Attempts: MaxAttempts - 1})
+	require.NoError(t, err)
+
+	require.Len(t, fake.retryAt, 1)
+	assert.Nil(t, fake.retryAt[0])
+}
+
+func TestSubscribeRejectsDuplicateNames(t *testing.T) {
+	d, _ := newTestDispatcher()
+	handle := func(event *store.OutboxEvent) error { return nil }
+
+	d.Subscribe("goals", handle, store.EventWorkoutCreated, store.EventWorkoutUpdated)
+	d.Subscribe("goals", handle, store.EventMeasurementCreated)
+
+	assert.Panics(t, func() {
+		d.Subscribe("goals", handle, store.EventWorkoutUpdated)
+	})
+}
@@ -0,0 +1,155 @@
+// Package progression suggests the next session of an exercise from the
+// recent ones, following a progression model. Weights are in kilograms.
+package progression
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+const (
+	ActionStart          = "start"
+	ActionIncreaseWeight = "increase_weight"
+	ActionAddReps        = "add_reps"
+	ActionRepeat         = "repeat"
+	ActionReduceWeight   = "reduce_weight"
+	ActionDeload         = "deload"
+)
+
+const (
+	defaultSets          = 3
+	defaultDeloadPercent = 10
+	defaultStallSessions = 3
+	defaultTargetRPE     = 8
+	// rpeOvershoot is how far above the target RPE a session may end before
+	// it counts as failed.
+	rpeOvershoot = 1
+)
+
+// Default returns the settings of model for an exercise, with weights going
+// up by 2.5 kg, or 5 lb for users of the imperial system.
+func Default(exerciseName string, model string, system string) store.ProgressionSettings {
+	settings := store.ProgressionSettings{
+		ExerciseName:  store.ExerciseKey(exerciseName),
+		Model:         model,
+		Sets:          defaultSets,
+		MinReps:       5,
+		MaxReps:       5,
+		Increment:     2.5,
+		DeloadPercent: defaultDeloadPercent,
+		StallSessions: defaultStallSessions,
+	}
+	if system == units.SystemImperial {
+		settings.Increment = units.Round(units.ToKilograms(5, units.Pounds), units.CanonicalWeightPlaces)
+	}
+
+	switch model {
+	case store.ProgressionModelDoubleProgression:
+		settings.MinReps, settings.MaxReps = 8, 12
+	case store.ProgressionModelRPE:
+		targetRPE := float64(defaultTargetRPE)
+		settings.TargetRPE = &targetRPE
+	}
+	return settings
+}
+
+// Suggestion is what to do in the next session. Failures counts the latest
+// sessions in a row that missed their target; the weight is deloaded once
+// they reach the settings' StallSessions.
+type Suggestion struct {
+	Action    string   `json:"action"`
+	Sets      int      `json:"sets"`
+	Reps      int      `json:"reps"`
+	Weight    *float64 `json:"weight"`
+	TargetRPE *float64 `json:"target_rpe"`
+	Failures  int      `json:"failures"`
+	Stalled   bool     `json:"stalled"`
+	Reason    string   `json:"reason"`
+}
+
+// roundTo rounds weight to the nearest multiple of step, never below one
+// step.
+func roundTo(weight float64, step float64) float64 {
+	rounded := math.Max(math.Round(weight/step), 1) * step
+	return units.Round(rounded, units.CanonicalWeightPlaces)
+}
+
+// failed reports whether the session missed what the settings aim for.
+func failed(settings store.ProgressionSettings, session store.ExerciseSession) bool {
+	if session.Sets < settings.Sets || session.Reps < settings.MinReps {
+		return true
+	}
+	return settings.Model == store.ProgressionModelRPE && session.RPE != nil && settings.TargetRPE != nil &&
+		*session.RPE > *settings.TargetRPE+rpeOvershoot
+}
+
+// EstimatedOneRepMax estimates a one-rep max from a set of reps at weight
+// that ended rpe, counting the reps left in reserve as if they were done.
+func EstimatedOneRepMax(weight float64, reps int, rpe float64) float64 {
+	return weight * (1 + (float64(reps)+10-rpe)/30)
+}
+
+// weightFor is the weight at which reps should end at rpe for oneRepMax.
+func weightFor(oneRepMax float64, reps int, rpe float64) float64 {
+	return oneRepMax / (1 + (float64(reps)+10-rpe)/30)
+}
+
+// Suggest proposes the next session from sessions, oldest first.
+func Suggest(settings store.ProgressionSettings, sessions []store.ExerciseSession) Suggestion {
+	suggestion := Suggestion{Sets: settings.Sets, Reps: settings.MinReps, TargetRPE: settings.TargetRPE}
+	if len(sessions) == 0 {
+		suggestion.Action = ActionStart
+		suggestion.Reason = "No weighted sets of this exercise were logged yet; start with a weight you can lift for every set with good form."
+		return suggestion
+	}
+
+	last := sessions[len(sessions)-1]
+	for i := len(sessions) - 1; i >= 0 && failed(settings, sessions[i]); i-- {
+		suggestion.Failures++
+	}
+
+	weight := last.Weight
+	switch {
+	case suggestion.Failures >= settings.StallSessions:
+		suggestion.Stalled = true
+		suggestion.Action = ActionDeload
+		weight = roundTo(last.Weight*(1-settings.DeloadPercent/100), settings.Increment)
+		suggestion.Reason = fmt.Sprintf("The target was missed in the last %d sessions; drop the weight by %g%% and build back up.", suggestion.Failures, settings.DeloadPercent)
+
+	case settings.Model == store.ProgressionModelRPE && last.RPE != nil:
+		target := roundTo(weightFor(EstimatedOneRepMax(last.Weight, last.Reps, *last.RPE), settings.MinReps, *settings.TargetRPE), settings.Increment)
+		switch {
+		case target > last.Weight:
+			suggestion.Action = ActionIncreaseWeight
+		case target < last.Weight:
+			suggestion.Action = ActionReduceWeight
+		default:
+			suggestion.Action = ActionRepeat
+		}
+		weight = target
+		suggestion.Reason = fmt.Sprintf("Based on %d reps at RPE %g last time, this weight should end at RPE %g.", last.Reps, *last.RPE, *settings.TargetRPE)
+
+	case suggestion.Failures > 0:
+		suggestion.Action = ActionRepeat
+		suggestion.Reason = "The last session missed the target; repeat the weight."
+
+	case settings.Model == store.ProgressionModelDoubleProgression && last.Reps < settings.MaxReps:
+		suggestion.Action = ActionAddReps
+		suggestion.Reps = last.Reps + 1
+		suggestion.Reason = fmt.Sprintf("Add a rep to every set until they all reach %d.", settings.MaxReps)
+
+	default:
+		suggestion.Action = ActionIncreaseWeight
+		weight = roundTo(last.Weight+settings.Increment, settings.Increment)
+		suggestion.Reason = "Every set hit the target last time; add weight."
+		if settings.Model == store.ProgressionModelRPE {
+			suggestion.Reason = "No RPE was logged last time and every set hit the target; add weight."
+		}
+	}
+
+	suggestion.Weight = &weight
+	return suggestion
+}
@@ -0,0 +1,91 @@
+package progression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func session(day int, weight float64, sets, reps int) store.ExerciseSession {
+	return store.ExerciseSession{PerformedAt: time.Date(2024, 5, day, 18, 0, 0, 0, time.UTC), Weight: weight, Sets: sets, Reps: reps}
+}
+
+func TestSuggestStart(t *testing.T) {
+	suggestion := Suggest(Default("Squat", store.ProgressionModelLinear, units.SystemMetric), nil)
+	assert.Equal(t, ActionStart, suggestion.Action)
+	assert.Nil(t, suggestion.Weight)
+	assert.Equal(t, 3, suggestion.Sets)
+	assert.Equal(t, 5, suggestion.Reps)
+}
+
+func TestSuggestLinear(t *testing.T) {
+	settings := Default("Squat", store.ProgressionModelLinear, units.SystemMetric)
+
+	suggestion := Suggest(settings, []store.ExerciseSession{session(1, 100, 3, 5)})
+	assert.Equal(t, ActionIncreaseWeight, suggestion.Action)
+	require.NotNil(t, suggestion.Weight)
+	assert.Equal(t, 102.5, *suggestion.Weight)
+
+	suggestion = Suggest(settings, []store.ExerciseSession{session(1, 100, 3, 5), session(3, 102.5, 3, 4)})
+	assert.Equal(t, ActionRepeat, suggestion.Action)
+	assert.Equal(t, 102.5, *suggestion.Weight)
+	assert.Equal(t, 1, suggestion.Failures)
+	assert.False(t, suggestion.Stalled)
+}
+
+func TestSuggestDeloadAfterRepeatedFailures(t *testing.T) {
+	settings := Default("Bench press", store.ProgressionModelLinear, units.SystemMetric)
+
+	sessions := []store.ExerciseSession{
+		session(1, 80, 3, 5),
+		session(3, 82.5, 3, 4),
+		session(5, 82.5, 2, 5),
+		session(7, 82.5, 3, 3),
+	}
+	suggestion := Suggest(settings, sessions)
+	assert.Equal(t, ActionDeload, suggestion.Action)
+	assert.True(t, suggestion.Stalled)
+	assert.Equal(t, 3, suggestion.Failures)
+	// 90% of 82.5 kg, rounded to 2.5 kg.
+	assert.Equal(t, 75.0, *suggestion.Weight)
+}
+
+func TestSuggestDoubleProgression(t *testing.T) {
+	settings := Default("Curl", store.ProgressionModelDoubleProgression, units.SystemImperial)
+
+	suggestion := Suggest(settings, []store.ExerciseSession{session(1, 20, 3, 9)})
+	assert.Equal(t, ActionAddReps, suggestion.Action)
+	assert.Equal(t, 10, suggestion.Reps)
+	assert.Equal(t, 20.0, *suggestion.Weight)
+
+	suggestion = Suggest(settings, []store.ExerciseSession{session(1, units.ToKilograms(45, units.Pounds), 3, 12)})
+	assert.Equal(t, ActionIncreaseWeight, suggestion.Action)
+	assert.Equal(t, 8, suggestion.Reps)
+	assert.InDelta(t, 50, units.FromKilograms(*suggestion.Weight, units.Pounds), 0.001)
+}
+
+func TestSuggestRPE(t *testing.T) {
+	settings := Default("Deadlift", store.ProgressionModelRPE, units.SystemMetric)
+
+	easy := session(1, 140, 3, 5)
+	rpe := 6.0
+	easy.RPE = &rpe
+	suggestion := Suggest(settings, []store.ExerciseSession{easy})
+	assert.Equal(t, ActionIncreaseWeight, suggestion.Action)
+	// 5 reps at RPE 6 estimate a max of 182 kg; 5 reps at RPE 8 of that
+	// is 147.6 kg, rounded to 2.5 kg.
+	assert.Equal(t, 147.5, *suggestion.Weight)
+	assert.Equal(t, 8.0, *suggestion.TargetRPE)
+
+	grind := session(1, 140, 3, 5)
+	rpe = 9.5
+	grind.RPE = &rpe
+	suggestion = Suggest(settings, []store.ExerciseSession{grind})
+	assert.Equal(t, ActionReduceWeight, suggestion.Action)
+	assert.Equal(t, 1, suggestion.Failures)
+	assert.Less(t, *suggestion.Weight, 140.0)
+}
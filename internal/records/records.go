@@ -0,0 +1,48 @@
+// Package records finds the personal records set in saved workouts and
+// announces each as a record achieved event.
+package records
+
+import (
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+// Achieved is the payload of a record achieved event. Weights are in
+// kilograms.
+type Achieved struct {
+	WorkoutID int `json:"workout_id"`
+	stats.Record
+	Unit string `json:"unit"`
+}
+
+type Watcher struct {
+	workoutStore store.WorkoutStore
+	outboxStore  store.OutboxStore
+}
+
+func NewWatcher(workoutStore store.WorkoutStore, outboxStore store.OutboxStore) *Watcher {
+	return &Watcher{workoutStore: workoutStore, outboxStore: outboxStore}
+}
+
+// WorkoutSaved compares the workout with those performed before it. The
+// events belong to the workout, so they are dispatched after the event
+// that saved it.
+func (w *Watcher) WorkoutSaved(workout *store.Workout) error {
+	earlier, err := w.workoutStore.ListWorkouts(store.WorkoutFilter{UserID: workout.UserID, To: &workout.PerformedAt})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range stats.PersonalRecords(workout, earlier) {
+		err = w.outboxStore.AppendEvent(store.AggregateWorkout, workout.ID, workout.UserID, store.EventRecordAchieved, Achieved{
+			WorkoutID: workout.ID,
+			Record:    record,
+			Unit:      units.Kilograms,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/notifications"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/webhooks"
+)
+
+// Recipient is the user a notice is sent to.
+type Recipient struct {
+	UserID   int
+	Username string
+	Email    string
+	Location *time.Location
+	Settings *store.ReminderSettings
+}
+
+// Notifier delivers notices through one channel.
+type Notifier interface {
+	Name() string
+	// Wants reports whether the recipient receives notices through this
+	// notifier.
+	Wants(recipient Recipient) bool
+	Notify(ctx context.Context, recipient Recipient, notice Notice) error
+}
+
+// Mailer sends plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes email to the log instead of sending it, for servers
+// without an SMTP relay.
+type LogMailer struct {
+	logger *log.Logger
+}
+
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	m.logger.Printf("INFO: mail to %s: %s: %s", to, subject, body)
+	return nil
+}
+
+// SMTPMailer sends email through an SMTP relay at addr, as host:port.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer that authenticates with PLAIN auth when
+// username is not empty.
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: addr, from: from, auth: auth}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("mail: header contains a line break")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg.Bytes())
+}
+
+// EmailNotifier mails notices to users who turned email on.
+type EmailNotifier struct {
+	mailer Mailer
+}
+
+func NewEmailNotifier(mailer Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+func (n *EmailNotifier) Name() string { return "email" }
+
+func (n *EmailNotifier) Wants(recipient Recipient) bool {
+	return recipient.Settings.Email && recipient.Email != ""
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, recipient Recipient, notice Notice) error {
+	subject, body := Message(notice, recipient.Location)
+	return n.mailer.Send(recipient.Email, subject, body)
+}
+
+// WebhookNotifier posts notices as JSON to the user's webhook URL, signed
+// with the user's webhook secret like webhook deliveries are. The client
+// should be one from webhooks.NewClient, which keeps requests off the
+// server's own network.
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+func NewWebhookNotifier(client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{client: client}
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Wants(recipient Recipient) bool {
+	return recipient.Settings.WebhookURL != nil && recipient.Settings.WebhookSecret != nil
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, recipient Recipient, notice Notice) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":   "schedule." + notice.Kind,
+		"user_id": recipient.UserID,
+		"notice":  notice,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *recipient.Settings.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fem-fitness-project-webhooks")
+	req.Header.Set(webhooks.HeaderEvent, "schedule."+notice.Kind)
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(*recipient.Settings.WebhookSecret, time.Now(), payload))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// InAppNotifier publishes notices to the user's notification center.
+type InAppNotifier struct {
+	center *notifications.Center
+}
+
+func NewInAppNotifier(center *notifications.Center) *InAppNotifier {
+	return &InAppNotifier{center: center}
+}
+
+func (n *InAppNotifier) Name() string { return "in_app" }
+
+func (n *InAppNotifier) Wants(recipient Recipient) bool {
+	return recipient.Settings.InApp
+}
+
+func (n *InAppNotifier) Notify(ctx context.Context, recipient Recipient, notice Notice) error {
+	notificationType := notifications.TypeScheduleReminder
+	if notice.Kind == store.NoticeMissed {
+		notificationType = notifications.TypeScheduleMissed
+	}
+
+	title, body := Message(notice, recipient.Location)
+	_, err := n.center.Publish(notifications.Event{
+		UserID: recipient.UserID,
+		Type:   notificationType,
+		Title:  title,
+		Body:   body,
+		Data: map[string]interface{}{
+			"schedule_id": notice.ScheduleID,
+			"starts_at":   notice.StartsAt,
+		},
+	})
+	return err
+}
@@ -0,0 +1,76 @@
+// Package reminders reminds users of their planned sessions and reports the
+// sessions they missed, through pluggable notifiers.
+package reminders
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// Notice is a reminder of, or a report on, one occurrence of a schedule.
+type Notice struct {
+	Kind       string    `json:"kind"`
+	ScheduleID int       `json:"schedule_id"`
+	Title      string    `json:"title"`
+	StartsAt   time.Time `json:"starts_at"`
+}
+
+// DayStart returns midnight of t's day in loc.
+func DayStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// Due returns the reminders of schedule that fall due within [from, to):
+// the occurrences starting ReminderMinutes after a moment in that window.
+func Due(schedule *store.Schedule, from, to time.Time, loc *time.Location) []Notice {
+	notices := []Notice{}
+	if schedule.ReminderMinutes == nil {
+		return notices
+	}
+
+	lead := time.Duration(*schedule.ReminderMinutes) * time.Minute
+	for _, start := range schedule.Occurrences(from.Add(lead), to.Add(lead), loc) {
+		notices = append(notices, Notice{Kind: store.NoticeReminder, ScheduleID: schedule.ID, Title: schedule.Title, StartsAt: start})
+	}
+	return notices
+}
+
+// Missed returns the occurrences of schedule starting within [from, to) on
+// whose day, in loc, no workout was performed. Occurrences before the
+// schedule was created are never missed. Callers should keep to at or
+// before the start of today, as a session may still be logged later today.
+func Missed(schedule *store.Schedule, performed []time.Time, from, to time.Time, loc *time.Location) []Notice {
+	if from.Before(schedule.CreatedAt) {
+		from = schedule.CreatedAt
+	}
+
+	days := map[string]bool{}
+	for _, t := range performed {
+		days[t.In(loc).Format(time.DateOnly)] = true
+	}
+
+	notices := []Notice{}
+	for _, start := range schedule.Occurrences(from, to, loc) {
+		if days[start.Format(time.DateOnly)] {
+			continue
+		}
+		notices = append(notices, Notice{Kind: store.NoticeMissed, ScheduleID: schedule.ID, Title: schedule.Title, StartsAt: start})
+	}
+	return notices
+}
+
+// Message returns the subject and body of notice for a reader in loc.
+func Message(notice Notice, loc *time.Location) (string, string) {
+	start := notice.StartsAt.In(loc)
+	switch notice.Kind {
+	case store.NoticeMissed:
+		return "Missed: " + notice.Title,
+			fmt.Sprintf("No workout was logged on %s for %q, planned at %s.", start.Format("Mon, 2 Jan 2006"), notice.Title, start.Format("15:04"))
+	default:
+		return fmt.Sprintf("Reminder: %s at %s", notice.Title, start.Format("15:04")),
+			fmt.Sprintf("%q starts at %s (%s).", notice.Title, start.Format("Mon, 2 Jan 2006 15:04"), loc.String())
+	}
+}
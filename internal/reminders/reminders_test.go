@@ -0,0 +1,96 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestDueKeepsLocalTimeAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	schedule := &store.Schedule{
+		ID: 3, Title: "Push day", StartsAt: "2026-03-02T18:00", DurationMinutes: 60,
+		RRule: strPtr("FREQ=WEEKLY;BYDAY=MO,TH"), ReminderMinutes: intPtr(30),
+	}
+
+	// Thursday before the change: 17:30 EST is 22:30 UTC.
+	due := Due(schedule, time.Date(2026, 3, 5, 22, 30, 0, 0, time.UTC), time.Date(2026, 3, 5, 22, 31, 0, 0, time.UTC), newYork)
+	require.Len(t, due, 1)
+	assert.Equal(t, store.NoticeReminder, due[0].Kind)
+	assert.Equal(t, 3, due[0].ScheduleID)
+	assert.Equal(t, 18, due[0].StartsAt.Hour())
+
+	// Monday after the change: 17:30 EDT is 21:30 UTC.
+	due = Due(schedule, time.Date(2026, 3, 9, 22, 30, 0, 0, time.UTC), time.Date(2026, 3, 9, 22, 31, 0, 0, time.UTC), newYork)
+	assert.Empty(t, due)
+	due = Due(schedule, time.Date(2026, 3, 9, 21, 30, 0, 0, time.UTC), time.Date(2026, 3, 9, 21, 31, 0, 0, time.UTC), newYork)
+	require.Len(t, due, 1)
+	assert.Equal(t, time.Monday, due[0].StartsAt.Weekday())
+	assert.Equal(t, 18, due[0].StartsAt.Hour())
+}
+
+func TestDueWithoutReminder(t *testing.T) {
+	schedule := &store.Schedule{ID: 1, Title: "Run", StartsAt: "2026-03-02T18:00", DurationMinutes: 30}
+
+	due := Due(schedule, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC), time.UTC)
+
+	assert.Empty(t, due)
+}
+
+func TestMissedUsesLocalDays(t *testing.T) {
+	budapest, err := time.LoadLocation("Europe/Budapest")
+	require.NoError(t, err)
+
+	schedule := &store.Schedule{
+		ID: 5, Title: "Mobility", StartsAt: "2026-01-01T07:00", DurationMinutes: 20,
+		RRule: strPtr("FREQ=DAILY"), CreatedAt: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+	performed := []time.Time{
+		// 00:30 on 5 January in Budapest.
+		time.Date(2026, 1, 4, 23, 30, 0, 0, time.UTC),
+	}
+
+	missed := Missed(schedule, performed, time.Date(2026, 1, 1, 0, 0, 0, 0, budapest), time.Date(2026, 1, 6, 0, 0, 0, 0, budapest), budapest)
+
+	require.Len(t, missed, 2)
+	assert.Equal(t, store.NoticeMissed, missed[0].Kind)
+	assert.Equal(t, time.Date(2026, 1, 3, 7, 0, 0, 0, budapest), missed[0].StartsAt)
+	assert.Equal(t, time.Date(2026, 1, 4, 7, 0, 0, 0, budapest), missed[1].StartsAt)
+}
+
+func TestDayStartAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	start := DayStart(time.Date(2026, 3, 8, 20, 0, 0, 0, time.UTC), newYork)
+
+	assert.Equal(t, time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), start)
+	assert.Equal(t, 23*time.Hour, DayStart(time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC), newYork).Sub(start))
+}
+
+func TestMessage(t *testing.T) {
+	budapest, err := time.LoadLocation("Europe/Budapest")
+	require.NoError(t, err)
+	startsAt := time.Date(2026, 1, 5, 17, 0, 0, 0, time.UTC)
+
+	subject, body := Message(Notice{Kind: store.NoticeReminder, Title: "Push day", StartsAt: startsAt}, budapest)
+	assert.Equal(t, "Reminder: Push day at 18:00", subject)
+	assert.Equal(t, `"Push day" starts at Mon, 5 Jan 2026 18:00 (Europe/Budapest).`, body)
+
+	subject, body = Message(Notice{Kind: store.NoticeMissed, Title: "Push day", StartsAt: startsAt}, budapest)
+	assert.Equal(t, "Missed: Push day", subject)
+	assert.Equal(t, `No workout was logged on Mon, 5 Jan 2026 for "Push day", planned at 18:00.`, body)
+}
@@ -0,0 +1,175 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	// missedLookback is how far back finished days are checked for missed
+	// sessions, so a report still goes out after the server was down.
+	missedLookback = 2 * 24 * time.Hour
+	// reminderLookback is how far back the first check after a start looks
+	// for due reminders, so those falling due while the server was down are
+	// still sent. Claiming keeps ones sent before it stopped from going out
+	// again, and the message names the start time, so a late one reads right.
+	reminderLookback = time.Hour
+	notifyTimeout    = 30 * time.Second
+)
+
+// NotifyJob sends one notice through one notifier.
+var NotifyJob = jobs.NewKind[NotifyPayload]("reminders.notify")
+
+type NotifyPayload struct {
+	Notifier string `json:"notifier"`
+	UserID   int    `json:"user_id"`
+	Notice   Notice `json:"notice"`
+}
+
+// Scheduler periodically sends due reminders and reports missed sessions.
+// Each notice is claimed in the database before its sends are queued, so
+// it is queued at most once even with several server processes. Every
+// notifier's send is a job of its own, retried when it fails.
+type Scheduler struct {
+	reminderStore store.ReminderStore
+	userStore     store.UserStore
+	queue         *jobs.Queue
+	notifiers     []Notifier
+	logger        *log.Logger
+}
+
+func NewScheduler(reminderStore store.ReminderStore, userStore store.UserStore, queue *jobs.Queue, notifiers []Notifier, logger *log.Logger) *Scheduler {
+	return &Scheduler{reminderStore: reminderStore, userStore: userStore, queue: queue, notifiers: notifiers, logger: logger}
+}
+
+func newRecipient(user *store.User, settings *store.ReminderSettings) Recipient {
+	return Recipient{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Location: user.Location(),
+		Settings: settings,
+	}
+}
+
+// Run checks schedules every interval until the process exits.
+func (s *Scheduler) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := catchUpSince(time.Now(), interval)
+	for {
+		now := time.Now()
+		err := s.Tick(last, now)
+		if err != nil {
+			s.logger.Printf("ERROR: reminderTick: %s", err)
+		} else {
+			last = now
+		}
+		<-ticker.C
+	}
+}
+
+// catchUpSince returns where the first check after a start begins.
+func catchUpSince(now time.Time, interval time.Duration) time.Time {
+	return now.Add(-max(interval, reminderLookback))
+}
+
+// Tick sends the reminders falling due within [since, now) and reports the
+// sessions missed on days that ended recently.
+func (s *Scheduler) Tick(since, now time.Time) error {
+	targets, err := s.reminderStore.ListReminderTargets()
+	if err != nil {
+		return err
+	}
+
+	performed := map[int][]time.Time{}
+	for _, target := range targets {
+		recipient := newRecipient(target.User, target.Settings)
+		loc := recipient.Location
+
+		for _, notice := range Due(target.Schedule, since, now, loc) {
+			s.send(recipient, notice)
+		}
+
+		if !target.Settings.NotifyMissed {
+			continue
+		}
+		from := DayStart(now.Add(-missedLookback), loc)
+		to := DayStart(now, loc)
+		times, ok := performed[target.User.ID]
+		if !ok {
+			times, err = s.reminderStore.ListWorkoutTimes(target.User.ID, from, to)
+			if err != nil {
+				s.logger.Printf("ERROR: listWorkoutTimes: %s", err)
+				continue
+			}
+			performed[target.User.ID] = times
+		}
+		for _, notice := range Missed(target.Schedule, times, from, to, loc) {
+			s.send(recipient, notice)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) send(recipient Recipient, notice Notice) {
+	claimed, err := s.reminderStore.ClaimNotice(notice.ScheduleID, notice.StartsAt, notice.Kind)
+	if err != nil {
+		s.logger.Printf("ERROR: claimNotice: %s", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	for _, notifier := range s.notifiers {
+		if !notifier.Wants(recipient) {
+			continue
+		}
+		payload := NotifyPayload{Notifier: notifier.Name(), UserID: recipient.UserID, Notice: notice}
+		uniqueKey := fmt.Sprintf("%d:%d:%s:%s", notice.ScheduleID, notice.StartsAt.Unix(), notice.Kind, notifier.Name())
+		_, err = jobs.Enqueue(s.queue, NotifyJob, payload, jobs.Options{UniqueKey: uniqueKey})
+		if err != nil {
+			s.logger.Printf("ERROR: enqueueNotify %s: schedule %d: %s", notifier.Name(), notice.ScheduleID, err)
+		}
+	}
+}
+
+// Notify handles NotifyJob. The recipient is loaded again, so the notice
+// goes where the user's settings say when it is sent.
+func (s *Scheduler) Notify(ctx context.Context, payload NotifyPayload) error {
+	var notifier Notifier
+	for _, n := range s.notifiers {
+		if n.Name() == payload.Notifier {
+			notifier = n
+		}
+	}
+	if notifier == nil {
+		return jobs.Permanent(fmt.Errorf("unknown notifier %q", payload.Notifier))
+	}
+
+	user, err := s.userStore.GetUserByID(payload.UserID)
+	if err != nil || user == nil {
+		return err
+	}
+	settings, err := s.reminderStore.GetReminderSettings(user.ID)
+	if err != nil {
+		return err
+	}
+
+	recipient := newRecipient(user, settings)
+	if !notifier.Wants(recipient) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, recipient, payload.Notice)
+}
@@ -0,0 +1,139 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/jobs"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReminderStore struct {
+	store.ReminderStore
+	settings *store.ReminderSettings
+	targets  []*store.ReminderTarget
+	claimed  map[string]bool
+}
+
+func (f *fakeReminderStore) ListReminderTargets() ([]*store.ReminderTarget, error) {
+	return f.targets, nil
+}
+
+func (f *fakeReminderStore) GetReminderSettings(userID int) (*store.ReminderSettings, error) {
+	return f.settings, nil
+}
+
+func (f *fakeReminderStore) ClaimNotice(scheduleID int, occurrenceAt time.Time, kind string) (bool, error) {
+	key := occurrenceAt.String() + kind
+	if f.claimed[key] {
+		return false, nil
+	}
+	f.claimed[key] = true
+	return true, nil
+}
+
+type fakeUserStore struct {
+	store.UserStore
+	user *store.User
+}
+
+func (f *fakeUserStore) GetUserByID(id int) (*store.User, error) {
+	return f.user, nil
+}
+
+type fakeJobStore struct {
+	store.JobStore
+	enqueued []*store.Job
+}
+
+func (f *fakeJobStore) EnqueueJob(job *store.Job) (bool, error) {
+	f.enqueued = append(f.enqueued, job)
+	return true, nil
+}
+
+type fakeNotifier struct {
+	name     string
+	wants    bool
+	err      error
+	notified []Notice
+}
+
+func (n *fakeNotifier) Name() string                   { return n.name }
+func (n *fakeNotifier) Wants(recipient Recipient) bool { return n.wants }
+
+func (n *fakeNotifier) Notify(ctx context.Context, recipient Recipient, notice Notice) error {
+	n.notified = append(n.notified, notice)
+	return n.err
+}
+
+func newTestScheduler(notifiers ...Notifier) (*Scheduler, *fakeJobStore) {
+	s, jobStore, _ := newTestSchedulerWithStore(notifiers...)
+	return s, jobStore
+}
+
+func newTestSchedulerWithStore(notifiers ...Notifier) (*Scheduler, *fakeJobStore, *fakeReminderStore) {
+	logger := log.New(io.Discard, "", 0)
+	jobStore := &fakeJobStore{}
+	reminderStore := &fakeReminderStore{settings: store.DefaultReminderSettings(1), claimed: map[string]bool{}}
+	userStore := &fakeUserStore{user: &store.User{ID: 1, Timezone: "UTC"}}
+	return NewScheduler(reminderStore, userStore, jobs.NewQueue(jobStore, logger), notifiers, logger), jobStore, reminderStore
+}
+
+func TestSendQueuesOneJobPerNotifier(t *testing.T) {
+	inApp := &fakeNotifier{name: "in_app", wants: true}
+	email := &fakeNotifier{name: "email"}
+	webhook := &fakeNotifier{name: "webhook", wants: true}
+	s, jobStore := newTestScheduler(inApp, email, webhook)
+	notice := Notice{Kind: store.NoticeReminder, ScheduleID: 4, Title: "Legs", StartsAt: time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)}
+	recipient := Recipient{UserID: 1, Settings: store.DefaultReminderSettings(1)}
+
+	s.send(recipient, notice)
+	s.send(recipient, notice)
+
+	require.Len(t, jobStore.enqueued, 2)
+	var payload NotifyPayload
+	require.NoError(t, json.Unmarshal(jobStore.enqueued[1].Payload, &payload))
+	assert.Equal(t, NotifyPayload{Notifier: "webhook", UserID: 1, Notice: notice}, payload)
+	assert.Empty(t, inApp.notified)
+}
+
+func TestNotifyReturnsNotifierErrors(t *testing.T) {
+	webhook := &fakeNotifier{name: "webhook", wants: true, err: errors.New("receiver down")}
+	s, _ := newTestScheduler(webhook)
+	payload := NotifyPayload{Notifier: "webhook", UserID: 1, Notice: Notice{Kind: store.NoticeMissed, ScheduleID: 4}}
+
+	err := s.Notify(context.Background(), payload)
+	assert.EqualError(t, err, "receiver down")
+	assert.Len(t, webhook.notified, 1)
+
+	webhook.wants = false
+	assert.NoError(t, s.Notify(context.Background(), payload))
+	assert.Len(t, webhook.notified, 1)
+
+	payload.Notifier = "sms"
+	assert.Error(t, s.Notify(context.Background(), payload))
+}
+
+func TestFirstTickSendsRemindersMissedWhileDown(t *testing.T) {
+	inApp := &fakeNotifier{name: "in_app", wants: true}
+	s, jobStore, reminderStore := newTestSchedulerWithStore(inApp)
+	user := &store.User{ID: 1, Timezone: "UTC"}
+	schedule := &store.Schedule{ID: 4, Title: "Legs", StartsAt: "2026-10-19T18:00", DurationMinutes: 60, ReminderMinutes: &[]int{30}[0]}
+	settings := &store.ReminderSettings{UserID: 1, InApp: true}
+	reminderStore.targets = []*store.ReminderTarget{{Schedule: schedule, User: user, Settings: settings}}
+
+	// The reminder fell due at 17:30 while the server was down until 17:50.
+	now := time.Date(2026, 10, 19, 17, 50, 0, 0, time.UTC)
+	require.NoError(t, s.Tick(catchUpSince(now, time.Minute), now))
+	require.Len(t, jobStore.enqueued, 1)
+
+	require.NoError(t, s.Tick(catchUpSince(now.Add(time.Minute), time.Minute), now.Add(time.Minute)))
+	assert.Len(t, jobStore.enqueued, 1)
+}
@@ -13,14 +13,133 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	router.Route("/api/v1", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
 			r.Use(app.Middleware.Authenticate)
+			r.Use(app.IdempotencyMiddleware.Idempotent)
 			r.Route("/workouts", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkouts))
 				r.Get("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkout))
+				r.Get("/{id}/samples", app.Middleware.RequireUser(app.ActivityHandler.HandleGetActivitySamples))
 				r.Post("/", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
 				r.Put("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkout))
 				r.Delete("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
+				r.Route("/{id}/session", func(r chi.Router) {
+					r.Post("/", app.Middleware.RequireUser(app.SessionHandler.HandleStartSession))
+					r.Get("/", app.Middleware.RequireUser(app.SessionHandler.HandleGetSession))
+					r.Get("/events", app.Middleware.RequireUser(app.SessionHandler.HandleSessionEvents))
+					r.Post("/sets", app.Middleware.RequireUser(app.SessionHandler.HandleCompleteSet))
+					r.Put("/current", app.Middleware.RequireUser(app.SessionHandler.HandleSetCurrentEntry))
+					r.Post("/rest", app.Middleware.RequireUser(app.SessionHandler.HandleStartRest))
+					r.Delete("/rest", app.Middleware.RequireUser(app.SessionHandler.HandleStopRest))
+					r.Post("/finish", app.Middleware.RequireUser(app.SessionHandler.HandleFinishSession))
+				})
+			})
+			r.Post("/workouts:batch", app.Middleware.RequireUser(app.WorkoutHandler.HandleWorkoutBatch))
+			r.Get("/stats", app.Middleware.RequireUser(app.StatsHandler.HandleGetSummary))
+			r.Get("/training-load", app.Middleware.RequireUser(app.TrainingLoadHandler.HandleGetTrainingLoad))
+			r.Get("/search", app.Middleware.RequireUser(app.SearchHandler.HandleSearch))
+			r.Get("/export/workouts.csv", app.Middleware.RequireUser(app.CSVHandler.HandleExportWorkouts))
+			r.Post("/import/csv", app.Middleware.RequireUser(app.CSVHandler.HandleImportWorkouts))
+			r.Post("/import/activity", app.Middleware.RequireUser(app.ActivityHandler.HandleImportActivity))
+			r.Route("/measurements", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.MeasurementHandler.HandleListMeasurements))
+				r.Post("/", app.Middleware.RequireUser(app.MeasurementHandler.HandleCreateMeasurement))
+				r.Get("/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleGetMeasurement))
+				r.Put("/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleUpdateMeasurement))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleDeleteMeasurement))
+			})
+			r.Route("/goals", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.GoalHandler.HandleListGoals))
+				r.Post("/", app.Middleware.RequireUser(app.GoalHandler.HandleCreateGoal))
+				r.Get("/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleGetGoal))
+				r.Put("/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleUpdateGoal))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleDeleteGoal))
+			})
+			r.Route("/challenges", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.ChallengeHandler.HandleListChallenges))
+				r.Post("/", app.Middleware.RequireUser(app.ChallengeHandler.HandleCreateChallenge))
+				r.Get("/{id}", app.Middleware.RequireUser(app.ChallengeHandler.HandleGetChallenge))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.ChallengeHandler.HandleDeleteChallenge))
+				r.Post("/{id}/join", app.Middleware.RequireUser(app.ChallengeHandler.HandleJoinChallenge))
+				r.Post("/{id}/leave", app.Middleware.RequireUser(app.ChallengeHandler.HandleLeaveChallenge))
+				r.Get("/{id}/leaderboard", app.Middleware.RequireUser(app.ChallengeHandler.HandleGetLeaderboard))
+			})
+			r.Route("/exercises/{name}", func(r chi.Router) {
+				r.Get("/suggestion", app.Middleware.RequireUser(app.ProgressionHandler.HandleGetSuggestion))
+				r.Get("/progression", app.Middleware.RequireUser(app.ProgressionHandler.HandleGetProgressionSettings))
+				r.Put("/progression", app.Middleware.RequireUser(app.ProgressionHandler.HandleSetProgressionSettings))
+				r.Delete("/progression", app.Middleware.RequireUser(app.ProgressionHandler.HandleDeleteProgressionSettings))
+			})
+			r.Route("/tags", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.TagHandler.HandleListTags))
+				r.Put("/{id}", app.Middleware.RequireUser(app.TagHandler.HandleRenameTag))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.TagHandler.HandleDeleteTag))
+			})
+			r.Route("/custom-fields", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.CustomFieldHandler.HandleListCustomFields))
+				r.Post("/", app.Middleware.RequireUser(app.CustomFieldHandler.HandleCreateCustomField))
+				r.Put("/{id}", app.Middleware.RequireUser(app.CustomFieldHandler.HandleUpdateCustomField))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.CustomFieldHandler.HandleDeleteCustomField))
+			})
+			r.Route("/schedules", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.ScheduleHandler.HandleListSchedules))
+				r.Post("/", app.Middleware.RequireUser(app.ScheduleHandler.HandleCreateSchedule))
+				r.Get("/missed", app.Middleware.RequireUser(app.ReminderHandler.HandleListMissed))
+				r.Get("/{id}", app.Middleware.RequireUser(app.ScheduleHandler.HandleGetSchedule))
+				r.Put("/{id}", app.Middleware.RequireUser(app.ScheduleHandler.HandleUpdateSchedule))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.ScheduleHandler.HandleDeleteSchedule))
+			})
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.WebhookHandler.HandleListWebhooks))
+				r.Post("/", app.Middleware.RequireUser(app.WebhookHandler.HandleCreateWebhook))
+				r.Get("/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleGetWebhook))
+				r.Put("/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleUpdateWebhook))
+				r.Delete("/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleDeleteWebhook))
+				r.Post("/{id}/secret", app.Middleware.RequireUser(app.WebhookHandler.HandleRotateWebhookSecret))
+				r.Get("/{id}/deliveries", app.Middleware.RequireUser(app.WebhookHandler.HandleListDeliveries))
+				r.Post("/{id}/deliveries/{deliveryID}/redeliver", app.Middleware.RequireUser(app.WebhookHandler.HandleRedeliver))
+			})
+			r.Route("/notifications", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.NotificationHandler.HandleListNotifications))
+				r.Get("/unread-count", app.Middleware.RequireUser(app.NotificationHandler.HandleGetUnreadCount))
+				r.Get("/stream", app.Middleware.RequireUser(app.NotificationHandler.HandleStream))
+				r.Post("/read-all", app.Middleware.RequireUser(app.NotificationHandler.HandleMarkAllRead))
+				r.Post("/{id}/read", app.Middleware.RequireUser(app.NotificationHandler.HandleMarkRead))
+				r.Get("/preferences", app.Middleware.RequireUser(app.NotificationHandler.HandleGetPreferences))
+				r.Put("/preferences", app.Middleware.RequireUser(app.NotificationHandler.HandleUpdatePreferences))
+			})
+			r.Get("/calendar", app.Middleware.RequireUser(app.CalendarHandler.HandleGetCalendar))
+			r.Post("/calendar/feed", app.Middleware.RequireUser(app.CalendarHandler.HandleCreateFeed))
+			r.Delete("/calendar/feed", app.Middleware.RequireUser(app.CalendarHandler.HandleRevokeFeed))
+			r.Route("/met-values", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.METHandler.HandleListMETValues))
+				r.Put("/", app.Middleware.RequireUser(app.METHandler.HandleSetMETValue))
+				r.Delete("/", app.Middleware.RequireUser(app.METHandler.HandleDeleteMETValue))
+			})
+			r.Get("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleGetCurrentUser))
+			r.Put("/users/me/preferences", app.Middleware.RequireUser(app.UserHandler.HandleUpdatePreferences))
+			r.Get("/users/me/reminder-settings", app.Middleware.RequireUser(app.ReminderHandler.HandleGetReminderSettings))
+			r.Put("/users/me/reminder-settings", app.Middleware.RequireUser(app.ReminderHandler.HandleUpdateReminderSettings))
+			r.Get("/users/me/achievements", app.Middleware.RequireUser(app.AchievementHandler.HandleListAchievements))
+			r.Route("/admin/jobs", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireAdmin(app.JobHandler.HandleListJobs))
+				r.Get("/stats", app.Middleware.RequireAdmin(app.JobHandler.HandleGetJobStats))
+				r.Get("/{id}", app.Middleware.RequireAdmin(app.JobHandler.HandleGetJob))
+				r.Post("/{id}/retry", app.Middleware.RequireAdmin(app.JobHandler.HandleRetryJob))
+				r.Post("/{id}/cancel", app.Middleware.RequireAdmin(app.JobHandler.HandleCancelJob))
+			})
+			r.Get("/admin/tokens/stats", app.Middleware.RequireAdmin(app.TokenHandler.HandleGetTokenStats))
+			r.Route("/sync", func(r chi.Router) {
+				r.Get("/", app.Middleware.RequireUser(app.SyncHandler.HandleGetChanges))
+				r.Post("/", app.Middleware.RequireUser(app.SyncHandler.HandlePushChanges))
 			})
 		})
 
+		// Registering and logging in are left out of Idempotent on purpose.
+		// Without a user there is nobody to scope a key to, so a replay could
+		// hand one client's new account or token to anyone sending the same
+		// key, and the token response would be stored in plaintext. Both are
+		// safe to retry anyway: usernames and emails are unique, so a repeated
+		// registration cannot create a second account, and a repeated login
+		// just issues another token.
 		r.Route("/users", func(r chi.Router) {
 			r.Post("/register", app.UserHandler.HandleRegisterUser)
 		})
@@ -28,6 +147,9 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 		r.Route("/tokens", func(r chi.Router) {
 			r.Post("/", app.TokenHandler.HandleCreateToken)
 		})
+
+		// Calendar apps cannot send credentials; the token in the URL is them.
+		r.Get("/calendar/feed/{file}", app.CalendarHandler.HandleGetFeed)
 	})
 
 	return router
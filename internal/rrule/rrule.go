@@ -0,0 +1,283 @@
+// Package rrule implements the part of the iCalendar recurrence rules
+// (RFC 5545) that training plans need: daily, weekly and monthly rules with
+// INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxPeriods bounds the days, weeks or months walked to expand a rule.
+const maxPeriods = 100000
+
+const (
+	untilLayout     = "20060102T150405Z"
+	untilDateLayout = "20060102"
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+var weekdayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule is a parsed recurrence rule. Occurrences keep the wall-clock time of
+// the start in its location, so a plan at 18:00 stays at 18:00 across DST
+// changes.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,TH". An optional
+// "RRULE:" prefix is ignored.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rrule is empty")
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("rrule part %q must be NAME=VALUE", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rrule part %s is given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq = value
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err == nil && rule.Interval < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err == nil && rule.Count < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "UNTIL":
+			rule.Until, err = parseUntil(value)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseByMonthDay(value)
+		case "WKST":
+			if value != "MO" {
+				err = errors.New("only MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("rrule part %s is not supported", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rrule %s: %w", name, err)
+		}
+	}
+
+	switch rule.Freq {
+	case FreqDaily:
+		if len(rule.ByDay) > 0 || len(rule.ByMonthDay) > 0 {
+			return nil, errors.New("daily rrules take no BYDAY or BYMONTHDAY")
+		}
+	case FreqWeekly:
+		if len(rule.ByMonthDay) > 0 {
+			return nil, errors.New("weekly rrules take no BYMONTHDAY")
+		}
+	case FreqMonthly:
+		if len(rule.ByDay) > 0 {
+			return nil, errors.New("monthly rrules take no BYDAY")
+		}
+	default:
+		return nil, errors.New("rrule FREQ must be DAILY, WEEKLY or MONTHLY")
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, errors.New("rrule takes COUNT or UNTIL, not both")
+	}
+
+	return rule, nil
+}
+
+func parseUntil(value string) (*time.Time, error) {
+	until, err := time.Parse(untilLayout, value)
+	if err != nil {
+		// A date alone includes the whole day.
+		until, err = time.Parse(untilDateLayout, value)
+		if err != nil {
+			return nil, errors.New("must be YYYYMMDD or YYYYMMDDTHHMMSSZ")
+		}
+		until = until.Add(24*time.Hour - time.Second)
+	}
+	return &until, nil
+}
+
+func parseByDay(value string) ([]time.Weekday, error) {
+	days := []time.Weekday{}
+	seen := map[time.Weekday]bool{}
+	for _, code := range strings.Split(value, ",") {
+		day, ok := weekdays[code]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a weekday code such as MO", code)
+		}
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	// Weeks start on Monday.
+	sort.Slice(days, func(i, j int) bool { return mondayOffset(days[i]) < mondayOffset(days[j]) })
+	return days, nil
+}
+
+func parseByMonthDay(value string) ([]int, error) {
+	days := []int{}
+	for _, v := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(v)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("%q must be a day from 1 to 31 or -31 to -1", v)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// String returns the rule in canonical form, without the RRULE: prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+func mondayOffset(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// Between returns the occurrences of the rule that starts at start and fall
+// within [from, to), in start's location.
+func (r *Rule) Between(start, from, to time.Time) []time.Time {
+	occurrences := []time.Time{}
+	n := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, occurrence := range r.period(start, period) {
+			if occurrence.Before(start) {
+				continue
+			}
+			if r.Until != nil && occurrence.After(*r.Until) {
+				return occurrences
+			}
+			if !occurrence.Before(to) {
+				return occurrences
+			}
+			n++
+			if !occurrence.Before(from) {
+				occurrences = append(occurrences, occurrence)
+			}
+			if r.Count > 0 && n == r.Count {
+				return occurrences
+			}
+		}
+	}
+	return occurrences
+}
+
+// period returns the candidate occurrences of the nth day, week or month
+// of the rule, in order.
+func (r *Rule) period(start time.Time, n int) []time.Time {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	step := n * r.Interval
+
+	switch r.Freq {
+	case FreqDaily:
+		return []time.Time{time.Date(y, m, d+step, hh, mm, ss, 0, loc)}
+	case FreqWeekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		monday := d - mondayOffset(start.Weekday()) + 7*step
+		occurrences := make([]time.Time, len(days))
+		for i, day := range days {
+			occurrences[i] = time.Date(y, m, monday+mondayOffset(day), hh, mm, ss, 0, loc)
+		}
+		return occurrences
+	case FreqMonthly:
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{d}
+		}
+		first := time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, loc)
+		length := daysIn(first.Year(), first.Month())
+		days := []int{}
+		for _, day := range monthDays {
+			if day < 0 {
+				day = length + day + 1
+			}
+			// Months without the day are skipped, as RFC 5545 requires.
+			if day >= 1 && day <= length {
+				days = append(days, day)
+			}
+		}
+		sort.Ints(days)
+		occurrences := []time.Time{}
+		for i, day := range days {
+			if i > 0 && day == days[i-1] {
+				continue
+			}
+			occurrences = append(occurrences, time.Date(first.Year(), first.Month(), day, hh, mm, ss, 0, loc))
+		}
+		return occurrences
+	}
+	return nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
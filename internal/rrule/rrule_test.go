@@ -0,0 +1,97 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestParseCanonicalizes(t *testing.T) {
+	rule, err := Parse("RRULE:freq=weekly;byday=TH,MO,MO;interval=1;until=20261231")
+	require.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,TH;UNTIL=20261231T235959Z", rule.String())
+}
+
+func TestParseRejectsUnsupportedRules(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"FREQ=YEARLY",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=WEEKLY;COUNT=3;UNTIL=20261231",
+		"FREQ=WEEKLY;INTERVAL=0",
+		"FREQ=WEEKLY;BYSETPOS=1",
+		"FREQ=WEEKLY;FREQ=DAILY",
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestWeeklyKeepsWallClockAcrossDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=MO,TH")
+	require.NoError(t, err)
+
+	// Thursday 2026-10-29 18:00; DST ends on Sunday 2026-11-01.
+	start := time.Date(2026, 10, 29, 18, 0, 0, 0, ny)
+	occurrences := rule.Between(start, start, time.Date(2026, 11, 6, 0, 0, 0, 0, ny))
+
+	require.Len(t, occurrences, 3)
+	for _, occurrence := range occurrences {
+		assert.Equal(t, 18, occurrence.Hour())
+	}
+	assert.Equal(t, time.Date(2026, 11, 2, 18, 0, 0, 0, ny), occurrences[1])
+	// The UTC offset changes, the local time does not.
+	assert.Equal(t, -4*60*60, offset(occurrences[0]))
+	assert.Equal(t, -5*60*60, offset(occurrences[1]))
+}
+
+func offset(t time.Time) int {
+	_, seconds := t.Zone()
+	return seconds
+}
+
+func TestCountIsCountedFromTheStart(t *testing.T) {
+	rule, err := Parse("FREQ=DAILY;INTERVAL=2;COUNT=3")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 7, 0, 0, 0, time.UTC)
+	all := rule.Between(start, start, start.AddDate(1, 0, 0))
+	assert.Equal(t, []time.Time{start, start.AddDate(0, 0, 2), start.AddDate(0, 0, 4)}, all)
+
+	later := rule.Between(start, start.AddDate(0, 0, 3), start.AddDate(1, 0, 0))
+	assert.Equal(t, []time.Time{start.AddDate(0, 0, 4)}, later)
+}
+
+func TestMonthlySkipsMissingDays(t *testing.T) {
+	rule, err := Parse("FREQ=MONTHLY;BYMONTHDAY=31,-1")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	occurrences := rule.Between(start, start, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 4, 30, 9, 0, 0, 0, time.UTC),
+	}, occurrences)
+}
+
+func TestUntilIsInclusive(t *testing.T) {
+	rule, err := Parse("FREQ=WEEKLY;UNTIL=20260115T090000Z")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	occurrences := rule.Between(start, start, start.AddDate(1, 0, 0))
+	assert.Len(t, occurrences, 3)
+}
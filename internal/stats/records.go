@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+// Record is an exercise whose estimated one-rep max in a workout beat every
+// earlier one. Weights are in kilograms.
+type Record struct {
+	ExerciseName string  `json:"exercise_name"`
+	OneRepMax    float64 `json:"one_rep_max"`
+	Previous     float64 `json:"previous"`
+}
+
+// PersonalRecords returns the records set in workout, given the workouts
+// performed before it. An exercise done for the first time sets none.
+func PersonalRecords(workout *store.Workout, earlier []*store.Workout) []Record {
+	names := map[string]string{}
+	best := map[string]float64{}
+	workout.EachEntry(func(_ *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+		if entry.Reps == nil || entry.Weight == nil {
+			return
+		}
+		key := strings.ToLower(strings.TrimSpace(entry.ExerciseName))
+		if _, ok := names[key]; !ok {
+			names[key] = strings.TrimSpace(entry.ExerciseName)
+		}
+		best[key] = max(best[key], EstimatedOneRepMax(entry.WeightKilograms(), *entry.Reps))
+	})
+
+	records := []Record{}
+	for key, oneRepMax := range best {
+		previous := BestOneRepMax(earlier, key)
+		if previous > 0 && oneRepMax > previous {
+			records = append(records, Record{ExerciseName: names[key], OneRepMax: oneRepMax, Previous: previous})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ExerciseName < records[j].ExerciseName })
+	return records
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func liftWorkout(exerciseName string, weight float64, reps int) *store.Workout {
+	return &store.Workout{Entries: []store.WorkoutEntry{
+		{ExerciseName: exerciseName, Sets: 3, Reps: &reps, Weight: &weight},
+	}}
+}
+
+func TestPersonalRecords(t *testing.T) {
+	earlier := []*store.Workout{liftWorkout("Bench Press", 100, 1), liftWorkout("Squat", 140, 1)}
+	workout := liftWorkout("bench press ", 105, 1)
+	workout.Entries = append(workout.Entries, liftWorkout("Squat", 130, 1).Entries...)
+	workout.Entries = append(workout.Entries, liftWorkout("Deadlift", 180, 1).Entries...)
+
+	records := PersonalRecords(workout, earlier)
+
+	// Squat did not improve and deadlift has nothing to beat.
+	require.Len(t, records, 1)
+	assert.Equal(t, "bench press", records[0].ExerciseName)
+	assert.Equal(t, 105.0, records[0].OneRepMax)
+	assert.Equal(t, 100.0, records[0].Previous)
+}
+
+func TestPersonalRecordsUsesEstimates(t *testing.T) {
+	earlier := []*store.Workout{liftWorkout("Squat", 140, 1)}
+
+	// 120 kg for 6 reps estimates 144 kg.
+	records := PersonalRecords(liftWorkout("Squat", 120, 6), earlier)
+
+	require.Len(t, records, 1)
+	assert.InDelta(t, 144.0, records[0].OneRepMax, 1e-9)
+}
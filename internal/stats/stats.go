@@ -0,0 +1,183 @@
+// Package stats aggregates training volume across workout entries of every
+// kind.
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+// Totals are summed over entries. Volume is sets × reps × weight and only
+// comes from reps entries, which count the athlete's body weight when they
+// carry no weight of their own (push-ups, pull-ups); distance and duration come from every entry that
+// records them, multiplied by its sets (e.g. 4 × 400 m intervals). Entries
+// in a group count once per round of the group. Volume
+// and distance are summed in kilograms and meters and converted once at the
+// end by Summarize.
+type Totals struct {
+	Sets            int     `json:"sets"`
+	Reps            int     `json:"reps"`
+	Volume          float64 `json:"volume"`
+	Distance        float64 `json:"distance"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+func (t *Totals) add(other Totals) {
+	t.Sets += other.Sets
+	t.Reps += other.Reps
+	t.Volume += other.Volume
+	t.Distance += other.Distance
+	t.DurationSeconds += other.DurationSeconds
+}
+
+func (t *Totals) scale(n int) {
+	t.Sets *= n
+	t.Reps *= n
+	t.Volume *= float64(n)
+	t.Distance *= float64(n)
+	t.DurationSeconds *= n
+}
+
+func (t *Totals) convert(system string) {
+	t.Volume = units.Round(units.FromKilograms(t.Volume, units.WeightUnit(system)), units.WeightPlaces)
+	t.Distance = units.Round(units.FromMeters(t.Distance, units.DistanceUnit(system)), units.DistancePlaces)
+}
+
+type ExerciseTotals struct {
+	ExerciseName string `json:"exercise_name"`
+	Kind         string `json:"kind"`
+	Totals
+}
+
+type Summary struct {
+	WeightUnit   string           `json:"weight_unit"`
+	DistanceUnit string           `json:"distance_unit"`
+	Workouts     int              `json:"workouts"`
+	Totals       Totals           `json:"totals"`
+	ByExercise   []ExerciseTotals `json:"by_exercise"`
+}
+
+// EntryTotals totals a single round of entry performed at bodyWeight
+// kilograms.
+func EntryTotals(entry store.WorkoutEntry, bodyWeight float64) Totals {
+	totals := Totals{Sets: entry.Sets}
+
+	if entry.Reps != nil {
+		totals.Reps = entry.Sets * *entry.Reps
+		weight := entry.WeightKilograms()
+		if entry.Weight == nil && entry.Kind == store.EntryKindReps {
+			weight = bodyWeight
+		}
+		totals.Volume = float64(totals.Reps) * weight
+	}
+	if entry.DurationSeconds != nil {
+		totals.DurationSeconds = entry.Sets * *entry.DurationSeconds
+	}
+	totals.Distance = float64(entry.Sets) * entry.DistanceMeters()
+
+	return totals
+}
+
+// groupEntryTotals totals entry over every round of group, which is nil for
+// ungrouped entries.
+func groupEntryTotals(group *store.WorkoutEntryGroup, entry *store.WorkoutEntry, bodyWeight float64) Totals {
+	totals := EntryTotals(*entry, bodyWeight)
+	if group != nil {
+		totals.scale(group.Rounds)
+	}
+	return totals
+}
+
+// WorkoutTotals sums the workout's entries in kilograms and meters, taking
+// the athlete's body weight from bodyWeights.
+func WorkoutTotals(workout *store.Workout, bodyWeights *store.BodyWeightLog) Totals {
+	var totals Totals
+	bodyWeight := bodyWeights.At(workout.PerformedAt)
+	workout.EachEntry(func(group *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+		totals.add(groupEntryTotals(group, entry, bodyWeight))
+	})
+	return totals
+}
+
+// Summarize totals the workouts overall and per exercise in the units of
+// system, taking the athlete's body weight from bodyWeights.
+func Summarize(workouts []*store.Workout, system string, bodyWeights *store.BodyWeightLog) Summary {
+	summary := Summary{
+		WeightUnit:   units.WeightUnit(system),
+		DistanceUnit: units.DistanceUnit(system),
+		Workouts:     len(workouts),
+		ByExercise:   []ExerciseTotals{},
+	}
+	byExercise := map[string]*ExerciseTotals{}
+
+	for _, workout := range workouts {
+		bodyWeight := bodyWeights.At(workout.PerformedAt)
+		workout.EachEntry(func(group *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+			totals := groupEntryTotals(group, entry, bodyWeight)
+			summary.Totals.add(totals)
+
+			key := entry.Kind + "|" + entry.ExerciseName
+			exercise, ok := byExercise[key]
+			if !ok {
+				exercise = &ExerciseTotals{ExerciseName: entry.ExerciseName, Kind: entry.Kind}
+				byExercise[key] = exercise
+			}
+			exercise.add(totals)
+		})
+	}
+
+	summary.Totals.convert(system)
+	for _, exercise := range byExercise {
+		exercise.convert(system)
+		summary.ByExercise = append(summary.ByExercise, *exercise)
+	}
+	sort.Slice(summary.ByExercise, func(i, j int) bool {
+		if summary.ByExercise[i].ExerciseName != summary.ByExercise[j].ExerciseName {
+			return summary.ByExercise[i].ExerciseName < summary.ByExercise[j].ExerciseName
+		}
+		return summary.ByExercise[i].Kind < summary.ByExercise[j].Kind
+	})
+
+	return summary
+}
+
+// maxOneRepMaxReps is the most reps a one-rep max is estimated from; the
+// estimate gets unreliable for longer sets.
+const maxOneRepMaxReps = 12
+
+// EstimatedOneRepMax estimates the most that could be lifted once from a set
+// of reps at weight, using the Epley formula. It returns 0 for sets it
+// cannot estimate from.
+func EstimatedOneRepMax(weight float64, reps int) float64 {
+	if weight <= 0 || reps < 1 || reps > maxOneRepMaxReps {
+		return 0
+	}
+	if reps == 1 {
+		return weight
+	}
+	return weight * (1 + float64(reps)/30)
+}
+
+// BestOneRepMax returns the highest one-rep max estimated from the weighted
+// reps entries of the named exercise, in kilograms.
+func BestOneRepMax(workouts []*store.Workout, exerciseName string) float64 {
+	best := 0.0
+	for _, workout := range workouts {
+		workout.EachEntry(func(_ *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+			if entry.Reps == nil || entry.Weight == nil || !SameExercise(entry.ExerciseName, exerciseName) {
+				return
+			}
+			best = max(best, EstimatedOneRepMax(entry.WeightKilograms(), *entry.Reps))
+		})
+	}
+	return best
+}
+
+// SameExercise reports whether two exercise names refer to the same
+// exercise, ignoring case and surrounding space.
+func SameExercise(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
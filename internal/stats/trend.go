@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+type Point struct {
+	At    time.Time `json:"at"`
+	Value float64   `json:"value"`
+}
+
+// Trend is the least-squares line through a series, given by its value at
+// the first and last point and its change per week.
+type Trend struct {
+	Start        Point   `json:"start"`
+	End          Point   `json:"end"`
+	SlopePerWeek float64 `json:"slope_per_week"`
+}
+
+// Series describes how a measured value develops: its trailing moving
+// average at every point and the trend line, which is nil below two points
+// taken at different times.
+type Series struct {
+	MovingAverage []Point `json:"moving_average"`
+	Trend         *Trend  `json:"trend"`
+}
+
+// NewSeries builds the series of points, which must be sorted by time,
+// averaging over window and rounding to places.
+func NewSeries(points []Point, window time.Duration, places int) Series {
+	series := Series{MovingAverage: MovingAverage(points, window), Trend: LinearTrend(points)}
+	for i := range series.MovingAverage {
+		series.MovingAverage[i].Value = units.Round(series.MovingAverage[i].Value, places)
+	}
+	if series.Trend != nil {
+		series.Trend.Start.Value = units.Round(series.Trend.Start.Value, places)
+		series.Trend.End.Value = units.Round(series.Trend.End.Value, places)
+		series.Trend.SlopePerWeek = units.Round(series.Trend.SlopePerWeek, places)
+	}
+	return series
+}
+
+// MovingAverage averages, at each point, the points taken within window up
+// to and including it. points must be sorted by time.
+func MovingAverage(points []Point, window time.Duration) []Point {
+	averages := make([]Point, len(points))
+	start := 0
+	sum := 0.0
+	for i, point := range points {
+		sum += point.Value
+		for start < i && !points[start].At.Add(window).After(point.At) {
+			sum -= points[start].Value
+			start++
+		}
+		averages[i] = Point{At: point.At, Value: sum / float64(i-start+1)}
+	}
+	return averages
+}
+
+// LinearTrend fits a least-squares line through points, which must be
+// sorted by time.
+func LinearTrend(points []Point) *Trend {
+	if len(points) < 2 {
+		return nil
+	}
+
+	origin := points[0].At
+	n := float64(len(points))
+	var sumX, sumY, sumXX, sumXY float64
+	for _, point := range points {
+		x := point.At.Sub(origin).Hours() / (24 * 7)
+		sumX += x
+		sumY += point.Value
+		sumXX += x * x
+		sumXY += x * point.Value
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return nil
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+
+	last := points[len(points)-1].At
+	weeks := last.Sub(origin).Hours() / (24 * 7)
+	return &Trend{
+		Start:        Point{At: origin, Value: intercept},
+		End:          Point{At: last, Value: intercept + slope*weeks},
+		SlopePerWeek: slope,
+	}
+}
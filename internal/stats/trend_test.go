@@ -0,0 +1,41 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(n int) time.Time {
+	return time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+}
+
+func TestMovingAverage(t *testing.T) {
+	points := []Point{{day(0), 80}, {day(1), 82}, {day(2), 81}, {day(9), 79}}
+
+	averages := MovingAverage(points, 7*24*time.Hour)
+
+	require.Len(t, averages, 4)
+	assert.Equal(t, 80.0, averages[0].Value)
+	assert.Equal(t, 81.0, averages[1].Value)
+	assert.Equal(t, 81.0, averages[2].Value)
+	// Day 9 is a week past days 0 to 2, so it stands alone.
+	assert.Equal(t, 79.0, averages[3].Value)
+}
+
+func TestLinearTrend(t *testing.T) {
+	points := []Point{{day(0), 80}, {day(7), 79.5}, {day(14), 79}}
+
+	trend := LinearTrend(points)
+
+	require.NotNil(t, trend)
+	assert.InDelta(t, -0.5, trend.SlopePerWeek, 1e-9)
+	assert.InDelta(t, 80, trend.Start.Value, 1e-9)
+	assert.InDelta(t, 79, trend.End.Value, 1e-9)
+	assert.Equal(t, day(14), trend.End.At)
+
+	assert.Nil(t, LinearTrend(points[:1]))
+	assert.Nil(t, LinearTrend([]Point{{day(0), 80}, {day(0), 81}}))
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	AchievementMetricWorkoutCount  = "workout_count"
+	AchievementMetricWeeklyStreak  = "weekly_streak"
+	AchievementMetricSessionVolume = "session_volume"
+	AchievementMetricTotalVolume   = "total_volume"
+)
+
+// AchievementRule awards a badge once a user's Metric reaches Threshold.
+// Volume thresholds are in kilograms.
+type AchievementRule struct {
+	ID          int     `json:"id"`
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Metric      string  `json:"metric"`
+	Threshold   float64 `json:"threshold"`
+}
+
+// MeasuresWeight reports whether the rule's metric is a weight.
+func (r *AchievementRule) MeasuresWeight() bool {
+	return r.Metric == AchievementMetricSessionVolume || r.Metric == AchievementMetricTotalVolume
+}
+
+// Award records that a user earned the badge of a rule. AchievedAt is when
+// their history first reached the threshold, with WorkoutID the workout
+// that did it.
+type Award struct {
+	UserID     int       `json:"-"`
+	RuleID     int       `json:"rule_id"`
+	WorkoutID  *int      `json:"workout_id"`
+	AchievedAt time.Time `json:"achieved_at"`
+	AwardedAt  time.Time `json:"awarded_at"`
+}
+
+type PostgresAchievementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAchievementStore(db *sql.DB) *PostgresAchievementStore {
+	return &PostgresAchievementStore{db: db}
+}
+
+type AchievementStore interface {
+	ListRules() ([]*AchievementRule, error)
+	ListRulesToBackfill() ([]*AchievementRule, error)
+	MarkRuleBackfilled(ruleID int) error
+	ListUsersWithWorkouts() ([]int, error)
+	ListAwards(userID int) ([]*Award, error)
+	CreateAwards(awards []*Award) ([]*Award, error)
+}
+
+const achievementRuleColumns = `id, code, name, description, metric, threshold`
+
+func (s *PostgresAchievementStore) listRules(where string) ([]*AchievementRule, error) {
+	query := `
+	SELECT ` + achievementRuleColumns + `
+	FROM achievement_rules
+	` + where + `
+	ORDER BY id
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*AchievementRule{}
+	for rows.Next() {
+		rule := &AchievementRule{}
+		err = rows.Scan(&rule.ID, &rule.Code, &rule.Name, &rule.Description, &rule.Metric, &rule.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (s *PostgresAchievementStore) ListRules() ([]*AchievementRule, error) {
+	return s.listRules("")
+}
+
+// ListRulesToBackfill returns the rules that have not yet been evaluated
+// against existing history.
+func (s *PostgresAchievementStore) ListRulesToBackfill() ([]*AchievementRule, error) {
+	return s.listRules("WHERE backfilled_at IS NULL")
+}
+
+func (s *PostgresAchievementStore) MarkRuleBackfilled(ruleID int) error {
+	query := `
+	UPDATE achievement_rules
+	SET backfilled_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+	_, err := s.db.Exec(query, ruleID)
+	return err
+}
+
+func (s *PostgresAchievementStore) ListUsersWithWorkouts() ([]int, error) {
+	query := `
+	SELECT DISTINCT user_id
+	FROM workouts
+	ORDER BY user_id
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int{}
+	for rows.Next() {
+		var userID int
+		err = rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// ListAwards returns the user's awards, earliest achieved first.
+func (s *PostgresAchievementStore) ListAwards(userID int) ([]*Award, error) {
+	query := `
+	SELECT user_id, rule_id, workout_id, achieved_at, awarded_at
+	FROM user_achievements
+	WHERE user_id = $1
+	ORDER BY achieved_at, rule_id
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := []*Award{}
+	for rows.Next() {
+		award := &Award{}
+		err = rows.Scan(&award.UserID, &award.RuleID, &award.WorkoutID, &award.AchievedAt, &award.AwardedAt)
+		if err != nil {
+			return nil, err
+		}
+		awards = append(awards, award)
+	}
+
+	return awards, rows.Err()
+}
+
+// CreateAwards stores awards and returns those that were new. A badge is
+// awarded to a user at most once, so awards already held are skipped.
+func (s *PostgresAchievementStore) CreateAwards(awards []*Award) ([]*Award, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO user_achievements (user_id, rule_id, workout_id, achieved_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, rule_id) DO NOTHING
+	RETURNING awarded_at
+	`
+
+	created := []*Award{}
+	for _, award := range awards {
+		err = tx.QueryRow(query, award.UserID, award.RuleID, award.WorkoutID, award.AchievedAt).Scan(&award.AwardedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, award)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
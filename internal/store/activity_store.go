@@ -0,0 +1,228 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var ErrDuplicateActivity = errors.New("activity already imported")
+
+type WorkoutActivity struct {
+	SourceFormat        string    `json:"source_format"`
+	Sport               string    `json:"sport"`
+	StartedAt           time.Time `json:"started_at"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	ElevationGainMeters float64   `json:"elevation_gain_meters"`
+	AvgHeartRate        *int      `json:"avg_heart_rate"`
+	MaxHeartRate        *int      `json:"max_heart_rate"`
+	SampleCount         int       `json:"sample_count"`
+}
+
+type ActivitySample struct {
+	RecordedAt     time.Time `json:"recorded_at"`
+	Latitude       *float64  `json:"latitude"`
+	Longitude      *float64  `json:"longitude"`
+	AltitudeMeters *float64  `json:"altitude_meters"`
+	HeartRate      *int      `json:"heart_rate"`
+	Cadence        *int      `json:"cadence"`
+	Power          *int      `json:"power"`
+}
+
+type PostgresActivityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresActivityStore(db *sql.DB) *PostgresActivityStore {
+	return &PostgresActivityStore{db: db}
+}
+
+type ActivityStore interface {
+	CreateActivityWorkout(workout *Workout, samples []ActivitySample) (*Workout, error)
+	GetWorkoutIDByActivityStart(userID int, startedAt time.Time) (int, error)
+	GetActivitySamples(workoutID int) ([]ActivitySample, error)
+}
+
+// CreateActivityWorkout stores workout together with its Activity summary and
+// sample stream. It returns ErrDuplicateActivity if the user already has an
+// activity starting at the same time.
+func (s *PostgresActivityStore) CreateActivityWorkout(workout *Workout, samples []ActivitySample) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := workout.Activity
+	activity.SampleCount = len(samples)
+
+	query := `
+	INSERT INTO workout_activities (workout_id, user_id, source_format, sport, started_at, distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate, sample_count)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(query, workout.ID, workout.UserID, activity.SourceFormat, activity.Sport, activity.StartedAt, activity.DistanceMeters, activity.ElevationGainMeters, activity.AvgHeartRate, activity.MaxHeartRate, activity.SampleCount)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "workout_activities_user_started_at_key" {
+			return nil, ErrDuplicateActivity
+		}
+		return nil, err
+	}
+
+	err = insertActivitySamples(tx, workout.ID, samples)
+	if err != nil {
+		return nil, err
+	}
+
+	err = appendWorkoutEvent(tx, EventWorkoutCreated, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+const maxSamplesPerInsert = 1000
+
+func insertActivitySamples(tx *sql.Tx, workoutID int, samples []ActivitySample) error {
+	for start := 0; start < len(samples); start += maxSamplesPerInsert {
+		end := min(start+maxSamplesPerInsert, len(samples))
+
+		var query strings.Builder
+		query.WriteString(`
+		INSERT INTO activity_samples (workout_id, recorded_at, latitude, longitude, altitude_meters, heart_rate, cadence, power)
+		VALUES `)
+
+		args := make([]interface{}, 0, (end-start)*8)
+		for i, sample := range samples[start:end] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+			args = append(args, workoutID, sample.RecordedAt, sample.Latitude, sample.Longitude, sample.AltitudeMeters, sample.HeartRate, sample.Cadence, sample.Power)
+		}
+
+		_, err := tx.Exec(query.String(), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgresActivityStore) GetWorkoutIDByActivityStart(userID int, startedAt time.Time) (int, error) {
+	query := `
+	SELECT workout_id
+	FROM workout_activities
+	WHERE user_id = $1 AND started_at = $2
+	`
+
+	var workoutID int
+	err := s.db.QueryRow(query, userID, startedAt).Scan(&workoutID)
+	if err != nil {
+		return 0, err
+	}
+
+	return workoutID, nil
+}
+
+func (s *PostgresActivityStore) GetActivitySamples(workoutID int) ([]ActivitySample, error) {
+	query := `
+	SELECT recorded_at, latitude, longitude, altitude_meters, heart_rate, cadence, power
+	FROM activity_samples
+	WHERE workout_id = $1
+	ORDER BY recorded_at
+	`
+
+	rows, err := s.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []ActivitySample{}
+	for rows.Next() {
+		var sample ActivitySample
+		err = rows.Scan(&sample.RecordedAt, &sample.Latitude, &sample.Longitude, &sample.AltitudeMeters, &sample.HeartRate, &sample.Cadence, &sample.Power)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+func getWorkoutActivity(q queryer, workoutID int) (*WorkoutActivity, error) {
+	query := `
+	SELECT source_format, sport, started_at, distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate, sample_count
+	FROM workout_activities
+	WHERE workout_id = $1
+	`
+
+	activity := &WorkoutActivity{}
+	err := q.QueryRow(query, workoutID).Scan(&activity.SourceFormat, &activity.Sport, &activity.StartedAt, &activity.DistanceMeters, &activity.ElevationGainMeters, &activity.AvgHeartRate, &activity.MaxHeartRate, &activity.SampleCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// loadWorkoutActivities fills in the Activity of those workouts that were
+// imported from an activity file.
+func loadWorkoutActivities(q queryer, workouts ...*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Workout{}
+	ids := make([]int, 0, len(workouts))
+	for _, workout := range workouts {
+		byID[workout.ID] = workout
+		ids = append(ids, workout.ID)
+	}
+
+	query := `
+	SELECT workout_id, source_format, sport, started_at, distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate, sample_count
+	FROM workout_activities
+	WHERE workout_id = ANY($1)
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		activity := &WorkoutActivity{}
+		err = rows.Scan(&workoutID, &activity.SourceFormat, &activity.Sport, &activity.StartedAt, &activity.DistanceMeters, &activity.ElevationGainMeters, &activity.AvgHeartRate, &activity.MaxHeartRate, &activity.SampleCount)
+		if err != nil {
+			return err
+		}
+		byID[workoutID].Activity = activity
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,512 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+const (
+	ChallengeMetricVolume       = "volume"
+	ChallengeMetricDistance     = "distance"
+	ChallengeMetricWorkoutCount = "workout_count"
+)
+
+const (
+	ChallengeStatusUpcoming = "upcoming"
+	ChallengeStatusActive   = "active"
+	ChallengeStatusFinished = "finished"
+)
+
+const (
+	maxChallengeTitleLength = 255
+	maxChallengeLength      = 366 * 24 * time.Hour
+)
+
+// Challenge ranks the users who joined it by Metric over the workouts they
+// performed between StartsAt and EndsAt. When ExerciseName is set only its
+// entries, and activities of that sport, count. Joined and
+// ParticipantCount are as seen by the user the challenge was read for.
+type Challenge struct {
+	ID               int       `json:"id"`
+	CreatorID        int       `json:"creator_id"`
+	Title            string    `json:"title"`
+	Metric           string    `json:"metric"`
+	ExerciseName     *string   `json:"exercise_name"`
+	Unit             *string   `json:"unit"`
+	StartsAt         time.Time `json:"starts_at"`
+	EndsAt           time.Time `json:"ends_at"`
+	Status           string    `json:"status"`
+	ParticipantCount int       `json:"participant_count"`
+	Joined           bool      `json:"joined"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (c *Challenge) Validate() error {
+	if strings.TrimSpace(c.Title) == "" || len(c.Title) > maxChallengeTitleLength {
+		return errors.New("title is required and must be at most 255 characters")
+	}
+	switch c.Metric {
+	case ChallengeMetricVolume, ChallengeMetricDistance, ChallengeMetricWorkoutCount:
+	default:
+		return errors.New("metric must be volume, distance or workout_count")
+	}
+	if c.ExerciseName != nil && strings.TrimSpace(*c.ExerciseName) == "" {
+		c.ExerciseName = nil
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if c.EndsAt.Sub(c.StartsAt) > maxChallengeLength {
+		return errors.New("challenges can last at most 366 days")
+	}
+	return nil
+}
+
+// Covers reports whether t falls in the challenge's window.
+func (c *Challenge) Covers(t time.Time) bool {
+	return !t.Before(c.StartsAt) && t.Before(c.EndsAt)
+}
+
+func (c *Challenge) statusAt(now time.Time) string {
+	switch {
+	case now.Before(c.StartsAt):
+		return ChallengeStatusUpcoming
+	case now.Before(c.EndsAt):
+		return ChallengeStatusActive
+	}
+	return ChallengeStatusFinished
+}
+
+// DisplayScore expresses score, in kilograms, meters or as a count, in the
+// units of system.
+func (c *Challenge) DisplayScore(score float64, system string) float64 {
+	switch c.Metric {
+	case ChallengeMetricVolume:
+		return units.Round(units.FromKilograms(score, units.WeightUnit(system)), units.WeightPlaces)
+	case ChallengeMetricDistance:
+		return units.Round(units.FromMeters(score, units.DistanceUnit(system)), units.DistancePlaces)
+	}
+	return score
+}
+
+// SetUnit names the unit scores are shown in for system.
+func (c *Challenge) SetUnit(system string) {
+	var unit string
+	switch c.Metric {
+	case ChallengeMetricVolume:
+		unit = units.WeightUnit(system)
+	case ChallengeMetricDistance:
+		unit = units.DistanceUnit(system)
+	default:
+		c.Unit = nil
+		return
+	}
+	c.Unit = &unit
+}
+
+// LeaderboardEntry is a participant's place in a challenge. Participants
+// with the same score share a rank.
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	Score    float64 `json:"score"`
+
+	exactScore string
+}
+
+// LeaderboardCursor points just past an entry of a leaderboard.
+type LeaderboardCursor struct {
+	Score  string
+	UserID int
+}
+
+// Cursor returns the cursor that continues a leaderboard after e.
+func (e *LeaderboardEntry) Cursor() LeaderboardCursor {
+	return LeaderboardCursor{Score: e.exactScore, UserID: e.UserID}
+}
+
+type ChallengeFilter struct {
+	UserID     int
+	Status     string
+	JoinedOnly bool
+}
+
+type PostgresChallengeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChallengeStore(db *sql.DB) *PostgresChallengeStore {
+	return &PostgresChallengeStore{db: db}
+}
+
+type ChallengeStore interface {
+	CreateChallenge(challenge *Challenge) error
+	GetChallenge(id int, userID int) (*Challenge, error)
+	ListChallenges(filter ChallengeFilter) ([]*Challenge, error)
+	DeleteChallenge(id int) error
+	ListOpenChallenges(userID int) ([]*Challenge, error)
+	JoinChallenge(challengeID int, userID int, contributions map[int]float64) (bool, error)
+	LeaveChallenge(challengeID int, userID int) error
+	SetContributions(userID int, workoutID int, values map[int]float64) error
+	RemoveWorkoutContributions(workoutID int) error
+	GetLeaderboard(challengeID int, after *LeaderboardCursor, limit int) ([]*LeaderboardEntry, error)
+	GetStanding(challengeID int, userID int) (*LeaderboardEntry, error)
+}
+
+const challengeColumns = `c.id, c.creator_id, c.title, c.metric, c.exercise_name, c.starts_at, c.ends_at, c.created_at,
+	(SELECT COUNT(*) FROM challenge_participants p WHERE p.challenge_id = c.id),
+	EXISTS (SELECT 1 FROM challenge_participants p WHERE p.challenge_id = c.id AND p.user_id = $1)`
+
+func scanChallenge(row rowScanner, challenge *Challenge) error {
+	err := row.Scan(&challenge.ID, &challenge.CreatorID, &challenge.Title, &challenge.Metric, &challenge.ExerciseName, &challenge.StartsAt, &challenge.EndsAt, &challenge.CreatedAt,
+		&challenge.ParticipantCount, &challenge.Joined)
+	if err != nil {
+		return err
+	}
+	challenge.Status = challenge.statusAt(time.Now())
+	return nil
+}
+
+func (s *PostgresChallengeStore) CreateChallenge(challenge *Challenge) error {
+	query := `
+	INSERT INTO challenges (creator_id, title, metric, exercise_name, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+
+	err := s.db.QueryRow(query, challenge.CreatorID, challenge.Title, challenge.Metric, challenge.ExerciseName, challenge.StartsAt, challenge.EndsAt).Scan(&challenge.ID, &challenge.CreatedAt)
+	if err != nil {
+		return err
+	}
+	challenge.Status = challenge.statusAt(time.Now())
+	return nil
+}
+
+// GetChallenge reads the challenge as seen by userID.
+func (s *PostgresChallengeStore) GetChallenge(id int, userID int) (*Challenge, error) {
+	challenge := &Challenge{}
+
+	query := `
+	SELECT ` + challengeColumns + `
+	FROM challenges c
+	WHERE c.id = $2
+	`
+
+	err := scanChallenge(s.db.QueryRow(query, userID, id), challenge)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// ListChallenges returns the challenges in the filter's status, or all of
+// them, soonest ending first.
+func (s *PostgresChallengeStore) ListChallenges(filter ChallengeFilter) ([]*Challenge, error) {
+	query := `
+	SELECT ` + challengeColumns + `
+	FROM challenges c
+	WHERE ($2 = '' OR ($2 = 'upcoming' AND c.starts_at > $3) OR ($2 = 'active' AND c.starts_at <= $3 AND c.ends_at > $3) OR ($2 = 'finished' AND c.ends_at <= $3))
+	AND (NOT $4 OR EXISTS (SELECT 1 FROM challenge_participants p WHERE p.challenge_id = c.id AND p.user_id = $1))
+	ORDER BY c.ends_at, c.id
+	`
+
+	return s.queryChallenges(query, filter.UserID, filter.Status, time.Now(), filter.JoinedOnly)
+}
+
+// ListOpenChallenges returns the challenges the user joined that have not
+// finished yet. Scores of finished challenges are final.
+func (s *PostgresChallengeStore) ListOpenChallenges(userID int) ([]*Challenge, error) {
+	query := `
+	SELECT ` + challengeColumns + `
+	FROM challenges c
+	JOIN challenge_participants me ON me.challenge_id = c.id AND me.user_id = $1
+	WHERE c.ends_at > $2
+	ORDER BY c.id
+	`
+
+	return s.queryChallenges(query, userID, time.Now())
+}
+
+func (s *PostgresChallengeStore) queryChallenges(query string, args ...interface{}) ([]*Challenge, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []*Challenge{}
+	for rows.Next() {
+		challenge := &Challenge{}
+		err = scanChallenge(rows, challenge)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, challenge)
+	}
+
+	return challenges, rows.Err()
+}
+
+func (s *PostgresChallengeStore) DeleteChallenge(id int) error {
+	query := `
+	DELETE FROM challenges
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// JoinChallenge adds the user to the challenge with contributions, the
+// value of each of their workouts performed in its window so far. It
+// reports false when the user had already joined.
+func (s *PostgresChallengeStore) JoinChallenge(challengeID int, userID int, contributions map[int]float64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO challenge_participants (challenge_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (challenge_id, user_id) DO NOTHING
+	`
+	result, err := tx.Exec(query, challengeID, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	err = applyContributions(tx, challengeID, userID, contributions)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *PostgresChallengeStore) LeaveChallenge(challengeID int, userID int) error {
+	query := `
+	DELETE FROM challenge_participants
+	WHERE challenge_id = $1 AND user_id = $2
+	`
+	result, err := s.db.Exec(query, challengeID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// SetContributions sets what the workout adds to the user's score in each
+// challenge of values, keyed by challenge id, and moves the score by the
+// difference. A value of 0 removes the workout from the challenge.
+// Challenges the user has left since are skipped.
+func (s *PostgresChallengeStore) SetContributions(userID int, workoutID int, values map[int]float64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for challengeID, value := range values {
+		// Locking the participant serializes concurrent saves of the
+		// user's workouts in this challenge.
+		query := `
+		SELECT 1
+		FROM challenge_participants
+		WHERE challenge_id = $1 AND user_id = $2
+		FOR UPDATE
+		`
+		var locked int
+		err = tx.QueryRow(query, challengeID, userID).Scan(&locked)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = applyContributions(tx, challengeID, userID, map[int]float64{workoutID: value})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// applyContributions sets the value of each workout in contributions for
+// a participant whose row is locked by tx.
+func applyContributions(tx *sql.Tx, challengeID int, userID int, contributions map[int]float64) error {
+	delta := 0.0
+	for workoutID, value := range contributions {
+		var previous float64
+		query := `
+		SELECT value
+		FROM challenge_contributions
+		WHERE challenge_id = $1 AND workout_id = $2
+		`
+		err := tx.QueryRow(query, challengeID, workoutID).Scan(&previous)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if value == previous {
+			continue
+		}
+
+		if value == 0 {
+			query = `
+			DELETE FROM challenge_contributions
+			WHERE challenge_id = $1 AND workout_id = $2
+			`
+			_, err = tx.Exec(query, challengeID, workoutID)
+		} else {
+			query = `
+			INSERT INTO challenge_contributions (challenge_id, user_id, workout_id, value)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (challenge_id, workout_id) DO UPDATE SET value = EXCLUDED.value
+			`
+			_, err = tx.Exec(query, challengeID, userID, workoutID, value)
+		}
+		if err != nil {
+			return err
+		}
+		delta += value - previous
+	}
+
+	if delta == 0 {
+		return nil
+	}
+
+	query := `
+	UPDATE challenge_participants
+	SET score = score + $1, updated_at = CURRENT_TIMESTAMP
+	WHERE challenge_id = $2 AND user_id = $3
+	`
+	_, err := tx.Exec(query, delta, challengeID, userID)
+	return err
+}
+
+// RemoveWorkoutContributions takes a deleted workout out of the challenges
+// that have not finished yet.
+func (s *PostgresChallengeStore) RemoveWorkoutContributions(workoutID int) error {
+	query := `
+	WITH removed AS (
+		DELETE FROM challenge_contributions
+		WHERE workout_id = $1
+		AND challenge_id IN (SELECT id FROM challenges WHERE ends_at > CURRENT_TIMESTAMP)
+		RETURNING challenge_id, user_id, value
+	)
+	UPDATE challenge_participants p
+	SET score = p.score - r.value, updated_at = CURRENT_TIMESTAMP
+	FROM removed r
+	WHERE p.challenge_id = r.challenge_id AND p.user_id = r.user_id
+	`
+	_, err := s.db.Exec(query, workoutID)
+	return err
+}
+
+// GetLeaderboard returns up to limit participants of the challenge, highest
+// score first, continuing after the cursor when it is given.
+func (s *PostgresChallengeStore) GetLeaderboard(challengeID int, after *LeaderboardCursor, limit int) ([]*LeaderboardEntry, error) {
+	var afterScore *string
+	afterUserID := 0
+	if after != nil {
+		afterScore, afterUserID = &after.Score, after.UserID
+	}
+
+	query := `
+	SELECT rank, user_id, username, score, score::text
+	FROM (
+		SELECT RANK() OVER (ORDER BY p.score DESC) AS rank, p.user_id, u.username, p.score
+		FROM challenge_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.challenge_id = $1
+	) ranked
+	WHERE $2::numeric IS NULL OR score < $2::numeric OR (score = $2::numeric AND user_id > $3)
+	ORDER BY score DESC, user_id
+	LIMIT $4
+	`
+
+	rows, err := s.db.Query(query, challengeID, afterScore, afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*LeaderboardEntry{}
+	for rows.Next() {
+		entry := &LeaderboardEntry{}
+		err = rows.Scan(&entry.Rank, &entry.UserID, &entry.Username, &entry.Score, &entry.exactScore)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetStanding returns the user's place in the challenge, or nil when they
+// have not joined it.
+func (s *PostgresChallengeStore) GetStanding(challengeID int, userID int) (*LeaderboardEntry, error) {
+	query := `
+	SELECT (SELECT COUNT(*) FROM challenge_participants o WHERE o.challenge_id = p.challenge_id AND o.score > p.score) + 1,
+		p.user_id, u.username, p.score, p.score::text
+	FROM challenge_participants p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.challenge_id = $1 AND p.user_id = $2
+	`
+
+	entry := &LeaderboardEntry{}
+	err := s.db.QueryRow(query, challengeID, userID).Scan(&entry.Rank, &entry.UserID, &entry.Username, &entry.Score, &entry.exactScore)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
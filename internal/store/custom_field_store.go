@@ -0,0 +1,464 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgconn"
+)
+
+// Custom field types. Scale fields hold a whole number from 1 to 10; enum
+// fields one of their Options.
+const (
+	CustomFieldNumber = "number"
+	CustomFieldText   = "text"
+	CustomFieldEnum   = "enum"
+	CustomFieldScale  = "scale"
+)
+
+const (
+	maxCustomFieldNameLength = 100
+	maxCustomFieldOptions    = 50
+	maxCustomFieldTextLength = 1000
+	minCustomFieldScale      = 1
+	maxCustomFieldScale      = 10
+)
+
+var (
+	ErrDuplicateCustomField = errors.New("custom field already exists")
+	ErrInvalidCustomField   = errors.New("invalid custom field value")
+)
+
+// CustomField is a user-defined property of workouts, such as sleep quality
+// or mood, filled in per workout.
+type CustomField struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkoutFieldValue is the value of a custom field on a workout. Value is a
+// number for number and scale fields and a string otherwise; Name and Type
+// are filled in from the field when the workout is read or saved.
+type WorkoutFieldValue struct {
+	FieldID int         `json:"field_id"`
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Value   interface{} `json:"value"`
+}
+
+func (f *CustomField) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" || utf8.RuneCountInString(f.Name) > maxCustomFieldNameLength {
+		return errors.New("name is required and must be at most 100 characters")
+	}
+
+	switch f.Type {
+	case CustomFieldNumber, CustomFieldText, CustomFieldScale:
+		if len(f.Options) > 0 {
+			return errors.New("only enum fields have options")
+		}
+		f.Options = []string{}
+	case CustomFieldEnum:
+		if len(f.Options) == 0 || len(f.Options) > maxCustomFieldOptions {
+			return errors.New("enum fields need between 1 and 50 options")
+		}
+		seen := map[string]bool{}
+		for i, option := range f.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || utf8.RuneCountInString(option) > maxCustomFieldNameLength {
+				return errors.New("options must be between 1 and 100 characters")
+			}
+			if seen[option] {
+				return fmt.Errorf("option %q is listed twice", option)
+			}
+			seen[option] = true
+			f.Options[i] = option
+		}
+	default:
+		return errors.New("type must be number, text, enum or scale")
+	}
+
+	return nil
+}
+
+// ParseValue checks that value, as decoded from JSON, suits the field and
+// returns it as the number or the text to store.
+func (f *CustomField) ParseValue(value interface{}) (*float64, *string, error) {
+	switch f.Type {
+	case CustomFieldNumber, CustomFieldScale:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, nil, fmt.Errorf("%s must be a number", f.Name)
+		}
+		if f.Type == CustomFieldScale && (number != math.Trunc(number) || number < minCustomFieldScale || number > maxCustomFieldScale) {
+			return nil, nil, fmt.Errorf("%s must be a whole number from 1 to 10", f.Name)
+		}
+		return &number, nil, nil
+	case CustomFieldText:
+		text, ok := value.(string)
+		if !ok || utf8.RuneCountInString(text) > maxCustomFieldTextLength {
+			return nil, nil, fmt.Errorf("%s must be text of at most 1000 characters", f.Name)
+		}
+		return nil, &text, nil
+	case CustomFieldEnum:
+		text, ok := value.(string)
+		if ok {
+			for _, option := range f.Options {
+				if option == text {
+					return nil, &text, nil
+				}
+			}
+		}
+		return nil, nil, fmt.Errorf("%s must be one of %s", f.Name, strings.Join(f.Options, ", "))
+	}
+	return nil, nil, fmt.Errorf("%s has an unknown type", f.Name)
+}
+
+type PostgresCustomFieldStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCustomFieldStore(db *sql.DB) *PostgresCustomFieldStore {
+	return &PostgresCustomFieldStore{db: db}
+}
+
+type CustomFieldStore interface {
+	CreateCustomField(field *CustomField) error
+	GetCustomField(id int) (*CustomField, error)
+	ListCustomFields(userID int) ([]*CustomField, error)
+	UpdateCustomField(field *CustomField) error
+	DeleteCustomField(id int) error
+}
+
+func duplicateCustomField(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "custom_fields_user_id_name_key" {
+		return ErrDuplicateCustomField
+	}
+	return err
+}
+
+// CreateCustomField returns ErrDuplicateCustomField if the user already has
+// a field with the same name.
+func (s *PostgresCustomFieldStore) CreateCustomField(field *CustomField) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO custom_fields (user_id, name, field_type)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, field.UserID, field.Name, field.Type).Scan(&field.ID, &field.CreatedAt, &field.UpdatedAt)
+	if err != nil {
+		return duplicateCustomField(err)
+	}
+
+	err = insertCustomFieldOptions(tx, field)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertCustomFieldOptions(tx *sql.Tx, field *CustomField) error {
+	if len(field.Options) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO custom_field_options (field_id, value, order_index)
+	SELECT $1, value, ordinality - 1
+	FROM unnest($2::text[]) WITH ORDINALITY AS value
+	`
+	_, err := tx.Exec(query, field.ID, field.Options)
+	return err
+}
+
+func (s *PostgresCustomFieldStore) GetCustomField(id int) (*CustomField, error) {
+	query := `
+	SELECT id, user_id, name, field_type, created_at, updated_at
+	FROM custom_fields
+	WHERE id = $1
+	`
+
+	field := &CustomField{}
+	err := s.db.QueryRow(query, id).Scan(&field.ID, &field.UserID, &field.Name, &field.Type, &field.CreatedAt, &field.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = loadCustomFieldOptions(s.db, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return field, nil
+}
+
+func (s *PostgresCustomFieldStore) ListCustomFields(userID int) ([]*CustomField, error) {
+	return listCustomFields(s.db, userID, nil)
+}
+
+// listCustomFields returns the user's fields by name, only those in ids
+// unless it is nil.
+func listCustomFields(q queryer, userID int, ids []int) ([]*CustomField, error) {
+	query := `
+	SELECT id, user_id, name, field_type, created_at, updated_at
+	FROM custom_fields
+	WHERE user_id = $1 AND ($2::bigint[] IS NULL OR id = ANY($2))
+	ORDER BY name
+	`
+
+	rows, err := q.Query(query, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []*CustomField{}
+	for rows.Next() {
+		field := &CustomField{}
+		err = rows.Scan(&field.ID, &field.UserID, &field.Name, &field.Type, &field.CreatedAt, &field.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadCustomFieldOptions(q, fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func loadCustomFieldOptions(q queryer, fields ...*CustomField) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	byID := map[int]*CustomField{}
+	ids := make([]int, 0, len(fields))
+	for _, field := range fields {
+		field.Options = []string{}
+		byID[field.ID] = field
+		ids = append(ids, field.ID)
+	}
+
+	query := `
+	SELECT field_id, value
+	FROM custom_field_options
+	WHERE field_id = ANY($1)
+	ORDER BY field_id, order_index
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fieldID int
+		var option string
+		err = rows.Scan(&fieldID, &option)
+		if err != nil {
+			return err
+		}
+		byID[fieldID].Options = append(byID[fieldID].Options, option)
+	}
+
+	return rows.Err()
+}
+
+// UpdateCustomField renames the field and replaces its options. Values
+// already given keep their text when their option is removed.
+func (s *PostgresCustomFieldStore) UpdateCustomField(field *CustomField) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE custom_fields
+	SET name = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	RETURNING updated_at
+	`
+	err = tx.QueryRow(query, field.Name, field.ID).Scan(&field.UpdatedAt)
+	if err != nil {
+		return duplicateCustomField(err)
+	}
+
+	query = `
+	DELETE FROM custom_field_options
+	WHERE field_id = $1
+	`
+	_, err = tx.Exec(query, field.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertCustomFieldOptions(tx, field)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCustomField deletes the field along with its values on every
+// workout.
+func (s *PostgresCustomFieldStore) DeleteCustomField(id int) error {
+	query := `
+	DELETE FROM custom_fields
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// saveWorkoutFieldValues replaces the custom field values of the workout
+// with workout.CustomFields, checking each against the user's field. Values
+// that are null are left out. Nil CustomFields keep the values the workout
+// has.
+func saveWorkoutFieldValues(tx *sql.Tx, workout *Workout) error {
+	if workout.CustomFields == nil {
+		return loadWorkoutFieldValues(tx, workout)
+	}
+
+	ids := make([]int, 0, len(workout.CustomFields))
+	for _, value := range workout.CustomFields {
+		ids = append(ids, value.FieldID)
+	}
+	fields, err := listCustomFields(tx, workout.UserID, ids)
+	if err != nil {
+		return err
+	}
+	byID := map[int]*CustomField{}
+	for _, field := range fields {
+		byID[field.ID] = field
+	}
+
+	query := `
+	DELETE FROM workout_custom_field_values
+	WHERE workout_id = $1
+	`
+	_, err = tx.Exec(query, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	values := []WorkoutFieldValue{}
+	for i, value := range workout.CustomFields {
+		if value.Value == nil {
+			continue
+		}
+		field, ok := byID[value.FieldID]
+		if !ok {
+			return fmt.Errorf("%w: custom_fields[%d]: field %d does not exist", ErrInvalidCustomField, i, value.FieldID)
+		}
+		number, text, err := field.ParseValue(value.Value)
+		if err != nil {
+			return fmt.Errorf("%w: custom_fields[%d]: %s", ErrInvalidCustomField, i, err)
+		}
+
+		query = `
+		INSERT INTO workout_custom_field_values (workout_id, field_id, number_value, text_value)
+		VALUES ($1, $2, $3, $4)
+		`
+		_, err = tx.Exec(query, workout.ID, field.ID, number, text)
+		if err != nil {
+			return err
+		}
+
+		values = append(values, WorkoutFieldValue{FieldID: field.ID, Name: field.Name, Type: field.Type, Value: value.Value})
+	}
+	workout.CustomFields = values
+
+	return nil
+}
+
+// loadWorkoutFieldValues fills in the custom field values of workouts,
+// ordered by field name.
+func loadWorkoutFieldValues(q queryer, workouts ...*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Workout{}
+	ids := make([]int, 0, len(workouts))
+	for _, workout := range workouts {
+		workout.CustomFields = []WorkoutFieldValue{}
+		byID[workout.ID] = workout
+		ids = append(ids, workout.ID)
+	}
+
+	query := `
+	SELECT v.workout_id, f.id, f.name, f.field_type, v.number_value, v.text_value
+	FROM workout_custom_field_values v
+	JOIN custom_fields f ON f.id = v.field_id
+	WHERE v.workout_id = ANY($1)
+	ORDER BY v.workout_id, f.name
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var number *float64
+		var text *string
+		value := WorkoutFieldValue{}
+		err = rows.Scan(&workoutID, &value.FieldID, &value.Name, &value.Type, &number, &text)
+		if err != nil {
+			return err
+		}
+		if number != nil {
+			value.Value = *number
+		} else if text != nil {
+			value.Value = *text
+		}
+		byID[workoutID].CustomFields = append(byID[workoutID].CustomFields, value)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomFieldValidate(t *testing.T) {
+	mood := &CustomField{Name: " Mood ", Type: CustomFieldEnum, Options: []string{" good", "bad "}}
+	require.NoError(t, mood.Validate())
+	assert.Equal(t, "Mood", mood.Name)
+	assert.Equal(t, []string{"good", "bad"}, mood.Options)
+
+	sleep := &CustomField{Name: "Sleep quality", Type: CustomFieldScale}
+	require.NoError(t, sleep.Validate())
+	assert.Equal(t, []string{}, sleep.Options)
+
+	assert.Error(t, (&CustomField{Name: "Mood", Type: CustomFieldEnum}).Validate())
+	assert.Error(t, (&CustomField{Name: "Mood", Type: CustomFieldEnum, Options: []string{"ok", "ok"}}).Validate())
+	assert.Error(t, (&CustomField{Name: "Sleep", Type: CustomFieldNumber, Options: []string{"a"}}).Validate())
+	assert.Error(t, (&CustomField{Name: "Sleep", Type: "date"}).Validate())
+	assert.Error(t, (&CustomField{Name: " ", Type: CustomFieldText}).Validate())
+}
+
+func TestCustomFieldParseValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  CustomField
+		value  interface{}
+		number *float64
+		text   *string
+		valid  bool
+	}{
+		{name: "number", field: CustomField{Type: CustomFieldNumber}, value: 7.5, number: ptr(7.5), valid: true},
+		{name: "number as text", field: CustomField{Type: CustomFieldNumber}, value: "7.5"},
+		{name: "scale", field: CustomField{Type: CustomFieldScale}, value: 10.0, number: ptr(10.0), valid: true},
+		{name: "scale out of range", field: CustomField{Type: CustomFieldScale}, value: 11.0},
+		{name: "scale fraction", field: CustomField{Type: CustomFieldScale}, value: 6.5},
+		{name: "text", field: CustomField{Type: CustomFieldText}, value: "slept badly", text: ptr("slept badly"), valid: true},
+		{name: "text as number", field: CustomField{Type: CustomFieldText}, value: 3.0},
+		{name: "enum option", field: CustomField{Type: CustomFieldEnum, Options: []string{"good", "bad"}}, value: "bad", text: ptr("bad"), valid: true},
+		{name: "enum unknown option", field: CustomField{Type: CustomFieldEnum, Options: []string{"good", "bad"}}, value: "meh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			number, text, err := tt.field.ParseValue(tt.value)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.number, number)
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -2,9 +2,12 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
+	"strings"
 
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
@@ -43,3 +46,10 @@ func Migrate(db *sql.DB, dir string) error {
 
 	return nil
 }
+
+// IsConstraintViolation reports whether err was caused by the database
+// rejecting the data, such as a failed CHECK or foreign key constraint.
+func IsConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23")
+}
@@ -0,0 +1,398 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+const (
+	GoalTypeOneRepMax        = "one_rep_max"
+	GoalTypeWorkoutsPerWeek  = "workouts_per_week"
+	GoalTypeWeeklyVolume     = "weekly_volume"
+	GoalTypeBodyWeight       = "body_weight"
+	GoalTypeDistancePerMonth = "distance_per_month"
+)
+
+const maxWorkoutsPerWeek = 50
+
+// Goal is a target the user works towards until Deadline, a date in the
+// user's time zone. Weekly and monthly goals are recurring: they are met
+// anew in every period. Target and StartValue are read back in kilograms,
+// meters or as a count, with Unit naming the unit; ConvertUnits expresses
+// them in a unit system.
+type Goal struct {
+	ID           int              `json:"id"`
+	UserID       int              `json:"user_id"`
+	Type         string           `json:"type"`
+	ExerciseName *string          `json:"exercise_name"`
+	Target       float64          `json:"target"`
+	Unit         *string          `json:"unit"`
+	StartValue   *float64         `json:"start_value"`
+	Deadline     string           `json:"deadline"`
+	CompletedAt  *time.Time       `json:"completed_at"`
+	Completions  []GoalCompletion `json:"completions"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// GoalCompletion records that a goal was met, once per period of a
+// recurring goal and once for any other goal.
+type GoalCompletion struct {
+	PeriodStart time.Time `json:"period_start"`
+	Value       float64   `json:"value"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func ValidGoalType(goalType string) bool {
+	switch goalType {
+	case GoalTypeOneRepMax, GoalTypeWorkoutsPerWeek, GoalTypeWeeklyVolume, GoalTypeBodyWeight, GoalTypeDistancePerMonth:
+		return true
+	}
+	return false
+}
+
+// Recurring reports whether the goal is met per week or per month.
+func (g *Goal) Recurring() bool {
+	return g.Type == GoalTypeWorkoutsPerWeek || g.Type == GoalTypeWeeklyVolume || g.Type == GoalTypeDistancePerMonth
+}
+
+func (g *Goal) measuresWeight() bool {
+	return g.Type == GoalTypeOneRepMax || g.Type == GoalTypeWeeklyVolume || g.Type == GoalTypeBodyWeight
+}
+
+// Validate checks the goal; its Unit must already be set for goals measured
+// in weight or distance.
+func (g *Goal) Validate() error {
+	if !ValidGoalType(g.Type) {
+		return errors.New("type must be one_rep_max, workouts_per_week, weekly_volume, body_weight or distance_per_month")
+	}
+	if g.Type == GoalTypeOneRepMax {
+		if g.ExerciseName == nil || strings.TrimSpace(*g.ExerciseName) == "" {
+			return errors.New("one_rep_max goals need an exercise_name")
+		}
+	} else if g.ExerciseName != nil {
+		return errors.New("only one_rep_max goals take an exercise_name")
+	}
+	if g.Target <= 0 {
+		return errors.New("target must be positive")
+	}
+
+	switch {
+	case g.measuresWeight():
+		if g.Unit == nil || !units.ValidWeightUnit(*g.Unit) {
+			return errors.New("unit must be kg or lb")
+		}
+	case g.Type == GoalTypeDistancePerMonth:
+		if g.Unit == nil || !units.ValidDistanceUnit(*g.Unit) {
+			return errors.New("unit must be m, km or mi")
+		}
+	default:
+		if g.Unit != nil {
+			return errors.New("workouts_per_week goals take no unit")
+		}
+		if g.Target != math.Trunc(g.Target) || g.Target > maxWorkoutsPerWeek {
+			return errors.New("target must be a whole number of workouts of at most 50")
+		}
+	}
+
+	if _, err := time.Parse("2006-01-02", g.Deadline); err != nil {
+		return errors.New("deadline must be a date in YYYY-MM-DD format")
+	}
+	return nil
+}
+
+// canonicalTarget is the value stored in the target column.
+func (g *Goal) canonicalTarget() float64 {
+	switch {
+	case g.Unit == nil:
+		return g.Target
+	case g.measuresWeight():
+		return units.Round(units.ToKilograms(g.Target, *g.Unit), units.CanonicalWeightPlaces)
+	default:
+		return units.ToMeters(g.Target, *g.Unit)
+	}
+}
+
+// canonicalUnit is the unit goals of the type are stored in.
+func (g *Goal) canonicalUnit() *string {
+	var unit string
+	switch {
+	case g.measuresWeight():
+		unit = units.Kilograms
+	case g.Type == GoalTypeDistancePerMonth:
+		unit = units.Meters
+	default:
+		return nil
+	}
+	return &unit
+}
+
+// DisplayValue expresses value, in the goal's stored unit, in the units of
+// system.
+func (g *Goal) DisplayValue(value float64, system string) float64 {
+	switch {
+	case g.measuresWeight():
+		return units.Round(units.FromKilograms(value, units.WeightUnit(system)), units.WeightPlaces)
+	case g.Type == GoalTypeDistancePerMonth:
+		return units.Round(units.FromMeters(value, units.DistanceUnit(system)), units.DistancePlaces)
+	default:
+		return value
+	}
+}
+
+// ConvertUnits expresses the goal's target, start value and completions in
+// the units of system. It must only be called once, on a goal as read from
+// the store.
+func (g *Goal) ConvertUnits(system string) {
+	if g.Unit == nil {
+		return
+	}
+	g.Target = g.DisplayValue(g.Target, system)
+	if g.StartValue != nil {
+		start := g.DisplayValue(*g.StartValue, system)
+		g.StartValue = &start
+	}
+	for i := range g.Completions {
+		g.Completions[i].Value = g.DisplayValue(g.Completions[i].Value, system)
+	}
+
+	unit := units.WeightUnit(system)
+	if g.Type == GoalTypeDistancePerMonth {
+		unit = units.DistanceUnit(system)
+	}
+	g.Unit = &unit
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{db: db}
+}
+
+type GoalStore interface {
+	CreateGoal(goal *Goal) error
+	GetGoal(id int) (*Goal, error)
+	ListGoals(userID int) ([]*Goal, error)
+	UpdateGoal(goal *Goal) error
+	DeleteGoal(id int) error
+	RecordGoalCompletion(goal *Goal, periodStart time.Time, value float64) (bool, error)
+}
+
+const goalColumns = `id, user_id, goal_type, exercise_name, target, start_value, to_char(deadline, 'YYYY-MM-DD'), completed_at, created_at, updated_at`
+
+func scanGoal(row rowScanner, goal *Goal) error {
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.Type, &goal.ExerciseName, &goal.Target, &goal.StartValue, &goal.Deadline, &goal.CompletedAt, &goal.CreatedAt, &goal.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	goal.Unit = goal.canonicalUnit()
+	goal.Completions = []GoalCompletion{}
+	return nil
+}
+
+// CreateGoal stores the goal with its target converted from Unit. The
+// StartValue must already be in kilograms.
+func (s *PostgresGoalStore) CreateGoal(goal *Goal) error {
+	query := `
+	INSERT INTO goals (user_id, goal_type, exercise_name, target, start_value, deadline)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+
+	goal.Target = goal.canonicalTarget()
+	goal.Unit = goal.canonicalUnit()
+	goal.Completions = []GoalCompletion{}
+	return s.db.QueryRow(query, goal.UserID, goal.Type, goal.ExerciseName, goal.Target, goal.StartValue, goal.Deadline).Scan(&goal.ID, &goal.CreatedAt, &goal.UpdatedAt)
+}
+
+func (s *PostgresGoalStore) GetGoal(id int) (*Goal, error) {
+	goal := &Goal{}
+
+	query := `
+	SELECT ` + goalColumns + `
+	FROM goals
+	WHERE id = $1
+	`
+
+	err := scanGoal(s.db.QueryRow(query, id), goal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadGoalCompletions(s.db, goal)
+	if err != nil {
+		return nil, err
+	}
+
+	return goal, nil
+}
+
+// ListGoals returns the user's goals, soonest deadline first.
+func (s *PostgresGoalStore) ListGoals(userID int) ([]*Goal, error) {
+	query := `
+	SELECT ` + goalColumns + `
+	FROM goals
+	WHERE user_id = $1
+	ORDER BY deadline, id
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []*Goal{}
+	for rows.Next() {
+		goal := &Goal{}
+		err = scanGoal(rows, goal)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadGoalCompletions(s.db, goals...)
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+// loadGoalCompletions fills in the completions of goals, oldest first.
+func loadGoalCompletions(q queryer, goals ...*Goal) error {
+	if len(goals) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Goal{}
+	ids := make([]int, 0, len(goals))
+	for _, goal := range goals {
+		byID[goal.ID] = goal
+		ids = append(ids, goal.ID)
+	}
+
+	query := `
+	SELECT goal_id, period_start, value, completed_at
+	FROM goal_completions
+	WHERE goal_id = ANY($1)
+	ORDER BY goal_id, period_start
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var goalID int
+		var completion GoalCompletion
+		err = rows.Scan(&goalID, &completion.PeriodStart, &completion.Value, &completion.CompletedAt)
+		if err != nil {
+			return err
+		}
+		goal := byID[goalID]
+		goal.Completions = append(goal.Completions, completion)
+	}
+
+	return rows.Err()
+}
+
+// UpdateGoal changes the goal's target, converted from Unit, and deadline.
+func (s *PostgresGoalStore) UpdateGoal(goal *Goal) error {
+	query := `
+	UPDATE goals
+	SET target = $1, deadline = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $3
+	RETURNING updated_at
+	`
+
+	goal.Target = goal.canonicalTarget()
+	goal.Unit = goal.canonicalUnit()
+	return s.db.QueryRow(query, goal.Target, goal.Deadline, goal.ID).Scan(&goal.UpdatedAt)
+}
+
+func (s *PostgresGoalStore) DeleteGoal(id int) error {
+	query := `
+	DELETE FROM goals
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RecordGoalCompletion records that the goal reached value in the period
+// starting at periodStart, and marks goals that are not recurring as
+// completed. It reports false when the completion was already recorded.
+func (s *PostgresGoalStore) RecordGoalCompletion(goal *Goal, periodStart time.Time, value float64) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO goal_completions (goal_id, period_start, value)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (goal_id, period_start) DO NOTHING
+	RETURNING completed_at
+	`
+
+	var completion GoalCompletion
+	err = tx.QueryRow(query, goal.ID, periodStart, value).Scan(&completion.CompletedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !goal.Recurring() {
+		query = `
+		UPDATE goals
+		SET completed_at = $1
+		WHERE id = $2 AND completed_at IS NULL
+		`
+		_, err = tx.Exec(query, completion.CompletedAt, goal.ID)
+		if err != nil {
+			return false, err
+		}
+		goal.CompletedAt = &completion.CompletedAt
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	completion.PeriodStart, completion.Value = periodStart, value
+	goal.Completions = append(goal.Completions, completion)
+	return true, nil
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type IdempotencyRecord struct {
+	UserID       int
+	Key          string
+	RequestHash  []byte
+	StatusCode   *int
+	ResponseBody []byte
+	ExpiresAt    time.Time
+	// LockedUntil is when the request holding an incomplete key is presumed
+	// gone, letting a retry take the key over.
+	LockedUntil time.Time
+}
+
+func (r *IdempotencyRecord) IsCompleted() bool {
+	return r.StatusCode != nil
+}
+
+type PostgresIdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdempotencyStore(db *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+type IdempotencyStore interface {
+	ReserveKey(userID int, key string, requestHash []byte, ttl time.Duration, lease time.Duration) (*IdempotencyRecord, bool, error)
+	CompleteKey(userID int, key string, statusCode int, responseBody []byte) error
+	ReleaseKey(userID int, key string) error
+	DeleteExpiredKeys() (int64, error)
+}
+
+// ReserveKey claims the key for the user for the length of lease. When the
+// key is new, or an earlier request for the same body left it incomplete and
+// its lease ran out, it returns the reserved record and true; otherwise it
+// returns the existing record and false.
+func (s *PostgresIdempotencyStore) ReserveKey(userID int, key string, requestHash []byte, ttl time.Duration, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2 AND expires_at <= $3
+	`
+	_, err = tx.Exec(query, userID, key, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	record := &IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(ttl),
+		LockedUntil: now.Add(lease),
+	}
+
+	// A request that panicked, crashed or failed to store its response
+	// leaves its key incomplete; once the lease runs out a retry takes it.
+	query = `
+	INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at, locked_until)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+	WHERE idempotency_keys.status_code IS NULL
+	AND idempotency_keys.locked_until <= $6
+	AND idempotency_keys.request_hash = EXCLUDED.request_hash
+	`
+	result, err := tx.Exec(query, userID, key, requestHash, record.ExpiresAt, record.LockedUntil, now)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if rowsAffected == 0 {
+		existing := &IdempotencyRecord{UserID: userID, Key: key}
+
+		query = `
+		SELECT request_hash, status_code, response_body, expires_at, locked_until
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+		`
+		err = tx.QueryRow(query, userID, key).Scan(&existing.RequestHash, &existing.StatusCode, &existing.ResponseBody, &existing.ExpiresAt, &existing.LockedUntil)
+		if err != nil {
+			return nil, false, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, false, err
+		}
+
+		return existing, false, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, true, nil
+}
+
+func (s *PostgresIdempotencyStore) CompleteKey(userID int, key string, statusCode int, responseBody []byte) error {
+	query := `
+	UPDATE idempotency_keys
+	SET status_code = $1, response_body = $2
+	WHERE user_id = $3 AND key = $4
+	`
+
+	result, err := s.db.Exec(query, statusCode, responseBody, userID, key)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresIdempotencyStore) ReleaseKey(userID int, key string) error {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2
+	`
+
+	_, err := s.db.Exec(query, userID, key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresIdempotencyStore) DeleteExpiredKeys() (int64, error) {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE expires_at <= $1
+	`
+
+	result, err := s.db.Exec(query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveKeyLease(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	idempotencyStore := NewPostgresIdempotencyStore(db)
+	user := createTestUser(t, db, "idempotency_lease")
+	hash := []byte("request")
+
+	_, reserved, err := idempotencyStore.ReserveKey(user.ID, "held", hash, time.Hour, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	record, reserved, err := idempotencyStore.ReserveKey(user.ID, "held", hash, time.Hour, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.False(t, record.IsCompleted())
+
+	// A lease that has run out is taken over, but only by the same request.
+	_, reserved, err = idempotencyStore.ReserveKey(user.ID, "lapsed", hash, time.Hour, 0)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	_, reserved, err = idempotencyStore.ReserveKey(user.ID, "lapsed", []byte("other"), time.Hour, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	_, reserved, err = idempotencyStore.ReserveKey(user.ID, "lapsed", hash, time.Hour, 0)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	err = idempotencyStore.CompleteKey(user.ID, "lapsed", 201, []byte(`{}`))
+	require.NoError(t, err)
+	record, reserved, err = idempotencyStore.ReserveKey(user.ID, "lapsed", hash, time.Hour, 0)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	require.True(t, record.IsCompleted())
+	assert.Equal(t, 201, *record.StatusCode)
+}
@@ -0,0 +1,316 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrDuplicateJob is returned when a job cannot be queued again because
+// another job of its kind with the same unique key is queued or running.
+var ErrDuplicateJob = errors.New("a job with the same unique key is queued or running")
+
+// Job statuses. A queued job waits for run_at, a running one is held by a
+// worker until its lease runs out, and a dead one ran out of attempts.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+	JobCancelled = "cancelled"
+)
+
+func ValidJobStatus(status string) bool {
+	switch status {
+	case JobQueued, JobRunning, JobSucceeded, JobDead, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// Job is a unit of background work of the given kind. Only one job of a
+// kind with the same UniqueKey can be queued or running at once.
+type Job struct {
+	ID          int             `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   *string         `json:"unique_key"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	LastError   *string         `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+type JobFilter struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+// JobCount is how many jobs of a kind have a status.
+type JobCount struct {
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+func NewPostgresJobStore(db *sql.DB) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+type JobStore interface {
+	EnqueueJob(job *Job) (bool, error)
+	ClaimJob(kinds []string, lease time.Duration) (*Job, error)
+	CompleteJob(job *Job) error
+	FailJob(job *Job, message string, retryAt *time.Time) error
+	GetJob(id int) (*Job, error)
+	ListJobs(filter JobFilter) ([]*Job, error)
+	CountJobs() ([]JobCount, error)
+	RetryJob(id int) (*Job, error)
+	CancelJob(id int) (*Job, error)
+}
+
+const jobColumns = `id, kind, payload, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, created_at, updated_at, finished_at`
+
+func scanJob(row rowScanner, job *Job) error {
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.UniqueKey, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LockedUntil, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+	job.Payload = payload
+	return err
+}
+
+// EnqueueJob queues the job and reports true. When a job of the same kind
+// and unique key is already queued or running, job is set to that one and
+// false is reported.
+func (s *PostgresJobStore) EnqueueJob(job *Job) (bool, error) {
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+
+	insert := `
+	INSERT INTO jobs (kind, payload, unique_key, max_attempts, run_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND status IN ('queued', 'running') DO NOTHING
+	RETURNING ` + jobColumns
+
+	existing := `
+	SELECT ` + jobColumns + `
+	FROM jobs
+	WHERE kind = $1 AND unique_key = $2 AND status IN ('queued', 'running')
+	`
+
+	// The existing job can finish between the two statements; inserting
+	// again then succeeds.
+	for {
+		err := scanJob(s.db.QueryRow(insert, job.Kind, []byte(job.Payload), job.UniqueKey, job.MaxAttempts, job.RunAt), job)
+		if err != sql.ErrNoRows {
+			return err == nil, err
+		}
+
+		err = scanJob(s.db.QueryRow(existing, job.Kind, job.UniqueKey), job)
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+	}
+}
+
+// ClaimJob takes the earliest due job of one of the kinds off the queue for
+// lease and counts the attempt, or returns nil when none is due. Jobs whose
+// lease ran out are due again. Concurrent callers never claim the same job.
+func (s *PostgresJobStore) ClaimJob(kinds []string, lease time.Duration) (*Job, error) {
+	job := &Job{}
+
+	query := `
+	UPDATE jobs
+	SET status = 'running', attempts = attempts + 1, locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id
+		FROM jobs
+		WHERE kind = ANY($1)
+			AND ((status = 'queued' AND run_at <= CURRENT_TIMESTAMP) OR (status = 'running' AND locked_until <= CURRENT_TIMESTAMP))
+		ORDER BY run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+
+	err := scanJob(s.db.QueryRow(query, kinds, lease.Seconds()), job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// CompleteJob marks the claimed job as succeeded, unless its lease ran out
+// and it was claimed again.
+func (s *PostgresJobStore) CompleteJob(job *Job) error {
+	query := `
+	UPDATE jobs
+	SET status = 'succeeded', locked_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND status = 'running' AND attempts = $2
+	`
+
+	_, err := s.db.Exec(query, job.ID, job.Attempts)
+	return err
+}
+
+// FailJob records a failed attempt of the claimed job. It is queued again
+// for retryAt; nil makes it dead.
+func (s *PostgresJobStore) FailJob(job *Job, message string, retryAt *time.Time) error {
+	query := `
+	UPDATE jobs
+	SET status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'queued' END,
+		run_at = COALESCE($4, run_at),
+		locked_until = NULL,
+		last_error = $3,
+		updated_at = CURRENT_TIMESTAMP,
+		finished_at = CASE WHEN $4::timestamptz IS NULL THEN CURRENT_TIMESTAMP END
+	WHERE id = $1 AND status = 'running' AND attempts = $2
+	`
+
+	_, err := s.db.Exec(query, job.ID, job.Attempts, message, retryAt)
+	return err
+}
+
+func (s *PostgresJobStore) GetJob(id int) (*Job, error) {
+	job := &Job{}
+
+	query := `
+	SELECT ` + jobColumns + `
+	FROM jobs
+	WHERE id = $1
+	`
+
+	err := scanJob(s.db.QueryRow(query, id), job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListJobs returns the jobs with the optional status and kind, newest
+// first.
+func (s *PostgresJobStore) ListJobs(filter JobFilter) ([]*Job, error) {
+	query := `
+	SELECT ` + jobColumns + `
+	FROM jobs
+	WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+	ORDER BY id DESC
+	LIMIT $3 OFFSET $4
+	`
+
+	rows, err := s.db.Query(query, filter.Status, filter.Kind, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job := &Job{}
+		err = scanJob(rows, job)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (s *PostgresJobStore) CountJobs() ([]JobCount, error) {
+	query := `
+	SELECT kind, status, COUNT(*)
+	FROM jobs
+	GROUP BY kind, status
+	ORDER BY kind, status
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []JobCount{}
+	for rows.Next() {
+		var count JobCount
+		err = rows.Scan(&count.Kind, &count.Status, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// RetryJob queues a dead or cancelled job to run now with its attempts
+// reset. It returns nil when the job is in neither state, and
+// ErrDuplicateJob when another job with its unique key is queued or running.
+func (s *PostgresJobStore) RetryJob(id int) (*Job, error) {
+	job := &Job{}
+
+	query := `
+	UPDATE jobs
+	SET status = 'queued', attempts = 0, run_at = CURRENT_TIMESTAMP, locked_until = NULL, updated_at = CURRENT_TIMESTAMP, finished_at = NULL
+	WHERE id = $1 AND status IN ('dead', 'cancelled')
+	RETURNING ` + jobColumns
+
+	err := scanJob(s.db.QueryRow(query, id), job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "idx_jobs_unique_key" {
+			return nil, ErrDuplicateJob
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// CancelJob cancels a queued job. It returns nil when the job is not
+// queued.
+func (s *PostgresJobStore) CancelJob(id int) (*Job, error) {
+	job := &Job{}
+
+	query := `
+	UPDATE jobs
+	SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND status = 'queued'
+	RETURNING ` + jobColumns
+
+	err := scanJob(s.db.QueryRow(query, id), job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
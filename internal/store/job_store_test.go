@@ -0,0 +1,45 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryJobWithQueuedDuplicate(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	jobStore := NewPostgresJobStore(db)
+	kind := "test.retry"
+	_, err := db.Exec(`DELETE FROM jobs WHERE kind = $1`, kind)
+	require.NoError(t, err)
+
+	newJob := func() *Job {
+		return &Job{Kind: kind, Payload: json.RawMessage(`{}`), UniqueKey: &[]string{"backfill"}[0], MaxAttempts: 3}
+	}
+	first := newJob()
+	_, err = jobStore.EnqueueJob(first)
+	require.NoError(t, err)
+	cancelled, err := jobStore.CancelJob(first.ID)
+	require.NoError(t, err)
+	require.NotNil(t, cancelled)
+
+	second := newJob()
+	queued, err := jobStore.EnqueueJob(second)
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	_, err = jobStore.RetryJob(first.ID)
+	assert.ErrorIs(t, err, ErrDuplicateJob)
+
+	_, err = jobStore.CancelJob(second.ID)
+	require.NoError(t, err)
+	retried, err := jobStore.RetryJob(first.ID)
+	require.NoError(t, err)
+	require.NotNil(t, retried)
+	assert.Equal(t, JobQueued, retried.Status)
+	assert.Zero(t, retried.Attempts)
+}
@@ -0,0 +1,411 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+// CircumferenceSites are the places a circumference can be measured.
+var CircumferenceSites = []string{
+	"neck", "shoulders", "chest", "waist", "hips",
+	"left_arm", "right_arm", "left_forearm", "right_forearm",
+	"left_thigh", "right_thigh", "left_calf", "right_calf",
+}
+
+func validCircumferenceSite(site string) bool {
+	for _, s := range CircumferenceSites {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+// Measurement is a body measurement taken at one time. It is stored in
+// kilograms and centimeters and read back in those units; ConvertUnits
+// expresses it in a unit system.
+type Measurement struct {
+	ID             int                `json:"id"`
+	UserID         int                `json:"user_id"`
+	MeasuredAt     time.Time          `json:"measured_at"`
+	BodyWeight     *float64           `json:"body_weight"`
+	WeightUnit     string             `json:"weight_unit"`
+	BodyFatPercent *float64           `json:"body_fat_percent"`
+	Circumferences map[string]float64 `json:"circumferences"`
+	LengthUnit     string             `json:"length_unit"`
+	Notes          string             `json:"notes"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+func (m *Measurement) Validate() error {
+	if m.BodyWeight == nil && m.BodyFatPercent == nil && len(m.Circumferences) == 0 {
+		return errors.New("a measurement needs body_weight, body_fat_percent or circumferences")
+	}
+	if m.BodyWeight != nil && *m.BodyWeight <= 0 {
+		return errors.New("body_weight must be positive")
+	}
+	if !units.ValidWeightUnit(m.WeightUnit) {
+		return errors.New("weight_unit must be kg or lb")
+	}
+	if m.BodyFatPercent != nil && (*m.BodyFatPercent <= 0 || *m.BodyFatPercent >= 100) {
+		return errors.New("body_fat_percent must be between 0 and 100")
+	}
+	for site, length := range m.Circumferences {
+		if !validCircumferenceSite(site) {
+			return fmt.Errorf("unknown circumference site %q", site)
+		}
+		if length <= 0 {
+			return fmt.Errorf("circumference %s must be positive", site)
+		}
+	}
+	if !units.ValidLengthUnit(m.LengthUnit) {
+		return errors.New("length_unit must be cm or in")
+	}
+	return nil
+}
+
+// ConvertUnits expresses the measurement in the units of system.
+func (m *Measurement) ConvertUnits(system string) {
+	weightUnit := units.WeightUnit(system)
+	if m.BodyWeight != nil {
+		weight := units.Round(units.FromKilograms(units.ToKilograms(*m.BodyWeight, m.WeightUnit), weightUnit), units.WeightPlaces)
+		m.BodyWeight = &weight
+	}
+	m.WeightUnit = weightUnit
+
+	lengthUnit := units.LengthUnit(system)
+	for site, length := range m.Circumferences {
+		m.Circumferences[site] = units.Round(units.FromCentimeters(units.ToCentimeters(length, m.LengthUnit), lengthUnit), units.LengthPlaces)
+	}
+	m.LengthUnit = lengthUnit
+}
+
+// canonicalBodyWeight is the value stored in the body_weight column.
+func (m *Measurement) canonicalBodyWeight() *float64 {
+	if m.BodyWeight == nil {
+		return nil
+	}
+	kilograms := units.Round(units.ToKilograms(*m.BodyWeight, m.WeightUnit), units.CanonicalWeightPlaces)
+	return &kilograms
+}
+
+type MeasurementFilter struct {
+	UserID int
+	From   *time.Time
+	To     *time.Time
+}
+
+// BodyWeightLog answers what a user weighed at a given time: the latest
+// logged body weight at or before it, else the body weight of their profile.
+type BodyWeightLog struct {
+	times     []time.Time
+	kilograms []float64
+	fallback  *float64
+}
+
+// At returns the body weight in kilograms at t, or 0 when none is known.
+func (l *BodyWeightLog) At(t time.Time) float64 {
+	if l == nil {
+		return 0
+	}
+	i := sort.Search(len(l.times), func(i int) bool {
+		return l.times[i].After(t)
+	})
+	if i > 0 {
+		return l.kilograms[i-1]
+	}
+	if l.fallback != nil {
+		return *l.fallback
+	}
+	return 0
+}
+
+type PostgresMeasurementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMeasurementStore(db *sql.DB) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{db: db}
+}
+
+type MeasurementStore interface {
+	CreateMeasurement(measurement *Measurement) error
+	GetMeasurement(id int) (*Measurement, error)
+	UpdateMeasurement(measurement *Measurement) error
+	DeleteMeasurement(id int) error
+	ListMeasurements(filter MeasurementFilter) ([]*Measurement, error)
+	GetBodyWeightLog(userID int) (*BodyWeightLog, error)
+}
+
+const measurementColumns = `id, user_id, measured_at, body_weight, body_fat_percent, notes, created_at, updated_at`
+
+func scanMeasurement(row rowScanner, measurement *Measurement) error {
+	measurement.WeightUnit = units.Kilograms
+	measurement.LengthUnit = units.Centimeters
+	measurement.Circumferences = map[string]float64{}
+	return row.Scan(&measurement.ID, &measurement.UserID, &measurement.MeasuredAt, &measurement.BodyWeight, &measurement.BodyFatPercent, &measurement.Notes, &measurement.CreatedAt, &measurement.UpdatedAt)
+}
+
+func (s *PostgresMeasurementStore) CreateMeasurement(measurement *Measurement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if measurement.MeasuredAt.IsZero() {
+		measurement.MeasuredAt = time.Now()
+	}
+
+	query := `
+	INSERT INTO body_measurements (user_id, measured_at, body_weight, body_fat_percent, notes)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, measurement.UserID, measurement.MeasuredAt, measurement.canonicalBodyWeight(), measurement.BodyFatPercent, measurement.Notes).Scan(&measurement.ID, &measurement.CreatedAt, &measurement.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = insertCircumferences(tx, measurement)
+	if err != nil {
+		return err
+	}
+
+	err = appendEvent(tx, AggregateMeasurement, measurement.ID, measurement.UserID, EventMeasurementCreated, measurement)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertCircumferences(tx *sql.Tx, measurement *Measurement) error {
+	query := `
+	INSERT INTO body_circumferences (measurement_id, site, centimeters)
+	VALUES ($1, $2, $3)
+	`
+	for site, length := range measurement.Circumferences {
+		centimeters := units.Round(units.ToCentimeters(length, measurement.LengthUnit), units.CanonicalLengthPlaces)
+		_, err := tx.Exec(query, measurement.ID, site, centimeters)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresMeasurementStore) GetMeasurement(id int) (*Measurement, error) {
+	measurement := &Measurement{}
+
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM body_measurements
+	WHERE id = $1
+	`
+
+	err := scanMeasurement(s.db.QueryRow(query, id), measurement)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadCircumferences(s.db, measurement)
+	if err != nil {
+		return nil, err
+	}
+
+	return measurement, nil
+}
+
+func (s *PostgresMeasurementStore) UpdateMeasurement(measurement *Measurement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE body_measurements
+	SET measured_at = $1, body_weight = $2, body_fat_percent = $3, notes = $4, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $5
+	RETURNING updated_at
+	`
+	err = tx.QueryRow(query, measurement.MeasuredAt, measurement.canonicalBodyWeight(), measurement.BodyFatPercent, measurement.Notes, measurement.ID).Scan(&measurement.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM body_circumferences
+	WHERE measurement_id = $1
+	`
+	_, err = tx.Exec(query, measurement.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertCircumferences(tx, measurement)
+	if err != nil {
+		return err
+	}
+
+	err = appendEvent(tx, AggregateMeasurement, measurement.ID, measurement.UserID, EventMeasurementUpdated, measurement)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresMeasurementStore) DeleteMeasurement(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM body_measurements
+	WHERE id = $1
+	RETURNING user_id
+	`
+	var userID int
+	err = tx.QueryRow(query, id).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	err = appendEvent(tx, AggregateMeasurement, id, userID, EventMeasurementDeleted, map[string]int{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListMeasurements returns the user's measurements taken within the
+// optional [From, To) range, oldest first.
+func (s *PostgresMeasurementStore) ListMeasurements(filter MeasurementFilter) ([]*Measurement, error) {
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM body_measurements
+	WHERE user_id = $1
+	AND ($2::timestamptz IS NULL OR measured_at >= $2)
+	AND ($3::timestamptz IS NULL OR measured_at < $3)
+	ORDER BY measured_at, id
+	`
+
+	rows, err := s.db.Query(query, filter.UserID, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []*Measurement{}
+	for rows.Next() {
+		measurement := &Measurement{}
+		err = scanMeasurement(rows, measurement)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, measurement)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadCircumferences(s.db, measurements...)
+	if err != nil {
+		return nil, err
+	}
+
+	return measurements, nil
+}
+
+// loadCircumferences fills in the circumferences of measurements.
+func loadCircumferences(q queryer, measurements ...*Measurement) error {
+	if len(measurements) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Measurement{}
+	ids := make([]int, 0, len(measurements))
+	for _, measurement := range measurements {
+		byID[measurement.ID] = measurement
+		ids = append(ids, measurement.ID)
+	}
+
+	query := `
+	SELECT measurement_id, site, centimeters
+	FROM body_circumferences
+	WHERE measurement_id = ANY($1)
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var measurementID int
+		var site string
+		var centimeters float64
+		err = rows.Scan(&measurementID, &site, &centimeters)
+		if err != nil {
+			return err
+		}
+		byID[measurementID].Circumferences[site] = centimeters
+	}
+
+	return rows.Err()
+}
+
+func (s *PostgresMeasurementStore) GetBodyWeightLog(userID int) (*BodyWeightLog, error) {
+	log := &BodyWeightLog{}
+
+	query := `
+	SELECT body_weight
+	FROM users
+	WHERE id = $1
+	`
+	err := s.db.QueryRow(query, userID).Scan(&log.fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT measured_at, body_weight
+	FROM body_measurements
+	WHERE user_id = $1 AND body_weight IS NOT NULL
+	ORDER BY measured_at, id
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var measuredAt time.Time
+		var kilograms float64
+		err = rows.Scan(&measuredAt, &kilograms)
+		if err != nil {
+			return nil, err
+		}
+		log.times = append(log.times, measuredAt)
+		log.kilograms = append(log.kilograms, kilograms)
+	}
+
+	return log, rows.Err()
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/calories"
+)
+
+type PostgresMETStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMETStore(db *sql.DB) *PostgresMETStore {
+	return &PostgresMETStore{db: db}
+}
+
+type METStore interface {
+	ListMETValues(userID int) (calories.Table, error)
+	UpsertMETValue(userID int, exerciseName string, met float64) error
+	DeleteMETValue(userID int, exerciseName string) error
+}
+
+// ListMETValues returns the MET values the user set, keyed by exercise.
+func (s *PostgresMETStore) ListMETValues(userID int) (calories.Table, error) {
+	return getMETValues(s.db, userID)
+}
+
+func getMETValues(q queryer, userID int) (calories.Table, error) {
+	query := `
+	SELECT exercise_name, met
+	FROM exercise_met_values
+	WHERE user_id = $1
+	`
+
+	rows, err := q.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := calories.Table{}
+	for rows.Next() {
+		var name string
+		var met float64
+		err = rows.Scan(&name, &met)
+		if err != nil {
+			return nil, err
+		}
+		table[name] = met
+	}
+
+	return table, rows.Err()
+}
+
+func (s *PostgresMETStore) UpsertMETValue(userID int, exerciseName string, met float64) error {
+	query := `
+	INSERT INTO exercise_met_values (user_id, exercise_name, met)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, exercise_name) DO UPDATE
+	SET met = EXCLUDED.met
+	`
+
+	_, err := s.db.Exec(query, userID, calories.Key(exerciseName), met)
+	return err
+}
+
+func (s *PostgresMETStore) DeleteMETValue(userID int, exerciseName string) error {
+	query := `
+	DELETE FROM exercise_met_values
+	WHERE user_id = $1 AND exercise_name = $2
+	`
+
+	result, err := s.db.Exec(query, userID, calories.Key(exerciseName))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// calorieEfforts lists the time spent on each entry, once per round of its
+// group. A workout without entries, such as an imported activity, counts as
+// one effort of its sport over the whole duration.
+func (w *Workout) calorieEfforts() []calories.Effort {
+	efforts := []calories.Effort{}
+	w.EachEntry(func(group *WorkoutEntryGroup, entry *WorkoutEntry) {
+		seconds := calories.EffortSeconds(entry.Sets, entry.Reps, entry.DurationSeconds)
+		if group != nil {
+			seconds *= float64(max(group.Rounds, 1))
+		}
+		efforts = append(efforts, calories.Effort{Name: entry.ExerciseName, Kind: entry.Kind, Seconds: seconds})
+	})
+
+	if len(efforts) == 0 && w.Activity != nil {
+		efforts = append(efforts, calories.Effort{Name: w.Activity.Sport, Kind: EntryKindCardio, Seconds: float64(w.DurationMinutes * 60)})
+	}
+
+	return efforts
+}
+
+// estimateCalories works out the workout's EstimatedCalories from the user's
+// MET values and body weight when the workout was performed, as
+// BodyWeightLog.At finds it, and copies it into CaloriesBurned when no
+// value was supplied or the previous value was an estimate as well.
+func estimateCalories(q queryer, workout *Workout) error {
+	var bodyWeight *float64
+	query := `
+	SELECT COALESCE(
+		(SELECT body_weight FROM body_measurements
+		WHERE user_id = $1 AND body_weight IS NOT NULL AND measured_at <= $2
+		ORDER BY measured_at DESC, id DESC
+		LIMIT 1),
+		body_weight
+	)
+	FROM users
+	WHERE id = $1
+	`
+	err := q.QueryRow(query, workout.UserID, workout.PerformedAt).Scan(&bodyWeight)
+	if err != nil {
+		return err
+	}
+
+	workout.EstimatedCalories = nil
+	if bodyWeight != nil {
+		overrides, err := getMETValues(q, workout.UserID)
+		if err != nil {
+			return err
+		}
+		estimate := calories.DefaultMETs.With(overrides).Estimate(*bodyWeight, float64(workout.DurationMinutes*60), workout.calorieEfforts())
+		workout.EstimatedCalories = &estimate
+	}
+
+	if workout.CaloriesBurned == 0 || workout.CaloriesEstimated {
+		workout.CaloriesBurned = 0
+		if workout.EstimatedCalories != nil {
+			workout.CaloriesBurned = *workout.EstimatedCalories
+		}
+		workout.CaloriesEstimated = workout.EstimatedCalories != nil
+	}
+
+	return nil
+}
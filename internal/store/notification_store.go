@@ -0,0 +1,248 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Notification is a message shown to a user inside the app. DedupeKey, when
+// set, makes a second notification with the same key for the user a no-op.
+type Notification struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"-"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`
+	DedupeKey *string         `json:"-"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// UnreadCounts counts a user's unread notifications, in total and by type.
+type UnreadCounts struct {
+	Total  int            `json:"total"`
+	ByType map[string]int `json:"by_type"`
+}
+
+type NotificationFilter struct {
+	UserID     int
+	UnreadOnly bool
+	Limit      int
+	Offset     int
+}
+
+type PostgresNotificationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresNotificationStore(db *sql.DB) *PostgresNotificationStore {
+	return &PostgresNotificationStore{db: db}
+}
+
+type NotificationStore interface {
+	CreateNotification(notification *Notification) (bool, error)
+	GetNotification(id int) (*Notification, error)
+	ListNotifications(filter NotificationFilter) ([]*Notification, error)
+	CountUnread(userID int) (*UnreadCounts, error)
+	MarkNotificationRead(notification *Notification) error
+	MarkAllNotificationsRead(userID int) (int64, error)
+	GetNotificationPreferences(userID int) (map[string]bool, error)
+	SaveNotificationPreferences(userID int, preferences map[string]bool) error
+}
+
+const notificationColumns = `id, user_id, type, title, body, data, dedupe_key, read_at, created_at`
+
+func scanNotification(row rowScanner, notification *Notification) error {
+	var data []byte
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.Title, &notification.Body, &data, &notification.DedupeKey, &notification.ReadAt, &notification.CreatedAt)
+	notification.Data = data
+	return err
+}
+
+// CreateNotification stores the notification and reports false when one
+// with the same dedupe key already exists.
+func (s *PostgresNotificationStore) CreateNotification(notification *Notification) (bool, error) {
+	if len(notification.Data) == 0 {
+		notification.Data = json.RawMessage("{}")
+	}
+
+	query := `
+	INSERT INTO notifications (user_id, type, title, body, data, dedupe_key)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, dedupe_key) WHERE dedupe_key IS NOT NULL DO NOTHING
+	RETURNING id, created_at
+	`
+
+	err := s.db.QueryRow(query, notification.UserID, notification.Type, notification.Title, notification.Body, []byte(notification.Data), notification.DedupeKey).Scan(&notification.ID, &notification.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *PostgresNotificationStore) GetNotification(id int) (*Notification, error) {
+	notification := &Notification{}
+
+	query := `
+	SELECT ` + notificationColumns + `
+	FROM notifications
+	WHERE id = $1
+	`
+
+	err := scanNotification(s.db.QueryRow(query, id), notification)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// ListNotifications returns the user's notifications, newest first.
+func (s *PostgresNotificationStore) ListNotifications(filter NotificationFilter) ([]*Notification, error) {
+	query := `
+	SELECT ` + notificationColumns + `
+	FROM notifications
+	WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3 OFFSET $4
+	`
+
+	rows, err := s.db.Query(query, filter.UserID, filter.UnreadOnly, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification := &Notification{}
+		err = scanNotification(rows, notification)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *PostgresNotificationStore) CountUnread(userID int) (*UnreadCounts, error) {
+	query := `
+	SELECT type, COUNT(*)
+	FROM notifications
+	WHERE user_id = $1 AND read_at IS NULL
+	GROUP BY type
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := &UnreadCounts{ByType: map[string]int{}}
+	for rows.Next() {
+		var notificationType string
+		var count int
+		err = rows.Scan(&notificationType, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts.ByType[notificationType] = count
+		counts.Total += count
+	}
+
+	return counts, rows.Err()
+}
+
+// MarkNotificationRead marks the notification read, keeping the time it was
+// first read.
+func (s *PostgresNotificationStore) MarkNotificationRead(notification *Notification) error {
+	query := `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+	WHERE id = $1
+	RETURNING read_at
+	`
+
+	return s.db.QueryRow(query, notification.ID).Scan(&notification.ReadAt)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user read
+// and returns how many there were.
+func (s *PostgresNotificationStore) MarkAllNotificationsRead(userID int) (int64, error) {
+	query := `
+	UPDATE notifications
+	SET read_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	result, err := s.db.Exec(query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetNotificationPreferences returns the types the user turned on or off;
+// types missing from it are on.
+func (s *PostgresNotificationStore) GetNotificationPreferences(userID int) (map[string]bool, error) {
+	query := `
+	SELECT type, enabled
+	FROM notification_preferences
+	WHERE user_id = $1
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := map[string]bool{}
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		err = rows.Scan(&notificationType, &enabled)
+		if err != nil {
+			return nil, err
+		}
+		preferences[notificationType] = enabled
+	}
+
+	return preferences, rows.Err()
+}
+
+func (s *PostgresNotificationStore) SaveNotificationPreferences(userID int, preferences map[string]bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO notification_preferences (user_id, type, enabled)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, type) DO UPDATE
+	SET enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+	`
+
+	for notificationType, enabled := range preferences {
+		_, err = tx.Exec(query, userID, notificationType, enabled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
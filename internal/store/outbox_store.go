@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Aggregates that domain events are about. Events of one aggregate are
+// dispatched in the order they were written.
+const (
+	AggregateUser        = "user"
+	AggregateWorkout     = "workout"
+	AggregateMeasurement = "measurement"
+)
+
+// Domain event types.
+const (
+	EventUserRegistered     = "user.registered"
+	EventWorkoutCreated     = "workout.created"
+	EventWorkoutUpdated     = "workout.updated"
+	EventWorkoutDeleted     = "workout.deleted"
+	EventRecordAchieved     = "record.achieved"
+	EventMeasurementCreated = "measurement.created"
+	EventMeasurementUpdated = "measurement.updated"
+	EventMeasurementDeleted = "measurement.deleted"
+)
+
+// OutboxEvent is a domain event about the aggregate of the given type and
+// ID, owned by UserID. Payload is the JSON of the aggregate as saved, or
+// of its ID once deleted.
+type OutboxEvent struct {
+	ID            int64
+	AggregateType string
+	AggregateID   int
+	UserID        int
+	Type          string
+	Payload       json.RawMessage
+	OccurredAt    time.Time
+	Attempts      int
+	// Delivered holds the subscribers that already handled the event.
+	Delivered map[string]bool
+}
+
+type PostgresOutboxStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxStore(db *sql.DB) *PostgresOutboxStore {
+	return &PostgresOutboxStore{db: db}
+}
+
+type OutboxStore interface {
+	AppendEvent(aggregateType string, aggregateID int, userID int, eventType string, data interface{}) error
+	LockDispatcher() (func() error, bool, error)
+	ListPendingEvents(limit int) ([]*OutboxEvent, error)
+	MarkEventDelivered(eventID int64, subscriber string) error
+	MarkEventDispatched(eventID int64) error
+	RecordEventFailure(eventID int64, message string, retryAt *time.Time) error
+	DeleteDispatchedEvents(before time.Time) (int64, error)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// appendEvent writes an event with data as its payload. Stores call it with
+// the transaction of the change, so the event exists exactly when the
+// change was committed.
+func appendEvent(e execer, aggregateType string, aggregateID int, userID int, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO outbox_events (aggregate_type, aggregate_id, user_id, event_type, payload)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = e.Exec(query, aggregateType, aggregateID, userID, eventType, payload)
+	return err
+}
+
+func appendWorkoutEvent(e execer, eventType string, workout *Workout) error {
+	return appendEvent(e, AggregateWorkout, workout.ID, workout.UserID, eventType, workout)
+}
+
+func appendWorkoutDeleted(e execer, userID int, workoutID int) error {
+	return appendEvent(e, AggregateWorkout, workoutID, userID, EventWorkoutDeleted, map[string]int{"id": workoutID})
+}
+
+// AppendEvent writes an event that follows from one already dispatched
+// rather than from a change of its own.
+func (s *PostgresOutboxStore) AppendEvent(aggregateType string, aggregateID int, userID int, eventType string, data interface{}) error {
+	return appendEvent(s.db, aggregateType, aggregateID, userID, eventType, data)
+}
+
+// LockDispatcher takes the lock that lets a single process dispatch events
+// and reports whether it got it. The lock lives on its own connection, so a
+// process that dies releases it.
+func (s *PostgresOutboxStore) LockDispatcher() (func() error, bool, error) {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext('outbox_dispatcher'))`).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext('outbox_dispatcher'))`)
+		return err
+	}
+	return unlock, true, nil
+}
+
+// ListPendingEvents returns up to limit due events, oldest first, that are
+// the earliest pending event of their aggregate. An aggregate whose event
+// waits for a retry holds back its later events.
+func (s *PostgresOutboxStore) ListPendingEvents(limit int) ([]*OutboxEvent, error) {
+	query := `
+	SELECT e.id, e.aggregate_type, e.aggregate_id, e.user_id, e.event_type, e.payload, e.occurred_at, e.attempts,
+		array_to_json(ARRAY(SELECT d.subscriber FROM outbox_deliveries d WHERE d.event_id = e.id))
+	FROM outbox_events e
+	WHERE e.dispatched_at IS NULL AND e.next_attempt_at <= CURRENT_TIMESTAMP
+		AND NOT EXISTS (
+			SELECT 1
+			FROM outbox_events earlier
+			WHERE earlier.dispatched_at IS NULL AND earlier.aggregate_type = e.aggregate_type
+				AND earlier.aggregate_id = e.aggregate_id AND earlier.id < e.id
+		)
+	ORDER BY e.id
+	LIMIT $1
+	`
+
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+	for rows.Next() {
+		event := &OutboxEvent{}
+		var payload, delivered []byte
+		err = rows.Scan(&event.ID, &event.AggregateType, &event.AggregateID, &event.UserID, &event.Type, &payload, &event.OccurredAt, &event.Attempts, &delivered)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+
+		var subscribers []string
+		err = json.Unmarshal(delivered, &subscribers)
+		if err != nil {
+			return nil, err
+		}
+		event.Delivered = map[string]bool{}
+		for _, subscriber := range subscribers {
+			event.Delivered[subscriber] = true
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *PostgresOutboxStore) MarkEventDelivered(eventID int64, subscriber string) error {
+	query := `
+	INSERT INTO outbox_deliveries (event_id, subscriber)
+	VALUES ($1, $2)
+	ON CONFLICT (event_id, subscriber) DO NOTHING
+	`
+
+	_, err := s.db.Exec(query, eventID, subscriber)
+	return err
+}
+
+func (s *PostgresOutboxStore) MarkEventDispatched(eventID int64) error {
+	query := `
+	UPDATE outbox_events
+	SET attempts = attempts + 1, last_error = NULL, dispatched_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+
+	_, err := s.db.Exec(query, eventID)
+	return err
+}
+
+// RecordEventFailure records an attempt some subscriber failed. The event
+// is tried again at retryAt; nil gives up on it.
+func (s *PostgresOutboxStore) RecordEventFailure(eventID int64, message string, retryAt *time.Time) error {
+	query := `
+	UPDATE outbox_events
+	SET attempts = attempts + 1,
+		last_error = $2,
+		next_attempt_at = COALESCE($3, next_attempt_at),
+		dispatched_at = CASE WHEN $3::timestamptz IS NULL THEN CURRENT_TIMESTAMP END
+	WHERE id = $1
+	`
+
+	_, err := s.db.Exec(query, eventID, message, retryAt)
+	return err
+}
+
+// DeleteDispatchedEvents deletes the events dispatched before the given
+// time and returns how many were deleted.
+func (s *PostgresOutboxStore) DeleteDispatchedEvents(before time.Time) (int64, error) {
+	query := `
+	DELETE FROM outbox_events
+	WHERE dispatched_at < $1
+	`
+
+	result, err := s.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	ProgressionModelLinear            = "linear"
+	ProgressionModelDoubleProgression = "double_progression"
+	ProgressionModelRPE               = "rpe"
+)
+
+// ProgressionSettings configure how suggestions progress on an exercise.
+// Linear and RPE-based progression aim for MinReps; double progression
+// works up from MinReps to MaxReps before adding weight. Increment is in
+// kilograms and is also the step suggested weights are rounded to. After
+// StallSessions failed sessions in a row the weight is cut by
+// DeloadPercent.
+type ProgressionSettings struct {
+	ExerciseName  string     `json:"exercise_name"`
+	Model         string     `json:"model"`
+	Sets          int        `json:"sets"`
+	MinReps       int        `json:"min_reps"`
+	MaxReps       int        `json:"max_reps"`
+	TargetRPE     *float64   `json:"target_rpe"`
+	Increment     float64    `json:"increment"`
+	DeloadPercent float64    `json:"deload_percent"`
+	StallSessions int        `json:"stall_sessions"`
+	UpdatedAt     *time.Time `json:"updated_at"`
+}
+
+func ValidProgressionModel(model string) bool {
+	switch model {
+	case ProgressionModelLinear, ProgressionModelDoubleProgression, ProgressionModelRPE:
+		return true
+	}
+	return false
+}
+
+func (s *ProgressionSettings) Validate() error {
+	if !ValidProgressionModel(s.Model) {
+		return errors.New("model must be linear, double_progression or rpe")
+	}
+	if s.Sets < 1 || s.Sets > 20 {
+		return errors.New("sets must be between 1 and 20")
+	}
+	if s.MinReps < 1 || s.MaxReps < s.MinReps || s.MaxReps > 100 {
+		return errors.New("min_reps must be at least 1 and max_reps between min_reps and 100")
+	}
+	if s.Model == ProgressionModelRPE && s.TargetRPE == nil {
+		return errors.New("rpe progression needs a target_rpe")
+	}
+	if s.TargetRPE != nil && (*s.TargetRPE < 1 || *s.TargetRPE > 10) {
+		return errors.New("target_rpe must be between 1 and 10")
+	}
+	if s.Increment <= 0 {
+		return errors.New("increment must be positive")
+	}
+	if s.DeloadPercent <= 0 || s.DeloadPercent >= 100 {
+		return errors.New("deload_percent must be between 0 and 100")
+	}
+	if s.StallSessions < 1 {
+		return errors.New("stall_sessions must be at least 1")
+	}
+	return nil
+}
+
+// ExerciseKey is how exercise names are matched: trimmed and lower case.
+func ExerciseKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ExerciseSession sums up how a workout went on an exercise at its top
+// weight, in kilograms: the sets done at that weight, the fewest reps of
+// any of them and the highest RPE logged.
+type ExerciseSession struct {
+	WorkoutID   int       `json:"workout_id"`
+	PerformedAt time.Time `json:"performed_at"`
+	Weight      float64   `json:"weight"`
+	Sets        int       `json:"sets"`
+	Reps        int       `json:"reps"`
+	RPE         *float64  `json:"rpe"`
+}
+
+type PostgresProgressionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgressionStore(db *sql.DB) *PostgresProgressionStore {
+	return &PostgresProgressionStore{db: db}
+}
+
+type ProgressionStore interface {
+	GetProgressionSettings(userID int, exerciseName string) (*ProgressionSettings, error)
+	UpsertProgressionSettings(userID int, settings *ProgressionSettings) error
+	DeleteProgressionSettings(userID int, exerciseName string) error
+	ListExerciseSessions(userID int, exerciseName string, limit int) ([]ExerciseSession, error)
+}
+
+// GetProgressionSettings returns the user's settings for the exercise, or
+// nil when they have none.
+func (s *PostgresProgressionStore) GetProgressionSettings(userID int, exerciseName string) (*ProgressionSettings, error) {
+	query := `
+	SELECT exercise_name, model, sets, min_reps, max_reps, target_rpe, increment, deload_percent, stall_sessions, updated_at
+	FROM progression_settings
+	WHERE user_id = $1 AND exercise_name = $2
+	`
+
+	settings := &ProgressionSettings{}
+	err := s.db.QueryRow(query, userID, ExerciseKey(exerciseName)).Scan(&settings.ExerciseName, &settings.Model, &settings.Sets, &settings.MinReps, &settings.MaxReps,
+		&settings.TargetRPE, &settings.Increment, &settings.DeloadPercent, &settings.StallSessions, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *PostgresProgressionStore) UpsertProgressionSettings(userID int, settings *ProgressionSettings) error {
+	query := `
+	INSERT INTO progression_settings (user_id, exercise_name, model, sets, min_reps, max_reps, target_rpe, increment, deload_percent, stall_sessions)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (user_id, exercise_name) DO UPDATE
+	SET model = EXCLUDED.model, sets = EXCLUDED.sets, min_reps = EXCLUDED.min_reps, max_reps = EXCLUDED.max_reps, target_rpe = EXCLUDED.target_rpe,
+		increment = EXCLUDED.increment, deload_percent = EXCLUDED.deload_percent, stall_sessions = EXCLUDED.stall_sessions, updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at
+	`
+
+	settings.ExerciseName = ExerciseKey(settings.ExerciseName)
+	return s.db.QueryRow(query, userID, settings.ExerciseName, settings.Model, settings.Sets, settings.MinReps, settings.MaxReps, settings.TargetRPE,
+		settings.Increment, settings.DeloadPercent, settings.StallSessions).Scan(&settings.UpdatedAt)
+}
+
+func (s *PostgresProgressionStore) DeleteProgressionSettings(userID int, exerciseName string) error {
+	query := `
+	DELETE FROM progression_settings
+	WHERE user_id = $1 AND exercise_name = $2
+	`
+	result, err := s.db.Exec(query, userID, ExerciseKey(exerciseName))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ListExerciseSessions returns the user's last limit sessions of weighted
+// reps of the exercise, oldest first. Entries in groups count once per
+// round.
+func (s *PostgresProgressionStore) ListExerciseSessions(userID int, exerciseName string, limit int) ([]ExerciseSession, error) {
+	query := `
+	WITH entries AS (
+		SELECT w.id AS workout_id, w.performed_at, e.weight, e.sets * COALESCE(g.rounds, 1) AS sets, e.reps, e.rpe
+		FROM workout_entries e
+		JOIN workouts w ON w.id = e.workout_id
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		WHERE w.user_id = $1 AND lower(trim(e.exercise_name)) = $2
+		AND e.kind = 'reps' AND e.reps > 0 AND e.weight > 0
+	), top AS (
+		SELECT workout_id, MAX(weight) AS weight
+		FROM entries
+		GROUP BY workout_id
+	)
+	SELECT t.workout_id, MIN(e.performed_at) AS performed_at, t.weight, SUM(e.sets), MIN(e.reps), MAX(e.rpe)
+	FROM top t
+	JOIN entries e ON e.workout_id = t.workout_id AND e.weight = t.weight
+	GROUP BY t.workout_id, t.weight
+	ORDER BY performed_at DESC, t.workout_id DESC
+	LIMIT $3
+	`
+
+	rows, err := s.db.Query(query, userID, ExerciseKey(exerciseName), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []ExerciseSession{}
+	for rows.Next() {
+		var session ExerciseSession
+		err = rows.Scan(&session.WorkoutID, &session.PerformedAt, &session.Weight, &session.Sets, &session.Reps, &session.RPE)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(sessions)-1; i < j; i, j = i+1, j-1 {
+		sessions[i], sessions[j] = sessions[j], sessions[i]
+	}
+	return sessions, nil
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Kinds of schedule notices.
+const (
+	NoticeReminder = "reminder"
+	NoticeMissed   = "missed"
+)
+
+// ReminderSettings says where a user's schedule reminders and missed-session
+// reports are sent. Users without saved settings get them in the app only.
+type ReminderSettings struct {
+	UserID     int     `json:"-"`
+	Email      bool    `json:"email"`
+	InApp      bool    `json:"in_app"`
+	WebhookURL *string `json:"webhook_url"`
+	// WebhookSecret signs the webhook requests. It is only shown when it
+	// is created.
+	WebhookSecret *string   `json:"-"`
+	NotifyMissed  bool      `json:"notify_missed"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DefaultReminderSettings returns the settings of a user who saved none.
+func DefaultReminderSettings(userID int) *ReminderSettings {
+	return &ReminderSettings{UserID: userID, InApp: true, NotifyMissed: true}
+}
+
+func (rs *ReminderSettings) Validate() error {
+	if rs.WebhookURL == nil {
+		return nil
+	}
+	u, err := url.Parse(*rs.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// ReminderTarget is a schedule with the owner its notices go to.
+type ReminderTarget struct {
+	Schedule *Schedule
+	User     *User
+	Settings *ReminderSettings
+}
+
+type PostgresReminderStore struct {
+	db *sql.DB
+}
+
+func NewPostgresReminderStore(db *sql.DB) *PostgresReminderStore {
+	return &PostgresReminderStore{db: db}
+}
+
+type ReminderStore interface {
+	GetReminderSettings(userID int) (*ReminderSettings, error)
+	SaveReminderSettings(settings *ReminderSettings) error
+	ListReminderTargets() ([]*ReminderTarget, error)
+	ListWorkoutTimes(userID int, from, to time.Time) ([]time.Time, error)
+	ClaimNotice(scheduleID int, occurrenceAt time.Time, kind string) (bool, error)
+}
+
+func (s *PostgresReminderStore) GetReminderSettings(userID int) (*ReminderSettings, error) {
+	settings := &ReminderSettings{UserID: userID}
+
+	query := `
+	SELECT email, in_app, webhook_url, webhook_secret, notify_missed, updated_at
+	FROM reminder_settings
+	WHERE user_id = $1
+	`
+
+	err := s.db.QueryRow(query, userID).Scan(&settings.Email, &settings.InApp, &settings.WebhookURL, &settings.WebhookSecret, &settings.NotifyMissed, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultReminderSettings(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *PostgresReminderStore) SaveReminderSettings(settings *ReminderSettings) error {
+	query := `
+	INSERT INTO reminder_settings (user_id, email, in_app, webhook_url, webhook_secret, notify_missed)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id) DO UPDATE
+	SET email = EXCLUDED.email, in_app = EXCLUDED.in_app, webhook_url = EXCLUDED.webhook_url,
+		webhook_secret = EXCLUDED.webhook_secret, notify_missed = EXCLUDED.notify_missed, updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at
+	`
+
+	return s.db.QueryRow(query, settings.UserID, settings.Email, settings.InApp, settings.WebhookURL, settings.WebhookSecret, settings.NotifyMissed).Scan(&settings.UpdatedAt)
+}
+
+// ListReminderTargets returns every schedule that asks for a reminder or
+// whose owner wants missed sessions reported.
+func (s *PostgresReminderStore) ListReminderTargets() ([]*ReminderTarget, error) {
+	query := `
+	SELECT s.id, s.user_id, s.title, s.notes, to_char(s.starts_at, 'YYYY-MM-DD"T"HH24:MI'), s.duration_minutes,
+		s.rrule, s.reminder_minutes, s.created_at, s.updated_at,
+		u.username, u.email, u.timezone,
+		COALESCE(rs.email, FALSE), COALESCE(rs.in_app, TRUE), rs.webhook_url, rs.webhook_secret, COALESCE(rs.notify_missed, TRUE)
+	FROM schedules s
+	JOIN users u ON u.id = s.user_id
+	LEFT JOIN reminder_settings rs ON rs.user_id = s.user_id
+	WHERE s.reminder_minutes IS NOT NULL OR COALESCE(rs.notify_missed, TRUE)
+	ORDER BY s.user_id, s.id
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []*ReminderTarget{}
+	for rows.Next() {
+		schedule := &Schedule{}
+		user := &User{}
+		settings := &ReminderSettings{}
+		err = rows.Scan(
+			&schedule.ID, &schedule.UserID, &schedule.Title, &schedule.Notes, &schedule.StartsAt, &schedule.DurationMinutes,
+			&schedule.RRule, &schedule.ReminderMinutes, &schedule.CreatedAt, &schedule.UpdatedAt,
+			&user.Username, &user.Email, &user.Timezone,
+			&settings.Email, &settings.InApp, &settings.WebhookURL, &settings.WebhookSecret, &settings.NotifyMissed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		user.ID = schedule.UserID
+		settings.UserID = schedule.UserID
+		targets = append(targets, &ReminderTarget{Schedule: schedule, User: user, Settings: settings})
+	}
+
+	return targets, rows.Err()
+}
+
+// ListWorkoutTimes returns when the user's workouts within [from, to) were
+// performed, earliest first.
+func (s *PostgresReminderStore) ListWorkoutTimes(userID int, from, to time.Time) ([]time.Time, error) {
+	query := `
+	SELECT performed_at
+	FROM workouts
+	WHERE user_id = $1 AND performed_at >= $2 AND performed_at < $3
+	ORDER BY performed_at
+	`
+
+	rows, err := s.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+
+	return times, rows.Err()
+}
+
+// ClaimNotice records that the notice of the given kind for an occurrence
+// is being sent. It reports false when it was already claimed, so every
+// notice goes out at most once.
+func (s *PostgresReminderStore) ClaimNotice(scheduleID int, occurrenceAt time.Time, kind string) (bool, error) {
+	query := `
+	INSERT INTO schedule_notices (schedule_id, occurrence_at, kind)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`
+
+	result, err := s.db.Exec(query, scheduleID, occurrenceAt, kind)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
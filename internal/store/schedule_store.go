@@ -0,0 +1,201 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/rrule"
+)
+
+// ScheduleTimeLayout is the layout of Schedule.StartsAt.
+const ScheduleTimeLayout = "2006-01-02T15:04"
+
+const (
+	maxScheduleTitleLength     = 255
+	maxScheduleDurationMinutes = 24 * 60
+	maxReminderMinutes         = 7 * 24 * 60
+)
+
+// Schedule is a planned workout. StartsAt is a wall-clock time in the
+// user's time zone; RRule, in RFC 5545 syntax, repeats it and nil means
+// the plan happens once. ReminderMinutes asks for a reminder that many
+// minutes before each occurrence.
+type Schedule struct {
+	ID              int       `json:"id"`
+	UserID          int       `json:"-"`
+	Title           string    `json:"title"`
+	Notes           string    `json:"notes"`
+	StartsAt        string    `json:"starts_at"`
+	DurationMinutes int       `json:"duration_minutes"`
+	RRule           *string   `json:"rrule"`
+	ReminderMinutes *int      `json:"reminder_minutes"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Validate checks the schedule and puts its RRule in canonical form.
+func (s *Schedule) Validate() error {
+	if strings.TrimSpace(s.Title) == "" || len(s.Title) > maxScheduleTitleLength {
+		return errors.New("title is required and must be at most 255 characters")
+	}
+	if _, err := time.Parse(ScheduleTimeLayout, s.StartsAt); err != nil {
+		return errors.New("starts_at must be a local time in YYYY-MM-DDTHH:MM format")
+	}
+	if s.DurationMinutes < 1 || s.DurationMinutes > maxScheduleDurationMinutes {
+		return errors.New("duration_minutes must be between 1 and 1440")
+	}
+	if s.ReminderMinutes != nil && (*s.ReminderMinutes < 0 || *s.ReminderMinutes > maxReminderMinutes) {
+		return errors.New("reminder_minutes must be between 0 and 10080")
+	}
+
+	if s.RRule != nil && strings.TrimSpace(*s.RRule) == "" {
+		s.RRule = nil
+	}
+	if s.RRule != nil {
+		rule, err := rrule.Parse(*s.RRule)
+		if err != nil {
+			return err
+		}
+		canonical := rule.String()
+		s.RRule = &canonical
+	}
+	return nil
+}
+
+// Start returns the first occurrence of a valid schedule in loc.
+func (s *Schedule) Start(loc *time.Location) time.Time {
+	start, _ := time.ParseInLocation(ScheduleTimeLayout, s.StartsAt, loc)
+	return start
+}
+
+// Occurrences returns the start of every occurrence of a valid schedule
+// within [from, to), in loc.
+func (s *Schedule) Occurrences(from, to time.Time, loc *time.Location) []time.Time {
+	start := s.Start(loc)
+	if s.RRule == nil {
+		if start.Before(from) || !start.Before(to) {
+			return []time.Time{}
+		}
+		return []time.Time{start}
+	}
+
+	rule, err := rrule.Parse(*s.RRule)
+	if err != nil {
+		return []time.Time{}
+	}
+	return rule.Between(start, from, to)
+}
+
+type PostgresScheduleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduleStore(db *sql.DB) *PostgresScheduleStore {
+	return &PostgresScheduleStore{db: db}
+}
+
+type ScheduleStore interface {
+	CreateSchedule(schedule *Schedule) error
+	GetSchedule(id int) (*Schedule, error)
+	ListSchedules(userID int) ([]*Schedule, error)
+	UpdateSchedule(schedule *Schedule) error
+	DeleteSchedule(id int) error
+}
+
+const scheduleColumns = `id, user_id, title, notes, to_char(starts_at, 'YYYY-MM-DD"T"HH24:MI'), duration_minutes, rrule, reminder_minutes, created_at, updated_at`
+
+func scanSchedule(row rowScanner, schedule *Schedule) error {
+	return row.Scan(&schedule.ID, &schedule.UserID, &schedule.Title, &schedule.Notes, &schedule.StartsAt, &schedule.DurationMinutes, &schedule.RRule, &schedule.ReminderMinutes, &schedule.CreatedAt, &schedule.UpdatedAt)
+}
+
+func (s *PostgresScheduleStore) CreateSchedule(schedule *Schedule) error {
+	query := `
+	INSERT INTO schedules (user_id, title, notes, starts_at, duration_minutes, rrule, reminder_minutes)
+	VALUES ($1, $2, $3, $4::timestamp, $5, $6, $7)
+	RETURNING id, created_at, updated_at
+	`
+
+	return s.db.QueryRow(query, schedule.UserID, schedule.Title, schedule.Notes, schedule.StartsAt, schedule.DurationMinutes, schedule.RRule, schedule.ReminderMinutes).Scan(&schedule.ID, &schedule.CreatedAt, &schedule.UpdatedAt)
+}
+
+func (s *PostgresScheduleStore) GetSchedule(id int) (*Schedule, error) {
+	schedule := &Schedule{}
+
+	query := `
+	SELECT ` + scheduleColumns + `
+	FROM schedules
+	WHERE id = $1
+	`
+
+	err := scanSchedule(s.db.QueryRow(query, id), schedule)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// ListSchedules returns the user's schedules, earliest start first.
+func (s *PostgresScheduleStore) ListSchedules(userID int) ([]*Schedule, error) {
+	query := `
+	SELECT ` + scheduleColumns + `
+	FROM schedules
+	WHERE user_id = $1
+	ORDER BY starts_at, id
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*Schedule{}
+	for rows.Next() {
+		schedule := &Schedule{}
+		err = scanSchedule(rows, schedule)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (s *PostgresScheduleStore) UpdateSchedule(schedule *Schedule) error {
+	query := `
+	UPDATE schedules
+	SET title = $1, notes = $2, starts_at = $3::timestamp, duration_minutes = $4, rrule = $5, reminder_minutes = $6, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $7
+	RETURNING updated_at
+	`
+
+	return s.db.QueryRow(query, schedule.Title, schedule.Notes, schedule.StartsAt, schedule.DurationMinutes, schedule.RRule, schedule.ReminderMinutes, schedule.ID).Scan(&schedule.UpdatedAt)
+}
+
+func (s *PostgresScheduleStore) DeleteSchedule(id int) error {
+	query := `
+	DELETE FROM schedules
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
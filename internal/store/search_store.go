@@ -0,0 +1,222 @@
+package store
+
+import (
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	SearchScopeMine = "mine"
+	SearchScopeAll  = "all"
+)
+
+// maxSearchTerms caps the words of a query that take part in the search.
+const maxSearchTerms = 10
+
+// ts_headline marks matches with private-use characters, stripped from the
+// text beforehand, rather than with <mark> tags: the text is user input,
+// and is only HTML-escaped once ts_headline returns it.
+const (
+	searchStartSel = "\uE000"
+	searchStopSel  = "\uE001"
+)
+
+// searchHeadline marks matches in the text returned by ts_headline.
+const searchHeadline = `StartSel="` + searchStartSel + `", StopSel="` + searchStopSel + `", HighlightAll=true`
+
+// searchSnippet picks the best matching fragments of longer text.
+const searchSnippet = `StartSel="` + searchStartSel + `", StopSel="` + searchStopSel + `", MaxWords=20, MinWords=8, MaxFragments=2, FragmentDelimiter=" … "`
+
+var searchMarks = strings.NewReplacer(searchStartSel, "<mark>", searchStopSel, "</mark>")
+
+// searchText strips the match marks from the text in column.
+func searchText(column string) string {
+	return `translate(` + column + `, '` + searchStartSel + searchStopSel + `', '')`
+}
+
+// highlight HTML-escapes text returned by ts_headline and wraps its matches
+// in <mark>.
+func highlight(marked string) string {
+	return searchMarks.Replace(html.EscapeString(marked))
+}
+
+func highlightNullable(marked *string) *string {
+	if marked == nil {
+		return nil
+	}
+	highlighted := highlight(*marked)
+	return &highlighted
+}
+
+// SearchResult is a workout matching a search, with text HTML-escaped and
+// matched words wrapped in <mark>. Title is always set; Description and the entries' Notes only
+// when they hold a matched word, and Entries lists only matching entries.
+type SearchResult struct {
+	WorkoutID   int                `json:"workout_id"`
+	UserID      int                `json:"user_id"`
+	Title       string             `json:"title"`
+	Description *string            `json:"description"`
+	PerformedAt time.Time          `json:"performed_at"`
+	Rank        float64            `json:"rank"`
+	Entries     []SearchEntryMatch `json:"entries"`
+}
+
+type SearchEntryMatch struct {
+	EntryID      int     `json:"entry_id"`
+	ExerciseName string  `json:"exercise_name"`
+	Notes        *string `json:"notes"`
+}
+
+type SearchFilter struct {
+	UserID int
+	Query  string
+	Scope  string
+	Tags   []string
+	Limit  int
+	Offset int
+}
+
+type PostgresSearchStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSearchStore(db *sql.DB) *PostgresSearchStore {
+	return &PostgresSearchStore{db: db}
+}
+
+type SearchStore interface {
+	SearchWorkouts(filter SearchFilter) ([]*SearchResult, error)
+}
+
+// PrefixQuery turns free text into a tsquery that matches workouts
+// containing every word, each as a prefix so partially typed words match
+// too. Punctuation is dropped, so the result is safe to pass to
+// to_tsquery; it is empty if the text holds no words.
+func PrefixQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = word + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchWorkouts returns the workouts whose title and description, or one
+// of whose entries, match filter.Query, best match first. The user's own
+// workouts are searched, along with other users' public ones for
+// SearchScopeAll; with Tags, only those carrying every one of them.
+func (s *PostgresSearchStore) SearchWorkouts(filter SearchFilter) ([]*SearchResult, error) {
+	tsquery := PrefixQuery(filter.Query)
+	if tsquery == "" {
+		return []*SearchResult{}, nil
+	}
+
+	query := `
+	WITH q AS (
+		SELECT to_tsquery('english', $1) AS query
+	),
+	hits AS (
+		SELECT w.id
+		FROM workouts w, q
+		WHERE w.search_vector @@ q.query
+		AND (w.user_id = $2 OR ($3 AND w.visibility = 'public'))
+		UNION
+		SELECT we.workout_id
+		FROM workout_entries we
+		JOIN workouts w ON w.id = we.workout_id
+		CROSS JOIN q
+		WHERE we.search_vector @@ q.query
+		AND (w.user_id = $2 OR ($3 AND w.visibility = 'public'))
+	)
+	SELECT w.id, w.user_id, w.performed_at,
+		ts_headline('english', ` + searchText("w.title") + `, q.query, '` + searchHeadline + `'),
+		CASE WHEN d.snippet LIKE '%` + searchStartSel + `%' THEN d.snippet END,
+		ts_rank(w.search_vector, q.query) + coalesce((
+			SELECT max(ts_rank(we.search_vector, q.query))
+			FROM workout_entries we
+			WHERE we.workout_id = w.id AND we.search_vector @@ q.query
+		), 0) AS rank
+	FROM hits
+	JOIN workouts w ON w.id = hits.id
+	CROSS JOIN q
+	CROSS JOIN LATERAL (
+		SELECT ts_headline('english', ` + searchText("coalesce(w.description, '')") + `, q.query, '` + searchSnippet + `') AS snippet
+	) d
+	WHERE (cardinality($6::text[]) = 0 OR w.id IN (` + taggedWorkoutIDs("$6") + `))
+	ORDER BY rank DESC, w.performed_at DESC, w.id DESC
+	LIMIT $4 OFFSET $5
+	`
+
+	rows, err := s.db.Query(query, tsquery, filter.UserID, filter.Scope == SearchScopeAll, filter.Limit, filter.Offset, tagNames(filter.Tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	byID := map[int]*SearchResult{}
+	ids := []int{}
+	for rows.Next() {
+		result := &SearchResult{Entries: []SearchEntryMatch{}}
+		err = rows.Scan(&result.WorkoutID, &result.UserID, &result.PerformedAt, &result.Title, &result.Description, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		result.Title = highlight(result.Title)
+		result.Description = highlightNullable(result.Description)
+		results = append(results, result)
+		byID[result.WorkoutID] = result
+		ids = append(ids, result.WorkoutID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	entryQuery := `
+	WITH q AS (
+		SELECT to_tsquery('english', $1) AS query
+	)
+	SELECT we.workout_id, we.id,
+		ts_headline('english', ` + searchText("we.exercise_name") + `, q.query, '` + searchHeadline + `'),
+		CASE WHEN n.snippet LIKE '%` + searchStartSel + `%' THEN n.snippet END
+	FROM workout_entries we
+	CROSS JOIN q
+	CROSS JOIN LATERAL (
+		SELECT ts_headline('english', ` + searchText("coalesce(we.notes, '')") + `, q.query, '` + searchSnippet + `') AS snippet
+	) n
+	WHERE we.workout_id = ANY($2) AND we.search_vector @@ q.query
+	ORDER BY we.workout_id, we.order_index
+	`
+
+	entryRows, err := s.db.Query(entryQuery, tsquery, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer entryRows.Close()
+
+	for entryRows.Next() {
+		var workoutID int
+		var match SearchEntryMatch
+		err = entryRows.Scan(&workoutID, &match.EntryID, &match.ExerciseName, &match.Notes)
+		if err != nil {
+			return nil, err
+		}
+		match.ExerciseName = highlight(match.ExerciseName)
+		match.Notes = highlightNullable(match.Notes)
+		byID[workoutID].Entries = append(byID[workoutID].Entries, match)
+	}
+
+	return results, entryRows.Err()
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "single word", text: "Shoulder", want: "shoulder:*"},
+		{name: "every word must match", text: "shoulder hurt", want: "shoulder:* & hurt:*"},
+		{name: "operators are dropped", text: "squat & !bench | (deadlift):*", want: "squat:* & bench:* & deadlift:*"},
+		{name: "quotes and apostrophes split words", text: `it's "leg day"`, want: "it:* & s:* & leg:* & day:*"},
+		{name: "digits and accents are kept", text: "5x5 Übung", want: "5x5:* & übung:*"},
+		{name: "no words", text: " -- !! ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PrefixQuery(tt.text))
+		})
+	}
+}
+
+func TestPrefixQueryCapsTerms(t *testing.T) {
+	query := PrefixQuery(strings.Repeat("word ", maxSearchTerms+5))
+	assert.Equal(t, maxSearchTerms, strings.Count(query, ":*"))
+}
+
+func TestHighlight(t *testing.T) {
+	marked := `<img src=x onerror=alert(1)> ` + searchStartSel + `Squat` + searchStopSel + ` & "press"`
+	assert.Equal(t, `&lt;img src=x onerror=alert(1)&gt; <mark>Squat</mark> &amp; &#34;press&#34;`, highlight(marked))
+	assert.Nil(t, highlightNullable(nil))
+}
@@ -0,0 +1,342 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+const (
+	SessionStatusActive   = "active"
+	SessionStatusFinished = "finished"
+)
+
+var (
+	ErrSessionExists   = errors.New("workout already has a session")
+	ErrSessionFinished = errors.New("session is finished")
+)
+
+// WorkoutSession is the live state of a workout being performed. Sets are
+// ticked off against the workout's entries. Updating the workout keeps the
+// progress on the entries sent back with their IDs; entries removed, or
+// sent without their IDs, lose theirs.
+type WorkoutSession struct {
+	ID             int            `json:"id"`
+	WorkoutID      int            `json:"workout_id"`
+	UserID         int            `json:"user_id"`
+	Status         string         `json:"status"`
+	CurrentEntryID *int           `json:"current_entry_id"`
+	RestStartedAt  *time.Time     `json:"rest_started_at"`
+	RestSeconds    *int           `json:"rest_seconds"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     *time.Time     `json:"finished_at"`
+	CompletedSets  []CompletedSet `json:"completed_sets"`
+}
+
+// RestEndsAt returns when the running rest timer ends, or nil without one.
+func (s *WorkoutSession) RestEndsAt() *time.Time {
+	if s.RestStartedAt == nil || s.RestSeconds == nil {
+		return nil
+	}
+	endsAt := s.RestStartedAt.Add(time.Duration(*s.RestSeconds) * time.Second)
+	return &endsAt
+}
+
+// CompletedSet records what was actually done for one set of an entry.
+type CompletedSet struct {
+	EntryID         int       `json:"entry_id"`
+	SetNumber       int       `json:"set_number"`
+	Reps            *int      `json:"reps"`
+	Weight          *float64  `json:"weight"`
+	WeightUnit      *string   `json:"weight_unit"`
+	DurationSeconds *int      `json:"duration_seconds"`
+	CompletedAt     time.Time `json:"completed_at"`
+}
+
+func (c *CompletedSet) Validate() error {
+	if c.SetNumber < 1 {
+		return errors.New("set_number must be at least 1")
+	}
+	if c.Weight != nil && (*c.Weight < 0 || c.WeightUnit == nil || !units.ValidWeightUnit(*c.WeightUnit)) {
+		return errors.New("weight must not be negative and weight_unit must be kg or lb")
+	}
+	if c.Weight == nil && c.WeightUnit != nil {
+		return errors.New("weight_unit needs a weight")
+	}
+	return nil
+}
+
+// ConvertUnits expresses the set's weight in the units of system.
+func (c *CompletedSet) ConvertUnits(system string) {
+	unit := units.WeightUnit(system)
+	if c.Weight == nil || c.WeightUnit == nil || *c.WeightUnit == unit {
+		return
+	}
+	weight := units.Round(units.FromKilograms(units.ToKilograms(*c.Weight, *c.WeightUnit), unit), units.WeightPlaces)
+	c.Weight, c.WeightUnit = &weight, &unit
+}
+
+// ConvertUnits expresses every completed set in the units of system.
+func (s *WorkoutSession) ConvertUnits(system string) {
+	for i := range s.CompletedSets {
+		s.CompletedSets[i].ConvertUnits(system)
+	}
+}
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db}
+}
+
+type SessionStore interface {
+	StartSession(workoutID int, userID int) (*WorkoutSession, error)
+	GetSession(workoutID int) (*WorkoutSession, error)
+	CompleteSet(session *WorkoutSession, set *CompletedSet) error
+	SetCurrentEntry(session *WorkoutSession, entryID *int) error
+	StartRest(session *WorkoutSession, seconds int) error
+	StopRest(session *WorkoutSession) error
+	FinishSession(session *WorkoutSession) (*Workout, error)
+}
+
+const workoutSessionColumns = `id, workout_id, user_id, status, current_entry_id, rest_started_at, rest_seconds, started_at, finished_at`
+
+func scanWorkoutSession(row rowScanner, session *WorkoutSession) error {
+	return row.Scan(&session.ID, &session.WorkoutID, &session.UserID, &session.Status, &session.CurrentEntryID, &session.RestStartedAt, &session.RestSeconds, &session.StartedAt, &session.FinishedAt)
+}
+
+// StartSession starts the session of a workout. A workout has at most one
+// session; starting another returns ErrSessionExists.
+func (s *PostgresSessionStore) StartSession(workoutID int, userID int) (*WorkoutSession, error) {
+	session := &WorkoutSession{CompletedSets: []CompletedSet{}}
+
+	query := `
+	INSERT INTO workout_sessions (workout_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (workout_id) DO NOTHING
+	RETURNING ` + workoutSessionColumns
+
+	err := scanWorkoutSession(s.db.QueryRow(query, workoutID, userID), session)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *PostgresSessionStore) GetSession(workoutID int) (*WorkoutSession, error) {
+	session := &WorkoutSession{CompletedSets: []CompletedSet{}}
+
+	query := `
+	SELECT ` + workoutSessionColumns + `
+	FROM workout_sessions
+	WHERE workout_id = $1
+	`
+
+	err := scanWorkoutSession(s.db.QueryRow(query, workoutID), session)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT entry_id, set_number, reps, weight, weight_unit, duration_seconds, completed_at
+	FROM workout_session_sets
+	WHERE session_id = $1
+	ORDER BY completed_at, entry_id, set_number
+	`
+
+	rows, err := s.db.Query(query, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var set CompletedSet
+		err = rows.Scan(&set.EntryID, &set.SetNumber, &set.Reps, &set.Weight, &set.WeightUnit, &set.DurationSeconds, &set.CompletedAt)
+		if err != nil {
+			return nil, err
+		}
+		if set.Weight != nil && set.WeightUnit != nil {
+			weight := units.Round(units.FromKilograms(*set.Weight, *set.WeightUnit), units.WeightPlaces)
+			set.Weight = &weight
+		}
+		session.CompletedSets = append(session.CompletedSets, set)
+	}
+
+	return session, rows.Err()
+}
+
+// CompleteSet records a set of one of the workout's entries, replacing an
+// earlier record of the same set. It returns sql.ErrNoRows when the entry is
+// not part of the session's workout.
+func (s *PostgresSessionStore) CompleteSet(session *WorkoutSession, set *CompletedSet) error {
+	if session.Status != SessionStatusActive {
+		return ErrSessionFinished
+	}
+
+	var weight *float64
+	if set.Weight != nil {
+		kilograms := units.Round(units.ToKilograms(*set.Weight, *set.WeightUnit), units.CanonicalWeightPlaces)
+		weight = &kilograms
+	}
+
+	query := `
+	INSERT INTO workout_session_sets (session_id, entry_id, set_number, reps, weight, weight_unit, duration_seconds)
+	SELECT $1, e.id, $3, $4, $5, $6, $7
+	FROM workout_entries e
+	WHERE e.id = $2 AND e.workout_id = $8
+	ON CONFLICT (session_id, entry_id, set_number) DO UPDATE
+	SET reps = EXCLUDED.reps, weight = EXCLUDED.weight, weight_unit = EXCLUDED.weight_unit,
+		duration_seconds = EXCLUDED.duration_seconds, completed_at = CURRENT_TIMESTAMP
+	RETURNING completed_at
+	`
+
+	return s.db.QueryRow(query, session.ID, set.EntryID, set.SetNumber, set.Reps, weight, set.WeightUnit, set.DurationSeconds, session.WorkoutID).Scan(&set.CompletedAt)
+}
+
+// SetCurrentEntry records the entry being performed, or none for nil. It
+// returns sql.ErrNoRows when the entry is not part of the session's workout.
+func (s *PostgresSessionStore) SetCurrentEntry(session *WorkoutSession, entryID *int) error {
+	if session.Status != SessionStatusActive {
+		return ErrSessionFinished
+	}
+
+	query := `
+	UPDATE workout_sessions
+	SET current_entry_id = $1
+	WHERE id = $2
+	AND ($1::bigint IS NULL OR EXISTS (SELECT 1 FROM workout_entries WHERE id = $1 AND workout_id = $3))
+	`
+
+	result, err := s.db.Exec(query, entryID, session.ID, session.WorkoutID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	session.CurrentEntryID = entryID
+	return nil
+}
+
+func (s *PostgresSessionStore) StartRest(session *WorkoutSession, seconds int) error {
+	if session.Status != SessionStatusActive {
+		return ErrSessionFinished
+	}
+
+	query := `
+	UPDATE workout_sessions
+	SET rest_started_at = CURRENT_TIMESTAMP, rest_seconds = $1
+	WHERE id = $2
+	RETURNING rest_started_at, rest_seconds
+	`
+
+	return s.db.QueryRow(query, seconds, session.ID).Scan(&session.RestStartedAt, &session.RestSeconds)
+}
+
+func (s *PostgresSessionStore) StopRest(session *WorkoutSession) error {
+	query := `
+	UPDATE workout_sessions
+	SET rest_started_at = NULL, rest_seconds = NULL
+	WHERE id = $1
+	`
+
+	_, err := s.db.Exec(query, session.ID)
+	if err != nil {
+		return err
+	}
+
+	session.RestStartedAt, session.RestSeconds = nil, nil
+	return nil
+}
+
+// FinishSession ends the session, sets the workout's duration to the time
+// between start and finish and estimates its calories again. It returns the
+// updated workout.
+func (s *PostgresSessionStore) FinishSession(session *WorkoutSession) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE workout_sessions
+	SET status = 'finished', finished_at = CURRENT_TIMESTAMP, rest_started_at = NULL, rest_seconds = NULL
+	WHERE id = $1 AND status = 'active'
+	RETURNING finished_at
+	`
+	err = tx.QueryRow(query, session.ID).Scan(&session.FinishedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.Status = SessionStatusFinished
+	session.RestStartedAt, session.RestSeconds = nil, nil
+
+	workout := &Workout{}
+	query = `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE id = $1
+	FOR UPDATE
+	`
+	err = scanWorkout(tx.QueryRow(query, session.WorkoutID), workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadWorkoutContent(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.DurationMinutes = int(math.Round(session.FinishedAt.Sub(session.StartedAt).Minutes()))
+	err = estimateCalories(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	UPDATE workouts
+	SET duration_minutes = $1, calories_burned = $2, estimated_calories = $3, calories_estimated = $4
+	WHERE id = $5
+	RETURNING sync_version, updated_at
+	`
+	err = tx.QueryRow(query, workout.DurationMinutes, workout.CaloriesBurned, workout.EstimatedCalories, workout.CaloriesEstimated, workout.ID).Scan(&workout.Version, &workout.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = appendWorkoutEvent(tx, EventWorkoutUpdated, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
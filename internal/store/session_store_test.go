@@ -0,0 +1,124 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateWorkoutKeepsSessionProgress(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	sessionStore := NewPostgresSessionStore(db)
+	user := createTestUser(t, db, "session_update")
+	workout := createTestWorkout(t, db, user.ID, "Legs", "Squat", "Lunge")
+	squat, lunge := workout.Entries[0], workout.Entries[1]
+
+	session, err := sessionStore.StartSession(workout.ID, user.ID)
+	require.NoError(t, err)
+	err = sessionStore.SetCurrentEntry(session, &squat.ID)
+	require.NoError(t, err)
+	for _, entryID := range []int{squat.ID, lunge.ID} {
+		err = sessionStore.CompleteSet(session, &CompletedSet{EntryID: entryID, SetNumber: 1, Reps: &[]int{10}[0]})
+		require.NoError(t, err)
+	}
+
+	workout.Title = "Leg day"
+	workout.Entries[0].Notes = "Go deeper"
+	workout.Entries = append(workout.Entries[:1], WorkoutEntry{ExerciseName: "Calf raise", Sets: 3, Reps: &[]int{15}[0], OrderIndex: 3})
+	err = workoutStore.UpdateWorkout(workout)
+	require.NoError(t, err)
+
+	updated, err := workoutStore.GetWorkout(workout.ID)
+	require.NoError(t, err)
+	require.Len(t, updated.Entries, 2)
+	assert.Equal(t, squat.ID, updated.Entries[0].ID)
+	assert.Equal(t, "Go deeper", updated.Entries[0].Notes)
+	assert.NotEqual(t, lunge.ID, updated.Entries[1].ID)
+
+	session, err = sessionStore.GetSession(workout.ID)
+	require.NoError(t, err)
+	require.NotNil(t, session.CurrentEntryID)
+	assert.Equal(t, squat.ID, *session.CurrentEntryID)
+	require.Len(t, session.CompletedSets, 1)
+	assert.Equal(t, squat.ID, session.CompletedSets[0].EntryID)
+}
+
+func TestCompleteSet(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	sessionStore := NewPostgresSessionStore(db)
+	user := createTestUser(t, db, "session_complete")
+	workout := createTestWorkout(t, db, user.ID, "Legs", "Squat")
+	otherWorkout := createTestWorkout(t, db, user.ID, "Arms", "Curl")
+	squat := workout.Entries[0]
+
+	session, err := sessionStore.StartSession(workout.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, SessionStatusActive, session.Status)
+	_, err = sessionStore.StartSession(workout.ID, user.ID)
+	assert.ErrorIs(t, err, ErrSessionExists)
+
+	set := &CompletedSet{EntryID: squat.ID, SetNumber: 1, Reps: &[]int{8}[0]}
+	err = sessionStore.CompleteSet(session, set)
+	require.NoError(t, err)
+	assert.False(t, set.CompletedAt.IsZero())
+
+	// Completing the same set again replaces the earlier record.
+	err = sessionStore.CompleteSet(session, &CompletedSet{EntryID: squat.ID, SetNumber: 1, Reps: &[]int{10}[0], Weight: &[]float64{225}[0], WeightUnit: &[]string{"lb"}[0]})
+	require.NoError(t, err)
+
+	err = sessionStore.CompleteSet(session, &CompletedSet{EntryID: otherWorkout.Entries[0].ID, SetNumber: 1, Reps: &[]int{10}[0]})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	session, err = sessionStore.GetSession(workout.ID)
+	require.NoError(t, err)
+	require.Len(t, session.CompletedSets, 1)
+	completed := session.CompletedSets[0]
+	assert.Equal(t, squat.ID, completed.EntryID)
+	assert.Equal(t, 10, *completed.Reps)
+	require.NotNil(t, completed.Weight)
+	assert.Equal(t, 225.0, *completed.Weight)
+	assert.Equal(t, "lb", *completed.WeightUnit)
+}
+
+func TestFinishSession(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	sessionStore := NewPostgresSessionStore(db)
+	user := createTestUser(t, db, "session_finish")
+	workout := createTestWorkout(t, db, user.ID, "Legs", "Squat")
+	workout.DurationMinutes = 45
+	err := NewPostgresWorkoutStore(db).UpdateWorkout(workout)
+	require.NoError(t, err)
+
+	session, err := sessionStore.StartSession(workout.ID, user.ID)
+	require.NoError(t, err)
+	err = sessionStore.StartRest(session, 90)
+	require.NoError(t, err)
+
+	finished, err := sessionStore.FinishSession(session)
+	require.NoError(t, err)
+	assert.Equal(t, workout.ID, finished.ID)
+	assert.Zero(t, finished.DurationMinutes)
+	assert.Greater(t, finished.Version, workout.Version)
+	assert.Equal(t, SessionStatusFinished, session.Status)
+	assert.NotNil(t, session.FinishedAt)
+	assert.Nil(t, session.RestStartedAt)
+
+	stored, err := sessionStore.GetSession(workout.ID)
+	require.NoError(t, err)
+	assert.Equal(t, SessionStatusFinished, stored.Status)
+	assert.Nil(t, stored.RestSeconds)
+
+	_, err = sessionStore.FinishSession(stored)
+	assert.ErrorIs(t, err, ErrSessionFinished)
+	err = sessionStore.CompleteSet(session, &CompletedSet{EntryID: workout.Entries[0].ID, SetNumber: 1, Reps: &[]int{10}[0]})
+	assert.ErrorIs(t, err, ErrSessionFinished)
+}
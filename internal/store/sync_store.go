@@ -0,0 +1,325 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrVersionConflict = errors.New("version conflict")
+
+// DeletedConflictError is the ErrVersionConflict of an edit to a workout
+// that was deleted after the version the edit is based on.
+type DeletedConflictError struct {
+	Tombstone Tombstone
+}
+
+func (e *DeletedConflictError) Error() string {
+	return "version conflict: workout was deleted"
+}
+
+func (e *DeletedConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+type Tombstone struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   int       `json:"entity_id"`
+	ClientID   *string   `json:"client_id"`
+	Version    int64     `json:"version"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+type SyncChanges struct {
+	Workouts   []*Workout  `json:"workouts"`
+	Tombstones []Tombstone `json:"tombstones"`
+	Version    int64       `json:"-"`
+	HasMore    bool        `json:"has_more"`
+}
+
+type PostgresSyncStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSyncStore(db *sql.DB) *PostgresSyncStore {
+	return &PostgresSyncStore{db: db}
+}
+
+type SyncStore interface {
+	GetChangesSince(userID int, since int64, limit int) (*SyncChanges, error)
+	GetWorkoutByClientID(userID int, clientID string) (*Workout, error)
+	UpsertWorkoutByClientID(workout *Workout, baseVersion int64) (*Workout, bool, error)
+	DeleteWorkoutByClientID(userID int, clientID string, baseVersion int64) (int, error)
+}
+
+func lockUserSync(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock_shared(hashtext('sync'), $1)`, userID)
+	return err
+}
+
+// GetChangesSince returns workouts and tombstones with a version greater than
+// since, oldest first. Workouts always carry their complete entries and
+// groups.
+func (s *PostgresSyncStore) GetChangesSince(userID int, since int64, limit int) (*SyncChanges, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Waiting on the shared lock lets in-flight writes for this user commit
+	// first, so nothing below the returned version can still appear later.
+	err = lockUserSync(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &SyncChanges{Workouts: []*Workout{}, Tombstones: []Tombstone{}, Version: since}
+
+	query := `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE user_id = $1 AND sync_version > $2
+	ORDER BY sync_version
+	LIMIT $3
+	`
+	rows, err := tx.Query(query, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		workout := &Workout{}
+		err = scanWorkout(rows, workout)
+		if err != nil {
+			return nil, err
+		}
+		changes.Workouts = append(changes.Workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT entity_type, entity_id, client_id, sync_version, deleted_at
+	FROM sync_tombstones
+	WHERE user_id = $1 AND sync_version > $2
+	ORDER BY sync_version
+	LIMIT $3
+	`
+	rows, err = tx.Query(query, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tombstone Tombstone
+		err = rows.Scan(&tombstone.EntityType, &tombstone.EntityID, &tombstone.ClientID, &tombstone.Version, &tombstone.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes.Tombstones = append(changes.Tombstones, tombstone)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	trimSyncChanges(changes, limit)
+
+	err = loadWorkoutContent(tx, changes.Workouts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// trimSyncChanges keeps the limit oldest changes across both lists and
+// records the version the next page should start after.
+func trimSyncChanges(changes *SyncChanges, limit int) {
+	versions := make([]int64, 0, len(changes.Workouts)+len(changes.Tombstones))
+	for _, workout := range changes.Workouts {
+		versions = append(versions, workout.Version)
+	}
+	for _, tombstone := range changes.Tombstones {
+		versions = append(versions, tombstone.Version)
+	}
+	if len(versions) == 0 {
+		return
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	if len(versions) > limit {
+		versions = versions[:limit]
+		changes.HasMore = true
+	}
+	changes.Version = versions[len(versions)-1]
+
+	workouts := changes.Workouts[:0]
+	for _, workout := range changes.Workouts {
+		if workout.Version <= changes.Version {
+			workouts = append(workouts, workout)
+		}
+	}
+	changes.Workouts = workouts
+
+	tombstones := changes.Tombstones[:0]
+	for _, tombstone := range changes.Tombstones {
+		if tombstone.Version <= changes.Version {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	changes.Tombstones = tombstones
+}
+
+func getWorkoutByClientID(q queryer, userID int, clientID string, forUpdate bool) (*Workout, error) {
+	workout := &Workout{}
+
+	query := `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE user_id = $1 AND client_id = $2
+	`
+	if forUpdate {
+		query += "FOR UPDATE"
+	}
+
+	err := scanWorkout(q.QueryRow(query, userID, clientID), workout)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = loadWorkoutContent(q, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+func getTombstoneByClientID(q queryer, userID int, clientID string) (*Tombstone, error) {
+	tombstone := &Tombstone{}
+
+	query := `
+	SELECT entity_type, entity_id, client_id, sync_version, deleted_at
+	FROM sync_tombstones
+	WHERE user_id = $1 AND entity_type = 'workout' AND client_id = $2
+	ORDER BY sync_version DESC
+	LIMIT 1
+	`
+
+	err := q.QueryRow(query, userID, clientID).Scan(&tombstone.EntityType, &tombstone.EntityID, &tombstone.ClientID, &tombstone.Version, &tombstone.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstone, nil
+}
+
+func (s *PostgresSyncStore) GetWorkoutByClientID(userID int, clientID string) (*Workout, error) {
+	return getWorkoutByClientID(s.db, userID, clientID, false)
+}
+
+// UpsertWorkoutByClientID creates the workout when its client ID is unknown
+// and reports true. An existing workout is only overwritten when baseVersion
+// matches its current version, otherwise ErrVersionConflict is returned. An
+// edit based on a version of a workout that has since been deleted returns
+// a *DeletedConflictError rather than bringing the workout back.
+func (s *PostgresSyncStore) UpsertWorkoutByClientID(workout *Workout, baseVersion int64) (*Workout, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getWorkoutByClientID(tx, workout.UserID, *workout.ClientID, true)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing == nil && baseVersion > 0 {
+		tombstone, err := getTombstoneByClientID(tx, workout.UserID, *workout.ClientID)
+		if err != nil {
+			return nil, false, err
+		}
+		if tombstone != nil {
+			return nil, false, &DeletedConflictError{Tombstone: *tombstone}
+		}
+	}
+
+	created := existing == nil
+	eventType := EventWorkoutCreated
+	if created {
+		err = insertWorkout(tx, workout)
+	} else {
+		if existing.Version != baseVersion {
+			return nil, false, ErrVersionConflict
+		}
+		workout.ID = existing.ID
+		eventType = EventWorkoutUpdated
+		err = updateWorkout(tx, workout)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = appendWorkoutEvent(tx, eventType, workout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return workout, created, nil
+}
+
+// DeleteWorkoutByClientID deletes the workout if baseVersion matches its
+// current version and returns its id. Deleting an unknown client ID returns
+// sql.ErrNoRows.
+func (s *PostgresSyncStore) DeleteWorkoutByClientID(userID int, clientID string, baseVersion int64) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getWorkoutByClientID(tx, userID, clientID, true)
+	if err != nil {
+		return 0, err
+	}
+	if existing == nil {
+		return 0, sql.ErrNoRows
+	}
+	if existing.Version != baseVersion {
+		return 0, ErrVersionConflict
+	}
+
+	_, err = tx.Exec(`DELETE FROM workouts WHERE id = $1`, existing.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = appendWorkoutDeleted(tx, userID, existing.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return existing.ID, tx.Commit()
+}
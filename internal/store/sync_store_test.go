@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSyncWorkout(userID int, clientID string, title string) *Workout {
+	return &Workout{UserID: userID, ClientID: &clientID, Title: title, Entries: []WorkoutEntry{
+		{ExerciseName: "Squat", Sets: 3, Reps: &[]int{10}[0], OrderIndex: 1},
+	}}
+}
+
+func TestSyncChangesCursor(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	syncStore := NewPostgresSyncStore(db)
+	user := createTestUser(t, db, "sync_cursor")
+	other := createTestUser(t, db, "sync_cursor_other")
+
+	changes, err := syncStore.GetChangesSince(user.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, changes.Workouts)
+	assert.Empty(t, changes.Tombstones)
+	assert.Zero(t, changes.Version)
+	assert.False(t, changes.HasMore)
+
+	first, created, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, "8d6a1c3e-0b7f-4b6e-9a51-0f3c2d1e4a01", "First"), 0)
+	require.NoError(t, err)
+	assert.True(t, created)
+	second, created, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, "8d6a1c3e-0b7f-4b6e-9a51-0f3c2d1e4a02", "Second"), 0)
+	require.NoError(t, err)
+	assert.True(t, created)
+	_, _, err = syncStore.UpsertWorkoutByClientID(newSyncWorkout(other.ID, "8d6a1c3e-0b7f-4b6e-9a51-0f3c2d1e4a03", "Other"), 0)
+	require.NoError(t, err)
+
+	changes, err = syncStore.GetChangesSince(user.ID, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, changes.Workouts, 1)
+	assert.Equal(t, first.ID, changes.Workouts[0].ID)
+	assert.Len(t, changes.Workouts[0].Entries, 1)
+	assert.Equal(t, first.Version, changes.Version)
+	assert.True(t, changes.HasMore)
+
+	changes, err = syncStore.GetChangesSince(user.ID, changes.Version, 10)
+	require.NoError(t, err)
+	require.Len(t, changes.Workouts, 1)
+	assert.Equal(t, second.ID, changes.Workouts[0].ID)
+	assert.Equal(t, second.Version, changes.Version)
+	assert.False(t, changes.HasMore)
+
+	cursor := changes.Version
+	changes, err = syncStore.GetChangesSince(user.ID, cursor, 10)
+	require.NoError(t, err)
+	assert.Empty(t, changes.Workouts)
+	assert.Equal(t, cursor, changes.Version)
+}
+
+func TestSyncConflictsAndTombstones(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	syncStore := NewPostgresSyncStore(db)
+	user := createTestUser(t, db, "sync_tombstones")
+	keptID := "5f0e2a7b-3c4d-4e8f-a1b2-c3d4e5f60701"
+	deletedID := "5f0e2a7b-3c4d-4e8f-a1b2-c3d4e5f60702"
+
+	kept, _, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, keptID, "Kept"), 0)
+	require.NoError(t, err)
+	deleted, _, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, deletedID, "Deleted"), 0)
+	require.NoError(t, err)
+	cursor := deleted.Version
+
+	_, _, err = syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, keptID, "Stale"), kept.Version-1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = syncStore.DeleteWorkoutByClientID(user.ID, deletedID, deleted.Version-1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	updated, created, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, keptID, "Renamed"), kept.Version)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, kept.ID, updated.ID)
+	assert.Greater(t, updated.Version, kept.Version)
+
+	id, err := syncStore.DeleteWorkoutByClientID(user.ID, deletedID, deleted.Version)
+	require.NoError(t, err)
+	assert.Equal(t, deleted.ID, id)
+	_, err = syncStore.DeleteWorkoutByClientID(user.ID, deletedID, deleted.Version)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	changes, err := syncStore.GetChangesSince(user.ID, cursor, 10)
+	require.NoError(t, err)
+	require.Len(t, changes.Workouts, 1)
+	assert.Equal(t, "Renamed", changes.Workouts[0].Title)
+	require.Len(t, changes.Tombstones, 1)
+	tombstone := changes.Tombstones[0]
+	assert.Equal(t, "workout", tombstone.EntityType)
+	assert.Equal(t, deleted.ID, tombstone.EntityID)
+	require.NotNil(t, tombstone.ClientID)
+	assert.Equal(t, deletedID, *tombstone.ClientID)
+	assert.Greater(t, tombstone.Version, updated.Version)
+	assert.Equal(t, tombstone.Version, changes.Version)
+
+	workout, err := syncStore.GetWorkoutByClientID(user.ID, deletedID)
+	require.NoError(t, err)
+	assert.Nil(t, workout)
+}
+
+func TestSyncStaleUpsertOfDeletedWorkout(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	syncStore := NewPostgresSyncStore(db)
+	user := createTestUser(t, db, "sync_resurrect")
+	clientID := "2b7c9e14-6a3f-4d21-8e5b-7f1a0c9d3e01"
+
+	workout, _, err := syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, clientID, "Deleted elsewhere"), 0)
+	require.NoError(t, err)
+	_, err = syncStore.DeleteWorkoutByClientID(user.ID, clientID, workout.Version)
+	require.NoError(t, err)
+
+	_, _, err = syncStore.UpsertWorkoutByClientID(newSyncWorkout(user.ID, clientID, "Edited offline"), workout.Version)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	var deleted *DeletedConflictError
+	require.ErrorAs(t, err, &deleted)
+	assert.Equal(t, workout.ID, deleted.Tombstone.EntityID)
+	assert.Greater(t, deleted.Tombstone.Version, workout.Version)
+
+	stored, err := syncStore.GetWorkoutByClientID(user.ID, clientID)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	maxTagLength      = 50
+	maxTagsPerWorkout = 20
+)
+
+var ErrDuplicateTag = errors.New("tag already exists")
+
+// Tag labels workouts, such as "deload" or "travel". WorkoutCount is the
+// number of workouts carrying it.
+type Tag struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"-"`
+	Name         string    `json:"name"`
+	WorkoutCount int       `json:"workout_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NormalizeTagName trims name, collapses inner whitespace and lowercases it
+// so "Deload " and "deload" are the same tag.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		return "", errors.New("tag names must be between 1 and 50 characters")
+	}
+	return name, nil
+}
+
+// NormalizeTags normalizes every tag name and drops duplicates, keeping the
+// first occurrence.
+func NormalizeTags(names []string) ([]string, error) {
+	tags := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		tag, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerWorkout {
+		return nil, errors.New("a workout can have at most 20 tags")
+	}
+	return tags, nil
+}
+
+// taggedWorkoutIDs returns a subquery selecting the workouts that carry
+// every tag named in the text array bound to param.
+func taggedWorkoutIDs(param string) string {
+	return `
+	SELECT wt.workout_id
+	FROM workout_tags wt
+	JOIN tags t ON t.id = wt.tag_id
+	WHERE t.name = ANY(` + param + `::text[])
+	GROUP BY wt.workout_id
+	HAVING count(*) = cardinality(` + param + `::text[])
+	`
+}
+
+// tagNames never returns nil, so the names always bind as an array.
+func tagNames(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+type PostgresTagStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{db: db}
+}
+
+type TagStore interface {
+	ListTags(userID int) ([]*Tag, error)
+	GetTag(id int) (*Tag, error)
+	RenameTag(tag *Tag) error
+	DeleteTag(id int) error
+}
+
+func (s *PostgresTagStore) ListTags(userID int) ([]*Tag, error) {
+	query := `
+	SELECT t.id, t.user_id, t.name, count(wt.workout_id), t.created_at
+	FROM tags t
+	LEFT JOIN workout_tags wt ON wt.tag_id = t.id
+	WHERE t.user_id = $1
+	GROUP BY t.id
+	ORDER BY t.name
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		tag := &Tag{}
+		err = rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.WorkoutCount, &tag.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *PostgresTagStore) GetTag(id int) (*Tag, error) {
+	query := `
+	SELECT t.id, t.user_id, t.name, (SELECT count(*) FROM workout_tags wt WHERE wt.tag_id = t.id), t.created_at
+	FROM tags t
+	WHERE t.id = $1
+	`
+
+	tag := &Tag{}
+	err := s.db.QueryRow(query, id).Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.WorkoutCount, &tag.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// RenameTag renames the tag on every workout carrying it. It returns
+// ErrDuplicateTag if the user already has a tag with the new name.
+func (s *PostgresTagStore) RenameTag(tag *Tag) error {
+	query := `
+	UPDATE tags
+	SET name = $1
+	WHERE id = $2
+	`
+	result, err := s.db.Exec(query, tag.Name, tag.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "tags_user_id_name_key" {
+			return ErrDuplicateTag
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteTag deletes the tag and removes it from every workout.
+func (s *PostgresTagStore) DeleteTag(id int) error {
+	query := `
+	DELETE FROM tags
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// saveWorkoutTags replaces the tags of the workout with workout.Tags,
+// creating the user's tags that do not exist yet. Nil Tags keep the ones
+// the workout has.
+func saveWorkoutTags(tx *sql.Tx, workout *Workout) error {
+	if workout.Tags == nil {
+		return loadWorkoutTags(tx, workout)
+	}
+
+	query := `
+	DELETE FROM workout_tags
+	WHERE workout_id = $1
+	`
+	_, err := tx.Exec(query, workout.ID)
+	if err != nil {
+		return err
+	}
+	if len(workout.Tags) == 0 {
+		workout.Tags = []string{}
+		return nil
+	}
+
+	query = `
+	INSERT INTO tags (user_id, name)
+	SELECT $1, name FROM unnest($2::text[]) AS name
+	ON CONFLICT (user_id, name) DO NOTHING
+	`
+	_, err = tx.Exec(query, workout.UserID, workout.Tags)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO workout_tags (workout_id, tag_id)
+	SELECT $1, id FROM tags
+	WHERE user_id = $2 AND name = ANY($3)
+	`
+	_, err = tx.Exec(query, workout.ID, workout.UserID, workout.Tags)
+	if err != nil {
+		return err
+	}
+
+	return loadWorkoutTags(tx, workout)
+}
+
+// loadWorkoutTags fills in the tag names of workouts, alphabetically.
+func loadWorkoutTags(q queryer, workouts ...*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Workout{}
+	ids := make([]int, 0, len(workouts))
+	for _, workout := range workouts {
+		workout.Tags = []string{}
+		byID[workout.ID] = workout
+		ids = append(ids, workout.ID)
+	}
+
+	query := `
+	SELECT wt.workout_id, t.name
+	FROM workout_tags wt
+	JOIN tags t ON t.id = wt.tag_id
+	WHERE wt.workout_id = ANY($1)
+	ORDER BY wt.workout_id, t.name
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var name string
+		err = rows.Scan(&workoutID, &name)
+		if err != nil {
+			return err
+		}
+		byID[workoutID].Tags = append(byID[workoutID].Tags, name)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Deload ", "deload", "Leg  Day", "travel"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deload", "leg day", "travel"}, tags)
+
+	_, err = NormalizeTags([]string{"   "})
+	assert.Error(t, err)
+
+	_, err = NormalizeTags([]string{strings.Repeat("a", maxTagLength+1)})
+	assert.Error(t, err)
+
+	tooMany := make([]string, maxTagsPerWorkout+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("t", i+1)
+	}
+	_, err = NormalizeTags(tooMany)
+	assert.Error(t, err)
+}
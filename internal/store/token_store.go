@@ -15,10 +15,20 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	return &PostgresTokenStore{db: db}
 }
 
+// TokenCounts counts tokens that still work by scope, and expired ones
+// waiting to be cleaned up.
+type TokenCounts struct {
+	Active  map[string]int `json:"active"`
+	Expired int            `json:"expired"`
+}
+
 type TokenStore interface {
 	InsertToken(token *tokens.Token) error
 	CreateToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	CreateCappedToken(userID int, ttl time.Duration, scope string, max int) (*tokens.Token, int64, error)
 	DeleteToken(userID int, scope string) error
+	DeleteExpiredTokens(limit int) (int64, error)
+	CountTokens() (*TokenCounts, error)
 }
 
 func (s *PostgresTokenStore) InsertToken(token *tokens.Token) error {
@@ -60,3 +70,114 @@ func (s *PostgresTokenStore) DeleteToken(userID int, scope string) error {
 	}
 	return nil
 }
+
+// CreateCappedToken creates a token like CreateToken and deletes the user's
+// tokens of the scope beyond the max newest ones, returning how many were
+// deleted. Tokens of a scope share their TTL, so the oldest expire first.
+func (s *PostgresTokenStore) CreateCappedToken(userID int, ttl time.Duration, scope string, max int) (*tokens.Token, int64, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	// Concurrent logins of the user would otherwise each keep max tokens
+	// without seeing the others.
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('tokens'), $1)`, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope)
+	VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = `
+	DELETE FROM tokens
+	WHERE hash IN (
+		SELECT hash
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2
+		ORDER BY expiry DESC
+		OFFSET $3
+	)
+	`
+	result, err := tx.Exec(query, userID, scope, max)
+	if err != nil {
+		return nil, 0, err
+	}
+	evicted, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return token, evicted, nil
+}
+
+// DeleteExpiredTokens deletes up to limit expired tokens and returns how
+// many were deleted.
+func (s *PostgresTokenStore) DeleteExpiredTokens(limit int) (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE hash IN (
+		SELECT hash
+		FROM tokens
+		WHERE expiry <= CURRENT_TIMESTAMP
+		LIMIT $1
+	)
+	`
+
+	result, err := s.db.Exec(query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *PostgresTokenStore) CountTokens() (*TokenCounts, error) {
+	query := `
+	SELECT scope, expiry > CURRENT_TIMESTAMP, COUNT(*)
+	FROM tokens
+	GROUP BY 1, 2
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := &TokenCounts{Active: map[string]int{}}
+	for rows.Next() {
+		var scope string
+		var active bool
+		var count int
+		err = rows.Scan(&scope, &active, &count)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			counts.Active[scope] = count
+		} else {
+			counts.Expired += count
+		}
+	}
+
+	return counts, rows.Err()
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -42,8 +43,40 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"bio"`
+	Units        string    `json:"units"`
+	BodyWeight   *float64  `json:"body_weight"`
+	Timezone     string    `json:"timezone"`
+	IsAdmin      bool      `json:"is_admin"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	bodyWeightKilograms *float64
+}
+
+// BodyWeightKilograms returns the user's body weight in kilograms, or nil
+// when it is not known.
+func (u *User) BodyWeightKilograms() *float64 {
+	return u.bodyWeightKilograms
+}
+
+// SetBodyWeight stores kilograms as the user's body weight and shows it as
+// BodyWeight in the units the user prefers.
+func (u *User) SetBodyWeight(kilograms *float64) {
+	u.bodyWeightKilograms = kilograms
+	u.BodyWeight = nil
+	if kilograms != nil {
+		weight := units.Round(units.FromKilograms(*kilograms, units.WeightUnit(u.Units)), units.WeightPlaces)
+		u.BodyWeight = &weight
+	}
+}
+
+// Location returns the user's time zone, or UTC when it cannot be loaded.
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 var AnonymousUser = &User{}
@@ -63,22 +96,47 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 type UserStore interface {
 	CreateUser(user *User) error
 	GetUserByUsername(username string) (*User, error)
+	GetUserByID(id int) (*User, error)
 	UpdateUser(user *User) error
+	UpdateUserPreferences(user *User) error
 	GetUserToken(scope string, tokenPlaintext string) (*User, error)
 }
 
 func (s *PostgresUserStore) CreateUser(user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-	INSERT INTO users (username, email, password_hash, bio)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id
+	INSERT INTO users (username, email, password_hash, bio, units, timezone)
+	VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'metric'), COALESCE(NULLIF($6, ''), 'UTC'))
+	RETURNING id, units, timezone, created_at, updated_at
 	`
 
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID)
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.Units, user.Timezone).Scan(&user.ID, &user.Units, &user.Timezone, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
+	err = appendEvent(tx, AggregateUser, user.ID, user.ID, EventUserRegistered, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const userColumns = `id, username, email, password_hash, bio, units, body_weight, timezone, is_admin, created_at, updated_at`
+
+func scanUser(row rowScanner, user *User) error {
+	var bodyWeight *float64
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.Units, &bodyWeight, &user.Timezone, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	user.SetBodyWeight(bodyWeight)
 	return nil
 }
 
@@ -88,12 +146,34 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	}
 
 	query := `
-	SELECT id, username, email, password_hash, bio, created_at, updated_at
+	SELECT ` + userColumns + `
 	FROM users
 	WHERE username = $1
 	`
 
-	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(s.db.QueryRow(query, username), user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	query := `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE id = $1
+	`
+
+	err := scanUser(s.db.QueryRow(query, id), user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -124,11 +204,27 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 	return nil
 }
 
+func (s *PostgresUserStore) UpdateUserPreferences(user *User) error {
+	query := `
+	UPDATE users
+	SET units = $1, body_weight = $2, timezone = $3, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $4
+	RETURNING updated_at
+	`
+
+	err := s.db.QueryRow(query, user.Units, user.bodyWeightKilograms, user.Timezone, user.ID).Scan(&user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *PostgresUserStore) GetUserToken(scope string, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.units, u.body_weight, u.timezone, u.is_admin, u.created_at, u.updated_at
 	FROM users u
 	INNER JOIN tokens t ON u.id = t.user_id
 	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
@@ -138,7 +234,7 @@ func (s *PostgresUserStore) GetUserToken(scope string, tokenPlaintext string) (*
 		PasswordHash: password{},
 	}
 
-	err := s.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(s.db.QueryRow(query, tokenHash[:], scope, time.Now()), user)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
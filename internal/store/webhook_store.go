@@ -0,0 +1,344 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses. A pending delivery is waiting for its next
+// attempt; a failed one ran out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription sends the user's events of the given types to URL,
+// signed with Secret.
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"-"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	Error          *string         `json:"error"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// ClaimedDelivery is a delivery taken off the queue with where it goes.
+type ClaimedDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// WebhookAttempt is the outcome of sending a delivery. RetryAt is when to
+// try again after a failure; nil gives up.
+type WebhookAttempt struct {
+	Succeeded      bool
+	ResponseStatus *int
+	Error          *string
+	RetryAt        *time.Time
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateSubscription(subscription *WebhookSubscription) error
+	GetSubscription(id int) (*WebhookSubscription, error)
+	ListSubscriptions(userID int) ([]*WebhookSubscription, error)
+	UpdateSubscription(subscription *WebhookSubscription) error
+	DeleteSubscription(id int) error
+	EnqueueDeliveries(userID int, eventID string, eventType string, payload []byte) (int64, error)
+	ClaimDueDeliveries(limit int, lease time.Duration) ([]*ClaimedDelivery, error)
+	RecordDeliveryAttempt(id int, attempt WebhookAttempt) error
+	GetDelivery(id int) (*WebhookDelivery, error)
+	ListDeliveries(subscriptionID int, limit int, offset int) ([]*WebhookDelivery, error)
+	Redeliver(delivery *WebhookDelivery) (*WebhookDelivery, error)
+}
+
+const webhookSubscriptionColumns = `id, user_id, url, secret, array_to_json(events), description, active, created_at, updated_at`
+
+func scanWebhookSubscription(row rowScanner, subscription *WebhookSubscription) error {
+	var events []byte
+	err := row.Scan(&subscription.ID, &subscription.UserID, &subscription.URL, &subscription.Secret, &events, &subscription.Description, &subscription.Active, &subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(events, &subscription.Events)
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, error, created_at`
+
+func scanWebhookDelivery(row rowScanner, delivery *WebhookDelivery) error {
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.ResponseStatus, &delivery.Error, &delivery.CreatedAt)
+	delivery.Payload = payload
+	return err
+}
+
+func (s *PostgresWebhookStore) CreateSubscription(subscription *WebhookSubscription) error {
+	query := `
+	INSERT INTO webhook_subscriptions (user_id, url, secret, events, description, active)
+	VALUES ($1, $2, $3, $4::text[], $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+
+	return s.db.QueryRow(query, subscription.UserID, subscription.URL, subscription.Secret, subscription.Events, subscription.Description, subscription.Active).Scan(&subscription.ID, &subscription.CreatedAt, &subscription.UpdatedAt)
+}
+
+func (s *PostgresWebhookStore) GetSubscription(id int) (*WebhookSubscription, error) {
+	subscription := &WebhookSubscription{}
+
+	query := `
+	SELECT ` + webhookSubscriptionColumns + `
+	FROM webhook_subscriptions
+	WHERE id = $1
+	`
+
+	err := scanWebhookSubscription(s.db.QueryRow(query, id), subscription)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *PostgresWebhookStore) ListSubscriptions(userID int) ([]*WebhookSubscription, error) {
+	query := `
+	SELECT ` + webhookSubscriptionColumns + `
+	FROM webhook_subscriptions
+	WHERE user_id = $1
+	ORDER BY id
+	`
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*WebhookSubscription{}
+	for rows.Next() {
+		subscription := &WebhookSubscription{}
+		err = scanWebhookSubscription(rows, subscription)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (s *PostgresWebhookStore) UpdateSubscription(subscription *WebhookSubscription) error {
+	query := `
+	UPDATE webhook_subscriptions
+	SET url = $1, secret = $2, events = $3::text[], description = $4, active = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $6
+	RETURNING updated_at
+	`
+
+	return s.db.QueryRow(query, subscription.URL, subscription.Secret, subscription.Events, subscription.Description, subscription.Active, subscription.ID).Scan(&subscription.UpdatedAt)
+}
+
+func (s *PostgresWebhookStore) DeleteSubscription(id int) error {
+	query := `
+	DELETE FROM webhook_subscriptions
+	WHERE id = $1
+	`
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EnqueueDeliveries queues the event for every active subscription of the
+// user to its type that does not have it queued yet, and returns how many
+// deliveries were queued.
+func (s *PostgresWebhookStore) EnqueueDeliveries(userID int, eventID string, eventType string, payload []byte) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+	SELECT ws.id, $2, $3, $4
+	FROM webhook_subscriptions ws
+	WHERE ws.user_id = $1 AND ws.active AND $3 = ANY(ws.events)
+		AND NOT EXISTS (
+			SELECT 1
+			FROM webhook_deliveries wd
+			WHERE wd.subscription_id = ws.id AND wd.event_id = $2
+		)
+	`
+
+	result, err := s.db.Exec(query, userID, eventID, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ClaimDueDeliveries takes up to limit due deliveries of active
+// subscriptions off the queue for lease. Concurrent callers never claim the
+// same delivery, and a delivery whose attempt is not recorded within the
+// lease becomes due again.
+func (s *PostgresWebhookStore) ClaimDueDeliveries(limit int, lease time.Duration) ([]*ClaimedDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+	FROM webhook_subscriptions s
+	WHERE s.id = d.subscription_id AND d.id IN (
+		SELECT wd.id
+		FROM webhook_deliveries wd
+		JOIN webhook_subscriptions ws ON ws.id = wd.subscription_id
+		WHERE wd.status = 'pending' AND wd.next_attempt_at <= CURRENT_TIMESTAMP AND ws.active
+		ORDER BY wd.next_attempt_at, wd.id
+		LIMIT $1
+		FOR UPDATE OF wd SKIP LOCKED
+	)
+	RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+		d.last_attempt_at, d.response_status, d.error, d.created_at, s.url, s.secret
+	`
+
+	rows, err := s.db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*ClaimedDelivery{}
+	for rows.Next() {
+		delivery := &ClaimedDelivery{}
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastAttemptAt, &delivery.ResponseStatus, &delivery.Error, &delivery.CreatedAt, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresWebhookStore) RecordDeliveryAttempt(id int, attempt WebhookAttempt) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET attempts = attempts + 1,
+		last_attempt_at = CURRENT_TIMESTAMP,
+		response_status = $2,
+		error = $3,
+		status = CASE WHEN $4 THEN 'succeeded' WHEN $5::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		next_attempt_at = COALESCE($5, next_attempt_at)
+	WHERE id = $1
+	`
+
+	_, err := s.db.Exec(query, id, attempt.ResponseStatus, attempt.Error, attempt.Succeeded, attempt.RetryAt)
+	return err
+}
+
+func (s *PostgresWebhookStore) GetDelivery(id int) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE id = $1
+	`
+
+	err := scanWebhookDelivery(s.db.QueryRow(query, id), delivery)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// ListDeliveries returns the subscription's deliveries, newest first.
+func (s *PostgresWebhookStore) ListDeliveries(subscriptionID int, limit int, offset int) ([]*WebhookDelivery, error) {
+	query := `
+	SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries
+	WHERE subscription_id = $1
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2 OFFSET $3
+	`
+
+	rows, err := s.db.Query(query, subscriptionID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		err = scanWebhookDelivery(rows, delivery)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Redeliver queues the delivery's event again as a new delivery with the
+// same event ID, so receivers can tell it is a repeat.
+func (s *PostgresWebhookStore) Redeliver(delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	redelivery := &WebhookDelivery{}
+
+	query := `
+	INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+	SELECT subscription_id, event_id, event_type, payload
+	FROM webhook_deliveries
+	WHERE id = $1
+	RETURNING ` + webhookDeliveryColumns
+
+	err := scanWebhookDelivery(s.db.QueryRow(query, delivery.ID), redelivery)
+	if err != nil {
+		return nil, err
+	}
+
+	return redelivery, nil
+}
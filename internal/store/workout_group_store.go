@@ -0,0 +1,396 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Group types. Superset and circuit entries are done back to back for the
+// given rounds; EMOM starts a round every work_seconds; AMRAP repeats the
+// entries until time_cap_seconds is up and records the completed rounds;
+// Tabata alternates work_seconds of effort with rest_between_exercises_seconds
+// of rest.
+const (
+	GroupTypeSuperset = "superset"
+	GroupTypeCircuit  = "circuit"
+	GroupTypeEMOM     = "emom"
+	GroupTypeAMRAP    = "amrap"
+	GroupTypeTabata   = "tabata"
+)
+
+const (
+	defaultEMOMWorkSeconds   = 60
+	defaultTabataRounds      = 8
+	defaultTabataWorkSeconds = 20
+	defaultTabataRestSeconds = 10
+)
+
+// WorkoutEntryGroup holds entries performed together. Groups share the
+// order_index sequence of the workout's ungrouped entries so both can be
+// interleaved; entries inside a group are ordered among themselves.
+type WorkoutEntryGroup struct {
+	ID                          int            `json:"id"`
+	Type                        string         `json:"type"`
+	Rounds                      int            `json:"rounds"`
+	WorkSeconds                 *int           `json:"work_seconds"`
+	TimeCapSeconds              *int           `json:"time_cap_seconds"`
+	RestBetweenExercisesSeconds int            `json:"rest_between_exercises_seconds"`
+	RestBetweenRoundsSeconds    int            `json:"rest_between_rounds_seconds"`
+	Notes                       string         `json:"notes"`
+	OrderIndex                  int            `json:"order_index"`
+	Entries                     []WorkoutEntry `json:"entries"`
+}
+
+// Normalize fills in the defaults of the group type and normalizes the
+// group's entries.
+func (g *WorkoutEntryGroup) Normalize() {
+	switch g.Type {
+	case GroupTypeEMOM:
+		if g.WorkSeconds == nil {
+			seconds := defaultEMOMWorkSeconds
+			g.WorkSeconds = &seconds
+		}
+	case GroupTypeTabata:
+		if g.Rounds == 0 {
+			g.Rounds = defaultTabataRounds
+		}
+		if g.WorkSeconds == nil {
+			seconds := defaultTabataWorkSeconds
+			g.WorkSeconds = &seconds
+		}
+		if g.RestBetweenExercisesSeconds == 0 {
+			g.RestBetweenExercisesSeconds = defaultTabataRestSeconds
+		}
+	}
+	if g.Rounds == 0 {
+		g.Rounds = 1
+	}
+
+	for i := range g.Entries {
+		g.Entries[i].Normalize()
+	}
+}
+
+// Validate mirrors the valid_workout_entry_group constraint and validates
+// the group's entries.
+func (g *WorkoutEntryGroup) Validate() error {
+	switch g.Type {
+	case GroupTypeSuperset, GroupTypeCircuit, GroupTypeEMOM, GroupTypeAMRAP, GroupTypeTabata:
+	default:
+		return fmt.Errorf("type must be one of %s, %s, %s, %s or %s", GroupTypeSuperset, GroupTypeCircuit, GroupTypeEMOM, GroupTypeAMRAP, GroupTypeTabata)
+	}
+
+	if g.Rounds < 1 {
+		return errors.New("rounds must be at least 1")
+	}
+	if g.RestBetweenExercisesSeconds < 0 || g.RestBetweenRoundsSeconds < 0 {
+		return errors.New("rest must not be negative")
+	}
+	if g.WorkSeconds != nil && *g.WorkSeconds <= 0 {
+		return errors.New("work_seconds must be positive")
+	}
+	if g.TimeCapSeconds != nil && *g.TimeCapSeconds <= 0 {
+		return errors.New("time_cap_seconds must be positive")
+	}
+	if g.Type == GroupTypeAMRAP && g.TimeCapSeconds == nil {
+		return errors.New("amrap groups need time_cap_seconds")
+	}
+
+	if len(g.Entries) == 0 {
+		return errors.New("groups need at least one entry")
+	}
+	if g.Type == GroupTypeSuperset && len(g.Entries) < 2 {
+		return errors.New("supersets need at least two entries")
+	}
+	for i := range g.Entries {
+		err := g.Entries[i].Validate()
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// EachEntry calls fn for every entry of the workout, ungrouped ones first,
+// with the group the entry belongs to or nil.
+func (w *Workout) EachEntry(fn func(group *WorkoutEntryGroup, entry *WorkoutEntry)) {
+	for i := range w.Entries {
+		fn(nil, &w.Entries[i])
+	}
+	for i := range w.Groups {
+		group := &w.Groups[i]
+		for j := range group.Entries {
+			fn(group, &group.Entries[j])
+		}
+	}
+}
+
+// insertWorkoutContent inserts the workout's ungrouped entries, its groups
+// and their entries, and saves its tags and custom field values.
+func insertWorkoutContent(tx *sql.Tx, workout *Workout) error {
+	err := insertWorkoutEntries(tx, workout.ID, nil, workout.Entries)
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Groups {
+		group := &workout.Groups[i]
+		err = insertWorkoutGroup(tx, workout.ID, group)
+		if err != nil {
+			return err
+		}
+
+		err = insertWorkoutEntries(tx, workout.ID, &group.ID, group.Entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = saveWorkoutTags(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	return saveWorkoutFieldValues(tx, workout)
+}
+
+func insertWorkoutGroup(tx *sql.Tx, workoutID int, group *WorkoutEntryGroup) error {
+	group.Normalize()
+
+	query := `
+	INSERT INTO workout_entry_groups (workout_id, group_type, rounds, work_seconds, time_cap_seconds, rest_between_exercises_seconds, rest_between_rounds_seconds, notes, order_index)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+	`
+	return tx.QueryRow(query, workoutID, group.Type, group.Rounds, group.WorkSeconds, group.TimeCapSeconds, group.RestBetweenExercisesSeconds, group.RestBetweenRoundsSeconds, group.Notes, group.OrderIndex).Scan(&group.ID)
+}
+
+// replaceWorkoutContent saves the workout's entries, groups, tags and custom
+// field values over those of previous, its stored content. Entries and
+// groups sent back with the IDs they have in previous are updated in place,
+// so a live session keeps the sets ticked off against them; the others are
+// inserted, and those left out are deleted.
+func replaceWorkoutContent(tx *sql.Tx, workout *Workout, previous *Workout) error {
+	previousEntries := map[int]bool{}
+	previous.EachEntry(func(_ *WorkoutEntryGroup, entry *WorkoutEntry) {
+		previousEntries[entry.ID] = true
+	})
+	previousGroups := map[int]bool{}
+	for _, group := range previous.Groups {
+		previousGroups[group.ID] = true
+	}
+
+	// An ID that belongs to another workout, or is sent twice, gets a new
+	// row like an entry sent without one.
+	keptEntries := []int{}
+	workout.EachEntry(func(_ *WorkoutEntryGroup, entry *WorkoutEntry) {
+		if !previousEntries[entry.ID] {
+			entry.ID = 0
+			return
+		}
+		delete(previousEntries, entry.ID)
+		keptEntries = append(keptEntries, entry.ID)
+	})
+	keptGroups := []int{}
+	for i := range workout.Groups {
+		group := &workout.Groups[i]
+		if !previousGroups[group.ID] {
+			group.ID = 0
+			continue
+		}
+		delete(previousGroups, group.ID)
+		keptGroups = append(keptGroups, group.ID)
+	}
+
+	query := `
+	DELETE FROM workout_entries
+	WHERE workout_id = $1 AND NOT (id = ANY($2))
+	`
+	_, err := tx.Exec(query, workout.ID, keptEntries)
+	if err != nil {
+		return err
+	}
+
+	err = saveWorkoutEntries(tx, workout.ID, nil, workout.Entries)
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Groups {
+		group := &workout.Groups[i]
+		if group.ID == 0 {
+			err = insertWorkoutGroup(tx, workout.ID, group)
+		} else {
+			err = updateWorkoutGroup(tx, group)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = saveWorkoutEntries(tx, workout.ID, &group.ID, group.Entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Groups go last: deleting one deletes the entries still in it.
+	query = `
+	DELETE FROM workout_entry_groups
+	WHERE workout_id = $1 AND NOT (id = ANY($2))
+	`
+	_, err = tx.Exec(query, workout.ID, keptGroups)
+	if err != nil {
+		return err
+	}
+
+	err = saveWorkoutTags(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	return saveWorkoutFieldValues(tx, workout)
+}
+
+func updateWorkoutGroup(tx *sql.Tx, group *WorkoutEntryGroup) error {
+	group.Normalize()
+
+	query := `
+	UPDATE workout_entry_groups
+	SET group_type = $2, rounds = $3, work_seconds = $4, time_cap_seconds = $5, rest_between_exercises_seconds = $6, rest_between_rounds_seconds = $7, notes = $8, order_index = $9
+	WHERE id = $1
+	`
+	_, err := tx.Exec(query, group.ID, group.Type, group.Rounds, group.WorkSeconds, group.TimeCapSeconds, group.RestBetweenExercisesSeconds, group.RestBetweenRoundsSeconds, group.Notes, group.OrderIndex)
+	return err
+}
+
+// saveWorkoutEntries updates the entries that have an ID and inserts the
+// others, all into the given group or none.
+func saveWorkoutEntries(tx *sql.Tx, workoutID int, groupID *int, entries []WorkoutEntry) error {
+	query := `
+	UPDATE workout_entries
+	SET group_id = $2, kind = $3, exercise_name = $4, sets = $5, reps = $6, duration_seconds = $7, weight = $8, weight_unit = $9, distance = $10, distance_unit = $11,
+		pace_seconds_per_km = $12, incline_percent = $13, resistance_level = $14, avg_heart_rate = $15, max_heart_rate = $16, rpe = $17, notes = $18, order_index = $19
+	WHERE id = $1
+	`
+
+	fresh := []WorkoutEntry{}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.ID == 0 {
+			fresh = append(fresh, *entry)
+			continue
+		}
+
+		entry.Normalize()
+		_, err := tx.Exec(query, entry.ID, groupID, entry.Kind, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.canonicalWeight(), entry.WeightUnit,
+			entry.Distance, entry.DistanceUnit, entry.PaceSecondsPerKm, entry.InclinePercent, entry.ResistanceLevel, entry.AvgHeartRate, entry.MaxHeartRate,
+			entry.RPE, entry.Notes, entry.OrderIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := insertWorkoutEntries(tx, workoutID, groupID, fresh)
+	if err != nil {
+		return err
+	}
+
+	// insertWorkoutEntries normalized its copies of the new entries.
+	j := 0
+	for i := range entries {
+		if entries[i].ID == 0 {
+			entries[i] = fresh[j]
+			j++
+		}
+	}
+	return nil
+}
+
+// loadWorkoutContent fills in the entries, groups, tags and custom field
+// values of workouts.
+func loadWorkoutContent(q queryer, workouts ...*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := map[int]*Workout{}
+	ids := make([]int, 0, len(workouts))
+	for _, workout := range workouts {
+		workout.Entries = []WorkoutEntry{}
+		workout.Groups = []WorkoutEntryGroup{}
+		byID[workout.ID] = workout
+		ids = append(ids, workout.ID)
+	}
+
+	query := `
+	SELECT workout_id, id, group_type, rounds, work_seconds, time_cap_seconds, rest_between_exercises_seconds, rest_between_rounds_seconds, notes, order_index
+	FROM workout_entry_groups
+	WHERE workout_id = ANY($1)
+	ORDER BY workout_id, order_index
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	groupIndex := map[int]int{}
+	for rows.Next() {
+		var workoutID int
+		group := WorkoutEntryGroup{Entries: []WorkoutEntry{}}
+		err = rows.Scan(&workoutID, &group.ID, &group.Type, &group.Rounds, &group.WorkSeconds, &group.TimeCapSeconds, &group.RestBetweenExercisesSeconds, &group.RestBetweenRoundsSeconds, &group.Notes, &group.OrderIndex)
+		if err != nil {
+			return err
+		}
+		workout := byID[workoutID]
+		groupIndex[group.ID] = len(workout.Groups)
+		workout.Groups = append(workout.Groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query = `
+	SELECT workout_id, group_id, ` + workoutEntryColumns + `
+	FROM workout_entries
+	WHERE workout_id = ANY($1)
+	ORDER BY workout_id, order_index
+	`
+
+	entryRows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer entryRows.Close()
+
+	for entryRows.Next() {
+		var workoutID int
+		var groupID *int
+		entry := WorkoutEntry{}
+		err = scanWorkoutEntry(entryRows, &entry, &workoutID, &groupID)
+		if err != nil {
+			return err
+		}
+
+		workout := byID[workoutID]
+		if groupID == nil {
+			workout.Entries = append(workout.Entries, entry)
+			continue
+		}
+		group := &workout.Groups[groupIndex[*groupID]]
+		group.Entries = append(group.Entries, entry)
+	}
+	if err = entryRows.Err(); err != nil {
+		return err
+	}
+
+	err = loadWorkoutTags(q, workouts...)
+	if err != nil {
+		return err
+	}
+
+	return loadWorkoutFieldValues(q, workouts...)
+}
@@ -2,27 +2,307 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
 )
 
+// Workout is a logged training session. EstimatedCalories is worked out from
+// MET values and the user's body weight, or nil without a body weight;
+// CaloriesEstimated reports that CaloriesBurned holds that estimate because
+// none was supplied. Private workouts never count towards challenges. RPE
+// rates the whole session from 1 to 10. Nil Tags or CustomFields leave those
+// of an existing workout as they are when it is saved.
 type Workout struct {
-	ID              int            `json:"id"`
-	UserID          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID                int                 `json:"id"`
+	UserID            int                 `json:"user_id"`
+	ClientID          *string             `json:"client_id"`
+	Title             string              `json:"title"`
+	Description       string              `json:"description"`
+	DurationMinutes   int                 `json:"duration_minutes"`
+	CaloriesBurned    int                 `json:"calories_burned"`
+	EstimatedCalories *int                `json:"estimated_calories"`
+	CaloriesEstimated bool                `json:"calories_estimated"`
+	PerformedAt       time.Time           `json:"performed_at"`
+	RPE               *float64            `json:"rpe"`
+	Visibility        string              `json:"visibility"`
+	Tags              []string            `json:"tags"`
+	CustomFields      []WorkoutFieldValue `json:"custom_fields"`
+	Entries           []WorkoutEntry      `json:"entries"`
+	Groups            []WorkoutEntryGroup `json:"groups"`
+	Activity          *WorkoutActivity    `json:"activity,omitempty"`
+	Version           int64               `json:"version"`
+	UpdatedAt         time.Time           `json:"updated_at"`
 }
 
 type WorkoutEntry struct {
-	ID              int      `json:"id"`
-	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
-	Reps            *int     `json:"reps"`
-	Weight          *float64 `json:"weight"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	ID               int      `json:"id"`
+	Kind             string   `json:"kind"`
+	ExerciseName     string   `json:"exercise_name"`
+	Sets             int      `json:"sets"`
+	Reps             *int     `json:"reps"`
+	Weight           *float64 `json:"weight"`
+	WeightUnit       *string  `json:"weight_unit"`
+	DurationSeconds  *int     `json:"duration_seconds"`
+	Distance         *float64 `json:"distance"`
+	DistanceUnit     *string  `json:"distance_unit"`
+	PaceSecondsPerKm *int     `json:"pace_seconds_per_km"`
+	InclinePercent   *float64 `json:"incline_percent"`
+	ResistanceLevel  *int     `json:"resistance_level"`
+	AvgHeartRate     *int     `json:"avg_heart_rate"`
+	MaxHeartRate     *int     `json:"max_heart_rate"`
+	RPE              *float64 `json:"rpe"`
+	Notes            string   `json:"notes"`
+	OrderIndex       int      `json:"order_index"`
+}
+
+// Entry kinds decide which measurements an entry must carry.
+const (
+	EntryKindReps     = "reps"
+	EntryKindTime     = "time"
+	EntryKindDistance = "distance"
+	EntryKindCardio   = "cardio"
+)
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+func ValidVisibility(visibility string) bool {
+	return visibility == VisibilityPublic || visibility == VisibilityPrivate
+}
+
+// DistanceMeters returns the entry's distance in meters, or 0 without one.
+func (e *WorkoutEntry) DistanceMeters() float64 {
+	if e.Distance == nil || e.DistanceUnit == nil {
+		return 0
+	}
+	return units.ToMeters(*e.Distance, *e.DistanceUnit)
+}
+
+// WeightKilograms returns the entry's weight in kilograms, or 0 without one.
+func (e *WorkoutEntry) WeightKilograms() float64 {
+	if e.Weight == nil {
+		return 0
+	}
+	unit := units.Kilograms
+	if e.WeightUnit != nil {
+		unit = *e.WeightUnit
+	}
+	return units.ToKilograms(*e.Weight, unit)
+}
+
+// canonicalWeight is the value stored in the weight column.
+func (e *WorkoutEntry) canonicalWeight() *float64 {
+	if e.Weight == nil {
+		return nil
+	}
+	kilograms := units.Round(e.WeightKilograms(), units.CanonicalWeightPlaces)
+	return &kilograms
+}
+
+// restoreEnteredWeight turns the kilograms read from the weight column back
+// into the unit the weight was entered in.
+func (e *WorkoutEntry) restoreEnteredWeight() {
+	if e.Weight == nil || e.WeightUnit == nil {
+		return
+	}
+	weight := units.Round(units.FromKilograms(*e.Weight, *e.WeightUnit), units.WeightPlaces)
+	e.Weight = &weight
+}
+
+// ConvertUnits expresses the entry's weight and distance in the units of
+// system. Values are always derived from what was entered, so converting
+// back and forth never accumulates rounding.
+func (e *WorkoutEntry) ConvertUnits(system string) {
+	if e.Weight != nil {
+		unit := units.WeightUnit(system)
+		if e.WeightUnit == nil || *e.WeightUnit != unit {
+			weight := units.Round(units.FromKilograms(e.WeightKilograms(), unit), units.WeightPlaces)
+			e.Weight, e.WeightUnit = &weight, &unit
+		}
+	}
+
+	if e.Distance != nil && e.DistanceUnit != nil && units.DistanceSystem(*e.DistanceUnit) != system {
+		unit := units.DistanceUnit(system)
+		distance := units.Round(units.FromMeters(e.DistanceMeters(), unit), units.DistancePlaces)
+		e.Distance, e.DistanceUnit = &distance, &unit
+	}
+}
+
+// keepEnteredUnits puts back the entered weight and distance of previous
+// when e carries the same values converted to other units, as happens when
+// a client sends back an entry it read in its preferred units.
+func (e *WorkoutEntry) keepEnteredUnits(previous WorkoutEntry) {
+	if e.Weight != nil && e.WeightUnit != nil && previous.Weight != nil && previous.WeightUnit != nil && *e.WeightUnit != *previous.WeightUnit {
+		shown := previous
+		shown.ConvertUnits(units.WeightSystem(*e.WeightUnit))
+		if *shown.Weight == *e.Weight {
+			e.Weight, e.WeightUnit = previous.Weight, previous.WeightUnit
+		}
+	}
+
+	if e.Distance != nil && e.DistanceUnit != nil && previous.Distance != nil && previous.DistanceUnit != nil && *e.DistanceUnit != *previous.DistanceUnit {
+		shown := previous
+		shown.ConvertUnits(units.DistanceSystem(*e.DistanceUnit))
+		if *shown.DistanceUnit == *e.DistanceUnit && *shown.Distance == *e.Distance {
+			e.Distance, e.DistanceUnit = previous.Distance, previous.DistanceUnit
+		}
+	}
+}
+
+// ConvertUnits expresses every entry of the workout in the units of system.
+func (w *Workout) ConvertUnits(system string) {
+	w.EachEntry(func(_ *WorkoutEntryGroup, entry *WorkoutEntry) {
+		entry.ConvertUnits(system)
+	})
+}
+
+// Normalize infers the kind of entries saved by older clients, defaults
+// weights without a unit to kilograms and derives the pace when distance and
+// duration are both known.
+func (e *WorkoutEntry) Normalize() {
+	if e.Weight != nil {
+		weight := units.Round(*e.Weight, units.WeightPlaces)
+		e.Weight = &weight
+		if e.WeightUnit == nil {
+			unit := units.Kilograms
+			e.WeightUnit = &unit
+		}
+	}
+
+	if e.Kind == "" {
+		switch {
+		case e.Reps != nil:
+			e.Kind = EntryKindReps
+		case e.Distance != nil:
+			e.Kind = EntryKindDistance
+		case e.DurationSeconds != nil:
+			e.Kind = EntryKindTime
+		}
+	}
+
+	if e.PaceSecondsPerKm == nil && e.DurationSeconds != nil && e.DistanceMeters() > 0 {
+		pace := int(math.Round(float64(*e.DurationSeconds) / (e.DistanceMeters() / 1000)))
+		e.PaceSecondsPerKm = &pace
+	}
+}
+
+// Validate mirrors the valid_workout_entry constraints so clients get a
+// readable error instead of a rejected insert.
+func (e *WorkoutEntry) Validate() error {
+	if e.ExerciseName == "" {
+		return errors.New("exercise_name is required")
+	}
+	if e.Sets < 1 {
+		return errors.New("sets must be at least 1")
+	}
+
+	switch e.Kind {
+	case EntryKindReps:
+		if e.Reps == nil || e.DurationSeconds != nil || e.Distance != nil {
+			return errors.New("reps entries need reps and no duration_seconds or distance")
+		}
+	case EntryKindTime:
+		if e.DurationSeconds == nil || e.Reps != nil || e.Distance != nil {
+			return errors.New("time entries need duration_seconds and no reps or distance")
+		}
+	case EntryKindDistance:
+		if e.Distance == nil || e.Reps != nil {
+			return errors.New("distance entries need distance and no reps")
+		}
+	case EntryKindCardio:
+		if e.DurationSeconds == nil || e.Reps != nil {
+			return errors.New("cardio entries need duration_seconds and no reps")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s, %s, %s or %s", EntryKindReps, EntryKindTime, EntryKindDistance, EntryKindCardio)
+	}
+
+	if e.Weight != nil && (*e.Weight < 0 || e.WeightUnit == nil || !units.ValidWeightUnit(*e.WeightUnit)) {
+		return errors.New("weight must not be negative and weight_unit must be kg or lb")
+	}
+	if e.Weight == nil && e.WeightUnit != nil {
+		return errors.New("weight_unit needs a weight")
+	}
+
+	if (e.Distance == nil) != (e.DistanceUnit == nil) {
+		return errors.New("distance and distance_unit must be given together")
+	}
+	if e.Distance != nil {
+		if !units.ValidDistanceUnit(*e.DistanceUnit) || *e.Distance <= 0 {
+			return errors.New("distance must be positive with a distance_unit of m, km or mi")
+		}
+	}
+
+	if e.RPE != nil && (*e.RPE < 1 || *e.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+
+	return nil
+}
+
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+var (
+	ErrNotOwner     = errors.New("not the owner of this workout")
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+type WorkoutBatchOp struct {
+	Op      string   `json:"op"`
+	ID      int      `json:"id"`
+	Workout *Workout `json:"workout"`
+}
+
+type WorkoutBatchResult struct {
+	ID  int
+	Err error
+}
+
+const workoutColumns = `id, user_id, client_id, title, description, duration_minutes, calories_burned, estimated_calories, calories_estimated, performed_at, rpe, visibility, sync_version, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWorkout(row rowScanner, workout *Workout) error {
+	return row.Scan(&workout.ID, &workout.UserID, &workout.ClientID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.EstimatedCalories, &workout.CaloriesEstimated, &workout.PerformedAt, &workout.RPE, &workout.Visibility, &workout.Version, &workout.UpdatedAt)
+}
+
+// WorkoutFilter selects a user's workouts. Workouts must carry every one
+// of Tags, which are normalized names.
+type WorkoutFilter struct {
+	UserID int
+	From   *time.Time
+	To     *time.Time
+	Tags   []string
+}
+
+const workoutEntryColumns = `id, kind, exercise_name, sets, reps, duration_seconds, weight, weight_unit, distance, distance_unit, pace_seconds_per_km, incline_percent, resistance_level, avg_heart_rate, max_heart_rate, rpe, notes, order_index`
+
+// scanWorkoutEntry scans workoutEntryColumns into entry, after any extra
+// leading columns selected into dest.
+func scanWorkoutEntry(row rowScanner, entry *WorkoutEntry, dest ...interface{}) error {
+	dest = append(dest, &entry.ID, &entry.Kind, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.WeightUnit,
+		&entry.Distance, &entry.DistanceUnit, &entry.PaceSecondsPerKm, &entry.InclinePercent, &entry.ResistanceLevel, &entry.AvgHeartRate, &entry.MaxHeartRate,
+		&entry.RPE, &entry.Notes, &entry.OrderIndex)
+	err := row.Scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	entry.restoreEnteredWeight()
+	return nil
 }
 
 type PostgresWorkoutStore struct {
@@ -39,6 +319,8 @@ type WorkoutStore interface {
 	UpdateWorkout(workout *Workout) error
 	DeleteWorkout(id int) error
 	GetWorkoutOwner(workoutID int) (int, error)
+	ListWorkouts(filter WorkoutFilter) ([]*Workout, error)
+	ApplyWorkoutBatch(userID int, ops []WorkoutBatchOp, atomic bool) ([]WorkoutBatchResult, error)
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -48,25 +330,14 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	}
 	defer tx.Rollback()
 
-	query := `
-	INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id
-	`
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = insertWorkout(tx, workout)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
-		_, err = tx.Exec(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex)
-		if err != nil {
-			return nil, err
-		}
+	err = appendWorkoutEvent(tx, EventWorkoutCreated, workout)
+	if err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit()
@@ -77,16 +348,87 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
+func insertWorkout(tx *sql.Tx, workout *Workout) error {
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+	}
+	if workout.Visibility == "" {
+		workout.Visibility = VisibilityPublic
+	}
+
+	err := estimateCalories(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO workouts (user_id, client_id, title, description, duration_minutes, calories_burned, estimated_calories, calories_estimated, performed_at, rpe, visibility)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING id, sync_version, updated_at
+	`
+	err = tx.QueryRow(query, workout.UserID, workout.ClientID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.EstimatedCalories, workout.CaloriesEstimated, workout.PerformedAt, workout.RPE, workout.Visibility).Scan(&workout.ID, &workout.Version, &workout.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return insertWorkoutContent(tx, workout)
+}
+
+// maxEntriesPerInsert keeps multi-row inserts well below Postgres' limit of
+// 65535 bind parameters per statement.
+const maxEntriesPerInsert = 1000
+
+func insertWorkoutEntries(tx *sql.Tx, workoutID int, groupID *int, entries []WorkoutEntry) error {
+	for start := 0; start < len(entries); start += maxEntriesPerInsert {
+		end := min(start+maxEntriesPerInsert, len(entries))
+
+		var query strings.Builder
+		query.WriteString(`
+		INSERT INTO workout_entries (workout_id, group_id, kind, exercise_name, sets, reps, duration_seconds, weight, weight_unit, distance, distance_unit, pace_seconds_per_km, incline_percent, resistance_level, avg_heart_rate, max_heart_rate, rpe, notes, order_index)
+		VALUES `)
+
+		const columns = 19
+		args := make([]interface{}, 0, (end-start)*columns)
+		for i := range entries[start:end] {
+			entry := &entries[start+i]
+			entry.Normalize()
+
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(")
+			for c := 1; c <= columns; c++ {
+				if c > 1 {
+					query.WriteString(", ")
+				}
+				fmt.Fprintf(&query, "$%d", len(args)+c)
+			}
+			query.WriteString(")")
+
+			args = append(args, workoutID, groupID, entry.Kind, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.canonicalWeight(), entry.WeightUnit,
+				entry.Distance, entry.DistanceUnit, entry.PaceSecondsPerKm, entry.InclinePercent, entry.ResistanceLevel, entry.AvgHeartRate, entry.MaxHeartRate,
+				entry.RPE, entry.Notes, entry.OrderIndex)
+		}
+
+		_, err := tx.Exec(query.String(), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (pg *PostgresWorkoutStore) GetWorkout(id int) (*Workout, error) {
 	workout := &Workout{}
 
 	query := `
-	SELECT id, user_id, title, description, duration_minutes, calories_burned
+	SELECT ` + workoutColumns + `
 	FROM workouts
 	WHERE id = $1
 	`
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err := scanWorkout(pg.db.QueryRow(query, id), workout)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -94,28 +436,68 @@ func (pg *PostgresWorkoutStore) GetWorkout(id int) (*Workout, error) {
 		return nil, err
 	}
 
-	query = `
-	SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-	FROM workout_entries
-	WHERE workout_id = $1
+	err = loadWorkoutContent(pg.db, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.Activity, err = getWorkoutActivity(pg.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// ListWorkouts returns the user's workouts performed within the optional
+// [From, To) range and carrying the filter's tags, oldest first, with their
+// entries and activity summaries.
+func (pg *PostgresWorkoutStore) ListWorkouts(filter WorkoutFilter) ([]*Workout, error) {
+	query := `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE user_id = $1
+	AND ($2::timestamptz IS NULL OR performed_at >= $2)
+	AND ($3::timestamptz IS NULL OR performed_at < $3)
+	AND (cardinality($4::text[]) = 0 OR id IN (` + taggedWorkoutIDs("$4") + `))
+	ORDER BY performed_at, id
 	`
 
-	rows, err := pg.db.Query(query, id)
+	rows, err := pg.db.Query(query, filter.UserID, filter.From, filter.To, tagNames(filter.Tags))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	workouts := []*Workout{}
 	for rows.Next() {
-		entry := WorkoutEntry{}
-		err = rows.Scan(&entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		workout := &Workout{}
+		err = scanWorkout(rows, workout)
 		if err != nil {
 			return nil, err
 		}
-		workout.Entries = append(workout.Entries, entry)
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return workout, nil
+	err = loadWorkoutContent(pg.db, workouts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadWorkoutActivities(pg.db, workouts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return workouts, nil
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
@@ -125,71 +507,94 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 	}
 	defer tx.Rollback()
 
-	query := `
-	UPDATE workouts
-	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-	WHERE id = $5
-	`
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	err = updateWorkout(tx, workout)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = appendWorkoutEvent(tx, EventWorkoutUpdated, workout)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
 
-	query = `
-	DELETE FROM workout_entries
-	WHERE workout_id = $1
-	`
-	_, err = tx.Exec(query, workout.ID)
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
-		_, err = tx.Exec(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex)
+	return nil
+}
+
+func updateWorkout(tx *sql.Tx, workout *Workout) error {
+	// A workout sent without performed_at keeps the one it has; calories are
+	// estimated from the body weight at that time, so it is read first.
+	if workout.PerformedAt.IsZero() {
+		err := tx.QueryRow(`SELECT performed_at FROM workouts WHERE id = $1`, workout.ID).Scan(&workout.PerformedAt)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = tx.Commit()
+	err := estimateCalories(tx, workout)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// A workout sent without a visibility keeps the one it has.
+	query := `
+	UPDATE workouts
+	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, estimated_calories = $5, calories_estimated = $6, performed_at = $7, rpe = $8,
+		visibility = COALESCE(NULLIF($9, ''), visibility)
+	WHERE id = $10
+	RETURNING visibility, sync_version, updated_at
+	`
+	err = tx.QueryRow(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.EstimatedCalories, workout.CaloriesEstimated, workout.PerformedAt, workout.RPE, workout.Visibility, workout.ID).Scan(&workout.Visibility, &workout.Version, &workout.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	previous := &Workout{ID: workout.ID}
+	err = loadWorkoutContent(tx, previous)
+	if err != nil {
+		return err
+	}
+	previousByID := map[int]WorkoutEntry{}
+	previous.EachEntry(func(_ *WorkoutEntryGroup, entry *WorkoutEntry) {
+		previousByID[entry.ID] = *entry
+	})
+	workout.EachEntry(func(_ *WorkoutEntryGroup, entry *WorkoutEntry) {
+		if previousEntry, ok := previousByID[entry.ID]; ok {
+			entry.keepEnteredUnits(previousEntry)
+		}
+	})
+
+	return replaceWorkoutContent(tx, workout, previous)
 }
 
 func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 	DELETE FROM workouts
 	WHERE id = $1
+	RETURNING user_id
 	`
-	result, err := pg.db.Exec(query, id)
+	var userID int
+	err = tx.QueryRow(query, id).Scan(&userID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = appendWorkoutDeleted(tx, userID, id)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int) (int, error) {
@@ -207,3 +612,107 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int) (int, error) {
 
 	return userID, nil
 }
+
+// ApplyWorkoutBatch runs ops for the user inside a single transaction. In
+// atomic mode the first failure rolls everything back and the remaining ops
+// report ErrBatchAborted; otherwise each op is isolated by a savepoint so
+// only the failing ones are undone. The returned error is reserved for
+// failures of the batch as a whole.
+func (pg *PostgresWorkoutStore) ApplyWorkoutBatch(userID int, ops []WorkoutBatchOp, atomic bool) ([]WorkoutBatchResult, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]WorkoutBatchResult, len(ops))
+	failed := false
+
+	for i, op := range ops {
+		if failed && atomic {
+			results[i].Err = ErrBatchAborted
+			continue
+		}
+
+		if !atomic {
+			_, err = tx.Exec(`SAVEPOINT batch_op`)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		results[i].ID, results[i].Err = applyWorkoutBatchOp(tx, userID, op)
+		if results[i].Err != nil {
+			failed = true
+			if !atomic {
+				_, err = tx.Exec(`ROLLBACK TO SAVEPOINT batch_op`)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if !atomic {
+			_, err = tx.Exec(`RELEASE SAVEPOINT batch_op`)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if failed && atomic {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+		return results, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func applyWorkoutBatchOp(tx *sql.Tx, userID int, op WorkoutBatchOp) (int, error) {
+	if op.Op == BatchOpCreate {
+		op.Workout.UserID = userID
+		err := insertWorkout(tx, op.Workout)
+		if err != nil {
+			return op.Workout.ID, err
+		}
+		return op.Workout.ID, appendWorkoutEvent(tx, EventWorkoutCreated, op.Workout)
+	}
+
+	var ownerID int
+	err := tx.QueryRow(`SELECT user_id FROM workouts WHERE id = $1 FOR UPDATE`, op.ID).Scan(&ownerID)
+	if err != nil {
+		return op.ID, err
+	}
+	if ownerID != userID {
+		return op.ID, ErrNotOwner
+	}
+
+	switch op.Op {
+	case BatchOpUpdate:
+		op.Workout.ID = op.ID
+		op.Workout.UserID = userID
+		err = updateWorkout(tx, op.Workout)
+		if err == nil {
+			err = appendWorkoutEvent(tx, EventWorkoutUpdated, op.Workout)
+		}
+	case BatchOpDelete:
+		_, err = tx.Exec(`DELETE FROM workouts WHERE id = $1`, op.ID)
+		if err == nil {
+			err = appendWorkoutDeleted(tx, userID, op.ID)
+		}
+	default:
+		err = fmt.Errorf("unknown batch op %q", op.Op)
+	}
+
+	return op.ID, err
+}
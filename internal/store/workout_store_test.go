@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
@@ -30,7 +31,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 
 	t.Log("Successfully ran migrations")
 
-	_, err = db.Exec(`TRUNCATE TABLE workouts, workout_entries CASCADE`)
+	_, err = db.Exec(`TRUNCATE TABLE users, workouts, workout_entries CASCADE`)
 	if err != nil {
 		t.Fatalf("Failed to truncate test database: %v", err)
 	}
@@ -44,6 +45,33 @@ func teardownTestDB(db *sql.DB) {
 	db.Close()
 }
 
+func createTestUser(t *testing.T, db *sql.DB, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com"}
+	err := user.PasswordHash.Set("password123")
+	require.NoError(t, err)
+
+	err = NewPostgresUserStore(db).CreateUser(user)
+	require.NoError(t, err)
+	return user
+}
+
+// createTestWorkout creates a workout for the user and reads it back, so
+// its entries have their IDs.
+func createTestWorkout(t *testing.T, db *sql.DB, userID int, title string, exercises ...string) *Workout {
+	workoutStore := NewPostgresWorkoutStore(db)
+	workout := &Workout{UserID: userID, Title: title, Entries: []WorkoutEntry{}}
+	for i, exercise := range exercises {
+		workout.Entries = append(workout.Entries, WorkoutEntry{ExerciseName: exercise, Sets: 3, Reps: &[]int{10}[0], OrderIndex: i + 1})
+	}
+
+	created, err := workoutStore.CreateWorkout(workout)
+	require.NoError(t, err)
+
+	saved, err := workoutStore.GetWorkout(created.ID)
+	require.NoError(t, err)
+	return saved
+}
+
 func TestCreateWorkout(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(db)
@@ -126,3 +154,100 @@ func TestCreateWorkout(t *testing.T) {
 		})
 	}
 }
+
+func workoutTitles(t *testing.T, db *sql.DB, userID int) []string {
+	rows, err := db.Query(`SELECT title FROM workouts WHERE user_id = $1 ORDER BY id`, userID)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	titles := []string{}
+	for rows.Next() {
+		var title string
+		require.NoError(t, rows.Scan(&title))
+		titles = append(titles, title)
+	}
+	require.NoError(t, rows.Err())
+	return titles
+}
+
+func newBatchOps(existing *Workout, othersID int) []WorkoutBatchOp {
+	return []WorkoutBatchOp{
+		{Op: BatchOpCreate, Workout: &Workout{Title: "Created", Entries: []WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 3, Reps: &[]int{10}[0], OrderIndex: 1},
+		}}},
+		// The workout row is inserted before its entry violates the check
+		// constraint, so undoing the op has to remove it again.
+		{Op: BatchOpCreate, Workout: &Workout{Title: "Broken", Entries: []WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 3, Reps: &[]int{10}[0], DurationSeconds: &[]int{60}[0], OrderIndex: 1},
+		}}},
+		{Op: BatchOpUpdate, ID: existing.ID, Workout: &Workout{Title: "Renamed", Entries: existing.Entries}},
+		{Op: BatchOpDelete, ID: othersID},
+	}
+}
+
+func TestApplyWorkoutBatchRollsBackFailedOps(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "batch_partial")
+	other := createTestUser(t, db, "batch_partial_other")
+	existing := createTestWorkout(t, db, user.ID, "Existing", "Squat")
+	others := createTestWorkout(t, db, other.ID, "Others", "Squat")
+
+	results, err := workoutStore.ApplyWorkoutBatch(user.ID, newBatchOps(existing, others.ID), false)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.NoError(t, results[0].Err)
+	assert.NotZero(t, results[0].ID)
+	assert.Error(t, results[1].Err)
+	assert.NotErrorIs(t, results[1].Err, ErrBatchAborted)
+	assert.NoError(t, results[2].Err)
+	assert.ErrorIs(t, results[3].Err, ErrNotOwner)
+
+	assert.Equal(t, []string{"Renamed", "Created"}, workoutTitles(t, db, user.ID))
+	assert.Equal(t, []string{"Others"}, workoutTitles(t, db, other.ID))
+
+	created, err := workoutStore.GetWorkout(results[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Len(t, created.Entries, 1)
+}
+
+func TestApplyWorkoutBatchAtomic(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "batch_atomic")
+	existing := createTestWorkout(t, db, user.ID, "Existing", "Squat")
+
+	results, err := workoutStore.ApplyWorkoutBatch(user.ID, newBatchOps(existing, existing.ID)[:3], true)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.ErrorIs(t, results[0].Err, ErrBatchAborted)
+	assert.Error(t, results[1].Err)
+	assert.NotErrorIs(t, results[1].Err, ErrBatchAborted)
+	assert.ErrorIs(t, results[2].Err, ErrBatchAborted)
+
+	assert.Equal(t, []string{"Existing"}, workoutTitles(t, db, user.ID))
+}
+
+func TestUpdateWorkoutKeepsPerformedAt(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "update_performed_at")
+	performedAt := time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)
+	created, err := workoutStore.CreateWorkout(&Workout{UserID: user.ID, Title: "Morning run", PerformedAt: performedAt, Entries: []WorkoutEntry{}})
+	require.NoError(t, err)
+
+	err = workoutStore.UpdateWorkout(&Workout{ID: created.ID, UserID: user.ID, Title: "Evening run", Entries: []WorkoutEntry{}})
+	require.NoError(t, err)
+
+	updated, err := workoutStore.GetWorkout(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Evening run", updated.Title)
+	assert.True(t, performedAt.Equal(updated.PerformedAt))
+}
@@ -9,6 +9,7 @@ import (
 
 const (
 	ScopeAuthentication = "authentication"
+	ScopeCalendarFeed   = "calendar_feed"
 )
 
 type Token struct {
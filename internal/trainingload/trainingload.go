@@ -0,0 +1,181 @@
+// Package trainingload turns workouts into a daily training load and the
+// fatigue metrics coaches watch for injury risk: acute and chronic load,
+// their ratio (ACWR), monotony and strain. Loads are in arbitrary units
+// (AU) and days are counted in the user's time zone.
+package trainingload
+
+import (
+	"math"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/stats"
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	MethodSessionRPE = "session_rpe"
+	MethodVolume     = "volume"
+	MethodNone       = "none"
+)
+
+const (
+	AcuteDays   = 7
+	ChronicDays = 28
+
+	// volumeLoadDivisor turns kilograms lifted into AU on roughly the scale
+	// of session RPE: 5000 kg lifted is a load of 500, like an hour at
+	// RPE 8.
+	volumeLoadDivisor = 10
+
+	DefaultBandLow  = 0.8
+	DefaultBandHigh = 1.3
+)
+
+const (
+	FlagHigh = "high"
+	FlagLow  = "low"
+)
+
+// SessionLoad is the load of a single workout.
+type SessionLoad struct {
+	WorkoutID   int       `json:"workout_id"`
+	PerformedAt time.Time `json:"performed_at"`
+	Method      string    `json:"method"`
+	Load        float64   `json:"load"`
+}
+
+// Band is the range of ACWR considered safe.
+type Band struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Day holds the load of a day and the metrics over the days up to it.
+// Acute and chronic load are daily averages over the last 7 and 28 days.
+// Metrics that would divide by zero are nil.
+type Day struct {
+	Date     string   `json:"date"`
+	Load     float64  `json:"load"`
+	Acute    float64  `json:"acute"`
+	Chronic  float64  `json:"chronic"`
+	ACWR     *float64 `json:"acwr"`
+	Monotony *float64 `json:"monotony"`
+	Strain   *float64 `json:"strain"`
+	Flag     *string  `json:"flag"`
+}
+
+// sessionRPE is the RPE of the workout as a whole, or the hardest RPE
+// logged on one of its entries.
+func sessionRPE(workout *store.Workout) *float64 {
+	if workout.RPE != nil {
+		return workout.RPE
+	}
+	var hardest *float64
+	workout.EachEntry(func(_ *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+		if entry.RPE != nil && (hardest == nil || *entry.RPE > *hardest) {
+			hardest = entry.RPE
+		}
+	})
+	return hardest
+}
+
+// Session computes the load of a workout: session RPE × duration in
+// minutes when both are known, or else the volume lifted.
+func Session(workout *store.Workout, bodyWeights *store.BodyWeightLog) SessionLoad {
+	load := SessionLoad{WorkoutID: workout.ID, PerformedAt: workout.PerformedAt, Method: MethodNone}
+
+	if rpe := sessionRPE(workout); rpe != nil && workout.DurationMinutes > 0 {
+		load.Method = MethodSessionRPE
+		load.Load = *rpe * float64(workout.DurationMinutes)
+		return load
+	}
+	if volume := stats.WorkoutTotals(workout, bodyWeights).Volume; volume > 0 {
+		load.Method = MethodVolume
+		load.Load = round(volume / volumeLoadDivisor)
+	}
+	return load
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func dayStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// HistoryStart is the earliest time workouts are needed from to compute
+// the metrics of the days from from on.
+func HistoryStart(from time.Time, loc *time.Location) time.Time {
+	return dayStart(from, loc).AddDate(0, 0, -(ChronicDays - 1))
+}
+
+// Series computes the metrics of every day from from to to, both
+// included, from sessions performed since HistoryStart(from). Days whose
+// ACWR leaves band are flagged.
+func Series(sessions []SessionLoad, from, to time.Time, band Band, loc *time.Location) []Day {
+	first := HistoryStart(from, loc)
+	start := dayStart(from, loc)
+	last := dayStart(to, loc)
+
+	var loads []float64
+	index := map[string]int{}
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		index[d.Format("2006-01-02")] = len(loads)
+		loads = append(loads, 0)
+	}
+	for _, session := range sessions {
+		if i, ok := index[session.PerformedAt.In(loc).Format("2006-01-02")]; ok {
+			loads[i] += session.Load
+		}
+	}
+
+	days := []Day{}
+	for d, i := start, index[start.Format("2006-01-02")]; !d.After(last); d, i = d.AddDate(0, 0, 1), i+1 {
+		day := Day{Date: d.Format("2006-01-02"), Load: round(loads[i])}
+
+		week := loads[i-AcuteDays+1 : i+1]
+		weekTotal, weekMean, weekSD := summarize(week)
+		day.Acute = round(weekMean)
+		_, chronicMean, _ := summarize(loads[i-ChronicDays+1 : i+1])
+		day.Chronic = round(chronicMean)
+
+		if chronicMean > 0 {
+			acwr := round(weekMean / chronicMean)
+			day.ACWR = &acwr
+			switch {
+			case acwr > band.High:
+				flag := FlagHigh
+				day.Flag = &flag
+			case acwr < band.Low:
+				flag := FlagLow
+				day.Flag = &flag
+			}
+		}
+		if weekSD > 0 {
+			monotony := round(weekMean / weekSD)
+			strain := round(weekTotal * weekMean / weekSD)
+			day.Monotony, day.Strain = &monotony, &strain
+		}
+
+		days = append(days, day)
+	}
+	return days
+}
+
+// summarize returns the total, mean and population standard deviation of
+// loads.
+func summarize(loads []float64) (float64, float64, float64) {
+	total := 0.0
+	for _, load := range loads {
+		total += load
+	}
+	mean := total / float64(len(loads))
+
+	variance := 0.0
+	for _, load := range loads {
+		variance += (load - mean) * (load - mean)
+	}
+	return total, mean, math.Sqrt(variance / float64(len(loads)))
+}
@@ -0,0 +1,71 @@
+package trainingload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	rpe := 7.0
+	assert.Equal(t, SessionLoad{Method: MethodSessionRPE, Load: 420}, Session(&store.Workout{RPE: &rpe, DurationMinutes: 60}, nil))
+
+	reps, weight, entryRPE := 5, 100.0, 9.0
+	lifting := &store.Workout{Entries: []store.WorkoutEntry{
+		{Kind: store.EntryKindReps, ExerciseName: "Squat", Sets: 5, Reps: &reps, Weight: &weight},
+	}}
+	assert.Equal(t, SessionLoad{Method: MethodVolume, Load: 250}, Session(lifting, nil))
+
+	// Without a session RPE the hardest entry stands in for it.
+	lifting.DurationMinutes = 45
+	lifting.Entries[0].RPE = &entryRPE
+	assert.Equal(t, SessionLoad{Method: MethodSessionRPE, Load: 405}, Session(lifting, nil))
+
+	assert.Equal(t, SessionLoad{Method: MethodNone}, Session(&store.Workout{DurationMinutes: 30}, nil))
+}
+
+func TestSeries(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Sydney")
+	require.NoError(t, err)
+
+	from := time.Date(2024, 6, 28, 0, 0, 0, 0, loc)
+	to := time.Date(2024, 7, 1, 0, 0, 0, 0, loc)
+
+	// 300 AU every other day for four weeks, then a 1200 AU spike.
+	var sessions []SessionLoad
+	for d := HistoryStart(from, loc); d.Before(from); d = d.AddDate(0, 0, 2) {
+		sessions = append(sessions, SessionLoad{PerformedAt: d.Add(18 * time.Hour), Load: 300})
+	}
+	// Late evening in Sydney is still the previous day in UTC.
+	sessions = append(sessions, SessionLoad{PerformedAt: time.Date(2024, 6, 30, 22, 30, 0, 0, loc).UTC(), Load: 1200})
+
+	days := Series(sessions, from, to, Band{Low: DefaultBandLow, High: DefaultBandHigh}, loc)
+	require.Len(t, days, 4)
+	assert.Equal(t, "2024-06-28", days[0].Date)
+	assert.Equal(t, "2024-07-01", days[3].Date)
+
+	spike := days[2]
+	assert.Equal(t, "2024-06-30", spike.Date)
+	assert.Equal(t, 1200.0, spike.Load)
+	require.NotNil(t, spike.ACWR)
+	assert.Greater(t, *spike.ACWR, DefaultBandHigh)
+	require.NotNil(t, spike.Flag)
+	assert.Equal(t, FlagHigh, *spike.Flag)
+	require.NotNil(t, spike.Monotony)
+	require.NotNil(t, spike.Strain)
+	assert.InEpsilon(t, spike.Acute*7*(*spike.Monotony), *spike.Strain, 0.01)
+
+	assert.Nil(t, days[0].Flag)
+}
+
+func TestSeriesWithoutHistory(t *testing.T) {
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	days := Series(nil, day, day, Band{Low: DefaultBandLow, High: DefaultBandHigh}, time.UTC)
+	require.Len(t, days, 1)
+	assert.Nil(t, days[0].ACWR)
+	assert.Nil(t, days[0].Monotony)
+	assert.Nil(t, days[0].Flag)
+}
@@ -0,0 +1,161 @@
+// Package units converts weights, distances and body lengths between the
+// metric and imperial systems. Weights are stored in kilograms, body lengths
+// in centimeters and distances in the unit they were entered in; everything
+// else is derived for display.
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	SystemMetric   = "metric"
+	SystemImperial = "imperial"
+)
+
+const (
+	Kilograms = "kg"
+	Pounds    = "lb"
+
+	Meters     = "m"
+	Kilometers = "km"
+	Miles      = "mi"
+
+	Centimeters = "cm"
+	Inches      = "in"
+)
+
+// kilogramsPerPound is exact by definition, as are the inch and the mile
+// below.
+const (
+	kilogramsPerPound  = 0.45359237
+	centimetersPerInch = 2.54
+)
+
+var metersPerDistanceUnit = map[string]float64{
+	Meters:     1,
+	Kilometers: 1000,
+	Miles:      1609.344,
+}
+
+// Decimal places kept for entered and displayed values, and for the
+// canonical kilograms and centimeters. Six places keep every two-place pound
+// or inch value exact after a trip through the metric unit.
+const (
+	WeightPlaces          = 2
+	DistancePlaces        = 3
+	LengthPlaces          = 2
+	CanonicalWeightPlaces = 6
+	CanonicalLengthPlaces = 6
+)
+
+func ValidSystem(system string) bool {
+	return system == SystemMetric || system == SystemImperial
+}
+
+func ValidWeightUnit(unit string) bool {
+	return unit == Kilograms || unit == Pounds
+}
+
+func ValidDistanceUnit(unit string) bool {
+	_, ok := metersPerDistanceUnit[unit]
+	return ok
+}
+
+func ValidLengthUnit(unit string) bool {
+	return unit == Centimeters || unit == Inches
+}
+
+// ParseSystem returns system, or fallback when system is empty.
+func ParseSystem(system, fallback string) (string, error) {
+	if system == "" {
+		return fallback, nil
+	}
+	if !ValidSystem(system) {
+		return "", fmt.Errorf("units must be %s or %s", SystemMetric, SystemImperial)
+	}
+	return system, nil
+}
+
+// WeightUnit is the unit weights are shown in for system.
+func WeightUnit(system string) string {
+	if system == SystemImperial {
+		return Pounds
+	}
+	return Kilograms
+}
+
+// DistanceUnit is the unit long distances are shown in for system.
+func DistanceUnit(system string) string {
+	if system == SystemImperial {
+		return Miles
+	}
+	return Kilometers
+}
+
+// LengthUnit is the unit body measurements are shown in for system.
+func LengthUnit(system string) string {
+	if system == SystemImperial {
+		return Inches
+	}
+	return Centimeters
+}
+
+// WeightSystem returns the system a weight unit belongs to.
+func WeightSystem(unit string) string {
+	if unit == Pounds {
+		return SystemImperial
+	}
+	return SystemMetric
+}
+
+// DistanceSystem returns the system a distance unit belongs to.
+func DistanceSystem(unit string) string {
+	if unit == Miles {
+		return SystemImperial
+	}
+	return SystemMetric
+}
+
+func ToKilograms(weight float64, unit string) float64 {
+	if unit == Pounds {
+		return weight * kilogramsPerPound
+	}
+	return weight
+}
+
+func FromKilograms(kilograms float64, unit string) float64 {
+	if unit == Pounds {
+		return kilograms / kilogramsPerPound
+	}
+	return kilograms
+}
+
+func ToMeters(distance float64, unit string) float64 {
+	return distance * metersPerDistanceUnit[unit]
+}
+
+func FromMeters(meters float64, unit string) float64 {
+	return meters / metersPerDistanceUnit[unit]
+}
+
+func ToCentimeters(length float64, unit string) float64 {
+	if unit == Inches {
+		return length * centimetersPerInch
+	}
+	return length
+}
+
+func FromCentimeters(centimeters float64, unit string) float64 {
+	if unit == Inches {
+		return centimeters / centimetersPerInch
+	}
+	return centimeters
+}
+
+// Round rounds v to the given number of decimal places.
+func Round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,39 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightRoundTrip(t *testing.T) {
+	for cents := 0; cents <= 200000; cents++ {
+		entered := float64(cents) / 100
+		for _, unit := range []string{Kilograms, Pounds} {
+			stored := Round(ToKilograms(entered, unit), CanonicalWeightPlaces)
+			require.Equal(t, entered, Round(FromKilograms(stored, unit), WeightPlaces), "%v %s", entered, unit)
+		}
+	}
+}
+
+func TestLengthRoundTrip(t *testing.T) {
+	for cents := 0; cents <= 50000; cents++ {
+		entered := float64(cents) / 100
+		for _, unit := range []string{Centimeters, Inches} {
+			stored := Round(ToCentimeters(entered, unit), CanonicalLengthPlaces)
+			require.Equal(t, entered, Round(FromCentimeters(stored, unit), LengthPlaces), "%v %s", entered, unit)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	assert.Equal(t, 102.06, Round(ToKilograms(225, Pounds), WeightPlaces))
+	assert.Equal(t, 3.107, Round(FromMeters(ToMeters(5, Kilometers), Miles), DistancePlaces))
+
+	system, err := ParseSystem("", SystemImperial)
+	require.NoError(t, err)
+	assert.Equal(t, SystemImperial, system)
+	_, err = ParseSystem("nautical", SystemMetric)
+	assert.Error(t, err)
+}
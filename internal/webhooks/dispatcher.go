@@ -0,0 +1,145 @@
+package webhooks
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+)
+
+const (
+	// claimBatchSize is how many deliveries one pass takes off the queue.
+	claimBatchSize = 20
+	// claimLease must outlast sending a whole batch.
+	claimLease = 5 * time.Minute
+)
+
+// Dispatcher queues domain events from the outbox and sends due deliveries.
+type Dispatcher struct {
+	webhookStore store.WebhookStore
+	client       *http.Client
+	logger       *log.Logger
+}
+
+func NewDispatcher(webhookStore store.WebhookStore, client *http.Client, logger *log.Logger) *Dispatcher {
+	return &Dispatcher{webhookStore: webhookStore, client: client, logger: logger}
+}
+
+// sourceEvents maps the domain events webhooks are sent for to the event
+// types subscriptions name.
+var sourceEvents = map[string]string{
+	store.EventWorkoutCreated:     EventWorkoutCreated,
+	store.EventWorkoutUpdated:     EventWorkoutUpdated,
+	store.EventWorkoutDeleted:     EventWorkoutDeleted,
+	store.EventRecordAchieved:     EventRecordAchieved,
+	store.EventMeasurementCreated: EventMeasurementSaved,
+	store.EventMeasurementUpdated: EventMeasurementSaved,
+}
+
+// SourceEvents returns the domain event types EventOccurred handles.
+func SourceEvents() []string {
+	types := make([]string, 0, len(sourceEvents))
+	for eventType := range sourceEvents {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// EventOccurred queues a domain event for every subscription of its user
+// to it. The event keeps the ID it has in the outbox, so an event the
+// outbox dispatches again is queued once per subscription.
+func (d *Dispatcher) EventOccurred(event *store.OutboxEvent) error {
+	eventType, ok := sourceEvents[event.Type]
+	if !ok {
+		return nil
+	}
+
+	eventID := strconv.FormatInt(event.ID, 10)
+	payload, err := encodePayload(eventID, eventType, event.OccurredAt, event.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.webhookStore.EnqueueDeliveries(event.UserID, eventID, eventType, payload)
+	return err
+}
+
+// Run sends due deliveries every interval until the process exits.
+func (d *Dispatcher) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := d.DeliverDue()
+		if err != nil {
+			d.logger.Printf("ERROR: deliverWebhooks: %s", err)
+		}
+	}
+}
+
+// DeliverDue sends due deliveries until none are left.
+func (d *Dispatcher) DeliverDue() error {
+	for {
+		deliveries, err := d.webhookStore.ClaimDueDeliveries(claimBatchSize, claimLease)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			err = d.webhookStore.RecordDeliveryAttempt(delivery.ID, d.send(delivery))
+			if err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < claimBatchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) send(delivery *store.ClaimedDelivery) store.WebhookAttempt {
+	var attempt store.WebhookAttempt
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "fem-fitness-project-webhooks")
+		req.Header.Set(HeaderEvent, delivery.EventType)
+		req.Header.Set(HeaderEventID, delivery.EventID)
+		req.Header.Set(HeaderDelivery, fmt.Sprint(delivery.ID))
+		req.Header.Set(HeaderSignature, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+		var resp *http.Response
+		resp, err = d.client.Do(req)
+		if err == nil {
+			// Only the status is kept: the body could echo back whatever
+			// the receiver's URL reaches.
+			resp.Body.Close()
+
+			status := resp.StatusCode
+			attempt.ResponseStatus = &status
+			attempt.Succeeded = status >= 200 && status <= 299
+			if !attempt.Succeeded {
+				err = fmt.Errorf("unexpected status %d", status)
+			}
+		}
+	}
+	if err == nil {
+		return attempt
+	}
+
+	message := err.Error()
+	attempt.Error = &message
+	if failures := delivery.Attempts + 1; failures < MaxAttempts {
+		retryAt := time.Now().Add(Backoff(failures))
+		attempt.RetryAt = &retryAt
+	} else {
+		d.logger.Printf("ERROR: webhookDelivery %d: giving up after %d attempts: %s", delivery.ID, failures, message)
+	}
+	return attempt
+}
@@ -0,0 +1,116 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for a URL that resolves to, or a connection
+// to, an address on the server's own network.
+var ErrBlockedAddress = errors.New("address is not publicly routable")
+
+// blockedPrefixes are the ranges requests to user-supplied URLs must not
+// reach: the server itself, private and carrier-grade NAT networks, which
+// are often cloud-internal, and the special-purpose ranges that are not
+// routed on the internet. The NAT64, 6to4 and Teredo prefixes are blocked
+// as well, since their addresses embed an IPv4 address a gateway may
+// forward to.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// blockedAddr reports whether requests to addr could reach the server
+// itself or its private network rather than a receiver on the internet.
+// IPv4 addresses written in IPv6 form are checked as IPv4.
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL checks that rawURL is an absolute http or https URL whose host
+// resolves only to public addresses.
+func ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("url host %q does not resolve", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if blockedAddr(addr) {
+			return fmt.Errorf("url host %q: %w", u.Hostname(), ErrBlockedAddress)
+		}
+	}
+	return nil
+}
+
+// checkDialAddress refuses connections to blocked addresses. It runs after
+// the host is resolved, so a name that resolved to a public address when
+// the URL was validated cannot be rebound to a private one later.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || blockedAddr(addrPort.Addr()) {
+		return fmt.Errorf("dial %s: %w", address, ErrBlockedAddress)
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for requests to user-supplied URLs. It
+// only connects to public addresses, ignores proxy settings, which would
+// hide the address it connects to, and does not follow redirects, so a
+// redirect response counts as a failure.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDialAddress}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockedAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		blocked bool
+	}{
+		{name: "this network", addr: "0.1.2.3", blocked: true},
+		{name: "private 10/8", addr: "10.1.2.3", blocked: true},
+		{name: "carrier-grade NAT", addr: "100.64.0.1", blocked: true},
+		{name: "carrier-grade NAT end", addr: "100.127.255.254", blocked: true},
+		{name: "loopback", addr: "127.0.0.1", blocked: true},
+		{name: "link-local metadata", addr: "169.254.169.254", blocked: true},
+		{name: "private 172.16/12", addr: "172.16.0.1", blocked: true},
+		{name: "IETF protocol assignments", addr: "192.0.0.170", blocked: true},
+		{name: "documentation 192.0.2/24", addr: "192.0.2.1", blocked: true},
+		{name: "6to4 relay anycast", addr: "192.88.99.1", blocked: true},
+		{name: "private 192.168/16", addr: "192.168.1.1", blocked: true},
+		{name: "benchmarking", addr: "198.19.0.1", blocked: true},
+		{name: "documentation 198.51.100/24", addr: "198.51.100.1", blocked: true},
+		{name: "documentation 203.0.113/24", addr: "203.0.113.1", blocked: true},
+		{name: "multicast", addr: "224.0.0.1", blocked: true},
+		{name: "reserved", addr: "240.0.0.1", blocked: true},
+		{name: "broadcast", addr: "255.255.255.255", blocked: true},
+		{name: "IPv6 unspecified", addr: "::", blocked: true},
+		{name: "IPv6 loopback", addr: "::1", blocked: true},
+		{name: "IPv4-compatible", addr: "::10.0.0.1", blocked: true},
+		{name: "IPv4-mapped loopback", addr: "::ffff:127.0.0.1", blocked: true},
+		{name: "IPv4-mapped CGNAT", addr: "::ffff:100.64.0.1", blocked: true},
+		{name: "NAT64", addr: "64:ff9b::a00:1", blocked: true},
+		{name: "local NAT64", addr: "64:ff9b:1::a00:1", blocked: true},
+		{name: "discard", addr: "100::1", blocked: true},
+		{name: "Teredo", addr: "2001::1", blocked: true},
+		{name: "IPv6 documentation", addr: "2001:db8::1", blocked: true},
+		{name: "6to4", addr: "2002:a00:1::1", blocked: true},
+		{name: "unique local", addr: "fd00::1", blocked: true},
+		{name: "IPv6 link-local", addr: "fe80::1", blocked: true},
+		{name: "IPv6 link-local with zone", addr: "fe80::1%eth0", blocked: true},
+		{name: "site-local", addr: "fec0::1", blocked: true},
+		{name: "IPv6 multicast", addr: "ff02::1", blocked: true},
+		{name: "public IPv4", addr: "93.184.216.34", blocked: false},
+		{name: "public next to CGNAT", addr: "100.128.0.1", blocked: false},
+		{name: "IPv4-mapped public", addr: "::ffff:93.184.216.34", blocked: false},
+		{name: "public IPv6", addr: "2606:2800:220:1::1", blocked: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.blocked, blockedAddr(netip.MustParseAddr(test.addr)))
+		})
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, ValidateURL(ctx, "https://93.184.216.34/hooks"))
+	assert.ErrorIs(t, ValidateURL(ctx, "http://127.0.0.1:8080/hooks"), ErrBlockedAddress)
+	assert.ErrorIs(t, ValidateURL(ctx, "http://169.254.169.254/latest/meta-data"), ErrBlockedAddress)
+	assert.ErrorIs(t, ValidateURL(ctx, "http://[::1]/hooks"), ErrBlockedAddress)
+	assert.ErrorIs(t, ValidateURL(ctx, "http://100.64.0.1/hooks"), ErrBlockedAddress)
+	assert.ErrorIs(t, ValidateURL(ctx, "http://[64:ff9b::a9fe:a9fe]/hooks"), ErrBlockedAddress)
+	assert.ErrorIs(t, ValidateURL(ctx, "http://localhost/hooks"), ErrBlockedAddress)
+	assert.Error(t, ValidateURL(ctx, "ftp://93.184.216.34/hooks"))
+	assert.Error(t, ValidateURL(ctx, "/hooks"))
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+}
@@ -0,0 +1,46 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1767225600, 0)
+	body := []byte(`{"id":"abc","type":"workout.created"}`)
+
+	signature := Sign("secret", at, body)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1767225600." + string(body)))
+	assert.Equal(t, "t=1767225600,v1="+hex.EncodeToString(mac.Sum(nil)), signature)
+	assert.NotEqual(t, signature, Sign("other", at, body))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 256*30*time.Second, Backoff(9))
+	assert.Equal(t, 6*time.Hour, Backoff(100))
+}
+
+func TestEncodePayload(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	payload, err := encodePayload("abc", EventWorkoutDeleted, at, map[string]int{"id": 7})
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"abc","type":"workout.deleted","created_at":"2026-03-01T11:00:00Z","data":{"id":7}}`, string(payload))
+}
+
+func TestValidEvent(t *testing.T) {
+	assert.True(t, ValidEvent(EventRecordAchieved))
+	assert.False(t, ValidEvent("workout.*"))
+}
@@ -0,0 +1,641 @@
+// Package workoutcsv converts workouts to and from CSV files, including the
+// exports of other lifting apps through named column mapping presets.
+package workoutcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+)
+
+// Fields a CSV column can be mapped onto.
+const (
+	FieldWorkoutID       = "workout_id"
+	FieldDate            = "date"
+	FieldEndDate         = "end_date"
+	FieldTitle           = "title"
+	FieldDescription     = "description"
+	FieldDurationMinutes = "duration_minutes"
+	FieldCaloriesBurned  = "calories_burned"
+	FieldOrderIndex      = "order_index"
+	FieldExerciseName    = "exercise_name"
+	FieldSets            = "sets"
+	FieldReps            = "reps"
+	FieldWeight          = "weight"
+	FieldWeightUnit      = "weight_unit"
+	FieldDurationSeconds = "duration_seconds"
+	FieldKind            = "kind"
+	FieldDistance        = "distance"
+	FieldDistanceUnit    = "distance_unit"
+	FieldNotes           = "notes"
+
+	FieldGroup               = "group"
+	FieldGroupType           = "group_type"
+	FieldGroupRounds         = "group_rounds"
+	FieldGroupWorkSeconds    = "group_work_seconds"
+	FieldGroupTimeCapSeconds = "group_time_cap_seconds"
+	FieldGroupExerciseRest   = "group_rest_between_exercises_seconds"
+	FieldGroupRoundRest      = "group_rest_between_rounds_seconds"
+)
+
+const defaultWorkoutTitle = "Imported workout"
+
+// Mapping maps a field onto the header of the CSV column holding it.
+type Mapping map[string]string
+
+// exportHeader is the column layout written by Export and read by the
+// "native" preset.
+var exportHeader = []string{
+	FieldWorkoutID, FieldDate, FieldTitle, FieldDescription, FieldDurationMinutes, FieldCaloriesBurned,
+	FieldOrderIndex, FieldExerciseName, FieldKind, FieldSets, FieldReps, FieldWeight, FieldWeightUnit, FieldDurationSeconds,
+	FieldDistance, FieldDistanceUnit, FieldNotes,
+	FieldGroup, FieldGroupType, FieldGroupRounds, FieldGroupWorkSeconds, FieldGroupTimeCapSeconds,
+	FieldGroupExerciseRest, FieldGroupRoundRest,
+}
+
+// Presets holds the mappings for the CSV layouts we know how to read.
+// Layouts without a sets column have one row per set; consecutive identical
+// sets of an exercise are folded into a single entry.
+var Presets = map[string]Mapping{
+	"native": nativeMapping(),
+	"strong": {
+		FieldDate:            "Date",
+		FieldTitle:           "Workout Name",
+		FieldDescription:     "Workout Notes",
+		FieldDurationMinutes: "Duration",
+		FieldExerciseName:    "Exercise Name",
+		FieldWeight:          "Weight",
+		FieldReps:            "Reps",
+		FieldDurationSeconds: "Seconds",
+		FieldDistance:        "Distance",
+		FieldNotes:           "Notes",
+	},
+	"hevy": {
+		FieldTitle:           "title",
+		FieldDate:            "start_time",
+		FieldEndDate:         "end_time",
+		FieldDescription:     "description",
+		FieldExerciseName:    "exercise_title",
+		FieldNotes:           "exercise_notes",
+		FieldWeight:          "weight_kg",
+		FieldReps:            "reps",
+		FieldDurationSeconds: "duration_seconds",
+		FieldDistance:        "distance_km",
+	},
+}
+
+// PresetUnits holds the unit system of presets whose columns always use the
+// same units; other files are read in the importing user's units.
+var PresetUnits = map[string]string{
+	"hevy": units.SystemMetric,
+}
+
+func nativeMapping() Mapping {
+	mapping := Mapping{}
+	for _, field := range exportHeader {
+		mapping[field] = field
+	}
+	return mapping
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2 Jan 2006, 15:04",
+	"02 Jan 2006, 15:04",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type Report struct {
+	Rows     int        `json:"rows"`
+	Workouts int        `json:"workouts"`
+	Entries  int        `json:"entries"`
+	Errors   []RowError `json:"errors"`
+}
+
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Export writes one row per workout entry, repeating the workout columns on
+// every row and the group columns on every row of a group. Workouts without
+// entries are written as a single row.
+func Export(w io.Writer, workouts []*store.Workout) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write(exportHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, workout := range workouts {
+		workoutColumns := []string{
+			strconv.Itoa(workout.ID),
+			workout.PerformedAt.UTC().Format(time.RFC3339),
+			workout.Title,
+			workout.Description,
+			strconv.Itoa(workout.DurationMinutes),
+			strconv.Itoa(workout.CaloriesBurned),
+		}
+
+		if len(workout.Entries) == 0 && len(workout.Groups) == 0 {
+			err = writer.Write(append(workoutColumns, make([]string, len(exportHeader)-len(workoutColumns))...))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var writeErr error
+		workout.EachEntry(func(group *store.WorkoutEntryGroup, entry *store.WorkoutEntry) {
+			if writeErr != nil {
+				return
+			}
+			row := append(workoutColumns[:len(workoutColumns):len(workoutColumns)],
+				strconv.Itoa(entry.OrderIndex),
+				entry.ExerciseName,
+				entry.Kind,
+				strconv.Itoa(entry.Sets),
+				formatOptionalInt(entry.Reps),
+				formatOptionalFloat(entry.Weight),
+				formatOptionalString(entry.WeightUnit),
+				formatOptionalInt(entry.DurationSeconds),
+				formatOptionalFloat(entry.Distance),
+				formatOptionalString(entry.DistanceUnit),
+				entry.Notes,
+			)
+			row = append(row, groupColumns(group)...)
+			writeErr = writer.Write(row)
+		})
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func groupColumns(group *store.WorkoutEntryGroup) []string {
+	if group == nil {
+		return make([]string, 7)
+	}
+	return []string{
+		strconv.Itoa(group.OrderIndex),
+		group.Type,
+		strconv.Itoa(group.Rounds),
+		formatOptionalInt(group.WorkSeconds),
+		formatOptionalInt(group.TimeCapSeconds),
+		strconv.Itoa(group.RestBetweenExercisesSeconds),
+		strconv.Itoa(group.RestBetweenRoundsSeconds),
+	}
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatOptionalString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// Options describe how to read values the file leaves ambiguous.
+type Options struct {
+	// Location applies to dates without a zone.
+	Location *time.Location
+	// Units is the system of weights and distances without a unit column.
+	Units string
+}
+
+// Parse reads a CSV file using mapping and groups its rows into workouts.
+// Rows sharing a workout_id, or else the same date and title, belong to the
+// same workout. Problems with single rows are collected in the report; the
+// error is reserved for files that cannot be read at all.
+func Parse(r io.Reader, mapping Mapping, opts Options) ([]*store.Workout, *Report, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Units == "" {
+		opts.Units = units.SystemMetric
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	fieldColumns := map[string]int{}
+	for field, name := range mapping {
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if ok {
+			fieldColumns[field] = i
+		}
+	}
+
+	for _, required := range []string{FieldDate, FieldExerciseName} {
+		if _, ok := fieldColumns[required]; !ok {
+			return nil, nil, fmt.Errorf("missing column for %s", required)
+		}
+	}
+
+	_, perEntryRows := fieldColumns[FieldSets]
+
+	report := &Report{Errors: []RowError{}}
+	workouts := []*store.Workout{}
+	byKey := map[string]*store.Workout{}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				report.Errors = append(report.Errors, RowError{Row: line, Error: err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		report.Rows++
+
+		value := func(field string) string {
+			i, ok := fieldColumns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		workout, entry, err := parseRow(value, opts)
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		key := value(FieldWorkoutID)
+		if key == "" {
+			key = value(FieldDate) + "|" + workout.Title
+		}
+
+		existing, ok := byKey[key]
+		if !ok {
+			existing = workout
+			byKey[key] = workout
+			workouts = append(workouts, workout)
+		}
+
+		if entry == nil {
+			continue
+		}
+
+		group, err := parseGroup(value)
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		entries := &existing.Entries
+		if group != nil {
+			entries = &findOrAddGroup(existing, group).Entries
+		}
+
+		if !perEntryRows && len(*entries) > 0 && sameSet((*entries)[len(*entries)-1], *entry) {
+			(*entries)[len(*entries)-1].Sets++
+			continue
+		}
+		if value(FieldOrderIndex) == "" {
+			entry.OrderIndex = len(*entries) + 1
+		}
+		*entries = append(*entries, *entry)
+	}
+
+	report.Workouts = len(workouts)
+	for _, workout := range workouts {
+		workout.EachEntry(func(_ *store.WorkoutEntryGroup, _ *store.WorkoutEntry) {
+			report.Entries++
+		})
+		for i := range workout.Groups {
+			err = workout.Groups[i].Validate()
+			if err != nil {
+				report.Errors = append(report.Errors, RowError{Error: fmt.Sprintf("workout %q, group %d: %s", workout.Title, workout.Groups[i].OrderIndex, err)})
+			}
+		}
+	}
+
+	return workouts, report, nil
+}
+
+// parseRow returns the workout described by a row and its entry, which is nil
+// for rows that only carry workout columns.
+func parseRow(value func(string) string, opts Options) (*store.Workout, *store.WorkoutEntry, error) {
+	workout := &store.Workout{
+		Title:       value(FieldTitle),
+		Description: value(FieldDescription),
+	}
+	entry := &store.WorkoutEntry{
+		Kind:         value(FieldKind),
+		ExerciseName: value(FieldExerciseName),
+		Notes:        value(FieldNotes),
+		Sets:         1,
+	}
+
+	if workout.Title == "" {
+		workout.Title = defaultWorkoutTitle
+	}
+
+	var err error
+	workout.PerformedAt, err = parseDate(value(FieldDate), opts.Location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workout.DurationMinutes, err = parseDurationMinutes(value(FieldDurationMinutes))
+	if err != nil {
+		return nil, nil, err
+	}
+	if end := value(FieldEndDate); end != "" && workout.DurationMinutes == 0 {
+		endedAt, err := parseDate(end, opts.Location)
+		if err != nil {
+			return nil, nil, err
+		}
+		workout.DurationMinutes = int(math.Round(endedAt.Sub(workout.PerformedAt).Minutes()))
+	}
+
+	calories, err := parseOptionalInt(value(FieldCaloriesBurned), FieldCaloriesBurned)
+	if err != nil {
+		return nil, nil, err
+	}
+	if calories != nil {
+		workout.CaloriesBurned = *calories
+	}
+
+	if v := value(FieldSets); v != "" {
+		entry.Sets, err = strconv.Atoi(v)
+		if err != nil || entry.Sets < 1 {
+			return nil, nil, fmt.Errorf("invalid sets %q", v)
+		}
+	}
+	if v := value(FieldOrderIndex); v != "" {
+		entry.OrderIndex, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid order_index %q", v)
+		}
+	}
+
+	if entry.ExerciseName == "" {
+		if value(FieldReps) != "" || value(FieldDurationSeconds) != "" || value(FieldDistance) != "" || value(FieldWeight) != "" {
+			return nil, nil, errors.New("exercise name is required")
+		}
+		return workout, nil, nil
+	}
+
+	entry.Reps, err = parseOptionalInt(value(FieldReps), FieldReps)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.DurationSeconds, err = parseOptionalInt(value(FieldDurationSeconds), FieldDurationSeconds)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.Weight, err = parseOptionalFloat(value(FieldWeight), FieldWeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.Distance, err = parseOptionalFloat(value(FieldDistance), FieldDistance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Apps that log every measurement in its own column write 0 in the
+	// unused ones.
+	if entry.DurationSeconds != nil && *entry.DurationSeconds == 0 {
+		entry.DurationSeconds = nil
+	}
+	if entry.Distance != nil && *entry.Distance == 0 {
+		entry.Distance = nil
+	}
+	if entry.Reps != nil && *entry.Reps == 0 && (entry.DurationSeconds != nil || entry.Distance != nil) {
+		entry.Reps = nil
+	}
+
+	if entry.Weight != nil {
+		unit := value(FieldWeightUnit)
+		if unit == "" {
+			unit = units.WeightUnit(opts.Units)
+		}
+		entry.WeightUnit = &unit
+	}
+	if entry.Distance != nil {
+		unit := value(FieldDistanceUnit)
+		if unit == "" {
+			unit = units.DistanceUnit(opts.Units)
+		}
+		entry.DistanceUnit = &unit
+	}
+
+	entry.Normalize()
+	err = entry.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return workout, entry, nil
+}
+
+// parseGroup returns the group a row's entry belongs to, or nil for
+// ungrouped entries.
+func parseGroup(value func(string) string) (*store.WorkoutEntryGroup, error) {
+	v := value(FieldGroup)
+	if v == "" {
+		return nil, nil
+	}
+
+	group := &store.WorkoutEntryGroup{Type: value(FieldGroupType), Entries: []store.WorkoutEntry{}}
+
+	var err error
+	group.OrderIndex, err = strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group %q", v)
+	}
+
+	ints := []struct {
+		field string
+		dest  *int
+	}{
+		{FieldGroupRounds, &group.Rounds},
+		{FieldGroupExerciseRest, &group.RestBetweenExercisesSeconds},
+		{FieldGroupRoundRest, &group.RestBetweenRoundsSeconds},
+	}
+	for _, f := range ints {
+		n, err := parseOptionalInt(value(f.field), f.field)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			*f.dest = *n
+		}
+	}
+
+	group.WorkSeconds, err = parseOptionalInt(value(FieldGroupWorkSeconds), FieldGroupWorkSeconds)
+	if err != nil {
+		return nil, err
+	}
+	group.TimeCapSeconds, err = parseOptionalInt(value(FieldGroupTimeCapSeconds), FieldGroupTimeCapSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	group.Normalize()
+	return group, nil
+}
+
+// findOrAddGroup returns the workout's group with the order index of group,
+// adding group if there is none yet. Group columns are read from the first
+// row of each group.
+func findOrAddGroup(workout *store.Workout, group *store.WorkoutEntryGroup) *store.WorkoutEntryGroup {
+	for i := range workout.Groups {
+		if workout.Groups[i].OrderIndex == group.OrderIndex {
+			return &workout.Groups[i]
+		}
+	}
+	workout.Groups = append(workout.Groups, *group)
+	return &workout.Groups[len(workout.Groups)-1]
+}
+
+func sameSet(a, b store.WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		a.Notes == b.Notes &&
+		equalOptional(a.Reps, b.Reps) &&
+		equalOptional(a.DurationSeconds, b.DurationSeconds) &&
+		equalOptional(a.Distance, b.Distance) &&
+		equalOptional(a.DistanceUnit, b.DistanceUnit) &&
+		equalOptional(a.Weight, b.Weight) &&
+		equalOptional(a.WeightUnit, b.WeightUnit)
+}
+
+func equalOptional[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func parseDate(v string, loc *time.Location) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, errors.New("date is required")
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, v, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", v)
+}
+
+// parseDurationMinutes accepts plain minutes ("45"), clock notation
+// ("1:05:00" or "45:00") and unit notation ("1h 5m").
+func parseDurationMinutes(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	if minutes, err := strconv.ParseFloat(v, 64); err == nil {
+		return int(math.Round(minutes)), nil
+	}
+
+	if strings.Contains(v, ":") {
+		parts := strings.Split(v, ":")
+		if len(parts) == 2 {
+			parts = append([]string{"0"}, parts...)
+		}
+		if len(parts) == 3 {
+			var seconds float64
+			valid := true
+			for _, part := range parts {
+				n, err := strconv.Atoi(part)
+				if err != nil || n < 0 {
+					valid = false
+					break
+				}
+				seconds = seconds*60 + float64(n)
+			}
+			if valid {
+				return int(math.Round(seconds / 60)), nil
+			}
+		}
+	}
+
+	d, err := time.ParseDuration(strings.ReplaceAll(v, " ", ""))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return int(math.Round(d.Minutes())), nil
+}
+
+func parseOptionalInt(v string, field string) (*int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("invalid %s %q", field, v)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func parseOptionalFloat(v string, field string) (*float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if !strings.Contains(v, ".") {
+		v = strings.Replace(v, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return nil, fmt.Errorf("invalid %s %q", field, v)
+	}
+	return &f, nil
+}
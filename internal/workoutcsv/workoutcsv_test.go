@@ -0,0 +1,92 @@
+package workoutcsv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andras-szesztai/fem_fitness_project/internal/store"
+	"github.com/andras-szesztai/fem_fitness_project/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStrongPreset(t *testing.T) {
+	input := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2024-03-01 07:30:00,Legs,1h 5m,Squat,1,100,5,0,0,,,
+2024-03-01 07:30:00,Legs,1h 5m,Squat,2,100,5,0,0,,,
+2024-03-01 07:30:00,Legs,1h 5m,Squat,3,105,3,0,0,,,
+2024-03-01 07:30:00,Legs,1h 5m,Plank,1,0,0,0,60,,,
+2024-03-01 07:30:00,Legs,1h 5m,Treadmill,1,0,0,1.5,600,,,
+2024-03-03 18:00:00,Push,45m,Bench Press,1,abc,5,0,0,,,
+`
+
+	workouts, report, err := Parse(strings.NewReader(input), Presets["strong"], Options{Location: time.UTC, Units: units.SystemImperial})
+	require.NoError(t, err)
+
+	assert.Equal(t, 6, report.Rows)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 7, report.Errors[0].Row)
+
+	require.Len(t, workouts, 1)
+	legs := workouts[0]
+	assert.Equal(t, "Legs", legs.Title)
+	assert.Equal(t, 65, legs.DurationMinutes)
+	assert.Equal(t, time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC), legs.PerformedAt)
+
+	require.Len(t, legs.Entries, 4)
+	assert.Equal(t, 2, legs.Entries[0].Sets)
+	assert.Equal(t, 5, *legs.Entries[0].Reps)
+	assert.Equal(t, 1, legs.Entries[1].Sets)
+	assert.Equal(t, 105.0, *legs.Entries[1].Weight)
+	assert.Equal(t, units.Pounds, *legs.Entries[1].WeightUnit)
+	assert.Nil(t, legs.Entries[2].Reps)
+	assert.Equal(t, 60, *legs.Entries[2].DurationSeconds)
+	assert.Equal(t, store.EntryKindDistance, legs.Entries[3].Kind)
+	assert.Equal(t, units.Miles, *legs.Entries[3].DistanceUnit)
+	assert.InDelta(t, 2414.0, legs.Entries[3].DistanceMeters(), 0.1)
+	assert.Equal(t, 249, *legs.Entries[3].PaceSecondsPerKm)
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	workouts := []*store.Workout{
+		{
+			ID:              7,
+			Title:           "Upper, heavy",
+			DurationMinutes: 50,
+			PerformedAt:     time.Date(2024, 5, 2, 17, 0, 0, 0, time.UTC),
+			Entries: []store.WorkoutEntry{
+				{Kind: store.EntryKindReps, ExerciseName: "Bench Press", Sets: 3, Reps: &[]int{5}[0], Weight: &[]float64{185}[0], WeightUnit: &[]string{"lb"}[0], OrderIndex: 1},
+				{Kind: store.EntryKindTime, ExerciseName: "Dead Hang", Sets: 2, DurationSeconds: &[]int{45}[0], Notes: "grip \"gave out\"", OrderIndex: 2},
+				{Kind: store.EntryKindDistance, ExerciseName: "Row", Sets: 1, Distance: &[]float64{2}[0], DistanceUnit: &[]string{"km"}[0], OrderIndex: 3},
+			},
+			Groups: []store.WorkoutEntryGroup{
+				{Type: store.GroupTypeSuperset, Rounds: 3, RestBetweenRoundsSeconds: 90, OrderIndex: 4, Entries: []store.WorkoutEntry{
+					{Kind: store.EntryKindReps, ExerciseName: "Chin Up", Sets: 1, Reps: &[]int{8}[0], OrderIndex: 1},
+					{Kind: store.EntryKindReps, ExerciseName: "Dip", Sets: 1, Reps: &[]int{10}[0], OrderIndex: 2},
+				}},
+			},
+		},
+		{ID: 8, Title: "Rest day walk", DurationMinutes: 30, PerformedAt: time.Date(2024, 5, 3, 9, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Export(&buf, workouts))
+
+	parsed, report, err := Parse(&buf, Presets["native"], Options{})
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+
+	require.Len(t, parsed, 2)
+	for i, workout := range workouts {
+		assert.Equal(t, workout.Title, parsed[i].Title)
+		assert.Equal(t, workout.DurationMinutes, parsed[i].DurationMinutes)
+		assert.True(t, workout.PerformedAt.Equal(parsed[i].PerformedAt))
+		assert.Equal(t, len(workout.Entries), len(parsed[i].Entries))
+		for j, entry := range workout.Entries {
+			assert.Equal(t, entry, parsed[i].Entries[j])
+		}
+		assert.Equal(t, workout.Groups, parsed[i].Groups)
+	}
+}
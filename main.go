@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+	// User time zones must load on hosts without a zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/andras-szesztai/fem_fitness_project/internal/app"
 	"github.com/andras-szesztai/fem_fitness_project/internal/routes"
@@ -12,10 +14,24 @@ import (
 
 func main() {
 	var port int
+	var cfg app.Config
 	flag.IntVar(&port, "port", 8080, "Port to run the server on")
+	flag.StringVar(&cfg.PublicURL, "public-url", "http://localhost:8080", "Address clients reach the API at; links handed out to clients are built from it")
+	flag.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", 24*time.Hour, "How long idempotency keys and their responses are kept")
+	flag.DurationVar(&cfg.ReminderInterval, "reminder-interval", time.Minute, "How often schedules are checked for due reminders and missed sessions")
+	flag.StringVar(&cfg.SMTPAddr, "smtp-addr", "", "SMTP relay (host:port) for reminder email; email is logged when empty")
+	flag.StringVar(&cfg.SMTPFrom, "smtp-from", "reminders@localhost", "Sender address of reminder email")
+	flag.StringVar(&cfg.SMTPUsername, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.SMTPPassword, "smtp-password", "", "SMTP password")
+	flag.DurationVar(&cfg.WebhookInterval, "webhook-interval", 5*time.Second, "How often due webhook deliveries are sent")
+	flag.DurationVar(&cfg.OutboxInterval, "outbox-interval", time.Second, "How often pending domain events are dispatched to their subscribers")
+	flag.IntVar(&cfg.JobWorkers, "job-workers", 4, "How many background jobs run at once")
+	flag.DurationVar(&cfg.JobPollInterval, "job-poll-interval", time.Second, "How long an idle job worker waits before looking for due jobs again")
+	flag.DurationVar(&cfg.TokenCleanupInterval, "token-cleanup-interval", time.Hour, "How often expired tokens are deleted")
+	flag.IntVar(&cfg.MaxSessions, "max-sessions", 10, "How many sessions a user can have at once before the oldest is ended; 0 for no limit")
 	flag.Parse()
 
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(cfg)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE SEQUENCE IF NOT EXISTS sync_version_seq;
+
+ALTER TABLE workouts ADD COLUMN client_id UUID;
+ALTER TABLE workouts ADD COLUMN sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq');
+ALTER TABLE workouts ADD CONSTRAINT workouts_user_client_id_key UNIQUE (user_id, client_id);
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_sync_version ON workouts(user_id, sync_version);
+
+CREATE TABLE IF NOT EXISTS sync_tombstones (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    client_id UUID,
+    sync_version BIGINT NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_tombstones_user_sync_version ON sync_tombstones(user_id, sync_version);
+
+-- Versions are handed out while holding a per-user transaction lock, so for a
+-- given user they become visible in the same order they were assigned and a
+-- sync cursor never skips a row committed late.
+CREATE OR REPLACE FUNCTION workouts_sync_version() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('sync'), NEW.user_id::INTEGER);
+    NEW.sync_version := nextval('sync_version_seq');
+    IF TG_OP = 'UPDATE' THEN
+        NEW.updated_at := CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workouts_sync_version
+BEFORE INSERT OR UPDATE ON workouts
+FOR EACH ROW EXECUTE FUNCTION workouts_sync_version();
+
+CREATE OR REPLACE FUNCTION workouts_sync_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+    -- Nothing to sync when the whole user is being deleted.
+    IF NOT EXISTS (SELECT 1 FROM users WHERE id = OLD.user_id) THEN
+        RETURN OLD;
+    END IF;
+
+    PERFORM pg_advisory_xact_lock(hashtext('sync'), OLD.user_id::INTEGER);
+    INSERT INTO sync_tombstones (user_id, entity_type, entity_id, client_id, sync_version)
+    VALUES (OLD.user_id, 'workout', OLD.id, OLD.client_id, nextval('sync_version_seq'));
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workouts_sync_tombstone
+AFTER DELETE ON workouts
+FOR EACH ROW EXECUTE FUNCTION workouts_sync_tombstone();
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TRIGGER IF EXISTS workouts_sync_tombstone ON workouts;
+DROP TRIGGER IF EXISTS workouts_sync_version ON workouts;
+DROP FUNCTION IF EXISTS workouts_sync_tombstone();
+DROP FUNCTION IF EXISTS workouts_sync_version();
+DROP TABLE IF EXISTS sync_tombstones;
+ALTER TABLE workouts DROP CONSTRAINT IF EXISTS workouts_user_client_id_key;
+ALTER TABLE workouts DROP COLUMN IF EXISTS sync_version;
+ALTER TABLE workouts DROP COLUMN IF EXISTS client_id;
+DROP SEQUENCE IF EXISTS sync_version_seq;
+
+-- +goose StatementEnd
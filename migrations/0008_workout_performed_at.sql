@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE workouts ADD COLUMN performed_at TIMESTAMP WITH TIME ZONE;
+UPDATE workouts SET performed_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE workouts ALTER COLUMN performed_at SET NOT NULL;
+ALTER TABLE workouts ALTER COLUMN performed_at SET DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_performed_at ON workouts(user_id, performed_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE workouts DROP COLUMN IF EXISTS performed_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS workout_activities (
+    workout_id BIGINT PRIMARY KEY REFERENCES workouts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_format VARCHAR(10) NOT NULL,
+    sport VARCHAR(50) NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    distance_meters DOUBLE PRECISION NOT NULL DEFAULT 0,
+    elevation_gain_meters DOUBLE PRECISION NOT NULL DEFAULT 0,
+    avg_heart_rate INTEGER,
+    max_heart_rate INTEGER,
+    sample_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT workout_activities_user_started_at_key UNIQUE (user_id, started_at)
+);
+
+CREATE TABLE IF NOT EXISTS activity_samples (
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    altitude_meters DOUBLE PRECISION,
+    heart_rate INTEGER,
+    cadence INTEGER,
+    power INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_samples_workout_id ON activity_samples(workout_id, recorded_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS activity_samples;
+DROP TABLE IF EXISTS workout_activities;
+
+-- +goose StatementEnd
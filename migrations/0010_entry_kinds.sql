@@ -0,0 +1,67 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE workout_entries ADD COLUMN kind VARCHAR(20);
+UPDATE workout_entries SET kind = CASE WHEN reps IS NOT NULL THEN 'reps' ELSE 'time' END;
+ALTER TABLE workout_entries ALTER COLUMN kind SET NOT NULL;
+
+ALTER TABLE workout_entries ADD COLUMN distance DECIMAL(10, 3);
+ALTER TABLE workout_entries ADD COLUMN distance_unit VARCHAR(2);
+ALTER TABLE workout_entries ADD COLUMN pace_seconds_per_km INTEGER;
+ALTER TABLE workout_entries ADD COLUMN incline_percent DECIMAL(4, 1);
+ALTER TABLE workout_entries ADD COLUMN resistance_level INTEGER;
+ALTER TABLE workout_entries ADD COLUMN avg_heart_rate INTEGER;
+ALTER TABLE workout_entries ADD COLUMN max_heart_rate INTEGER;
+
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry;
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK (
+    (kind = 'reps' AND reps IS NOT NULL AND duration_seconds IS NULL AND distance IS NULL) OR
+    (kind = 'time' AND duration_seconds IS NOT NULL AND reps IS NULL AND distance IS NULL) OR
+    (kind = 'distance' AND distance IS NOT NULL AND reps IS NULL) OR
+    (kind = 'cardio' AND duration_seconds IS NOT NULL AND reps IS NULL)
+);
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry_distance CHECK (
+    (distance IS NULL AND distance_unit IS NULL) OR
+    (distance > 0 AND distance_unit IN ('m', 'km', 'mi'))
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- Distance entries without a duration have no place in the old schema.
+-- Rather than deleting them, refuse to roll back until they are dealt with.
+-- The distance and cardio measurements of the other entries are dropped.
+DO $$
+DECLARE
+    nonconforming BIGINT;
+BEGIN
+    SELECT count(*) INTO nonconforming
+    FROM workout_entries
+    WHERE NOT (
+        (reps IS NOT NULL AND duration_seconds IS NULL) OR
+        (reps IS NULL AND duration_seconds IS NOT NULL)
+    );
+    IF nonconforming > 0 THEN
+        RAISE EXCEPTION 'cannot roll back entry kinds: % workout entries have neither reps nor a duration', nonconforming;
+    END IF;
+END
+$$;
+
+ALTER TABLE workout_entries DROP CONSTRAINT IF EXISTS valid_workout_entry_distance;
+ALTER TABLE workout_entries DROP CONSTRAINT IF EXISTS valid_workout_entry;
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK (
+    (reps IS NOT NULL AND duration_seconds IS NULL) OR
+    (reps IS NULL AND duration_seconds IS NOT NULL)
+);
+ALTER TABLE workout_entries DROP COLUMN max_heart_rate;
+ALTER TABLE workout_entries DROP COLUMN avg_heart_rate;
+ALTER TABLE workout_entries DROP COLUMN resistance_level;
+ALTER TABLE workout_entries DROP COLUMN incline_percent;
+ALTER TABLE workout_entries DROP COLUMN pace_seconds_per_km;
+ALTER TABLE workout_entries DROP COLUMN distance_unit;
+ALTER TABLE workout_entries DROP COLUMN distance;
+ALTER TABLE workout_entries DROP COLUMN kind;
+
+-- +goose StatementEnd
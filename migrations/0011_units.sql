@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users ADD COLUMN units VARCHAR(8) NOT NULL DEFAULT 'metric';
+ALTER TABLE users ADD CONSTRAINT valid_user_units CHECK (units IN ('metric', 'imperial'));
+
+-- Weights are stored in kilograms; weight_unit records what the user entered.
+-- Six decimal places keep pound values exact after conversion.
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE DECIMAL(14, 6);
+ALTER TABLE workout_entries ADD COLUMN weight_unit VARCHAR(2);
+UPDATE workout_entries SET weight_unit = 'kg' WHERE weight IS NOT NULL;
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry_weight CHECK (
+    (weight IS NULL AND weight_unit IS NULL) OR
+    (weight IS NOT NULL AND weight_unit IN ('kg', 'lb'))
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry_weight;
+ALTER TABLE workout_entries DROP COLUMN weight_unit;
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE DECIMAL(10, 2);
+
+ALTER TABLE users DROP CONSTRAINT valid_user_units;
+ALTER TABLE users DROP COLUMN units;
+
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    group_type VARCHAR(20) NOT NULL,
+    rounds INTEGER NOT NULL DEFAULT 1,
+    work_seconds INTEGER,
+    time_cap_seconds INTEGER,
+    rest_between_exercises_seconds INTEGER NOT NULL DEFAULT 0,
+    rest_between_rounds_seconds INTEGER NOT NULL DEFAULT 0,
+    notes TEXT NOT NULL DEFAULT '',
+    order_index INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_workout_entry_group CHECK (
+        group_type IN ('superset', 'circuit', 'emom', 'amrap', 'tabata') AND
+        rounds >= 1 AND
+        rest_between_exercises_seconds >= 0 AND
+        rest_between_rounds_seconds >= 0 AND
+        (work_seconds IS NULL OR work_seconds > 0) AND
+        (time_cap_seconds IS NULL OR time_cap_seconds > 0) AND
+        (group_type <> 'amrap' OR time_cap_seconds IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_entry_groups_workout_id ON workout_entry_groups(workout_id);
+
+ALTER TABLE workout_entries ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_workout_entries_group_id ON workout_entries(group_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- Grouped entries are kept as ungrouped entries in their group's place.
+-- Every workout with groups has its entries numbered again, since entries
+-- inside a group were only ordered among themselves.
+UPDATE workout_entries we
+SET order_index = ordered.position
+FROM (
+    SELECT e.id, ROW_NUMBER() OVER (
+        PARTITION BY e.workout_id
+        ORDER BY COALESCE(g.order_index, e.order_index), g.id NULLS FIRST, e.order_index, e.id
+    ) AS position
+    FROM workout_entries e
+    LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+    WHERE e.workout_id IN (SELECT workout_id FROM workout_entry_groups)
+) ordered
+WHERE we.id = ordered.id;
+ALTER TABLE workout_entries DROP COLUMN group_id;
+DROP TABLE IF EXISTS workout_entry_groups;
+
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS workout_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL UNIQUE REFERENCES workouts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL DEFAULT 'active',
+    current_entry_id BIGINT REFERENCES workout_entries(id) ON DELETE SET NULL,
+    rest_started_at TIMESTAMP WITH TIME ZONE,
+    rest_seconds INTEGER,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_workout_session CHECK (
+        (status = 'active' AND finished_at IS NULL) OR
+        (status = 'finished' AND finished_at IS NOT NULL)
+    ),
+    CONSTRAINT valid_workout_session_rest CHECK (
+        (rest_started_at IS NULL AND rest_seconds IS NULL) OR
+        (rest_started_at IS NOT NULL AND rest_seconds > 0)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_sessions_user_id ON workout_sessions(user_id) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS workout_session_sets (
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+    set_number INTEGER NOT NULL CHECK (set_number >= 1),
+    reps INTEGER,
+    weight DECIMAL(14, 6),
+    weight_unit VARCHAR(2),
+    duration_seconds INTEGER,
+    completed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, entry_id, set_number),
+    CONSTRAINT valid_workout_session_set_weight CHECK (
+        (weight IS NULL AND weight_unit IS NULL) OR
+        (weight IS NOT NULL AND weight_unit IN ('kg', 'lb'))
+    )
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS workout_session_sets;
+DROP TABLE IF EXISTS workout_sessions;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Body weight is stored in kilograms.
+ALTER TABLE users ADD COLUMN body_weight DECIMAL(14, 6) CHECK (body_weight > 0);
+
+-- calories_estimated is true while calories_burned holds estimated_calories
+-- rather than a value the user supplied.
+ALTER TABLE workouts ADD COLUMN estimated_calories INTEGER;
+ALTER TABLE workouts ADD COLUMN calories_estimated BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS exercise_met_values (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    met DECIMAL(5, 2) NOT NULL CHECK (met > 0 AND met <= 30),
+    PRIMARY KEY (user_id, exercise_name)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS exercise_met_values;
+
+ALTER TABLE workouts DROP COLUMN calories_estimated;
+ALTER TABLE workouts DROP COLUMN estimated_calories;
+
+ALTER TABLE users DROP COLUMN body_weight;
+
+-- +goose StatementEnd
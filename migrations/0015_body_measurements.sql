@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Body weight is stored in kilograms and circumferences in centimeters.
+CREATE TABLE IF NOT EXISTS body_measurements (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    measured_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    body_weight DECIMAL(14, 6) CHECK (body_weight > 0),
+    body_fat_percent DECIMAL(5, 2) CHECK (body_fat_percent > 0 AND body_fat_percent < 100),
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_body_measurements_user_measured_at ON body_measurements(user_id, measured_at);
+
+CREATE TABLE IF NOT EXISTS body_circumferences (
+    measurement_id BIGINT NOT NULL REFERENCES body_measurements(id) ON DELETE CASCADE,
+    site VARCHAR(20) NOT NULL,
+    centimeters DECIMAL(12, 6) NOT NULL CHECK (centimeters > 0),
+    PRIMARY KEY (measurement_id, site)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS body_circumferences;
+DROP TABLE IF EXISTS body_measurements;
+
+-- +goose StatementEnd
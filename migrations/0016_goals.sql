@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- IANA time zone name; weeks and months of goals are counted in it.
+ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- target and start_value are stored in kilograms for weight goals, meters
+-- for distance goals and as a count for workouts_per_week.
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    goal_type VARCHAR(30) NOT NULL,
+    exercise_name VARCHAR(255),
+    target DECIMAL(14, 6) NOT NULL CHECK (target > 0),
+    start_value DECIMAL(14, 6),
+    deadline DATE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal CHECK (
+        goal_type IN ('one_rep_max', 'workouts_per_week', 'weekly_volume', 'body_weight', 'distance_per_month') AND
+        (goal_type = 'one_rep_max') = (exercise_name IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_user_id ON goals(user_id);
+
+-- A completion is recorded once per period of a weekly or monthly goal, and
+-- once for the whole goal otherwise.
+CREATE TABLE IF NOT EXISTS goal_completions (
+    goal_id BIGINT NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    value DECIMAL(14, 6) NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (goal_id, period_start)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS goal_completions;
+DROP TABLE IF EXISTS goals;
+
+ALTER TABLE users DROP COLUMN timezone;
+
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A rule awards its badge once metric reaches threshold. New rules are
+-- added by inserting rows; rules with backfilled_at unset are evaluated
+-- against every user's existing history when the server starts.
+CREATE TABLE IF NOT EXISTS achievement_rules (
+    id BIGSERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    metric VARCHAR(30) NOT NULL CHECK (metric IN ('workout_count', 'weekly_streak', 'session_volume', 'total_volume')),
+    threshold DECIMAL(14, 6) NOT NULL CHECK (threshold > 0),
+    backfilled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- achieved_at is when the user's history first reached the threshold,
+-- workout_id the workout that did it.
+CREATE TABLE IF NOT EXISTS user_achievements (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rule_id BIGINT NOT NULL REFERENCES achievement_rules(id) ON DELETE CASCADE,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    awarded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, rule_id)
+);
+
+INSERT INTO achievement_rules (code, name, description, metric, threshold) VALUES
+    ('first_workout', 'First Steps', 'Log your first workout.', 'workout_count', 1),
+    ('workouts_10', 'Getting Into It', 'Log 10 workouts.', 'workout_count', 10),
+    ('workouts_100', 'Centurion', 'Log 100 workouts.', 'workout_count', 100),
+    ('streak_10_weeks', 'Ten Week Streak', 'Work out in 10 consecutive weeks.', 'weekly_streak', 10),
+    ('session_volume_1000', 'Ton Session', 'Lift 1000 kg in a single workout.', 'session_volume', 1000);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS user_achievements;
+DROP TABLE IF EXISTS achievement_rules;
+
+-- +goose StatementEnd
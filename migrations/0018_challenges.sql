@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Private workouts are only ever seen by their owner and never count
+-- towards challenges.
+ALTER TABLE workouts ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'private'));
+
+-- A challenge ranks its participants by metric over the workouts they
+-- performed in [starts_at, ends_at). exercise_name, when set, only counts
+-- entries (and activities, by sport) of that exercise.
+CREATE TABLE IF NOT EXISTS challenges (
+    id BIGSERIAL PRIMARY KEY,
+    creator_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    metric VARCHAR(20) NOT NULL CHECK (metric IN ('volume', 'distance', 'workout_count')),
+    exercise_name VARCHAR(255),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_challenges_ends_at ON challenges(ends_at);
+
+-- score is the sum of the participant's contributions, kept up to date as
+-- workouts are saved; volume is in kilograms and distance in meters.
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score DECIMAL(16, 6) NOT NULL DEFAULT 0,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (challenge_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_challenge_participants_leaderboard ON challenge_participants(challenge_id, score DESC, user_id);
+CREATE INDEX IF NOT EXISTS idx_challenge_participants_user_id ON challenge_participants(user_id);
+
+-- What each workout adds to a participant's score. workout_id has no
+-- foreign key: contributions of a deleted workout are subtracted from the
+-- score before they are removed.
+CREATE TABLE IF NOT EXISTS challenge_contributions (
+    challenge_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    workout_id BIGINT NOT NULL,
+    value DECIMAL(16, 6) NOT NULL,
+    PRIMARY KEY (challenge_id, workout_id),
+    FOREIGN KEY (challenge_id, user_id) REFERENCES challenge_participants(challenge_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_challenge_contributions_workout_id ON challenge_contributions(workout_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS challenge_contributions;
+DROP TABLE IF EXISTS challenge_participants;
+DROP TABLE IF EXISTS challenges;
+
+ALTER TABLE workouts DROP COLUMN visibility;
+
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Rate of perceived exertion of the entry's hardest set, from 1 to 10.
+ALTER TABLE workout_entries ADD COLUMN rpe DECIMAL(3, 1) CHECK (rpe IS NULL OR (rpe >= 1 AND rpe <= 10));
+
+-- How the user wants to progress on an exercise; exercise_name is stored
+-- trimmed and lower case. increment is in kilograms and is also the step
+-- suggested weights are rounded to.
+CREATE TABLE IF NOT EXISTS progression_settings (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    model VARCHAR(30) NOT NULL CHECK (model IN ('linear', 'double_progression', 'rpe')),
+    sets INTEGER NOT NULL CHECK (sets >= 1),
+    min_reps INTEGER NOT NULL CHECK (min_reps >= 1),
+    max_reps INTEGER NOT NULL CHECK (max_reps >= min_reps),
+    target_rpe DECIMAL(3, 1) CHECK (target_rpe IS NULL OR (target_rpe >= 1 AND target_rpe <= 10)),
+    increment DECIMAL(14, 6) NOT NULL CHECK (increment > 0),
+    deload_percent DECIMAL(5, 2) NOT NULL CHECK (deload_percent > 0 AND deload_percent < 100),
+    stall_sessions INTEGER NOT NULL CHECK (stall_sessions >= 1),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, exercise_name)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS progression_settings;
+
+ALTER TABLE workout_entries DROP COLUMN rpe;
+
+-- +goose StatementEnd
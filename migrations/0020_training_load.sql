@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Session RPE: how hard the workout was as a whole, from 1 to 10.
+ALTER TABLE workouts ADD COLUMN rpe DECIMAL(3, 1) CHECK (rpe IS NULL OR (rpe >= 1 AND rpe <= 10));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE workouts DROP COLUMN rpe;
+
+-- +goose StatementEnd
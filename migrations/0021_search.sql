@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Titles and exercise names weigh most in search ranking, notes least.
+ALTER TABLE workouts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+
+ALTER TABLE workout_entries ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(exercise_name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(notes, '')), 'C')
+) STORED;
+
+CREATE INDEX workouts_search_vector_idx ON workouts USING GIN (search_vector);
+CREATE INDEX workout_entries_search_vector_idx ON workout_entries USING GIN (search_vector);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS workout_entries_search_vector_idx;
+DROP INDEX IF EXISTS workouts_search_vector_idx;
+ALTER TABLE workout_entries DROP COLUMN search_vector;
+ALTER TABLE workouts DROP COLUMN search_vector;
+
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Tag names are stored trimmed and lowercased.
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS workout_tags (
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (workout_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_tags_tag_id ON workout_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    field_type VARCHAR(10) NOT NULL CHECK (field_type IN ('number', 'text', 'enum', 'scale')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- The choices of enum fields.
+CREATE TABLE IF NOT EXISTS custom_field_options (
+    field_id BIGINT NOT NULL REFERENCES custom_fields(id) ON DELETE CASCADE,
+    value VARCHAR(100) NOT NULL,
+    order_index INTEGER NOT NULL,
+    PRIMARY KEY (field_id, value)
+);
+
+-- Number and scale fields are stored in number_value, text and enum fields
+-- in text_value.
+CREATE TABLE IF NOT EXISTS workout_custom_field_values (
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    field_id BIGINT NOT NULL REFERENCES custom_fields(id) ON DELETE CASCADE,
+    number_value DECIMAL(14, 4),
+    text_value TEXT,
+    PRIMARY KEY (workout_id, field_id),
+    CONSTRAINT one_custom_field_value CHECK ((number_value IS NULL) <> (text_value IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_custom_field_values_field_id ON workout_custom_field_values(field_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS workout_custom_field_values;
+DROP TABLE IF EXISTS custom_field_options;
+DROP TABLE IF EXISTS custom_fields;
+DROP TABLE IF EXISTS workout_tags;
+DROP TABLE IF EXISTS tags;
+
+-- +goose StatementEnd
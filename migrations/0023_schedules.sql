@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- starts_at is a wall-clock time in the user's time zone, so a plan at 18:00
+-- stays at 18:00 across DST changes. Plans without an rrule happen once.
+CREATE TABLE IF NOT EXISTS schedules (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    duration_minutes INTEGER NOT NULL CHECK (duration_minutes > 0),
+    rrule VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_user_id ON schedules(user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS schedules;
+
+-- +goose StatementEnd
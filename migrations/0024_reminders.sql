@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Minutes before each occurrence to remind the user; NULL for no reminder.
+ALTER TABLE schedules ADD COLUMN reminder_minutes INTEGER CHECK (reminder_minutes >= 0 AND reminder_minutes <= 10080);
+
+-- Where a user's reminders and missed-session reports go.
+CREATE TABLE IF NOT EXISTS reminder_settings (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email BOOLEAN NOT NULL DEFAULT FALSE,
+    in_app BOOLEAN NOT NULL DEFAULT TRUE,
+    webhook_url TEXT,
+    notify_missed BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per reminder or missed-session report sent, so each is sent once
+-- even when the scheduler restarts.
+CREATE TABLE IF NOT EXISTS schedule_notices (
+    schedule_id BIGINT NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    occurrence_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('reminder', 'missed')),
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (schedule_id, occurrence_at, kind)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}',
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_created_at ON notifications(user_id, created_at DESC);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS schedule_notices;
+DROP TABLE IF EXISTS reminder_settings;
+ALTER TABLE schedules DROP COLUMN reminder_minutes;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Events that may happen more than once, such as a workout being saved
+-- again, carry a key so they notify once.
+ALTER TABLE notifications ADD COLUMN dedupe_key VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_user_id_dedupe_key_idx ON notifications(user_id, dedupe_key) WHERE dedupe_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id, type) WHERE read_at IS NULL;
+
+-- Types a user turned off; every type is on without a row.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, type)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS notification_preferences;
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS notifications_user_id_dedupe_key_idx;
+ALTER TABLE notifications DROP COLUMN dedupe_key;
+
+-- +goose StatementEnd
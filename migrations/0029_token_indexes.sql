@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Serves deleting a user's tokens of a scope and evicting their oldest
+-- sessions, which expire first.
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id_scope_expiry ON tokens(user_id, scope, expiry);
+-- Serves the cleanup of expired tokens.
+CREATE INDEX IF NOT EXISTS idx_tokens_expiry ON tokens(expiry);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_tokens_expiry;
+DROP INDEX IF EXISTS idx_tokens_user_id_scope_expiry;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Receivers' responses are no longer kept: a URL reaching an internal
+-- service would have its response shown to the subscriber.
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS response_body;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS response_body TEXT;
+
+-- +goose StatementEnd
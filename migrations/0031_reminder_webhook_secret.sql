@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Signs reminder webhooks like webhook subscriptions are signed. Existing
+-- webhook URLs get a random secret; users see a secret when they save
+-- their webhook_url.
+ALTER TABLE reminder_settings ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+UPDATE reminder_settings
+SET webhook_secret = replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', '')
+WHERE webhook_url IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE reminder_settings DROP COLUMN IF EXISTS webhook_secret;
+
+-- +goose StatementEnd
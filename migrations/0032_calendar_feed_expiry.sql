@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Calendar feed tokens used to last ten years. Existing ones get the shorter
+-- lifetime new feed URLs have.
+UPDATE tokens
+SET expiry = LEAST(expiry, CURRENT_TIMESTAMP + INTERVAL '90 days')
+WHERE scope = 'calendar_feed';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- The original expiries are gone; shortened tokens keep their new expiry.
+SELECT 1;
+
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Incomplete keys are held by their request only until locked_until, so a
+-- request that never finished does not block retries until the key expires.
+-- Keys left incomplete before this column existed are free straight away.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS locked_until;
+
+-- +goose StatementEnd